@@ -0,0 +1,328 @@
+// Package analytics summarizes a VOD's chat: message and chatter counts per
+// time window, top emotes and chatters, and chat spikes that mark candidate
+// highlights. Aggregation runs in Postgres; only the per-window histogram is
+// loaded into memory.
+package analytics
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	// DefaultWindow is the histogram bucket size.
+	DefaultWindow = time.Minute
+	// DefaultTop is how many emotes and chatters Stats returns.
+	DefaultTop = 10
+)
+
+// ErrInvalidWindow is returned for a window outside 5s..1h.
+var ErrInvalidWindow = errors.New("window must be between 5s and 1h")
+
+// Bucket is one histogram window starting at StartSeconds.
+type Bucket struct {
+	StartSeconds float64 `json:"start_seconds"`
+	Messages     int     `json:"messages"`
+	Chatters     int     `json:"chatters"`
+}
+
+// Count is a name with its number of messages.
+type Count struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// Stats is the chat summary of one VOD.
+type Stats struct {
+	VodID          string   `json:"vod_id"`
+	Histogram      []Bucket `json:"histogram"`
+	TopEmotes      []Count  `json:"top_emotes"`
+	TopChatters    []Count  `json:"top_chatters"`
+	WindowSeconds  float64  `json:"window_seconds"`
+	TotalMessages  int      `json:"total_messages"`
+	UniqueChatters int      `json:"unique_chatters"`
+}
+
+func checkWindow(window time.Duration) (time.Duration, error) {
+	if window == 0 {
+		return DefaultWindow, nil
+	}
+	if window < 5*time.Second || window > time.Hour {
+		return 0, ErrInvalidWindow
+	}
+	return window, nil
+}
+
+// Compute builds the chat summary of a VOD. Emotes are counted once per message that uses them.
+func Compute(ctx context.Context, db *sql.DB, vodID string, window time.Duration, top int) (Stats, error) {
+	window, err := checkWindow(window)
+	if err != nil {
+		return Stats{}, err
+	}
+	if top <= 0 {
+		top = DefaultTop
+	}
+	st := Stats{VodID: vodID, WindowSeconds: window.Seconds()}
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*), COUNT(DISTINCT username) FROM chat_messages WHERE vod_id=$1`, vodID).
+		Scan(&st.TotalMessages, &st.UniqueChatters); err != nil {
+		return st, err
+	}
+	if st.Histogram, err = Histogram(ctx, db, vodID, window); err != nil {
+		return st, err
+	}
+	if st.TopEmotes, err = topCounts(ctx, db, `SELECT e, COUNT(*) FROM chat_messages, unnest(string_to_array(emotes, ',')) AS e
+		WHERE vod_id=$1 AND e <> '' GROUP BY e ORDER BY 2 DESC, 1 LIMIT $2`, vodID, top); err != nil {
+		return st, err
+	}
+	if st.TopChatters, err = topCounts(ctx, db, `SELECT username, COUNT(*) FROM chat_messages
+		WHERE vod_id=$1 AND COALESCE(username,'') <> '' GROUP BY username ORDER BY 2 DESC, 1 LIMIT $2`, vodID, top); err != nil {
+		return st, err
+	}
+	return st, nil
+}
+
+// Histogram counts messages and distinct chatters per window, including empty windows
+// between the first and last message.
+func Histogram(ctx context.Context, db *sql.DB, vodID string, window time.Duration) ([]Bucket, error) {
+	window, err := checkWindow(window)
+	if err != nil {
+		return nil, err
+	}
+	size := window.Seconds()
+	rows, err := db.QueryContext(ctx, `SELECT FLOOR(GREATEST(rel_timestamp,0) / $2)::BIGINT AS b, COUNT(*), COUNT(DISTINCT username)
+		FROM chat_messages WHERE vod_id=$1 AND rel_timestamp IS NOT NULL GROUP BY b ORDER BY b`, vodID, size)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			slog.Warn("failed to close rows", slog.Any("err", err))
+		}
+	}()
+	out := []Bucket{}
+	next := int64(-1)
+	for rows.Next() {
+		var b int64
+		var bk Bucket
+		if err := rows.Scan(&b, &bk.Messages, &bk.Chatters); err != nil {
+			return nil, err
+		}
+		for next >= 0 && next < b {
+			out = append(out, Bucket{StartSeconds: float64(next) * size})
+			next++
+		}
+		bk.StartSeconds = float64(b) * size
+		out = append(out, bk)
+		next = b + 1
+	}
+	return out, rows.Err()
+}
+
+func topCounts(ctx context.Context, db *sql.DB, query, vodID string, top int) ([]Count, error) {
+	rows, err := db.QueryContext(ctx, query, vodID, top)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			slog.Warn("failed to close rows", slog.Any("err", err))
+		}
+	}()
+	out := []Count{}
+	for rows.Next() {
+		var c Count
+		if err := rows.Scan(&c.Name, &c.Count); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// Highlight is a chat spike: a run of windows well above the trailing baseline.
+// Baseline is the median message count of the windows before it and Score the
+// strongest window's distance from that median in units of spread.
+type Highlight struct {
+	StartSeconds float64 `json:"start_seconds"`
+	EndSeconds   float64 `json:"end_seconds"`
+	PeakSeconds  float64 `json:"peak_seconds"`
+	Baseline     float64 `json:"baseline"`
+	Score        float64 `json:"score"`
+	Messages     int     `json:"messages"`
+}
+
+// DetectOptions tunes spike detection.
+type DetectOptions struct {
+	// Window is the histogram bucket size (DefaultWindow when zero).
+	Window time.Duration
+	// Baseline is how many preceding windows form the baseline (default 10).
+	Baseline int
+	// MinScore is the score a window needs over its baseline (default 3).
+	MinScore float64
+	// MinMessages ignores quiet windows however spiky (default 10).
+	MinMessages int
+	// Max keeps only the strongest highlights (default 20).
+	Max int
+}
+
+func (o DetectOptions) withDefaults() DetectOptions {
+	if o.Window == 0 {
+		o.Window = DefaultWindow
+	}
+	if o.Baseline <= 0 {
+		o.Baseline = 10
+	}
+	if o.MinScore <= 0 {
+		o.MinScore = 3
+	}
+	if o.MinMessages <= 0 {
+		o.MinMessages = 10
+	}
+	if o.Max <= 0 {
+		o.Max = 20
+	}
+	return o
+}
+
+// DetectSpikes finds windows whose message count stands out from the preceding
+// o.Baseline windows and merges adjacent ones. The baseline is the median and the
+// spread the larger of the scaled median absolute deviation and the Poisson noise
+// sqrt(median), so an earlier spike in the baseline does not mask the next one.
+// Because chat reacts after the moment, each highlight starts one window before
+// its first spiking window.
+func DetectSpikes(hist []Bucket, o DetectOptions) []Highlight {
+	o = o.withDefaults()
+	size := o.Window.Seconds()
+	var out []Highlight
+	var cur *Highlight
+	peak := 0
+	for i, b := range hist {
+		lo := max(0, i-o.Baseline)
+		median, spread := baseline(hist[lo:i])
+		z := (float64(b.Messages) - median) / spread
+		if i-lo < min(3, o.Baseline) || b.Messages < o.MinMessages || z < o.MinScore {
+			cur = nil
+			continue
+		}
+		if cur == nil {
+			out = append(out, Highlight{StartSeconds: math.Max(b.StartSeconds-size, 0), Baseline: median})
+			cur = &out[len(out)-1]
+			peak = 0
+		}
+		cur.EndSeconds = b.StartSeconds + size
+		cur.Messages += b.Messages
+		if b.Messages > peak {
+			peak = b.Messages
+			cur.PeakSeconds = b.StartSeconds
+		}
+		cur.Score = math.Max(cur.Score, math.Round(z*100)/100)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Score > out[j].Score })
+	if len(out) > o.Max {
+		out = out[:o.Max]
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].StartSeconds < out[j].StartSeconds })
+	return out
+}
+
+// baseline returns the median of bs and its spread, at least one message.
+func baseline(bs []Bucket) (float64, float64) {
+	if len(bs) == 0 {
+		return 0, 1
+	}
+	vals := make([]float64, len(bs))
+	for i, b := range bs {
+		vals[i] = float64(b.Messages)
+	}
+	median := medianOf(vals)
+	for i, v := range vals {
+		vals[i] = math.Abs(v - median)
+	}
+	// 1.4826 scales the MAD to a standard deviation for normally distributed counts.
+	return median, math.Max(math.Max(1.4826*medianOf(vals), math.Sqrt(median)), 1)
+}
+
+func medianOf(vals []float64) float64 {
+	sort.Float64s(vals)
+	n := len(vals)
+	if n%2 == 1 {
+		return vals[n/2]
+	}
+	return (vals[n/2-1] + vals[n/2]) / 2
+}
+
+// DetectHighlights recomputes a VOD's highlights, replaces the rows in vod_highlights and
+// records the run in vods.highlights_analyzed_at.
+func DetectHighlights(ctx context.Context, db *sql.DB, vodID string, o DetectOptions) ([]Highlight, error) {
+	o = o.withDefaults()
+	hist, err := Histogram(ctx, db, vodID, o.Window)
+	if err != nil {
+		return nil, err
+	}
+	hs := DetectSpikes(hist, o)
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if _, err := tx.ExecContext(ctx, `DELETE FROM vod_highlights WHERE vod_id=$1`, vodID); err != nil {
+		return nil, fmt.Errorf("delete highlights: %w", err)
+	}
+	for _, h := range hs {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO vod_highlights (vod_id, start_seconds, end_seconds, peak_seconds, message_count, baseline, score)
+			VALUES ($1,$2,$3,$4,$5,$6,$7)`, vodID, h.StartSeconds, h.EndSeconds, h.PeakSeconds, h.Messages, h.Baseline, h.Score); err != nil {
+			return nil, fmt.Errorf("insert highlight: %w", err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE vods SET highlights_analyzed_at=NOW() WHERE twitch_vod_id=$1`, vodID); err != nil {
+		return nil, fmt.Errorf("mark highlights analyzed: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	if hs == nil {
+		hs = []Highlight{}
+	}
+	return hs, nil
+}
+
+// HighlightsAnalyzedAt returns when detection last ran for a VOD, or nil if it never has.
+func HighlightsAnalyzedAt(ctx context.Context, db *sql.DB, vodID string) (*time.Time, error) {
+	var at sql.NullTime
+	if err := db.QueryRowContext(ctx, `SELECT highlights_analyzed_at FROM vods WHERE twitch_vod_id=$1`, vodID).Scan(&at); err != nil {
+		return nil, err
+	}
+	if !at.Valid {
+		return nil, nil
+	}
+	return &at.Time, nil
+}
+
+// LoadHighlights returns the stored highlights of a VOD in time order.
+func LoadHighlights(ctx context.Context, db *sql.DB, vodID string) ([]Highlight, error) {
+	rows, err := db.QueryContext(ctx, `SELECT start_seconds, end_seconds, peak_seconds, message_count, baseline, score
+		FROM vod_highlights WHERE vod_id=$1 ORDER BY start_seconds`, vodID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			slog.Warn("failed to close rows", slog.Any("err", err))
+		}
+	}()
+	out := []Highlight{}
+	for rows.Next() {
+		var h Highlight
+		if err := rows.Scan(&h.StartSeconds, &h.EndSeconds, &h.PeakSeconds, &h.Messages, &h.Baseline, &h.Score); err != nil {
+			return nil, err
+		}
+		out = append(out, h)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,136 @@
+package analytics
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+
+	dbpkg "github.com/onnwee/vod-tender/backend/db"
+)
+
+func hist(counts ...int) []Bucket {
+	out := make([]Bucket, len(counts))
+	for i, c := range counts {
+		out[i] = Bucket{StartSeconds: float64(i * 60), Messages: c}
+	}
+	return out
+}
+
+func TestDetectSpikesMergesAdjacentWindows(t *testing.T) {
+	hs := DetectSpikes(hist(10, 12, 9, 11, 10, 80, 95, 12, 10, 11, 60, 10), DetectOptions{})
+	if len(hs) != 2 {
+		t.Fatalf("highlights = %+v", hs)
+	}
+	first := hs[0]
+	if first.StartSeconds != 240 || first.EndSeconds != 420 || first.PeakSeconds != 360 || first.Messages != 175 {
+		t.Fatalf("first highlight = %+v", first)
+	}
+	if hs[1].StartSeconds != 540 || hs[1].PeakSeconds != 600 {
+		t.Fatalf("second highlight = %+v", hs[1])
+	}
+}
+
+func TestDetectSpikesIgnoresQuietAndEarlyWindows(t *testing.T) {
+	// The opening burst has no baseline yet and the later bump is under MinMessages.
+	if hs := DetectSpikes(hist(50, 0, 0, 0, 0, 0, 8, 0), DetectOptions{}); len(hs) != 0 {
+		t.Fatalf("expected no highlights, got %+v", hs)
+	}
+	if hs := DetectSpikes(hist(0, 0, 0, 0, 0, 0, 8, 0), DetectOptions{MinMessages: 5}); len(hs) != 1 {
+		t.Fatalf("expected one highlight with MinMessages=5, got %+v", hs)
+	}
+}
+
+func TestDetectSpikesKeepsStrongest(t *testing.T) {
+	hs := DetectSpikes(hist(5, 5, 5, 5, 30, 5, 5, 5, 5, 90, 5, 5, 5, 5, 40), DetectOptions{Max: 2})
+	if len(hs) != 2 || hs[0].PeakSeconds != 540 || hs[1].PeakSeconds != 840 {
+		t.Fatalf("highlights = %+v", hs)
+	}
+}
+
+func TestInvalidWindow(t *testing.T) {
+	if _, err := Compute(context.Background(), nil, "v", time.Second, 0); !errors.Is(err, ErrInvalidWindow) {
+		t.Fatalf("expected ErrInvalidWindow, got %v", err)
+	}
+}
+
+func TestComputeAndDetect(t *testing.T) {
+	dsn := os.Getenv("TEST_PG_DSN")
+	if dsn == "" {
+		t.Skip("TEST_PG_DSN not set")
+	}
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = db.Close() }()
+	ctx := context.Background()
+	if err := dbpkg.Migrate(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+	vodID := "analytics_test_1"
+	if _, err := db.ExecContext(ctx, `INSERT INTO vods (channel, twitch_vod_id, title, date, created_at) VALUES ('', $1, 'Analytics', NOW(), NOW())
+		ON CONFLICT (twitch_vod_id) DO NOTHING`, vodID); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_, _ = db.Exec(`DELETE FROM chat_messages WHERE vod_id=$1`, vodID)
+		_, _ = db.Exec(`DELETE FROM vods WHERE twitch_vod_id=$1`, vodID)
+	})
+	_, _ = db.ExecContext(ctx, `DELETE FROM chat_messages WHERE vod_id=$1`, vodID)
+	_, _ = db.ExecContext(ctx, `UPDATE vods SET highlights_analyzed_at=NULL WHERE twitch_vod_id=$1`, vodID)
+	if at, err := HighlightsAnalyzedAt(ctx, db, vodID); err != nil || at != nil {
+		t.Fatalf("analyzed at = %v, %v; want nil before detection", at, err)
+	}
+	insert := func(user, emotes string, rel float64) {
+		t.Helper()
+		if _, err := db.ExecContext(ctx, `INSERT INTO chat_messages (vod_id, username, message, abs_timestamp, rel_timestamp, emotes)
+			VALUES ($1, $2, 'x', NOW(), $3, $4)`, vodID, user, rel, emotes); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Quiet minutes 0-4 and 6, a burst in minute 5, nothing in minute 7, one message in minute 8.
+	for m := 0; m < 7; m++ {
+		if m == 5 {
+			for i := 0; i < 40; i++ {
+				insert("user"+string(rune('a'+i%8)), "PogChamp,", float64(m*60+i))
+			}
+			continue
+		}
+		insert("lurker", "Kappa,LUL,", float64(m*60+1))
+	}
+	insert("lurker", "", 8*60+1)
+
+	st, err := Compute(ctx, db, vodID, 0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.TotalMessages != 47 || st.UniqueChatters != 9 || len(st.Histogram) != 9 || st.Histogram[7].Messages != 0 {
+		t.Fatalf("stats = %+v", st)
+	}
+	if len(st.TopEmotes) != 2 || st.TopEmotes[0] != (Count{Name: "PogChamp", Count: 40}) {
+		t.Fatalf("top emotes = %+v", st.TopEmotes)
+	}
+	if st.TopChatters[0] != (Count{Name: "lurker", Count: 7}) {
+		t.Fatalf("top chatters = %+v", st.TopChatters)
+	}
+
+	hs, err := DetectHighlights(ctx, db, vodID, DetectOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := LoadHighlights(ctx, db, vodID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hs) != 1 || len(stored) != 1 || stored[0].PeakSeconds != 300 || stored[0].Messages != 40 {
+		t.Fatalf("highlights = %+v, stored = %+v", hs, stored)
+	}
+	if at, err := HighlightsAnalyzedAt(ctx, db, vodID); err != nil || at == nil {
+		t.Fatalf("analyzed at = %v, %v; want the detection run recorded", at, err)
+	}
+}
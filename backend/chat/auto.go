@@ -8,6 +8,7 @@ import (
 	"os"
 	"time"
 
+	"github.com/onnwee/vod-tender/backend/chat/analytics"
 	"github.com/onnwee/vod-tender/backend/twitchapi"
 	vodpkg "github.com/onnwee/vod-tender/backend/vod"
 )
@@ -15,12 +16,16 @@ import (
 // StartAutoChatRecorder polls Twitch stream status and automatically starts the chat recorder
 // when the configured channel goes live. It uses a placeholder VOD id (live-<unixStart>) until
 // the real VOD is published.
-// The channel parameter specifies which Twitch channel to monitor.
+// The channel parameter specifies which Twitch channel to monitor; its chat is recorded
+// through hub, which shares IRC connections with the other channels.
+// EventSub stream.online/offline notifications (see WatchLive) are acted on as they
+// arrive, with polling kept as a fallback; an offline notification starts
+// reconciliation without the usual delay.
 // Env knobs:
 //
-//	CHAT_AUTO_POLL_INTERVAL (default 30s)
+//	CHAT_AUTO_POLL_INTERVAL (default 30s, or 5m when EventSub is configured)
 //	TWITCH_BOT_USERNAME, TWITCH_CLIENT_ID, TWITCH_CLIENT_SECRET required (plus stored oauth token)
-func StartAutoChatRecorder(ctx context.Context, db *sql.DB, channel string) {
+func StartAutoChatRecorder(ctx context.Context, db *sql.DB, hub *Hub, channel string) {
 	if channel == "" {
 		slog.Info("auto chat: TWITCH_CHANNEL empty; abort")
 		return
@@ -37,6 +42,9 @@ func StartAutoChatRecorder(ctx context.Context, db *sql.DB, channel string) {
 	}
 
 	pollEvery := 30 * time.Second
+	if _, _, ok := EventSubConfig(); ok {
+		pollEvery = 5 * time.Minute
+	}
 	if v := os.Getenv("CHAT_AUTO_POLL_INTERVAL"); v != "" {
 		if d, err := time.ParseDuration(v); err == nil && d > 0 {
 			pollEvery = d
@@ -62,6 +70,9 @@ func StartAutoChatRecorder(ctx context.Context, db *sql.DB, channel string) {
 	}
 	reconcileWindow := 15 * time.Minute // how long after offline we keep trying
 
+	live, unwatch := WatchLive(channel)
+	defer unwatch()
+	var event *LiveEvent // set when this iteration was woken by EventSub rather than the ticker
 	ticker := time.NewTicker(pollEvery)
 	defer ticker.Stop()
 	slog.Info("auto chat: started poller", slog.Duration("interval", pollEvery))
@@ -71,11 +82,22 @@ func StartAutoChatRecorder(ctx context.Context, db *sql.DB, channel string) {
 		}
 		func() {
 			// If we're running, check if stream still live; if not, stop recorder and reconcile.
-			// (no-op check removed - logic continues to fetch live status)
-			streams, err := helix.GetStreams(ctx, channel)
-			if err != nil {
-				slog.Debug("auto chat: streams req", slog.Any("err", err))
-				return
+			// An offline notification skips the lookup and the initial reconcile delay.
+			delay := reconcileDelay
+			var streams []twitchapi.StreamMeta
+			if event != nil && !event.Online {
+				delay = 0
+			} else {
+				var err error
+				streams, err = helix.GetStreams(ctx, channel)
+				if event != nil && (err != nil || len(streams) == 0) {
+					// Helix can lag the online notification by a few seconds.
+					streams, err = []twitchapi.StreamMeta{{StartedAt: event.StartedAt}}, nil
+				}
+				if err != nil {
+					slog.Debug("auto chat: streams req", slog.Any("err", err))
+					return
+				}
 			}
 			if len(streams) == 0 {
 				// Offline
@@ -91,7 +113,7 @@ func StartAutoChatRecorder(ctx context.Context, db *sql.DB, channel string) {
 						select {
 						case <-ctx.Done():
 							return
-						case <-time.After(reconcileDelay):
+						case <-time.After(delay):
 						}
 						for attempt := 0; attempt < 30; attempt++ { // roughly up to reconcileWindow depending on delay
 							if ctx.Err() != nil {
@@ -134,12 +156,33 @@ func StartAutoChatRecorder(ctx context.Context, db *sql.DB, channel string) {
 											slog.Warn("auto chat: reconcile shift timestamps", slog.Any("err", err))
 											return
 										}
+										if _, err := tx.ExecContext(ctx, `UPDATE chat_events SET rel_timestamp=rel_timestamp - $1 WHERE channel=$2 AND vod_id=$3`, delta, channel, ph); err != nil {
+											_ = tx.Rollback()
+											slog.Warn("auto chat: reconcile shift event timestamps", slog.Any("err", err))
+											return
+										}
+										if _, err := tx.ExecContext(ctx, `UPDATE chat_gaps SET start_rel=start_rel - $1, end_rel=end_rel - $1 WHERE channel=$2 AND vod_id=$3`, delta, channel, ph); err != nil {
+											_ = tx.Rollback()
+											slog.Warn("auto chat: reconcile shift gap timestamps", slog.Any("err", err))
+											return
+										}
 									}
 									if _, err := tx.ExecContext(ctx, `UPDATE chat_messages SET vod_id=$1 WHERE channel=$2 AND vod_id=$3`, candidate.ID, channel, ph); err != nil {
 										_ = tx.Rollback()
 										slog.Warn("auto chat: reconcile update chat", slog.Any("err", err))
 										return
 									}
+									// Events and gaps cascade with the placeholder row, so move them before it is deleted
+									if _, err := tx.ExecContext(ctx, `UPDATE chat_events SET vod_id=$1 WHERE channel=$2 AND vod_id=$3`, candidate.ID, channel, ph); err != nil {
+										_ = tx.Rollback()
+										slog.Warn("auto chat: reconcile update chat events", slog.Any("err", err))
+										return
+									}
+									if _, err := tx.ExecContext(ctx, `UPDATE chat_gaps SET vod_id=$1 WHERE channel=$2 AND vod_id=$3`, candidate.ID, channel, ph); err != nil {
+										_ = tx.Rollback()
+										slog.Warn("auto chat: reconcile update chat gaps", slog.Any("err", err))
+										return
+									}
 									if _, err := tx.ExecContext(ctx, `DELETE FROM vods WHERE channel=$1 AND twitch_vod_id=$2`, channel, ph); err != nil {
 										_ = tx.Rollback()
 										slog.Warn("auto chat: reconcile delete placeholder", slog.Any("err", err))
@@ -150,6 +193,11 @@ func StartAutoChatRecorder(ctx context.Context, db *sql.DB, channel string) {
 										return
 									}
 									slog.Info("auto chat: reconciliation complete", slog.String("placeholder", ph), slog.String("real_vod", candidate.ID), slog.String("channel", channel))
+									// The recording is complete, so its highlights can be detected once here.
+									if _, err := analytics.DetectHighlights(ctx, db, candidate.ID, analytics.DetectOptions{}); err != nil {
+										slog.Warn("auto chat: highlight detection", slog.Any("err", err), slog.String("vod_id", candidate.ID))
+									}
+									vodpkg.TriggerProcessing(channel)
 									reconciled = true
 									running = false
 									return
@@ -180,14 +228,18 @@ func StartAutoChatRecorder(ctx context.Context, db *sql.DB, channel string) {
 			recCtx, cancel := context.WithCancel(ctx)
 			recCancel = cancel
 			go func(pID string, st time.Time) {
-				StartTwitchChatRecorder(recCtx, db, pID, st)
+				StartTwitchChatRecorder(recCtx, hub, channel, pID, st)
 				slog.Info("auto chat: recorder goroutine exited", slog.String("vod_id", pID))
 			}(placeholder, startedAt)
 		}()
+		event = nil
 		select {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
+		case ev := <-live:
+			slog.Info("auto chat: eventsub status change", slog.Bool("online", ev.Online), slog.String("channel", channel))
+			event = &ev
 		}
 	}
 }
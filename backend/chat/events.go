@@ -0,0 +1,169 @@
+package chat
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	twitch "github.com/gempir/go-twitch-irc/v4"
+)
+
+// Chat event types other than USERNOTICE, whose type is Twitch's msg-id (sub, resub,
+// subgift, submysterygift, raid, announcement, ...).
+const (
+	EventTimeout = "timeout"
+	EventBan     = "ban"
+	EventClear   = "clear"
+	EventDelete  = "delete"
+	EventCheer   = "cheer"
+)
+
+// Event is a non-message chat occurrence stored in chat_events. Username is the
+// subject: the subscriber, raider, gifter or cheerer, or the user a moderation
+// action targets. Amount carries months, raid viewers, gift count or bits.
+type Event struct {
+	AbsTimestamp    time.Time         `json:"abs_timestamp"`
+	Tags            map[string]string `json:"tags,omitempty"`
+	Type            string            `json:"type"`
+	Username        string            `json:"username,omitempty"`
+	Recipient       string            `json:"recipient,omitempty"`
+	Message         string            `json:"message,omitempty"`
+	SystemMessage   string            `json:"system_message,omitempty"`
+	TargetMessageID string            `json:"target_message_id,omitempty"`
+	RelTimestamp    float64           `json:"rel_timestamp"`
+	Amount          int               `json:"amount,omitempty"`
+	DurationSeconds int               `json:"duration_seconds,omitempty"`
+}
+
+// clearChatEvent maps CLEARCHAT: a timeout (ban-duration set), a ban, or a full chat clear (no target).
+func clearChatEvent(m twitch.ClearChatMessage) Event {
+	ev := Event{Type: EventClear, Username: m.TargetUsername, Tags: m.Tags}
+	switch {
+	case m.TargetUsername == "":
+	case m.BanDuration > 0:
+		ev.Type, ev.DurationSeconds = EventTimeout, m.BanDuration
+	default:
+		ev.Type = EventBan
+	}
+	return ev
+}
+
+// clearMsgEvent maps CLEARMSG, the deletion of a single message.
+func clearMsgEvent(m twitch.ClearMessage) Event {
+	return Event{Type: EventDelete, Username: m.Login, Message: m.Message, TargetMessageID: m.TargetMsgID, Tags: m.Tags}
+}
+
+// userNoticeEvent maps USERNOTICE (subs, gifts, raids, announcements).
+func userNoticeEvent(m twitch.UserNoticeMessage) Event {
+	ev := Event{Type: m.MsgID, Username: m.User.Name, Message: m.Message, SystemMessage: m.SystemMsg, Tags: m.Tags}
+	p := m.MsgParams
+	switch m.MsgID {
+	case "sub", "resub":
+		ev.Amount, _ = strconv.Atoi(p["msg-param-cumulative-months"])
+	case "subgift", "anonsubgift":
+		ev.Recipient = p["msg-param-recipient-user-name"]
+		ev.Amount, _ = strconv.Atoi(p["msg-param-gift-months"])
+	case "submysterygift", "anonsubmysterygift":
+		ev.Amount, _ = strconv.Atoi(p["msg-param-mass-gift-count"])
+	case "raid":
+		ev.Username = p["msg-param-login"]
+		ev.Amount, _ = strconv.Atoi(p["msg-param-viewerCount"])
+	}
+	if ev.Username == "" {
+		ev.Username = m.User.Name
+	}
+	return ev
+}
+
+// recordEvent stores ev and, for timeouts, bans and deletions, marks the affected
+// messages in chat_messages (moderated_at, moderation) so replays can hide them.
+// A timeout or ban hides all of the user's earlier messages in the VOD, as Twitch
+// clients do; a full chat clear is only recorded. ev carries the time it was received.
+func recordEvent(ctx context.Context, dbx *sql.DB, channel, vodID string, ev Event) {
+	tags, _ := json.Marshal(ev.Tags)
+	if _, err := dbx.ExecContext(ctx, `INSERT INTO chat_events (vod_id, channel, type, username, recipient, message, system_message, target_message_id, amount, duration_seconds, tags, abs_timestamp, rel_timestamp)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13)`,
+		vodID, channel, ev.Type, ev.Username, ev.Recipient, ev.Message, ev.SystemMessage, ev.TargetMessageID, ev.Amount, ev.DurationSeconds, tags, ev.AbsTimestamp, ev.RelTimestamp); err != nil {
+		slog.Error("failed to insert chat event", slog.String("type", ev.Type), slog.Any("err", err))
+		return
+	}
+	var err error
+	switch ev.Type {
+	case EventTimeout, EventBan:
+		_, err = dbx.ExecContext(ctx, `UPDATE chat_messages SET moderated_at=$4, moderation=$3
+			WHERE vod_id=$1 AND username=$2 AND abs_timestamp <= $4 AND moderated_at IS NULL`, vodID, ev.Username, ev.Type, ev.AbsTimestamp)
+	case EventDelete:
+		err = markDeleted(ctx, dbx, vodID, ev)
+	}
+	if err != nil {
+		slog.Warn("failed to mark moderated chat messages", slog.String("type", ev.Type), slog.String("username", ev.Username), slog.Any("err", err))
+	}
+}
+
+// markDeleted flags the message a CLEARMSG removed, by Twitch message id when it was
+// stored, otherwise the author's latest earlier message with the same text.
+func markDeleted(ctx context.Context, dbx *sql.DB, vodID string, ev Event) error {
+	if ev.TargetMessageID != "" {
+		res, err := dbx.ExecContext(ctx, `UPDATE chat_messages SET moderated_at=$3, moderation=$2 WHERE message_id=$1 AND moderated_at IS NULL`,
+			ev.TargetMessageID, ev.Type, ev.AbsTimestamp)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			return nil
+		}
+	}
+	_, err := dbx.ExecContext(ctx, `UPDATE chat_messages SET moderated_at=$5, moderation=$4
+		WHERE id = (SELECT id FROM chat_messages WHERE vod_id=$1 AND username=$2 AND message=$3 AND abs_timestamp <= $5 AND moderated_at IS NULL
+			ORDER BY abs_timestamp DESC LIMIT 1)`, vodID, ev.Username, ev.Message, ev.Type, ev.AbsTimestamp)
+	return err
+}
+
+// ListEvents returns a VOD's chat events in time order, optionally filtered by type and a
+// [from, to] window in seconds (to <= 0 means no upper bound).
+func ListEvents(ctx context.Context, dbx *sql.DB, vodID string, types []string, from, to float64) ([]Event, error) {
+	q := `SELECT type, COALESCE(username,''), COALESCE(recipient,''), COALESCE(message,''), COALESCE(system_message,''),
+		COALESCE(target_message_id,''), amount, duration_seconds, tags, abs_timestamp, rel_timestamp
+		FROM chat_events WHERE vod_id=$1 AND rel_timestamp >= $2`
+	args := []any{vodID, from}
+	if to > 0 {
+		args = append(args, to)
+		q += ` AND rel_timestamp <= $3`
+	}
+	if len(types) > 0 {
+		ph := make([]string, 0, len(types))
+		for _, t := range types {
+			args = append(args, t)
+			ph = append(ph, "$"+strconv.Itoa(len(args)))
+		}
+		q += ` AND type IN (` + strings.Join(ph, ",") + `)`
+	}
+	//nolint:gosec // G202: filters are parameterized
+	rows, err := dbx.QueryContext(ctx, q+` ORDER BY rel_timestamp ASC, id ASC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			slog.Warn("failed to close rows", slog.Any("err", err))
+		}
+	}()
+	out := []Event{}
+	for rows.Next() {
+		var ev Event
+		var tags []byte
+		if err := rows.Scan(&ev.Type, &ev.Username, &ev.Recipient, &ev.Message, &ev.SystemMessage,
+			&ev.TargetMessageID, &ev.Amount, &ev.DurationSeconds, &tags, &ev.AbsTimestamp, &ev.RelTimestamp); err != nil {
+			return nil, err
+		}
+		if len(tags) > 0 {
+			_ = json.Unmarshal(tags, &ev.Tags)
+		}
+		out = append(out, ev)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,98 @@
+package chat
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	twitch "github.com/gempir/go-twitch-irc/v4"
+
+	"github.com/onnwee/vod-tender/backend/testutil"
+)
+
+func TestClearChatEvent(t *testing.T) {
+	cases := []struct {
+		msg  twitch.ClearChatMessage
+		want Event
+	}{
+		{twitch.ClearChatMessage{TargetUsername: "spammer", BanDuration: 600}, Event{Type: EventTimeout, Username: "spammer", DurationSeconds: 600}},
+		{twitch.ClearChatMessage{TargetUsername: "troll"}, Event{Type: EventBan, Username: "troll"}},
+		{twitch.ClearChatMessage{}, Event{Type: EventClear}},
+	}
+	for _, c := range cases {
+		got := clearChatEvent(c.msg)
+		if got.Type != c.want.Type || got.Username != c.want.Username || got.DurationSeconds != c.want.DurationSeconds {
+			t.Fatalf("clearChatEvent(%+v) = %+v, want %+v", c.msg, got, c.want)
+		}
+	}
+}
+
+func TestUserNoticeEvent(t *testing.T) {
+	gift := userNoticeEvent(twitch.UserNoticeMessage{
+		User:      twitch.User{Name: "gifter"},
+		MsgID:     "subgift",
+		SystemMsg: "gifter gifted a Tier 1 sub to lucky!",
+		MsgParams: map[string]string{"msg-param-recipient-user-name": "lucky", "msg-param-gift-months": "3"},
+	})
+	if gift.Type != "subgift" || gift.Username != "gifter" || gift.Recipient != "lucky" || gift.Amount != 3 {
+		t.Fatalf("gift = %+v", gift)
+	}
+	raid := userNoticeEvent(twitch.UserNoticeMessage{
+		User:      twitch.User{Name: "raider"},
+		MsgID:     "raid",
+		MsgParams: map[string]string{"msg-param-login": "raidingchan", "msg-param-viewerCount": "250"},
+	})
+	if raid.Username != "raidingchan" || raid.Amount != 250 {
+		t.Fatalf("raid = %+v", raid)
+	}
+}
+
+func TestRecordEventModeratesMessages(t *testing.T) {
+	db := testutil.SetupTestDB(t)
+	ctx := context.Background()
+	channel := "test_chat_events"
+	vodID := "events-vod-1"
+	t.Cleanup(func() {
+		_, _ = db.ExecContext(context.Background(), `DELETE FROM chat_messages WHERE channel=$1`, channel)
+		_, _ = db.ExecContext(context.Background(), `DELETE FROM vods WHERE channel=$1`, channel)
+	})
+	start := time.Now().Add(-time.Hour).UTC()
+	if _, err := db.ExecContext(ctx, `INSERT INTO vods (channel, twitch_vod_id, title, date, created_at) VALUES ($1,$2,'Events',$3,NOW())`, channel, vodID, start); err != nil {
+		t.Fatal(err)
+	}
+	insert := func(user, text string, ago time.Duration) {
+		t.Helper()
+		abs := time.Now().Add(-ago).UTC()
+		if _, err := db.ExecContext(ctx, `INSERT INTO chat_messages (channel, vod_id, username, message, abs_timestamp, rel_timestamp) VALUES ($1,$2,$3,$4,$5,$6)`,
+			channel, vodID, user, text, abs, abs.Sub(start).Seconds()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	insert("spammer", "buy followers", 3*time.Minute)
+	insert("spammer", "buy followers again", 2*time.Minute)
+	insert("viewer", "oops", time.Minute)
+	insert("viewer", "fine", 30*time.Second)
+
+	rec := func(ev Event) {
+		ev.AbsTimestamp = time.Now().UTC()
+		ev.RelTimestamp = ev.AbsTimestamp.Sub(start).Seconds()
+		recordEvent(ctx, db, channel, vodID, ev)
+	}
+	rec(clearChatEvent(twitch.ClearChatMessage{TargetUsername: "spammer", BanDuration: 600}))
+	rec(clearMsgEvent(twitch.ClearMessage{Login: "viewer", Message: "oops", TargetMsgID: "abc"}))
+
+	var hidden int
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM chat_messages WHERE vod_id=$1 AND moderated_at IS NOT NULL`, vodID).Scan(&hidden); err != nil {
+		t.Fatal(err)
+	}
+	if hidden != 3 {
+		t.Fatalf("moderated messages = %d, want 3", hidden)
+	}
+	events, err := ListEvents(ctx, db, vodID, []string{EventTimeout}, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Username != "spammer" || events[0].DurationSeconds != 600 || events[0].RelTimestamp < 3500 {
+		t.Fatalf("events = %+v", events)
+	}
+}
@@ -0,0 +1,118 @@
+package chat
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/onnwee/vod-tender/backend/twitchapi"
+)
+
+// eventSubResync is how often StartEventSubSubscriptions re-checks its subscriptions,
+// so revoked or failed ones are recreated.
+const eventSubResync = time.Hour
+
+// LiveEvent is a stream status change pushed by EventSub.
+type LiveEvent struct {
+	StartedAt time.Time
+	Online    bool
+}
+
+var (
+	liveMu       sync.Mutex
+	liveWatchers = map[string]chan LiveEvent{}
+)
+
+// WatchLive returns the stream status changes delivered for channel until stop is
+// called. StartAutoChatRecorder watches its channel so EventSub notifications take
+// effect without waiting for the next poll.
+func WatchLive(channel string) (events <-chan LiveEvent, stop func()) {
+	key := strings.ToLower(channel)
+	ch := make(chan LiveEvent, 4)
+	liveMu.Lock()
+	liveWatchers[key] = ch
+	liveMu.Unlock()
+	return ch, func() {
+		liveMu.Lock()
+		if liveWatchers[key] == ch {
+			delete(liveWatchers, key)
+		}
+		liveMu.Unlock()
+	}
+}
+
+// NotifyLive delivers ev to the watcher of channel. It reports false when no
+// watcher is registered or its queue is full; polling picks the change up then.
+func NotifyLive(channel string, ev LiveEvent) bool {
+	liveMu.Lock()
+	ch, ok := liveWatchers[strings.ToLower(channel)]
+	liveMu.Unlock()
+	if !ok {
+		return false
+	}
+	select {
+	case ch <- ev:
+		return true
+	default:
+		return false
+	}
+}
+
+// EventSubConfig returns the webhook callback URL and signing secret from
+// TWITCH_EVENTSUB_CALLBACK and TWITCH_EVENTSUB_SECRET; ok is false unless both are set.
+func EventSubConfig() (callback, secret string, ok bool) {
+	callback = strings.TrimSpace(os.Getenv("TWITCH_EVENTSUB_CALLBACK"))
+	secret = os.Getenv("TWITCH_EVENTSUB_SECRET")
+	return callback, secret, callback != "" && secret != ""
+}
+
+// StartEventSubSubscriptions keeps stream.online and stream.offline webhook
+// subscriptions for channel pointed at TWITCH_EVENTSUB_CALLBACK. It checks them at
+// start and then hourly, retrying failures after a minute. It returns at once when
+// EventSub or the Twitch app credentials are not configured.
+func StartEventSubSubscriptions(ctx context.Context, channel string) {
+	callback, secret, ok := EventSubConfig()
+	if !ok || channel == "" {
+		return
+	}
+	clientID := os.Getenv("TWITCH_CLIENT_ID")
+	clientSecret := os.Getenv("TWITCH_CLIENT_SECRET")
+	if clientID == "" || clientSecret == "" {
+		slog.Info("eventsub: missing client id/secret; subscriptions disabled", slog.String("channel", channel))
+		return
+	}
+	helix := &twitchapi.HelixClient{
+		AppTokenSource: &twitchapi.TokenSource{ClientID: clientID, ClientSecret: clientSecret},
+		ClientID:       clientID,
+	}
+	var userID string
+	for {
+		wait := eventSubResync
+		err := func() error {
+			if userID == "" {
+				id, err := helix.GetUserID(ctx, channel)
+				if err != nil {
+					return err
+				}
+				userID = id
+			}
+			n, err := helix.EnsureEventSubSubscriptions(ctx, userID, callback, secret, twitchapi.EventSubStreamOnline, twitchapi.EventSubStreamOffline)
+			if n > 0 {
+				slog.Info("eventsub: created subscriptions", slog.Int("count", n), slog.String("channel", channel))
+			}
+			return err
+		}()
+		if err != nil {
+			slog.Warn("eventsub: sync subscriptions", slog.Any("err", err), slog.String("channel", channel))
+			wait = time.Minute
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
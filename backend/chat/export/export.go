@@ -0,0 +1,241 @@
+// Package export renders recorded chat as subtitle and replay files: WebVTT,
+// ASS (with username colors), YouTube timed text (YTT/SRV3) and line-delimited
+// JSON. Messages are read from chat_messages with a cursor and encoded as they
+// arrive, so exports never hold a whole VOD's chat in memory.
+package export
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// Format is a chat export format.
+type Format string
+
+// Supported formats.
+const (
+	FormatWebVTT Format = "vtt"
+	FormatASS    Format = "ass"
+	FormatYTT    Format = "ytt"
+	FormatJSONL  Format = "jsonl"
+)
+
+// DefaultCueDuration is how long each message stays on screen in subtitle formats.
+const DefaultCueDuration = 5 * time.Second
+
+// ErrUnknownFormat is returned by ParseFormat.
+var ErrUnknownFormat = errors.New("unknown chat export format")
+
+// ParseFormat accepts a format name or a common alias (webvtt, srv3, ssa, ndjson).
+func ParseFormat(s string) (Format, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "vtt", "webvtt":
+		return FormatWebVTT, nil
+	case "ass", "ssa":
+		return FormatASS, nil
+	case "ytt", "srv3":
+		return FormatYTT, nil
+	case "jsonl", "ndjson":
+		return FormatJSONL, nil
+	}
+	return "", fmt.Errorf("%w: %q (want vtt|ass|ytt|jsonl)", ErrUnknownFormat, s)
+}
+
+// ContentType is the MIME type served for the format.
+func (f Format) ContentType() string {
+	switch f {
+	case FormatWebVTT:
+		return "text/vtt; charset=utf-8"
+	case FormatASS:
+		return "text/x-ssa; charset=utf-8"
+	case FormatYTT:
+		return "application/xml; charset=utf-8"
+	default:
+		return "application/x-ndjson"
+	}
+}
+
+// Extension is the file extension (without dot) for the format.
+func (f Format) Extension() string {
+	if f == FormatYTT {
+		return "srv3"
+	}
+	return string(f)
+}
+
+// Message is one chat message as exported.
+type Message struct {
+	Abs    time.Time `json:"abs_timestamp"`
+	User   string    `json:"username"`
+	Text   string    `json:"message"`
+	Badges string    `json:"badges"`
+	Emotes string    `json:"emotes"`
+	Color  string    `json:"color"`
+	Rel    float64   `json:"rel_timestamp"`
+}
+
+// Options narrows and shapes an export.
+type Options struct {
+	// From and To bound rel_timestamp in seconds; To <= 0 means the end of the VOD.
+	From float64
+	To   float64
+	// Shift makes times relative to From (used for captions of one part of a split VOD).
+	Shift bool
+	// HideModerated leaves out messages removed by a timeout, ban or deletion.
+	HideModerated bool
+	// CueDuration is the on-screen time of each message (DefaultCueDuration when zero).
+	CueDuration time.Duration
+}
+
+// encoder writes one format. colors lists the distinct username colors up front
+// because YTT declares its pens before the body.
+type encoder interface {
+	begin(colors []string) error
+	message(m Message) error
+	end() error
+}
+
+func newEncoder(w *bufio.Writer, f Format, cue time.Duration) encoder {
+	switch f {
+	case FormatWebVTT:
+		return &vttEncoder{w: w, cue: cue}
+	case FormatASS:
+		return &assEncoder{w: w, cue: cue}
+	case FormatYTT:
+		return &yttEncoder{w: w, cue: cue}
+	default:
+		return newJSONLEncoder(w)
+	}
+}
+
+// Write streams a VOD's chat to w in the given format and returns the number of messages written.
+func Write(ctx context.Context, db *sql.DB, w io.Writer, vodID string, f Format, opts Options) (int, error) {
+	if opts.CueDuration <= 0 {
+		opts.CueDuration = DefaultCueDuration
+	}
+	where := `vod_id=$1 AND rel_timestamp>=$2`
+	args := []any{vodID, opts.From}
+	if opts.To > 0 {
+		where += ` AND rel_timestamp<$3`
+		args = append(args, opts.To)
+	}
+	if opts.HideModerated {
+		where += ` AND moderated_at IS NULL`
+	}
+	var colors []string
+	if f == FormatYTT {
+		var err error
+		if colors, err = distinctColors(ctx, db, where, args); err != nil {
+			return 0, err
+		}
+	}
+	//nolint:gosec // G202: where is built from fixed fragments, values are parameterized
+	rows, err := db.QueryContext(ctx, `SELECT COALESCE(username,''), COALESCE(message,''), COALESCE(abs_timestamp, to_timestamp(0)), COALESCE(rel_timestamp,0),
+		COALESCE(badges,''), COALESCE(emotes,''), COALESCE(color,'') FROM chat_messages WHERE `+where+` ORDER BY rel_timestamp ASC, id ASC`, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			slog.Warn("failed to close rows", slog.Any("err", err))
+		}
+	}()
+	bw := bufio.NewWriterSize(w, 32<<10)
+	enc := newEncoder(bw, f, opts.CueDuration)
+	if err := enc.begin(colors); err != nil {
+		return 0, err
+	}
+	n := 0
+	for rows.Next() {
+		var m Message
+		if err := rows.Scan(&m.User, &m.Text, &m.Abs, &m.Rel, &m.Badges, &m.Emotes, &m.Color); err != nil {
+			return n, err
+		}
+		if opts.Shift {
+			m.Rel -= opts.From
+		}
+		if err := enc.message(m); err != nil {
+			return n, err
+		}
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return n, err
+	}
+	if err := enc.end(); err != nil {
+		return n, err
+	}
+	return n, bw.Flush()
+}
+
+func distinctColors(ctx context.Context, db *sql.DB, where string, args []any) ([]string, error) {
+	//nolint:gosec // G202: where is built from fixed fragments, values are parameterized
+	rows, err := db.QueryContext(ctx, `SELECT DISTINCT UPPER(color) FROM chat_messages WHERE `+where+` AND color LIKE '#%'`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			slog.Warn("failed to close rows", slog.Any("err", err))
+		}
+	}()
+	var out []string
+	for rows.Next() {
+		var c string
+		if err := rows.Scan(&c); err != nil {
+			return nil, err
+		}
+		if c = normalizeColor(c); c != "" {
+			out = append(out, c)
+		}
+	}
+	return out, rows.Err()
+}
+
+// defaultColors mirrors the colors Twitch assigns to users who never picked one.
+var defaultColors = []string{
+	"#FF0000", "#0000FF", "#008000", "#B22222", "#FF7F50", "#9ACD32", "#FF4500", "#2E8B57",
+	"#DAA520", "#D2691E", "#5F9EA0", "#1E90FF", "#FF69B4", "#8A2BE2", "#00FF7F",
+}
+
+// userColor returns the message's #RRGGBB color, or a stable default for the username.
+func userColor(m Message) string {
+	if c := normalizeColor(m.Color); c != "" {
+		return c
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(strings.ToLower(m.User)))
+	return defaultColors[h.Sum32()%uint32(len(defaultColors))]
+}
+
+func normalizeColor(c string) string {
+	c = strings.ToUpper(strings.TrimSpace(c))
+	if len(c) != 7 || c[0] != '#' {
+		return ""
+	}
+	for _, r := range c[1:] {
+		if (r < '0' || r > '9') && (r < 'A' || r > 'F') {
+			return ""
+		}
+	}
+	return c
+}
+
+// cueTimes converts a message's relative time to start/end durations.
+func cueTimes(rel float64, cue time.Duration) (time.Duration, time.Duration) {
+	start := time.Duration(max(rel, 0) * float64(time.Second)).Round(time.Millisecond)
+	return start, start + cue
+}
+
+// singleLine collapses newlines, which subtitle formats would treat as cue breaks.
+func singleLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,140 @@
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+func encode(t *testing.T, f Format, colors []string, msgs ...Message) string {
+	t.Helper()
+	var buf bytes.Buffer
+	bw := bufio.NewWriter(&buf)
+	enc := newEncoder(bw, f, 3*time.Second)
+	if err := enc.begin(colors); err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range msgs {
+		if err := enc.message(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := enc.end(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bw.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestParseFormat(t *testing.T) {
+	for in, want := range map[string]Format{"WebVTT": FormatWebVTT, "srv3": FormatYTT, "ass": FormatASS, "ndjson": FormatJSONL} {
+		if got, err := ParseFormat(in); err != nil || got != want {
+			t.Fatalf("ParseFormat(%q) = %q, %v", in, got, err)
+		}
+	}
+	if _, err := ParseFormat("srt"); !errors.Is(err, ErrUnknownFormat) {
+		t.Fatalf("expected ErrUnknownFormat, got %v", err)
+	}
+}
+
+func TestWebVTT(t *testing.T) {
+	got := encode(t, FormatWebVTT, nil, Message{User: "alice", Text: "a <b> & c\nd", Rel: 3661.5})
+	want := "WEBVTT\n\n01:01:01.500 --> 01:01:04.500\n<v alice>a &lt;b&gt; &amp; c d\n\n"
+	if got != want {
+		t.Fatalf("vtt =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestASSColors(t *testing.T) {
+	got := encode(t, FormatASS, nil,
+		Message{User: "bob", Text: `{\pos(0,0)} hi`, Color: "#1E90ff", Rel: 1.25},
+		Message{User: "carol", Text: "no color", Rel: 2})
+	lines := strings.Split(strings.TrimSpace(got), "\n")
+	first := lines[len(lines)-2]
+	want := "Dialogue: 0,0:00:01.25,0:00:04.25,Chat,bob,0,0,0,,{\\b1\\c&HFF901E&}bob{\\b0\\c&HFFFFFF&}: \\{\\\u200bpos(0,0)\\} hi"
+	if first != want {
+		t.Fatalf("dialogue =\n%q\nwant\n%q", first, want)
+	}
+	if !strings.HasPrefix(got, "[Script Info]") || !strings.Contains(lines[len(lines)-1], "}carol{") {
+		t.Fatalf("unexpected ass output:\n%s", got)
+	}
+}
+
+func TestYTTDeclaresPens(t *testing.T) {
+	got := encode(t, FormatYTT, []string{"#123456"}, Message{User: "dave", Text: "x < y", Color: "#123456", Rel: 0.5})
+	pen := ""
+	for _, l := range strings.Split(got, "\n") {
+		if strings.Contains(l, `fc="#123456"`) {
+			pen = strings.TrimPrefix(strings.Split(l, `" fc`)[0], `<pen id="`)
+		}
+	}
+	if pen == "" {
+		t.Fatalf("no pen for user color:\n%s", got)
+	}
+	if !strings.Contains(got, `<p t="500" d="3000"><s p="`+pen+`">dave</s><s p="0">: x &lt; y</s></p>`) {
+		t.Fatalf("unexpected ytt body:\n%s", got)
+	}
+	if !strings.HasSuffix(got, "</body>\n</timedtext>\n") {
+		t.Fatalf("unterminated ytt:\n%s", got)
+	}
+}
+
+func TestJSONL(t *testing.T) {
+	got := encode(t, FormatJSONL, nil, Message{User: "erin", Text: "<3", Rel: 7}, Message{User: "frank", Text: "gg", Rel: 8})
+	lines := strings.Split(strings.TrimSpace(got), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("jsonl lines = %d", len(lines))
+	}
+	var m Message
+	if err := json.Unmarshal([]byte(lines[0]), &m); err != nil || m.Text != "<3" || m.Rel != 7 {
+		t.Fatalf("line 0 = %s (%v)", lines[0], err)
+	}
+}
+
+func TestWriteStreamsWindow(t *testing.T) {
+	dsn := os.Getenv("TEST_PG_DSN")
+	if dsn == "" {
+		t.Skip("TEST_PG_DSN not set")
+	}
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = db.Close() }()
+	ctx := context.Background()
+	vodID := "export_test_1"
+	if _, err := db.ExecContext(ctx, `INSERT INTO vods (channel, twitch_vod_id, title, date, created_at) VALUES ('', $1, 'Export', NOW(), NOW())
+		ON CONFLICT (twitch_vod_id) DO NOTHING`, vodID); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_, _ = db.Exec(`DELETE FROM chat_messages WHERE vod_id=$1`, vodID)
+		_, _ = db.Exec(`DELETE FROM vods WHERE twitch_vod_id=$1`, vodID)
+	})
+	_, _ = db.ExecContext(ctx, `DELETE FROM chat_messages WHERE vod_id=$1`, vodID)
+	for i, rel := range []float64{5, 65, 125} {
+		if _, err := db.ExecContext(ctx, `INSERT INTO chat_messages (vod_id, username, message, abs_timestamp, rel_timestamp, color)
+			VALUES ($1, $2, 'hi', NOW(), $3, '#00FF00')`, vodID, "user"+string(rune('a'+i)), rel); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var buf bytes.Buffer
+	n, err := Write(ctx, db, &buf, vodID, FormatYTT, Options{From: 60, To: 120, Shift: true})
+	if err != nil || n != 1 {
+		t.Fatalf("Write = %d, %v", n, err)
+	}
+	if !strings.Contains(buf.String(), `<p t="5000" d="5000">`) || !strings.Contains(buf.String(), ">userb<") {
+		t.Fatalf("unexpected export:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,157 @@
+package export
+
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// vttEncoder writes WebVTT with the username as the cue voice.
+type vttEncoder struct {
+	w   *bufio.Writer
+	cue time.Duration
+}
+
+var vttEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+func (e *vttEncoder) begin([]string) error {
+	_, err := e.w.WriteString("WEBVTT\n\n")
+	return err
+}
+
+func (e *vttEncoder) message(m Message) error {
+	start, end := cueTimes(m.Rel, e.cue)
+	_, err := fmt.Fprintf(e.w, "%s --> %s\n<v %s>%s\n\n", vttTime(start), vttTime(end),
+		vttEscaper.Replace(singleLine(m.User)), vttEscaper.Replace(singleLine(m.Text)))
+	return err
+}
+
+func (e *vttEncoder) end() error { return nil }
+
+func vttTime(d time.Duration) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+// assEncoder writes Advanced SubStation Alpha; messages stack bottom-left and the
+// username is drawn bold in its chat color.
+type assEncoder struct {
+	w   *bufio.Writer
+	cue time.Duration
+}
+
+const assHeader = `[Script Info]
+ScriptType: v4.00+
+PlayResX: 1920
+PlayResY: 1080
+WrapStyle: 0
+ScaledBorderAndShadow: yes
+
+[V4+ Styles]
+Format: Name, Fontname, Fontsize, PrimaryColour, SecondaryColour, OutlineColour, BackColour, Bold, Italic, Underline, StrikeOut, ScaleX, ScaleY, Spacing, Angle, BorderStyle, Outline, Shadow, Alignment, MarginL, MarginR, MarginV, Encoding
+Style: Chat,Arial,36,&H00FFFFFF,&H000000FF,&H00000000,&H80000000,0,0,0,0,100,100,0,0,1,2,0,1,30,30,30,1
+
+[Events]
+Format: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text
+`
+
+// assEscaper keeps message text from forming override blocks or codes like \N
+// (a zero-width space is inserted after each backslash).
+var assEscaper = strings.NewReplacer(`\`, "\\\u200b", "{", `\{`, "}", `\}`)
+
+func (e *assEncoder) begin([]string) error {
+	_, err := e.w.WriteString(assHeader)
+	return err
+}
+
+func (e *assEncoder) message(m Message) error {
+	start, end := cueTimes(m.Rel, e.cue)
+	user := assEscaper.Replace(singleLine(m.User))
+	_, err := fmt.Fprintf(e.w, "Dialogue: 0,%s,%s,Chat,%s,0,0,0,,{\\b1\\c%s}%s{\\b0\\c&HFFFFFF&}: %s\n",
+		assTime(start), assTime(end), strings.ReplaceAll(user, ",", ""), assColor(userColor(m)), user, assEscaper.Replace(singleLine(m.Text)))
+	return err
+}
+
+func (e *assEncoder) end() error { return nil }
+
+// assTime renders H:MM:SS.cc (centiseconds).
+func assTime(d time.Duration) string {
+	cs := d.Milliseconds() / 10
+	return fmt.Sprintf("%d:%02d:%02d.%02d", cs/360000, cs/6000%60, cs/100%60, cs%100)
+}
+
+// assColor converts #RRGGBB to ASS's &HBBGGRR& order.
+func assColor(c string) string {
+	return "&H" + c[5:7] + c[3:5] + c[1:3] + "&"
+}
+
+// yttEncoder writes YouTube timed text (format 3). Pens are declared in the head, one
+// bold pen per username color plus a plain white pen for message text.
+type yttEncoder struct {
+	w    *bufio.Writer
+	pens map[string]int
+	cue  time.Duration
+}
+
+func (e *yttEncoder) begin(colors []string) error {
+	e.pens = map[string]int{}
+	if _, err := e.w.WriteString("<?xml version=\"1.0\" encoding=\"utf-8\"?>\n<timedtext format=\"3\">\n<head>\n<pen id=\"0\" fc=\"#FFFFFF\"/>\n"); err != nil {
+		return err
+	}
+	for _, c := range append(append([]string(nil), defaultColors...), colors...) {
+		if _, ok := e.pens[c]; ok {
+			continue
+		}
+		id := len(e.pens) + 1
+		e.pens[c] = id
+		if _, err := fmt.Fprintf(e.w, "<pen id=\"%d\" fc=\"%s\" b=\"1\"/>\n", id, c); err != nil {
+			return err
+		}
+	}
+	_, err := e.w.WriteString("</head>\n<body>\n")
+	return err
+}
+
+func (e *yttEncoder) message(m Message) error {
+	start, _ := cueTimes(m.Rel, e.cue)
+	pen := e.pens[userColor(m)]
+	if _, err := fmt.Fprintf(e.w, "<p t=\"%d\" d=\"%d\"><s p=\"%d\">", start.Milliseconds(), e.cue.Milliseconds(), pen); err != nil {
+		return err
+	}
+	if err := xml.EscapeText(e.w, []byte(singleLine(m.User))); err != nil {
+		return err
+	}
+	if _, err := e.w.WriteString("</s><s p=\"0\">: "); err != nil {
+		return err
+	}
+	if err := xml.EscapeText(e.w, []byte(singleLine(m.Text))); err != nil {
+		return err
+	}
+	_, err := e.w.WriteString("</s></p>\n")
+	return err
+}
+
+func (e *yttEncoder) end() error {
+	_, err := e.w.WriteString("</body>\n</timedtext>\n")
+	return err
+}
+
+// jsonlEncoder writes one JSON object per message.
+type jsonlEncoder struct {
+	enc *json.Encoder
+}
+
+func newJSONLEncoder(w *bufio.Writer) *jsonlEncoder {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return &jsonlEncoder{enc: enc}
+}
+
+func (e *jsonlEncoder) begin([]string) error { return nil }
+
+func (e *jsonlEncoder) message(m Message) error { return e.enc.Encode(m) }
+
+func (e *jsonlEncoder) end() error { return nil }
@@ -0,0 +1,355 @@
+package chat
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	twitch "github.com/gempir/go-twitch-irc/v4"
+
+	"github.com/onnwee/vod-tender/backend/db"
+	"github.com/onnwee/vod-tender/backend/telemetry"
+)
+
+const (
+	defaultChannelsPerConnection = 50
+	reconnectMinBackoff          = time.Second
+	defaultReconnectBackoff      = 2 * time.Minute
+)
+
+// ErrAlreadyRecording is returned by Hub.Record when the channel already has a recorder.
+var ErrAlreadyRecording = errors.New("chat: channel is already being recorded")
+
+// ErrNoCredentials is returned when no bot username or IRC token is configured.
+var ErrNoCredentials = errors.New("chat: twitch bot username or oauth token not set")
+
+// Hub shares a small pool of IRC connections between all recorded channels. A
+// channel is joined when its recording starts and parted when it stops; incoming
+// lines are routed by channel to that channel's recorder. Connections are opened
+// on demand, hold up to CHAT_IRC_CHANNELS_PER_CONNECTION channels each, and are
+// closed when their last channel leaves. Channels that authorized their own bot
+// token get connections logged in as that account; the rest share the default.
+type Hub struct {
+	dbx *sql.DB
+	// credentials returns the bot login and IRC token of an account (an oauth_tokens
+	// channel, "" for the default) for each (re)connect, so a refreshed stored token
+	// is picked up (replaced in tests).
+	credentials func(ctx context.Context, account string) (username, oauth string, err error)
+	ircAddress  string
+	perConn     int
+	maxBackoff  time.Duration
+
+	mu      sync.Mutex
+	conns   []*hubConn
+	writers map[string]*recorder
+}
+
+// hubConn is one pooled IRC connection and the channels assigned to it.
+type hubConn struct {
+	hub      *Hub
+	account  string
+	client   *twitch.Client
+	channels map[string]bool
+	cancel   context.CancelFunc
+	// lastSeen is the unix nano time of the last line from the server; a gap starts there.
+	lastSeen atomic.Int64
+}
+
+// NewHub returns a hub that records into dbx. A channel with its own stored twitch
+// token logs in with it, as the login recorded when it was authorized. Otherwise the
+// bot login comes from TWITCH_BOT_USERNAME and the token from TWITCH_OAUTH_TOKEN, or
+// the default stored twitch token when the variable is unset.
+func NewHub(dbx *sql.DB) *Hub {
+	h := &Hub{
+		dbx:        dbx,
+		perConn:    envInt("CHAT_IRC_CHANNELS_PER_CONNECTION", defaultChannelsPerConnection),
+		maxBackoff: envDuration("CHAT_RECONNECT_MAX_BACKOFF", defaultReconnectBackoff),
+		writers:    map[string]*recorder{},
+	}
+	h.credentials = func(ctx context.Context, account string) (string, string, error) {
+		return ircCredentials(ctx, dbx, account)
+	}
+	return h
+}
+
+func ircCredentials(ctx context.Context, dbx *sql.DB, account string) (string, string, error) {
+	username := os.Getenv("TWITCH_BOT_USERNAME")
+	oauth := ""
+	if account == "" {
+		oauth = os.Getenv("TWITCH_OAUTH_TOKEN")
+	}
+	if oauth == "" && dbx != nil {
+		// Attempt to load from oauth_tokens using db.GetOAuthTokenForChannel to handle decryption
+		accessToken, _, _, _, err := db.GetOAuthTokenForChannel(ctx, dbx, "twitch", account)
+		if err == nil && accessToken != "" {
+			oauth = accessToken
+			if login, err := db.GetTwitchBotLogin(ctx, dbx, account); err == nil && login != "" {
+				username = login
+			}
+		}
+	}
+	if username == "" || oauth == "" {
+		return "", "", ErrNoCredentials
+	}
+	// Normalize token format for IRC lib (expects "oauth:xxxxx").
+	if !strings.HasPrefix(strings.ToLower(oauth), "oauth:") {
+		oauth = "oauth:" + oauth
+	}
+	return username, oauth, nil
+}
+
+// Record joins channel and stores its chat under vodID, with relative timestamps
+// measured from vodStart, until ctx is done. It then parts the channel and returns
+// once the buffered messages are written.
+func (h *Hub) Record(ctx context.Context, channel, vodID string, vodStart time.Time) error {
+	channel = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(channel), "#"))
+	if channel == "" {
+		return errors.New("chat: channel is required")
+	}
+	account := h.account(ctx, channel)
+	if _, _, err := h.credentials(ctx, account); err != nil {
+		return err
+	}
+	rec := newRecorder(h.dbx, channel, vodID, vodStart)
+	rec.account = account
+	if err := h.attach(ctx, rec); err != nil {
+		return err
+	}
+	flushed := make(chan struct{})
+	go func() {
+		rec.run(ctx)
+		close(flushed)
+	}()
+	<-ctx.Done()
+	h.detach(rec)
+	<-flushed
+	return nil
+}
+
+// account returns the oauth_tokens channel whose twitch token channel's chat is read
+// with: channel's own when it authorized one, otherwise the default.
+func (h *Hub) account(ctx context.Context, channel string) string {
+	if h.dbx == nil {
+		return ""
+	}
+	account, err := db.ResolveOAuthChannel(ctx, h.dbx, "twitch", channel)
+	if err != nil {
+		slog.Warn("chat hub: resolve bot account", slog.Any("err", err), slog.String("channel", channel))
+		return ""
+	}
+	return account
+}
+
+// attach routes rec.channel's lines to rec and joins it on a connection for its
+// account with room, opening a new connection when all are full.
+func (h *Hub) attach(ctx context.Context, rec *recorder) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.writers[rec.channel]; ok {
+		return fmt.Errorf("%w: %s", ErrAlreadyRecording, rec.channel)
+	}
+	h.writers[rec.channel] = rec
+	var conn *hubConn
+	for _, c := range h.conns {
+		if c.account == rec.account && len(c.channels) < h.perConn {
+			conn = c
+			break
+		}
+	}
+	if conn == nil {
+		// The connection outlives the recording that opened it; it is closed
+		// when its last channel is detached.
+		cctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		conn = &hubConn{hub: h, account: rec.account, channels: map[string]bool{}, cancel: cancel}
+		h.conns = append(h.conns, conn)
+		go conn.run(cctx)
+	}
+	conn.channels[rec.channel] = true
+	if conn.client != nil {
+		conn.client.Join(rec.channel)
+	}
+	slog.Info("chat hub: joined channel", slog.String("channel", rec.channel), slog.String("vod_id", rec.vodID), slog.Int("connections", len(h.conns)))
+	return nil
+}
+
+// detach stops routing to rec and parts its channel. A connection left without
+// channels is closed.
+func (h *Hub) detach(rec *recorder) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.writers[rec.channel] == rec {
+		delete(h.writers, rec.channel)
+	}
+	for i, c := range h.conns {
+		if !c.channels[rec.channel] {
+			continue
+		}
+		delete(c.channels, rec.channel)
+		if c.client != nil {
+			c.client.Depart(rec.channel)
+		}
+		if len(c.channels) == 0 {
+			c.cancel()
+			h.conns = append(h.conns[:i], h.conns[i+1:]...)
+		}
+		break
+	}
+	rec.closeGap(context.Background())
+	slog.Info("chat hub: parted channel", slog.String("channel", rec.channel), slog.String("vod_id", rec.vodID))
+}
+
+func (h *Hub) writer(channel string) *recorder {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.writers[strings.ToLower(channel)]
+}
+
+// register routes a client's lines to the recorders of their channels.
+func (c *hubConn) register(client *twitch.Client) {
+	h := c.hub
+	client.OnPrivateMessage(func(msg twitch.PrivateMessage) {
+		c.seen()
+		if r := h.writer(msg.Channel); r != nil {
+			r.onMessage(msg)
+		}
+	})
+	client.OnUserNoticeMessage(func(msg twitch.UserNoticeMessage) {
+		c.seen()
+		if r := h.writer(msg.Channel); r != nil {
+			r.onEvent(userNoticeEvent(msg))
+		}
+	})
+	client.OnClearChatMessage(func(msg twitch.ClearChatMessage) {
+		c.seen()
+		if r := h.writer(msg.Channel); r != nil {
+			r.onEvent(clearChatEvent(msg))
+		}
+	})
+	client.OnClearMessage(func(msg twitch.ClearMessage) {
+		c.seen()
+		if r := h.writer(msg.Channel); r != nil {
+			r.onEvent(clearMsgEvent(msg))
+		}
+	})
+	client.OnPingMessage(func(twitch.PingMessage) { c.seen() })
+	client.OnPongMessage(func(twitch.PongMessage) { c.seen() })
+}
+
+func (c *hubConn) seen() {
+	c.lastSeen.Store(time.Now().UnixNano())
+}
+
+// gapStart is when the server was last heard from, or now if it never was.
+func (c *hubConn) gapStart() time.Time {
+	if ns := c.lastSeen.Load(); ns != 0 {
+		return time.Unix(0, ns).UTC()
+	}
+	return time.Now().UTC()
+}
+
+// recorders returns the recorders of the channels on this connection.
+func (c *hubConn) recorders() []*recorder {
+	h := c.hub
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	out := make([]*recorder, 0, len(c.channels))
+	for ch := range c.channels {
+		if r := h.writers[ch]; r != nil {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// outage records a gap for every channel on the connection.
+func (c *hubConn) outage(ctx context.Context, reason string) {
+	start := c.gapStart()
+	for _, r := range c.recorders() {
+		r.openGap(ctx, start, reason)
+	}
+	if telemetry.ChatReconnections != nil {
+		telemetry.ChatReconnections.Inc()
+	}
+}
+
+func (c *hubConn) restored(ctx context.Context) {
+	for _, r := range c.recorders() {
+		r.closeGap(ctx)
+	}
+}
+
+// run keeps the connection open until ctx is done. The IRC client reconnects by
+// itself after a dropped connection and rejoins its channels; when Connect returns
+// (a failed dial or login) a new client is started after a jittered exponential
+// backoff. Both kinds of outage are recorded as gaps starting at the last line heard.
+func (c *hubConn) run(ctx context.Context) {
+	h := c.hub
+	backoff := reconnectMinBackoff
+	for {
+		var connects atomic.Int32
+		username, oauth, err := h.credentials(ctx, c.account)
+		if err == nil {
+			client := twitch.NewClient(username, oauth)
+			if h.ircAddress != "" {
+				client.IrcAddress, client.TLS = h.ircAddress, false
+			}
+			c.register(client)
+			client.OnConnect(func() {
+				if ctx.Err() != nil {
+					_ = client.Disconnect()
+					return
+				}
+				if connects.Add(1) > 1 {
+					// The client reconnected internally after losing the connection.
+					c.outage(ctx, "connection lost")
+				}
+				c.restored(ctx)
+				c.seen()
+			})
+			h.mu.Lock()
+			c.client = client
+			for ch := range c.channels {
+				client.Join(ch)
+			}
+			h.mu.Unlock()
+			stop := context.AfterFunc(ctx, func() { _ = client.Disconnect() })
+			err = client.Connect()
+			stop()
+			h.mu.Lock()
+			c.client = nil
+			h.mu.Unlock()
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		reason := "disconnected"
+		if err != nil {
+			reason = err.Error()
+		}
+		c.outage(ctx, reason)
+		if connects.Load() > 0 {
+			backoff = reconnectMinBackoff
+		}
+		// Jitter to 50-100% so many connections do not reconnect in lockstep.
+		wait := backoff/2 + rand.N(backoff/2+1)
+		logArgs := []any{slog.Int("channels", len(c.recorders())), slog.Duration("retry_in", wait), slog.Any("err", err)}
+		if errors.Is(err, twitch.ErrLoginAuthenticationFailed) {
+			logArgs = append(logArgs, slog.String("hint", "ensure TWITCH_BOT_USERNAME matches the token owner and token includes 'oauth:' prefix"))
+		}
+		slog.Warn("twitch chat disconnected; reconnecting", logArgs...)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		backoff = min(backoff*2, h.maxBackoff)
+	}
+}
@@ -0,0 +1,244 @@
+package chat
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/onnwee/vod-tender/backend/telemetry"
+)
+
+// ircLog is what a fakeIRC server saw: connections, and JOIN/PART commands in order.
+type ircLog struct {
+	mu       sync.Mutex
+	conns    int
+	commands []string
+}
+
+func (l *ircLog) snapshot() (int, []string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.conns, append([]string(nil), l.commands...)
+}
+
+// fakeIRC accepts connections, welcomes each client and answers every joined
+// channel with one PRIVMSG ("hi <channel>"). With dropFirst the first connection
+// is closed shortly after its first JOIN to force a reconnect.
+func fakeIRC(t *testing.T, dropFirst bool) (string, *ircLog) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	log := &ircLog{}
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			log.mu.Lock()
+			log.conns++
+			n := log.conns
+			log.mu.Unlock()
+			go func(c net.Conn, n int) {
+				defer func() { _ = c.Close() }()
+				sc := bufio.NewScanner(c)
+				for sc.Scan() {
+					line := sc.Text()
+					switch {
+					case strings.HasPrefix(line, "NICK"):
+						_, _ = c.Write([]byte(":tmi.twitch.tv 001 bot :Welcome, GLHF!\r\n"))
+					case strings.HasPrefix(line, "JOIN "), strings.HasPrefix(line, "PART "):
+						log.mu.Lock()
+						log.commands = append(log.commands, line)
+						log.mu.Unlock()
+						if strings.HasPrefix(line, "PART ") {
+							continue
+						}
+						for _, ch := range strings.Split(strings.TrimPrefix(line, "JOIN "), ",") {
+							ch = strings.TrimPrefix(ch, "#")
+							_, _ = fmt.Fprintf(c, "@id=%d-%s :viewer!viewer@viewer.tmi.twitch.tv PRIVMSG #%s :hi %s\r\n", n, ch, ch, ch)
+						}
+						if dropFirst && n == 1 {
+							time.Sleep(50 * time.Millisecond)
+							return
+						}
+					}
+				}
+			}(c, n)
+		}
+	}()
+	return ln.Addr().String(), log
+}
+
+func testHub(addr string) *Hub {
+	return &Hub{
+		credentials: func(context.Context, string) (string, string, error) { return "bot", "oauth:token", nil },
+		ircAddress:  addr,
+		perConn:     10,
+		maxBackoff:  time.Second,
+		writers:     map[string]*recorder{},
+	}
+}
+
+// waitFor polls cond until it holds or the test context expires.
+func waitFor(ctx context.Context, cond func() bool) bool {
+	for ctx.Err() == nil {
+		if cond() {
+			return true
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	return cond()
+}
+
+func TestHubRoutesChannelsOverOneConnection(t *testing.T) {
+	addr, irc := fakeIRC(t, false)
+	h := testHub(addr)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	recs := map[string]*fakeSink{}
+	var wg sync.WaitGroup
+	for _, ch := range []string{"alpha", "beta"} {
+		r, sink := testRecorder(100, 1)
+		r.channel = ch
+		recs[ch] = sink
+		if err := h.attach(ctx, r); err != nil {
+			t.Fatal(err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.run(ctx)
+		}()
+		defer h.detach(r)
+	}
+	if err := h.attach(ctx, &recorder{channel: "alpha"}); err == nil {
+		t.Fatal("second recorder for alpha attached")
+	}
+	ok := waitFor(ctx, func() bool {
+		a, _ := recs["alpha"].snapshot()
+		b, _ := recs["beta"].snapshot()
+		return len(a) == 1 && len(b) == 1
+	})
+	a, _ := recs["alpha"].snapshot()
+	b, _ := recs["beta"].snapshot()
+	if !ok || a[0] != "msg:hi alpha" || b[0] != "msg:hi beta" {
+		t.Fatalf("routed alpha=%v beta=%v", a, b)
+	}
+	if conns, _ := irc.snapshot(); conns != 1 {
+		t.Fatalf("connections = %d, want 1", conns)
+	}
+	h.detach(h.writer("beta"))
+	if !waitFor(ctx, func() bool {
+		_, cmds := irc.snapshot()
+		return len(cmds) > 0 && cmds[len(cmds)-1] == "PART #beta"
+	}) {
+		_, cmds := irc.snapshot()
+		t.Fatalf("commands = %v, want a trailing PART #beta", cmds)
+	}
+	h.detach(h.writer("alpha"))
+	h.mu.Lock()
+	open := len(h.conns)
+	h.mu.Unlock()
+	if open != 0 {
+		t.Fatalf("connections left open = %d", open)
+	}
+	cancel()
+	wg.Wait()
+}
+
+func TestHubPoolsConnections(t *testing.T) {
+	addr, irc := fakeIRC(t, false)
+	h := testHub(addr)
+	h.perConn = 2
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, ch := range []string{"a", "b", "c"} {
+		r, _ := testRecorder(10, 1)
+		r.channel = ch
+		if err := h.attach(ctx, r); err != nil {
+			t.Fatal(err)
+		}
+		defer h.detach(r)
+	}
+	if !waitFor(ctx, func() bool { conns, _ := irc.snapshot(); return conns == 2 }) {
+		conns, _ := irc.snapshot()
+		t.Fatalf("connections = %d, want 2 for 3 channels at 2 per connection", conns)
+	}
+}
+
+func TestHubSeparatesAccounts(t *testing.T) {
+	addr, irc := fakeIRC(t, false)
+	h := testHub(addr)
+	var mu sync.Mutex
+	logins := map[string]bool{}
+	h.credentials = func(_ context.Context, account string) (string, string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		logins[account] = true
+		return "bot", "oauth:token-" + account, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	// a and b share the default bot; c authorized its own.
+	for _, rc := range []struct{ channel, account string }{{"a", ""}, {"b", ""}, {"c", "c"}} {
+		r, _ := testRecorder(10, 1)
+		r.channel, r.account = rc.channel, rc.account
+		if err := h.attach(ctx, r); err != nil {
+			t.Fatal(err)
+		}
+		defer h.detach(r)
+	}
+	if !waitFor(ctx, func() bool { conns, _ := irc.snapshot(); return conns == 2 }) {
+		conns, _ := irc.snapshot()
+		t.Fatalf("connections = %d, want one per account", conns)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(logins) != 2 || !logins[""] || !logins["c"] {
+		t.Fatalf("credentials requested for %v", logins)
+	}
+}
+
+func TestHubReconnects(t *testing.T) {
+	telemetry.Init()
+	before := testutil.ToFloat64(telemetry.ChatReconnections)
+	addr, irc := fakeIRC(t, true)
+	h := testHub(addr)
+	r, sink := testRecorder(100, 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		r.run(ctx)
+		close(done)
+	}()
+	if err := h.attach(ctx, r); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(ctx, func() bool {
+		got, _ := sink.snapshot()
+		conns, _ := irc.snapshot()
+		return len(got) >= 2 && conns >= 2
+	})
+	h.detach(r)
+	cancel()
+	<-done
+	if got, _ := sink.snapshot(); len(got) < 2 {
+		conns, _ := irc.snapshot()
+		t.Fatalf("messages across reconnect = %v (connections %d)", got, conns)
+	}
+	if d := testutil.ToFloat64(telemetry.ChatReconnections) - before; d < 1 {
+		t.Fatalf("chat_reconnections_total increased by %v", d)
+	}
+}
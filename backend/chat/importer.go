@@ -0,0 +1,336 @@
+package chat
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/onnwee/vod-tender/backend/twitchapi"
+)
+
+// Import job states stored in chat_imports.state.
+const (
+	ImportRunning = "running"
+	ImportDone    = "done"
+	ImportFailed  = "failed"
+)
+
+// importStaleAfter is how long a running import may go without progress before
+// another import of the same VOD may take over (the process running it died).
+const importStaleAfter = 10 * time.Minute
+
+// ErrImportRunning is returned by StartImport when the VOD already has an import in progress.
+var ErrImportRunning = errors.New("chat: an import is already running for this vod")
+
+// Comment is a historical chat message from an import source. Offset is its
+// position in the VOD in seconds; CreatedAt may be zero, in which case the
+// absolute time is derived from the VOD start.
+type Comment struct {
+	CreatedAt   time.Time
+	Badges      map[string]string
+	ID          string
+	UserID      string
+	Username    string
+	DisplayName string
+	Text        string
+	Color       string
+	// EmotePositions are code point ranges of emotes in Text.
+	EmotePositions []EmotePosition
+	Offset         float64
+	Bits           int
+}
+
+// CommentSource yields a VOD's historical chat a page at a time, in offset order.
+// Next returns io.EOF after the last page. A source that implements io.Closer is
+// closed when the import ends.
+type CommentSource interface {
+	Next(ctx context.Context) ([]Comment, error)
+}
+
+// ImportStatus is the progress of a VOD's chat import, as stored in chat_imports.
+type ImportStatus struct {
+	StartedAt  time.Time  `json:"started_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	VodID      string     `json:"vod_id"`
+	Source     string     `json:"source"`
+	State      string     `json:"state"`
+	Error      string     `json:"error,omitempty"`
+	Imported   int64      `json:"imported"`
+	// Duplicates counts comments skipped because their message id was already stored.
+	Duplicates      int64   `json:"duplicates"`
+	OffsetSeconds   float64 `json:"offset_seconds"`
+	DurationSeconds float64 `json:"duration_seconds"`
+	// Progress is OffsetSeconds over the VOD duration (0-1), 1 once done.
+	Progress float64 `json:"progress"`
+}
+
+// StartImport claims the VOD's import slot and imports src in the background until
+// ctx is done. Progress is readable with LoadImport. It returns ErrImportRunning
+// when another import of the VOD is active and sql.ErrNoRows for an unknown VOD.
+func StartImport(ctx context.Context, dbx *sql.DB, vodID, sourceName string, src CommentSource) error {
+	job, err := claimImport(ctx, dbx, vodID, sourceName)
+	if err != nil {
+		closeSource(src)
+		return err
+	}
+	go func() {
+		if err := job.run(ctx, src); err != nil {
+			slog.Warn("chat import failed", slog.String("vod_id", vodID), slog.String("source", sourceName), slog.Any("err", err))
+		}
+	}()
+	return nil
+}
+
+// LoadImport returns the VOD's latest import status, or sql.ErrNoRows if it was never imported.
+func LoadImport(ctx context.Context, dbx *sql.DB, vodID string) (ImportStatus, error) {
+	var st ImportStatus
+	var errMsg sql.NullString
+	err := dbx.QueryRowContext(ctx, `SELECT vod_id, source, state, imported, duplicates, offset_seconds, duration_seconds, error, started_at, updated_at, finished_at
+		FROM chat_imports WHERE vod_id=$1`, vodID).Scan(&st.VodID, &st.Source, &st.State, &st.Imported, &st.Duplicates,
+		&st.OffsetSeconds, &st.DurationSeconds, &errMsg, &st.StartedAt, &st.UpdatedAt, &st.FinishedAt)
+	if err != nil {
+		return st, err
+	}
+	st.Error = errMsg.String
+	switch {
+	case st.State == ImportDone:
+		st.Progress = 1
+	case st.DurationSeconds > 0:
+		st.Progress = min(st.OffsetSeconds/st.DurationSeconds, 1)
+	}
+	return st, nil
+}
+
+// importJob is a claimed import of one VOD.
+type importJob struct {
+	vodStart time.Time
+	dbx      *sql.DB
+	vodID    string
+	channel  string
+}
+
+// claimImport resets the VOD's chat_imports row to running unless a live import holds it.
+func claimImport(ctx context.Context, dbx *sql.DB, vodID, sourceName string) (*importJob, error) {
+	job := &importJob{dbx: dbx, vodID: vodID}
+	var duration int
+	if err := dbx.QueryRowContext(ctx, `SELECT channel, date, COALESCE(duration_seconds,0) FROM vods WHERE twitch_vod_id=$1`, vodID).
+		Scan(&job.channel, &job.vodStart, &duration); err != nil {
+		return nil, err
+	}
+	res, err := dbx.ExecContext(ctx, `INSERT INTO chat_imports (vod_id, source, state, duration_seconds) VALUES ($1,$2,$3,$4)
+		ON CONFLICT (vod_id) DO UPDATE SET source=EXCLUDED.source, state=EXCLUDED.state, duration_seconds=EXCLUDED.duration_seconds,
+			imported=0, duplicates=0, offset_seconds=0, error=NULL, started_at=NOW(), updated_at=NOW(), finished_at=NULL
+		WHERE chat_imports.state <> $3 OR chat_imports.updated_at < $5`,
+		vodID, sourceName, ImportRunning, duration, time.Now().Add(-importStaleAfter))
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, ErrImportRunning
+	}
+	return job, nil
+}
+
+// run stores every comment from src and records progress after each page. The
+// final state is done, or failed with the error.
+func (j *importJob) run(ctx context.Context, src CommentSource) (err error) {
+	defer closeSource(src)
+	defer func() {
+		state, msg := ImportDone, sql.NullString{}
+		if err != nil {
+			state, msg = ImportFailed, sql.NullString{String: err.Error(), Valid: true}
+		}
+		// Record the outcome even when ctx was canceled by shutdown.
+		fctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+		defer cancel()
+		if _, uerr := j.dbx.ExecContext(fctx, `UPDATE chat_imports SET state=$2, error=$3, updated_at=NOW(), finished_at=NOW() WHERE vod_id=$1`,
+			j.vodID, state, msg); uerr != nil {
+			slog.Warn("failed to record chat import result", slog.String("vod_id", j.vodID), slog.Any("err", uerr))
+		}
+	}()
+	var imported, duplicates int64
+	var offset float64
+	for {
+		comments, err := src.Next(ctx)
+		if errors.Is(err, io.EOF) {
+			slog.Info("chat import finished", slog.String("vod_id", j.vodID), slog.Int64("imported", imported), slog.Int64("duplicates", duplicates))
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		rows := make([]messageRow, 0, len(comments))
+		for _, c := range comments {
+			rows = append(rows, commentRow(c, j.vodStart))
+			offset = max(offset, c.Offset)
+		}
+		for len(rows) > 0 {
+			n := min(len(rows), defaultChatBatchSize)
+			stored, err := insertMessages(ctx, j.dbx, j.channel, j.vodID, rows[:n])
+			if err != nil {
+				return fmt.Errorf("insert chat messages: %w", err)
+			}
+			imported += stored
+			duplicates += int64(n) - stored
+			rows = rows[n:]
+		}
+		if _, err := j.dbx.ExecContext(ctx, `UPDATE chat_imports SET imported=$2, duplicates=$3, offset_seconds=$4, updated_at=NOW() WHERE vod_id=$1`,
+			j.vodID, imported, duplicates, offset); err != nil {
+			return err
+		}
+	}
+}
+
+func closeSource(src CommentSource) {
+	if c, ok := src.(io.Closer); ok {
+		_ = c.Close()
+	}
+}
+
+// commentRow maps an imported comment to the row the live recorder would have stored.
+func commentRow(c Comment, vodStart time.Time) messageRow {
+	abs := c.CreatedAt
+	if abs.IsZero() {
+		abs = vodStart.Add(time.Duration(c.Offset * float64(time.Second)))
+	}
+	row := messageRow{
+		abs:            abs.UTC(),
+		rel:            c.Offset,
+		username:       c.Username,
+		displayName:    c.DisplayName,
+		userID:         c.UserID,
+		text:           c.Text,
+		color:          c.Color,
+		messageID:      c.ID,
+		bits:           c.Bits,
+		emotePositions: c.EmotePositions,
+	}
+	sets := make([]string, 0, len(c.Badges))
+	for k := range c.Badges {
+		sets = append(sets, k)
+	}
+	sort.Strings(sets)
+	for _, k := range sets {
+		row.badges += k + ":" + c.Badges[k] + ","
+	}
+	seen := map[string]bool{}
+	for _, e := range c.EmotePositions {
+		if !seen[e.Name] {
+			seen[e.Name] = true
+			row.emotes += e.Name + ","
+		}
+	}
+	return row
+}
+
+// fragmentText joins message fragments and records the code point range of each emote.
+func fragmentText(frags []twitchapi.CommentFragment) (string, []EmotePosition) {
+	var text []rune
+	var emotes []EmotePosition
+	for _, f := range frags {
+		r := []rune(f.Text)
+		if f.EmoteID != "" && len(r) > 0 {
+			emotes = append(emotes, EmotePosition{ID: f.EmoteID, Name: f.Text, Start: len(text), End: len(text) + len(r) - 1})
+		}
+		text = append(text, r...)
+	}
+	return string(text), emotes
+}
+
+// TwitchCommentSource reads a VOD's replay chat from Twitch.
+type TwitchCommentSource struct {
+	client  *twitchapi.HelixClient
+	videoID string
+	cursor  string
+	done    bool
+}
+
+// NewTwitchCommentSource returns a source for the Twitch video videoID. A nil client
+// uses the public GQL endpoint with default settings.
+func NewTwitchCommentSource(client *twitchapi.HelixClient, videoID string) *TwitchCommentSource {
+	if client == nil {
+		client = &twitchapi.HelixClient{GQLClientID: os.Getenv("TWITCH_GQL_CLIENT_ID")}
+	}
+	return &TwitchCommentSource{client: client, videoID: videoID}
+}
+
+// Next returns the next page of comments.
+func (s *TwitchCommentSource) Next(ctx context.Context) ([]Comment, error) {
+	if s.done {
+		return nil, io.EOF
+	}
+	page, next, err := s.client.GetVideoComments(ctx, s.videoID, s.cursor)
+	if err != nil {
+		return nil, err
+	}
+	if next == "" || next == s.cursor {
+		s.done = true
+	}
+	s.cursor = next
+	out := make([]Comment, 0, len(page))
+	for _, vc := range page {
+		c := Comment{ID: vc.ID, CreatedAt: vc.CreatedAt, Offset: vc.OffsetSeconds, UserID: vc.UserID,
+			Username: vc.Login, DisplayName: vc.DisplayName, Color: vc.Color}
+		c.Text, c.EmotePositions = fragmentText(vc.Fragments)
+		if len(vc.Badges) > 0 {
+			c.Badges = make(map[string]string, len(vc.Badges))
+			for _, b := range vc.Badges {
+				c.Badges[b.SetID] = b.Version
+			}
+		}
+		out = append(out, c)
+	}
+	if len(out) == 0 && s.done {
+		return nil, io.EOF
+	}
+	return out, nil
+}
+
+// StartChatImportJob imports Twitch replay chat for the channel's VODs that have no
+// chat (typically found by the catalog backfill), newest first, one VOD per tick.
+// It is enabled with CHAT_IMPORT_AUTO=1; CHAT_IMPORT_INTERVAL sets the tick (default 10m).
+func StartChatImportJob(ctx context.Context, dbx *sql.DB, channel string) {
+	if os.Getenv("CHAT_IMPORT_AUTO") != "1" {
+		return
+	}
+	interval := envDuration("CHAT_IMPORT_INTERVAL", 10*time.Minute)
+	slog.Info("chat import job starting", slog.Duration("interval", interval), slog.String("channel", channel))
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := importNextVOD(ctx, dbx, channel); err != nil && !errors.Is(err, sql.ErrNoRows) {
+			slog.Warn("chat import job", slog.String("channel", channel), slog.Any("err", err))
+		}
+		select {
+		case <-ctx.Done():
+			slog.Info("chat import job stopped", slog.String("channel", channel))
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// importNextVOD imports the newest published VOD of channel without chat or a
+// previous import attempt. It returns sql.ErrNoRows when there is none.
+func importNextVOD(ctx context.Context, dbx *sql.DB, channel string) error {
+	var vodID string
+	if err := dbx.QueryRowContext(ctx, `SELECT v.twitch_vod_id FROM vods v
+		WHERE v.channel=$1 AND v.twitch_vod_id NOT LIKE 'live-%'
+			AND NOT EXISTS (SELECT 1 FROM chat_imports i WHERE i.vod_id = v.twitch_vod_id)
+			AND NOT EXISTS (SELECT 1 FROM chat_messages m WHERE m.vod_id = v.twitch_vod_id)
+		ORDER BY v.date DESC LIMIT 1`, channel).Scan(&vodID); err != nil {
+		return err
+	}
+	job, err := claimImport(ctx, dbx, vodID, "twitch")
+	if err != nil {
+		return err
+	}
+	return job.run(ctx, NewTwitchCommentSource(nil, vodID))
+}
@@ -0,0 +1,137 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/onnwee/vod-tender/backend/testutil"
+)
+
+const twitchDownloaderFile = `{
+  "FileInfo": {"Version": {"Major": 1}},
+  "streamer": {"name": "chan", "id": 1},
+  "video": {"id": "999", "start": 0, "end": 3600},
+  "comments": [
+    {"_id": "a1", "created_at": "2024-10-15T14:30:01Z", "content_offset_seconds": 1,
+     "commenter": {"display_name": "Viewer", "_id": "42", "name": "viewer"},
+     "message": {"body": "hi Kappa", "bits_spent": 0,
+       "fragments": [{"text": "hi ", "emoticon": null}, {"text": "Kappa", "emoticon": {"emoticon_id": "25"}}],
+       "user_badges": [{"_id": "subscriber", "version": "12"}, {"_id": "bits", "version": "100"}], "user_color": "#FF0000"}},
+    {"_id": "a2", "created_at": "2024-10-15T14:30:05Z", "content_offset_seconds": 5,
+     "commenter": {"display_name": "Other", "_id": "43", "name": "other"},
+     "message": {"body": "cheer100 gg", "bits_spent": 100, "fragments": [], "user_badges": []}}
+  ],
+  "embeddedData": null
+}`
+
+func TestTwitchDownloaderSource(t *testing.T) {
+	src := NewTwitchDownloaderSource(strings.NewReader(twitchDownloaderFile))
+	ctx := context.Background()
+	page, err := src.Next(ctx)
+	if err != nil {
+		t.Fatalf("Next() error = %v", err)
+	}
+	if len(page) != 2 {
+		t.Fatalf("comments = %+v", page)
+	}
+	c := page[0]
+	if c.ID != "a1" || c.Username != "viewer" || c.Text != "hi Kappa" || c.Offset != 1 || c.Badges["subscriber"] != "12" {
+		t.Fatalf("first comment = %+v", c)
+	}
+	if len(c.EmotePositions) != 1 || c.EmotePositions[0] != (EmotePosition{ID: "25", Name: "Kappa", Start: 3, End: 7}) {
+		t.Fatalf("emote positions = %+v", c.EmotePositions)
+	}
+	if page[1].Text != "cheer100 gg" || page[1].Bits != 100 {
+		t.Fatalf("second comment = %+v", page[1])
+	}
+	if _, err := src.Next(ctx); !errors.Is(err, io.EOF) {
+		t.Fatalf("Next() after last page = %v, want io.EOF", err)
+	}
+}
+
+func TestTwitchDownloaderSourceRejectsFileWithoutComments(t *testing.T) {
+	if _, err := NewTwitchDownloaderSource(strings.NewReader(`{"video": {}}`)).Next(context.Background()); err == nil || errors.Is(err, io.EOF) {
+		t.Fatalf("Next() = %v, want an error", err)
+	}
+}
+
+func TestCommentRow(t *testing.T) {
+	start := time.Date(2024, 10, 15, 14, 0, 0, 0, time.UTC)
+	row := commentRow(Comment{
+		ID: "x", Username: "viewer", Text: "Kappa Kappa", Offset: 90,
+		Badges:         map[string]string{"subscriber": "12", "bits": "100"},
+		EmotePositions: []EmotePosition{{ID: "25", Name: "Kappa", Start: 0, End: 4}, {ID: "25", Name: "Kappa", Start: 6, End: 10}},
+	}, start)
+	if !row.abs.Equal(start.Add(90*time.Second)) || row.rel != 90 {
+		t.Fatalf("timestamps = %v / %v", row.abs, row.rel)
+	}
+	if row.badges != "bits:100,subscriber:12," || row.emotes != "Kappa," || row.messageID != "x" {
+		t.Fatalf("row = %+v", row)
+	}
+}
+
+// pagedSource serves fixed pages of comments.
+type pagedSource struct {
+	pages [][]Comment
+}
+
+func (s *pagedSource) Next(context.Context) ([]Comment, error) {
+	if len(s.pages) == 0 {
+		return nil, io.EOF
+	}
+	p := s.pages[0]
+	s.pages = s.pages[1:]
+	return p, nil
+}
+
+func TestImportDeduplicatesByMessageID(t *testing.T) {
+	db := testutil.SetupTestDB(t)
+	ctx := context.Background()
+	channel := "test_chat_import"
+	vodID := "import-vod-1"
+	t.Cleanup(func() {
+		_, _ = db.ExecContext(context.Background(), `DELETE FROM chat_messages WHERE channel=$1`, channel)
+		_, _ = db.ExecContext(context.Background(), `DELETE FROM vods WHERE channel=$1`, channel)
+	})
+	start := time.Date(2024, 10, 15, 14, 0, 0, 0, time.UTC)
+	if _, err := db.ExecContext(ctx, `INSERT INTO vods (channel, twitch_vod_id, title, date, duration_seconds, created_at) VALUES ($1,$2,'Import',$3,100,NOW())`, channel, vodID, start); err != nil {
+		t.Fatal(err)
+	}
+	comments := func() *pagedSource {
+		return &pagedSource{pages: [][]Comment{
+			{{ID: vodID + "-1", Username: "a", Text: "first", Offset: 10}, {ID: vodID + "-2", Username: "b", Text: "second", Offset: 20}},
+			{{ID: vodID + "-3", Username: "a", Text: "third", Offset: 50}},
+		}}
+	}
+	for run, want := range []struct{ imported, duplicates int64 }{{3, 0}, {0, 3}} {
+		job, err := claimImport(ctx, db, vodID, "test")
+		if err != nil {
+			t.Fatalf("run %d: claim: %v", run, err)
+		}
+		if _, err := claimImport(ctx, db, vodID, "test"); !errors.Is(err, ErrImportRunning) {
+			t.Fatalf("run %d: second claim = %v, want ErrImportRunning", run, err)
+		}
+		if err := job.run(ctx, comments()); err != nil {
+			t.Fatalf("run %d: %v", run, err)
+		}
+		st, err := LoadImport(ctx, db, vodID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if st.State != ImportDone || st.Imported != want.imported || st.Duplicates != want.duplicates || st.OffsetSeconds != 50 || st.Progress != 1 {
+			t.Fatalf("run %d: status = %+v", run, st)
+		}
+	}
+	var n int
+	var rel float64
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*), MAX(rel_timestamp) FROM chat_messages WHERE vod_id=$1`, vodID).Scan(&n, &rel); err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 || rel != 50 {
+		t.Fatalf("stored %d messages (max rel %v), want 3 (50)", n, rel)
+	}
+}
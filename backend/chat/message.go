@@ -0,0 +1,80 @@
+package chat
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	twitch "github.com/gempir/go-twitch-irc/v4"
+)
+
+// EmotePosition is one emote occurrence in a message. Start and End are inclusive
+// code point offsets, as in the IRC emotes tag.
+type EmotePosition struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+}
+
+// messageRow is a PRIVMSG as stored in chat_messages.
+type messageRow struct {
+	abs            time.Time
+	tags           map[string]string
+	username       string
+	text           string
+	badges         string
+	emotes         string
+	color          string
+	messageID      string
+	userID         string
+	displayName    string
+	replyParentID  string
+	replyUsername  string
+	replyMessage   string
+	emotePositions []EmotePosition
+	rel            float64
+	bits           int
+	firstMessage   bool
+}
+
+func newMessageRow(msg twitch.PrivateMessage, abs, vodStart time.Time) messageRow {
+	row := messageRow{
+		abs:            abs,
+		rel:            abs.Sub(vodStart).Seconds(),
+		tags:           msg.Tags,
+		username:       msg.User.Name,
+		displayName:    msg.User.DisplayName,
+		userID:         msg.User.ID,
+		text:           msg.Message,
+		color:          msg.User.Color,
+		messageID:      msg.ID,
+		bits:           msg.Bits,
+		firstMessage:   msg.FirstMessage,
+		emotePositions: emotePositions(msg.Emotes),
+	}
+	for k, v := range msg.User.Badges {
+		row.badges += k + ":" + fmt.Sprintf("%v", v) + ","
+	}
+	for _, e := range msg.Emotes {
+		row.emotes += e.Name + ","
+	}
+	if msg.Reply != nil {
+		row.replyParentID = msg.Reply.ParentMsgID
+		row.replyUsername = msg.Reply.ParentUserLogin
+		row.replyMessage = msg.Reply.ParentMsgBody
+	}
+	return row
+}
+
+// emotePositions flattens the parsed emotes tag into occurrences ordered by position.
+func emotePositions(emotes []*twitch.Emote) []EmotePosition {
+	var out []EmotePosition
+	for _, e := range emotes {
+		for _, p := range e.Positions {
+			out = append(out, EmotePosition{ID: e.ID, Name: e.Name, Start: p.Start, End: p.End})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Start < out[j].Start })
+	return out
+}
@@ -0,0 +1,38 @@
+package chat
+
+import (
+	"testing"
+	"time"
+
+	twitch "github.com/gempir/go-twitch-irc/v4"
+)
+
+func TestNewMessageRowKeepsTags(t *testing.T) {
+	line := `@badge-info=;badges=moderator/1;bits=100;color=#FF0000;display-name=Alice;emotes=25:0-4,12-16/1902:6-10;first-msg=1;id=msg-1;` +
+		`reply-parent-display-name=Bob;reply-parent-msg-body=hi\sthere;reply-parent-msg-id=parent-1;reply-parent-user-id=42;reply-parent-user-login=bob;` +
+		`room-id=1;tmi-sent-ts=1700000000000;user-id=99 :alice!alice@alice.tmi.twitch.tv PRIVMSG #chan :Kappa Keepo Kappa`
+	msg, ok := twitch.ParseMessage(line).(*twitch.PrivateMessage)
+	if !ok {
+		t.Fatalf("not a PRIVMSG")
+	}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	row := newMessageRow(*msg, start.Add(90*time.Second), start)
+	if row.messageID != "msg-1" || row.userID != "99" || row.displayName != "Alice" || row.bits != 100 || !row.firstMessage || row.rel != 90 {
+		t.Fatalf("row = %+v", row)
+	}
+	if row.replyParentID != "parent-1" || row.replyUsername != "bob" || row.replyMessage != "hi there" {
+		t.Fatalf("reply = %q %q %q", row.replyParentID, row.replyUsername, row.replyMessage)
+	}
+	want := []EmotePosition{{"25", "Kappa", 0, 4}, {"1902", "Keepo", 6, 10}, {"25", "Kappa", 12, 16}}
+	if len(row.emotePositions) != len(want) {
+		t.Fatalf("emote positions = %+v", row.emotePositions)
+	}
+	for i, p := range want {
+		if row.emotePositions[i] != p {
+			t.Fatalf("emote position %d = %+v, want %+v", i, row.emotePositions[i], p)
+		}
+	}
+	if row.tags["user-id"] != "99" || row.badges != "moderator:1," {
+		t.Fatalf("tags = %v, badges = %q", row.tags, row.badges)
+	}
+}
@@ -0,0 +1,319 @@
+package chat
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	twitch "github.com/gempir/go-twitch-irc/v4"
+
+	"github.com/onnwee/vod-tender/backend/telemetry"
+)
+
+const (
+	defaultChatBufferSize    = 5000
+	defaultChatBatchSize     = 200
+	defaultChatFlushInterval = time.Second
+
+	// chatMessageCols is the number of parameters insertMessages binds per row.
+	chatMessageCols = 19
+	// maxChatInsertRows keeps one INSERT within Postgres' 65535 bind parameters.
+	maxChatInsertRows = 65535 / chatMessageCols
+)
+
+// chatItem is one queued IRC line: a message or an event. Both travel through the
+// same queue so a moderation event is applied after the message it removes is stored.
+type chatItem struct {
+	msg *messageRow
+	ev  *Event
+}
+
+// recorder buffers one channel's chat for a VOD in memory, writes it in batches and
+// tracks connection gaps. The hub's IRC callbacks only enqueue; run does all database work.
+type recorder struct {
+	vodStart time.Time
+	dbx      *sql.DB
+	items    chan chatItem
+	// flushMessages and recordEvent are the database writes (replaced in tests).
+	flushMessages func(ctx context.Context, rows []messageRow) error
+	recordEvent   func(ctx context.Context, ev Event)
+	channel       string
+	vodID         string
+	batchSize     int
+	flushEvery    time.Duration
+	// account is the oauth_tokens channel whose twitch token reads this chat ("" for the default).
+	account string
+
+	mu      sync.Mutex
+	gapID   int64
+	dropped int
+}
+
+func newRecorder(dbx *sql.DB, channel, vodID string, vodStart time.Time) *recorder {
+	r := &recorder{
+		dbx:        dbx,
+		channel:    channel,
+		vodID:      vodID,
+		vodStart:   vodStart,
+		items:      make(chan chatItem, envInt("CHAT_BUFFER_SIZE", defaultChatBufferSize)),
+		batchSize:  min(envInt("CHAT_BATCH_SIZE", defaultChatBatchSize), maxChatInsertRows),
+		flushEvery: envDuration("CHAT_FLUSH_INTERVAL", defaultChatFlushInterval),
+	}
+	r.flushMessages = func(ctx context.Context, rows []messageRow) error {
+		_, err := insertMessages(ctx, dbx, channel, vodID, rows)
+		return err
+	}
+	r.recordEvent = func(ctx context.Context, ev Event) {
+		recordEvent(ctx, dbx, channel, vodID, ev)
+	}
+	return r
+}
+
+func envInt(key string, def int) int {
+	if n, err := strconv.Atoi(os.Getenv(key)); err == nil && n > 0 {
+		return n
+	}
+	return def
+}
+
+func envDuration(key string, def time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(key)); err == nil && d > 0 {
+		return d
+	}
+	return def
+}
+
+// enqueue never blocks the IRC read loop: when the buffer is full (the database is
+// down or too slow) the item is dropped and counted.
+func (r *recorder) enqueue(it chatItem) {
+	select {
+	case r.items <- it:
+	default:
+		r.mu.Lock()
+		r.dropped++
+		n := r.dropped
+		r.mu.Unlock()
+		if n == 1 || n%1000 == 0 {
+			slog.Warn("chat buffer full; dropping messages", slog.String("vod_id", r.vodID), slog.Int("dropped", n), slog.Int("capacity", cap(r.items)))
+		}
+	}
+}
+
+func (r *recorder) onMessage(msg twitch.PrivateMessage) {
+	now := time.Now().UTC()
+	row := newMessageRow(msg, now, r.vodStart)
+	r.enqueue(chatItem{msg: &row})
+	if msg.Bits > 0 {
+		r.onEvent(Event{Type: EventCheer, Username: msg.User.Name, Message: msg.Message, Amount: msg.Bits, Tags: msg.Tags})
+	}
+}
+
+func (r *recorder) onEvent(ev Event) {
+	ev.AbsTimestamp = time.Now().UTC()
+	ev.RelTimestamp = ev.AbsTimestamp.Sub(r.vodStart).Seconds()
+	r.enqueue(chatItem{ev: &ev})
+}
+
+// run writes queued items until ctx is done, then drains what is left in the buffer.
+// Messages are flushed when batchSize accumulate, every flushEvery, and before any event.
+func (r *recorder) run(ctx context.Context) {
+	batch := make([]messageRow, 0, r.batchSize)
+	flush := func(ctx context.Context) {
+		if len(batch) == 0 {
+			return
+		}
+		r.flush(ctx, batch)
+		batch = batch[:0]
+	}
+	handle := func(ctx context.Context, it chatItem) {
+		if it.msg != nil {
+			batch = append(batch, *it.msg)
+			if len(batch) >= r.batchSize {
+				flush(ctx)
+			}
+			return
+		}
+		flush(ctx)
+		r.recordEvent(ctx, *it.ev)
+	}
+	ticker := time.NewTicker(r.flushEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case it := <-r.items:
+			handle(ctx, it)
+		case <-ticker.C:
+			flush(ctx)
+		case <-ctx.Done():
+			drainCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+			defer cancel()
+			for {
+				select {
+				case it := <-r.items:
+					handle(drainCtx, it)
+				default:
+					flush(drainCtx)
+					return
+				}
+			}
+		}
+	}
+}
+
+// flush writes one batch, retrying twice. A batch that still fails is written row by row
+// so one bad message does not lose the others; rows that fail alone are logged and dropped
+// so a database outage cannot grow memory beyond the buffer.
+func (r *recorder) flush(ctx context.Context, rows []messageRow) {
+	var err error
+	for attempt := 0; attempt < 3; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Duration(attempt) * time.Second):
+			}
+		}
+		if err = r.flushMessages(ctx, rows); err == nil {
+			if telemetry.ChatMessagesRecorded != nil {
+				telemetry.ChatMessagesRecorded.WithLabelValues(r.channel).Add(float64(len(rows)))
+			}
+			return
+		}
+	}
+	failed := len(rows)
+	if len(rows) > 1 && ctx.Err() == nil {
+		failed = 0
+		for i := range rows {
+			if rowErr := r.flushMessages(ctx, rows[i:i+1]); rowErr != nil {
+				failed++
+				err = rowErr
+			}
+		}
+		if telemetry.ChatMessagesRecorded != nil {
+			telemetry.ChatMessagesRecorded.WithLabelValues(r.channel).Add(float64(len(rows) - failed))
+		}
+		if failed == 0 {
+			return
+		}
+	}
+	slog.Error("failed to insert chat messages", slog.String("vod_id", r.vodID), slog.Int("count", failed), slog.Any("err", err))
+}
+
+// Gap is an interval in which the recorder had no IRC connection, so missing chat
+// is an outage rather than silence. EndAbs and EndRel are nil while the gap is open.
+type Gap struct {
+	StartAbs time.Time  `json:"start_abs"`
+	EndAbs   *time.Time `json:"end_abs,omitempty"`
+	EndRel   *float64   `json:"end_rel,omitempty"`
+	Reason   string     `json:"reason,omitempty"`
+	StartRel float64    `json:"start_rel"`
+}
+
+func (r *recorder) openGap(ctx context.Context, start time.Time, reason string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.gapID != 0 || r.dbx == nil {
+		return
+	}
+	if err := r.dbx.QueryRowContext(ctx, `INSERT INTO chat_gaps (vod_id, channel, start_abs, start_rel, reason) VALUES ($1,$2,$3,$4,$5) RETURNING id`,
+		r.vodID, r.channel, start, start.Sub(r.vodStart).Seconds(), reason).Scan(&r.gapID); err != nil {
+		slog.Warn("failed to record chat gap", slog.String("vod_id", r.vodID), slog.Any("err", err))
+	}
+}
+
+func (r *recorder) closeGap(ctx context.Context) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.gapID == 0 || r.dbx == nil {
+		return
+	}
+	now := time.Now().UTC()
+	if _, err := r.dbx.ExecContext(ctx, `UPDATE chat_gaps SET end_abs=$2, end_rel=$3 WHERE id=$1`, r.gapID, now, now.Sub(r.vodStart).Seconds()); err != nil {
+		slog.Warn("failed to close chat gap", slog.String("vod_id", r.vodID), slog.Any("err", err))
+	}
+	r.gapID = 0
+}
+
+// ListGaps returns a VOD's recorded connection gaps in time order.
+func ListGaps(ctx context.Context, dbx *sql.DB, vodID string) ([]Gap, error) {
+	rows, err := dbx.QueryContext(ctx, `SELECT start_abs, end_abs, start_rel, end_rel, COALESCE(reason,'') FROM chat_gaps WHERE vod_id=$1 ORDER BY start_abs`, vodID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			slog.Warn("failed to close rows", slog.Any("err", err))
+		}
+	}()
+	out := []Gap{}
+	for rows.Next() {
+		var g Gap
+		if err := rows.Scan(&g.StartAbs, &g.EndAbs, &g.StartRel, &g.EndRel, &g.Reason); err != nil {
+			return nil, err
+		}
+		out = append(out, g)
+	}
+	return out, rows.Err()
+}
+
+// insertMessages writes rows with multi-row INSERTs of at most maxChatInsertRows rows and
+// returns how many were stored. Message ids already stored (a line seen twice across a
+// reconnect, or an imported message) are skipped.
+func insertMessages(ctx context.Context, dbx *sql.DB, channel, vodID string, rows []messageRow) (int64, error) {
+	var total int64
+	for len(rows) > 0 {
+		n := min(len(rows), maxChatInsertRows)
+		stored, err := insertMessageChunk(ctx, dbx, channel, vodID, rows[:n])
+		total += stored
+		if err != nil {
+			return total, err
+		}
+		rows = rows[n:]
+	}
+	return total, nil
+}
+
+func insertMessageChunk(ctx context.Context, dbx *sql.DB, channel, vodID string, rows []messageRow) (int64, error) {
+	const cols = chatMessageCols
+	var sb strings.Builder
+	sb.WriteString(`INSERT INTO chat_messages (channel, vod_id, username, message, abs_timestamp, rel_timestamp, badges, emotes, color,
+		reply_to_id, reply_to_username, reply_to_message, message_id, user_id, display_name, emote_positions, bits, first_message, tags) VALUES `)
+	args := make([]any, 0, len(rows)*cols)
+	for i, m := range rows {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteByte('(')
+		for c := 1; c <= cols; c++ {
+			if c > 1 {
+				sb.WriteByte(',')
+			}
+			p := "$" + strconv.Itoa(i*cols+c)
+			if c == 13 || c == 14 {
+				p = "NULLIF(" + p + ",'')"
+			}
+			sb.WriteString(p)
+		}
+		sb.WriteByte(')')
+		tags, _ := json.Marshal(m.tags)
+		var positions []byte
+		if len(m.emotePositions) > 0 {
+			positions, _ = json.Marshal(m.emotePositions)
+		}
+		args = append(args, channel, vodID, m.username, m.text, m.abs, m.rel, m.badges, m.emotes, m.color,
+			m.replyParentID, m.replyUsername, m.replyMessage, m.messageID, m.userID, m.displayName, positions, m.bits, m.firstMessage, tags)
+	}
+	sb.WriteString(` ON CONFLICT (message_id) WHERE message_id IS NOT NULL DO NOTHING`)
+	//nolint:gosec // G202: only placeholders are generated, values are parameterized
+	res, err := dbx.ExecContext(ctx, sb.String(), args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,113 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSink records what a recorder writes, in order.
+type fakeSink struct {
+	mu      sync.Mutex
+	log     []string
+	batches int
+	fail    int
+	// reject fails every write that contains a message with this text.
+	reject string
+}
+
+func (f *fakeSink) attach(r *recorder) {
+	r.flushMessages = func(_ context.Context, rows []messageRow) error {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if f.fail > 0 {
+			f.fail--
+			return errors.New("db down")
+		}
+		for _, m := range rows {
+			if f.reject != "" && m.text == f.reject {
+				return errors.New("invalid byte sequence")
+			}
+		}
+		f.batches++
+		for _, m := range rows {
+			f.log = append(f.log, "msg:"+m.text)
+		}
+		return nil
+	}
+	r.recordEvent = func(_ context.Context, ev Event) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.log = append(f.log, "event:"+ev.Type)
+	}
+}
+
+func (f *fakeSink) snapshot() ([]string, int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.log...), f.batches
+}
+
+func testRecorder(buffer, batch int) (*recorder, *fakeSink) {
+	r := &recorder{channel: "chan", vodID: "v", vodStart: time.Now(), items: make(chan chatItem, buffer),
+		batchSize: batch, flushEvery: time.Hour}
+	sink := &fakeSink{}
+	sink.attach(r)
+	return r, sink
+}
+
+func TestRecorderBatchesAndOrdersEvents(t *testing.T) {
+	r, sink := testRecorder(100, 3)
+	for _, text := range []string{"a", "b", "c", "d", "oops"} {
+		row := messageRow{text: text}
+		r.enqueue(chatItem{msg: &row})
+	}
+	r.enqueue(chatItem{ev: &Event{Type: EventDelete}})
+	r.enqueue(chatItem{msg: &messageRow{text: "e"}})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r.run(ctx) // drains the buffer and returns
+	got, batches := sink.snapshot()
+	want := "msg:a msg:b msg:c msg:d msg:oops event:delete msg:e"
+	if strings.Join(got, " ") != want || batches != 3 {
+		t.Fatalf("writes = %v (%d batches), want %s", got, batches, want)
+	}
+}
+
+func TestRecorderDropsWhenBufferFull(t *testing.T) {
+	r, _ := testRecorder(2, 10)
+	for i := 0; i < 5; i++ {
+		r.enqueue(chatItem{msg: &messageRow{}})
+	}
+	if len(r.items) != 2 || r.dropped != 3 {
+		t.Fatalf("buffered %d, dropped %d", len(r.items), r.dropped)
+	}
+}
+
+func TestRecorderFallsBackToSingleRows(t *testing.T) {
+	r, sink := testRecorder(10, 10)
+	sink.reject = "bad"
+	r.flush(context.Background(), []messageRow{{text: "a"}, {text: "bad"}, {text: "b"}})
+	if got, _ := sink.snapshot(); strings.Join(got, " ") != "msg:a msg:b" {
+		t.Fatalf("writes = %v, want the rows around the bad one", got)
+	}
+}
+
+func TestRecorderClampsBatchSize(t *testing.T) {
+	t.Setenv("CHAT_BATCH_SIZE", "100000")
+	if r := newRecorder(nil, "chan", "v", time.Now()); r.batchSize != maxChatInsertRows {
+		t.Fatalf("batch size = %d, want %d", r.batchSize, maxChatInsertRows)
+	}
+}
+
+func TestRecorderRetriesFailedBatch(t *testing.T) {
+	r, sink := testRecorder(10, 10)
+	sink.fail = 1
+	r.flush(context.Background(), []messageRow{{text: "x"}})
+	if got, _ := sink.snapshot(); len(got) != 1 {
+		t.Fatalf("writes after retry = %v", got)
+	}
+}
@@ -0,0 +1,189 @@
+// Package search runs full-text queries over the chat archive. Messages are
+// matched against the message_tsv column (to_tsvector('simple', message), GIN
+// indexed), newest first, with keyset pagination on (abs_timestamp, id).
+package search
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultLimit is the page size when Query.Limit is zero.
+	DefaultLimit = 50
+	// MaxLimit caps Query.Limit.
+	MaxLimit = 200
+)
+
+var (
+	// ErrEmptyQuery is returned when Query.Text is blank.
+	ErrEmptyQuery = errors.New("search text required")
+	// ErrInvalidCursor is returned for a cursor not produced by a previous page.
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+// Query is a search request. Text uses websearch syntax: quoted phrases, OR and -exclusions.
+type Query struct {
+	Since    time.Time
+	Until    time.Time
+	Text     string
+	Channel  string
+	Username string
+	VodID    string
+	Cursor   string
+	Limit    int
+}
+
+// Hit is one matching message.
+type Hit struct {
+	AbsTimestamp time.Time `json:"abs_timestamp"`
+	VodID        string    `json:"vod_id"`
+	VodTitle     string    `json:"vod_title"`
+	Channel      string    `json:"channel"`
+	Username     string    `json:"username"`
+	Message      string    `json:"message"`
+	// YouTubeURL links to the uploaded video at the message's time (the matching part for split VODs).
+	YouTubeURL   string  `json:"youtube_url,omitempty"`
+	ID           int64   `json:"id"`
+	RelTimestamp float64 `json:"rel_timestamp"`
+}
+
+// Page is one page of hits; NextCursor is empty on the last page.
+type Page struct {
+	NextCursor string `json:"next_cursor,omitempty"`
+	Hits       []Hit  `json:"results"`
+}
+
+// Search runs q against chat_messages.
+func Search(ctx context.Context, db *sql.DB, q Query) (Page, error) {
+	text := strings.TrimSpace(q.Text)
+	if text == "" {
+		return Page{}, ErrEmptyQuery
+	}
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	limit = min(limit, MaxLimit)
+
+	args := []any{text}
+	where := []string{`c.message_tsv @@ websearch_to_tsquery('simple', $1)`, `c.abs_timestamp IS NOT NULL`}
+	add := func(cond string, v any) {
+		args = append(args, v)
+		where = append(where, strings.ReplaceAll(cond, "?", "$"+strconv.Itoa(len(args))))
+	}
+	if q.Channel != "" {
+		add(`c.channel = ?`, q.Channel)
+	}
+	if q.Username != "" {
+		add(`LOWER(c.username) = LOWER(?)`, q.Username)
+	}
+	if q.VodID != "" {
+		add(`c.vod_id = ?`, q.VodID)
+	}
+	if !q.Since.IsZero() {
+		add(`c.abs_timestamp >= ?`, q.Since)
+	}
+	if !q.Until.IsZero() {
+		add(`c.abs_timestamp < ?`, q.Until)
+	}
+	if q.Cursor != "" {
+		ts, id, err := decodeCursor(q.Cursor)
+		if err != nil {
+			return Page{}, err
+		}
+		args = append(args, ts, id)
+		n := len(args)
+		where = append(where, fmt.Sprintf(`(c.abs_timestamp, c.id) < ($%d, $%d)`, n-1, n))
+	}
+	args = append(args, limit+1)
+	//nolint:gosec // G202: conditions are fixed fragments, values are parameterized
+	query := `SELECT c.id, c.vod_id, COALESCE(v.title,''), c.channel, COALESCE(c.username,''), COALESCE(c.message,''),
+		c.abs_timestamp, COALESCE(c.rel_timestamp,0), COALESCE(v.youtube_url,''), COALESCE(p.upload_url,''), COALESCE(p.start_time,0)
+	FROM chat_messages c
+	JOIN vods v ON v.twitch_vod_id = c.vod_id
+	LEFT JOIN LATERAL (
+		SELECT s.upload_url, s.start_time FROM vod_segments s
+		WHERE s.vod_id = c.vod_id AND s.type = 'part' AND s.upload_status = 'succeeded'
+			AND c.rel_timestamp >= s.start_time AND c.rel_timestamp < s.end_time
+		ORDER BY s.start_time LIMIT 1
+	) p ON TRUE
+	WHERE ` + strings.Join(where, " AND ") + `
+	ORDER BY c.abs_timestamp DESC, c.id DESC
+	LIMIT $` + strconv.Itoa(len(args))
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return Page{}, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			slog.Warn("failed to close rows", slog.Any("err", err))
+		}
+	}()
+	page := Page{Hits: []Hit{}}
+	for rows.Next() {
+		var h Hit
+		var vodURL, partURL string
+		var partStart float64
+		if err := rows.Scan(&h.ID, &h.VodID, &h.VodTitle, &h.Channel, &h.Username, &h.Message,
+			&h.AbsTimestamp, &h.RelTimestamp, &vodURL, &partURL, &partStart); err != nil {
+			return Page{}, err
+		}
+		if partURL != "" {
+			h.YouTubeURL = DeepLink(partURL, h.RelTimestamp-partStart)
+		} else if vodURL != "" {
+			h.YouTubeURL = DeepLink(vodURL, h.RelTimestamp)
+		}
+		page.Hits = append(page.Hits, h)
+	}
+	if err := rows.Err(); err != nil {
+		return Page{}, err
+	}
+	if len(page.Hits) > limit {
+		page.Hits = page.Hits[:limit]
+		last := page.Hits[limit-1]
+		page.NextCursor = encodeCursor(last.AbsTimestamp, last.ID)
+	}
+	return page, nil
+}
+
+// DeepLink adds a t=<seconds>s parameter to a YouTube URL.
+func DeepLink(videoURL string, seconds float64) string {
+	u, err := url.Parse(videoURL)
+	if err != nil {
+		return videoURL
+	}
+	q := u.Query()
+	q.Set("t", strconv.Itoa(int(max(seconds, 0)))+"s")
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+func encodeCursor(ts time.Time, id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(ts.UnixNano(), 10) + ":" + strconv.FormatInt(id, 10)))
+}
+
+func decodeCursor(s string) (time.Time, int64, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return time.Time{}, 0, ErrInvalidCursor
+	}
+	tsPart, idPart, ok := strings.Cut(string(b), ":")
+	if !ok {
+		return time.Time{}, 0, ErrInvalidCursor
+	}
+	ns, err1 := strconv.ParseInt(tsPart, 10, 64)
+	id, err2 := strconv.ParseInt(idPart, 10, 64)
+	if err1 != nil || err2 != nil {
+		return time.Time{}, 0, ErrInvalidCursor
+	}
+	return time.Unix(0, ns).UTC(), id, nil
+}
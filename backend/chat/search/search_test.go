@@ -0,0 +1,96 @@
+package search
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+
+	dbpkg "github.com/onnwee/vod-tender/backend/db"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	ts := time.Date(2024, 5, 1, 12, 0, 0, 123456000, time.UTC)
+	gotTS, gotID, err := decodeCursor(encodeCursor(ts, 42))
+	if err != nil || !gotTS.Equal(ts) || gotID != 42 {
+		t.Fatalf("decodeCursor = %v, %d, %v", gotTS, gotID, err)
+	}
+	for _, bad := range []string{"!!", "bm9jb2xvbg", "YTpi"} {
+		if _, _, err := decodeCursor(bad); !errors.Is(err, ErrInvalidCursor) {
+			t.Fatalf("decodeCursor(%q) = %v", bad, err)
+		}
+	}
+}
+
+func TestDeepLink(t *testing.T) {
+	if got := DeepLink("https://www.youtube.com/watch?v=abc", 3725.9); got != "https://www.youtube.com/watch?t=3725s&v=abc" {
+		t.Fatalf("DeepLink = %s", got)
+	}
+	if got := DeepLink("https://youtu.be/abc", -3); got != "https://youtu.be/abc?t=0s" {
+		t.Fatalf("DeepLink = %s", got)
+	}
+}
+
+func TestSearchRequiresText(t *testing.T) {
+	if _, err := Search(context.Background(), nil, Query{Text: "  "}); !errors.Is(err, ErrEmptyQuery) {
+		t.Fatalf("expected ErrEmptyQuery, got %v", err)
+	}
+}
+
+func TestSearchPaginates(t *testing.T) {
+	dsn := os.Getenv("TEST_PG_DSN")
+	if dsn == "" {
+		t.Skip("TEST_PG_DSN not set")
+	}
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = db.Close() }()
+	ctx := context.Background()
+	if err := dbpkg.Migrate(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+	vodID := "search_test_1"
+	if _, err := db.ExecContext(ctx, `INSERT INTO vods (channel, twitch_vod_id, title, date, youtube_url, created_at)
+		VALUES ('searchchan', $1, 'Search', NOW(), 'https://www.youtube.com/watch?v=vid', NOW()) ON CONFLICT (twitch_vod_id) DO NOTHING`, vodID); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_, _ = db.Exec(`DELETE FROM chat_messages WHERE vod_id=$1`, vodID)
+		_, _ = db.Exec(`DELETE FROM vods WHERE twitch_vod_id=$1`, vodID)
+	})
+	_, _ = db.ExecContext(ctx, `DELETE FROM chat_messages WHERE vod_id=$1`, vodID)
+	base := time.Now().Add(-time.Hour).UTC()
+	msgs := []string{"that was a zebraquokka moment", "nothing here", "ZEBRAQUOKKA again", "zebraquokka three"}
+	for i, m := range msgs {
+		if _, err := db.ExecContext(ctx, `INSERT INTO chat_messages (vod_id, channel, username, message, abs_timestamp, rel_timestamp)
+			VALUES ($1, 'searchchan', 'viewer', $2, $3, $4)`, vodID, m, base.Add(time.Duration(i)*time.Minute), float64(i*60)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	page, err := Search(ctx, db, Query{Text: "zebraquokka", Channel: "searchchan", Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Hits) != 2 || page.NextCursor == "" || page.Hits[0].Message != "zebraquokka three" {
+		t.Fatalf("page 1 = %+v", page)
+	}
+	if page.Hits[0].YouTubeURL != "https://www.youtube.com/watch?t=180s&v=vid" {
+		t.Fatalf("deep link = %s", page.Hits[0].YouTubeURL)
+	}
+	page, err = Search(ctx, db, Query{Text: "zebraquokka", Channel: "searchchan", Limit: 2, Cursor: page.NextCursor})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Hits) != 1 || page.NextCursor != "" || page.Hits[0].RelTimestamp != 0 {
+		t.Fatalf("page 2 = %+v", page)
+	}
+	if page, _ := Search(ctx, db, Query{Text: "zebraquokka", Username: "someone-else"}); len(page.Hits) != 0 {
+		t.Fatalf("username filter ignored: %+v", page)
+	}
+}
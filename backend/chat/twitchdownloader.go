@@ -0,0 +1,159 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/onnwee/vod-tender/backend/twitchapi"
+)
+
+// twitchDownloaderPage is how many comments TwitchDownloaderSource decodes per Next.
+const twitchDownloaderPage = 500
+
+// TwitchDownloaderSource reads a chat JSON file written by TwitchDownloader
+// ({"video": {...}, "comments": [...]}). Comments are decoded as they are read,
+// so large files are never held in memory.
+type TwitchDownloaderSource struct {
+	r       io.Reader
+	dec     *json.Decoder
+	inArray bool
+	done    bool
+}
+
+// NewTwitchDownloaderSource reads a TwitchDownloader chat file from r. If r is an
+// io.Closer it is closed with the source.
+func NewTwitchDownloaderSource(r io.Reader) *TwitchDownloaderSource {
+	return &TwitchDownloaderSource{r: r, dec: json.NewDecoder(r)}
+}
+
+// Close closes the underlying reader when it is closable.
+func (s *TwitchDownloaderSource) Close() error {
+	if c, ok := s.r.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+type tdComment struct {
+	CreatedAt time.Time `json:"created_at"`
+	Commenter struct {
+		ID          string `json:"_id"`
+		Name        string `json:"name"`
+		DisplayName string `json:"display_name"`
+	} `json:"commenter"`
+	ID      string `json:"_id"`
+	Message struct {
+		Body      string `json:"body"`
+		UserColor string `json:"user_color"`
+		Fragments []struct {
+			Emoticon *struct {
+				EmoticonID string `json:"emoticon_id"`
+			} `json:"emoticon"`
+			Text string `json:"text"`
+		} `json:"fragments"`
+		UserBadges []struct {
+			ID      string `json:"_id"`
+			Version string `json:"version"`
+		} `json:"user_badges"`
+		BitsSpent int `json:"bits_spent"`
+	} `json:"message"`
+	ContentOffsetSeconds float64 `json:"content_offset_seconds"`
+}
+
+// Next returns the next page of comments.
+func (s *TwitchDownloaderSource) Next(_ context.Context) ([]Comment, error) {
+	if s.done {
+		return nil, io.EOF
+	}
+	if !s.inArray {
+		if err := s.seekComments(); err != nil {
+			return nil, err
+		}
+	}
+	var out []Comment
+	for len(out) < twitchDownloaderPage && s.dec.More() {
+		var tc tdComment
+		if err := s.dec.Decode(&tc); err != nil {
+			return nil, fmt.Errorf("decode comment: %w", err)
+		}
+		out = append(out, tc.comment())
+	}
+	if !s.dec.More() {
+		// Anything after the comments array (embedded emote data) is not needed.
+		s.done = true
+	}
+	if len(out) == 0 {
+		return nil, io.EOF
+	}
+	return out, nil
+}
+
+// seekComments advances the decoder to the first element of the comments array.
+func (s *TwitchDownloaderSource) seekComments() error {
+	tok, err := s.dec.Token()
+	if err != nil {
+		return fmt.Errorf("read chat file: %w", err)
+	}
+	if d, ok := tok.(json.Delim); !ok || d != '{' {
+		return errors.New("chat file is not a JSON object")
+	}
+	if err := s.skipTo("comments"); err != nil {
+		return err
+	}
+	tok, err = s.dec.Token()
+	if err != nil {
+		return fmt.Errorf("read comments: %w", err)
+	}
+	if d, ok := tok.(json.Delim); !ok || d != '[' {
+		return errors.New("chat file comments is not an array")
+	}
+	s.inArray = true
+	return nil
+}
+
+// skipTo reads top-level keys, skipping their values, until the decoder is before
+// the value of key.
+func (s *TwitchDownloaderSource) skipTo(key string) error {
+	for s.dec.More() {
+		tok, err := s.dec.Token()
+		if err != nil {
+			return fmt.Errorf("read chat file: %w", err)
+		}
+		if k, _ := tok.(string); k == key {
+			return nil
+		}
+		var skip json.RawMessage
+		if err := s.dec.Decode(&skip); err != nil {
+			return fmt.Errorf("read chat file: %w", err)
+		}
+	}
+	return fmt.Errorf("chat file has no %q array", key)
+}
+
+func (tc tdComment) comment() Comment {
+	c := Comment{ID: tc.ID, CreatedAt: tc.CreatedAt, Offset: tc.ContentOffsetSeconds, UserID: tc.Commenter.ID,
+		Username: tc.Commenter.Name, DisplayName: tc.Commenter.DisplayName, Color: tc.Message.UserColor, Bits: tc.Message.BitsSpent}
+	frags := make([]twitchapi.CommentFragment, 0, len(tc.Message.Fragments))
+	for _, f := range tc.Message.Fragments {
+		frag := twitchapi.CommentFragment{Text: f.Text}
+		if f.Emoticon != nil {
+			frag.EmoteID = f.Emoticon.EmoticonID
+		}
+		frags = append(frags, frag)
+	}
+	c.Text, c.EmotePositions = fragmentText(frags)
+	if len(frags) == 0 {
+		c.Text = tc.Message.Body
+	}
+	if len(tc.Message.UserBadges) > 0 {
+		c.Badges = make(map[string]string, len(tc.Message.UserBadges))
+		for _, b := range tc.Message.UserBadges {
+			c.Badges[b.ID] = b.Version
+		}
+	}
+	return c
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/onnwee/vod-tender/backend/vod"
+)
+
+// backend carries out vodctl commands, either through the HTTP API (apiClient) or
+// directly against the database (dbBackend).
+type backend interface {
+	ListVODs(ctx context.Context, q listQuery) ([]vodSummary, error)
+	InspectVOD(ctx context.Context, id string) (vodDetail, error)
+	Reprocess(ctx context.Context, id string) error
+	// Cancel reports whether a running download was cancelled.
+	Cancel(ctx context.Context, id string) (bool, error)
+	SetPriority(ctx context.Context, id string, priority int) error
+	SetSkipUpload(ctx context.Context, id string, skip bool) error
+	Scan(ctx context.Context, channel string) error
+	Catalog(ctx context.Context, channel string, maxCount, maxAgeDays int) error
+	Circuit(ctx context.Context, channel string) (vod.Circuit, error)
+	ExportChat(ctx context.Context, id, format string, w io.Writer) error
+	Retention(ctx context.Context, channel string) (vod.RetentionReport, error)
+}
+
+// listQuery selects a page of VODs. Channel only applies when ByChannel is set, since
+// the empty channel is a channel of its own.
+type listQuery struct {
+	Channel   string
+	Limit     int
+	Offset    int
+	ByChannel bool
+}
+
+// vodSummary is a VOD as listed by GET /vods.
+type vodSummary struct {
+	Date          time.Time  `json:"date"`
+	TwitchDeleted *time.Time `json:"twitch_deleted_at,omitempty"`
+	ID            string     `json:"id"`
+	Channel       string     `json:"channel"`
+	Title         string     `json:"title"`
+	YouTube       string     `json:"youtube_url"`
+	Status        string     `json:"status"`
+	Processed     bool       `json:"processed"`
+}
+
+// vodDetail is the part of GET /vods/{id} that vodctl shows.
+type vodDetail struct {
+	vodSummary
+	DownloadedPath  string                `json:"downloaded_path"`
+	DownloadState   string                `json:"download_state"`
+	ProcessingError string                `json:"processing_error,omitempty"`
+	StatusHistory   []vod.StateTransition `json:"status_history"`
+	Stages          []vod.StageResult     `json:"stages"`
+	Duration        int                   `json:"duration_seconds"`
+	DownloadRetries int                   `json:"download_retries"`
+	Priority        int                   `json:"priority"`
+	SkipUpload      bool                  `json:"skip_upload"`
+}
+
+// result is the outcome of a command that changes something.
+type result struct {
+	Channel *string `json:"channel,omitempty"`
+	Status  string  `json:"status"`
+	VodID   string  `json:"vod_id,omitempty"`
+	Message string  `json:"message"`
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/onnwee/vod-tender/backend/chat/export"
+	"github.com/onnwee/vod-tender/backend/config"
+	dbpkg "github.com/onnwee/vod-tender/backend/db"
+	"github.com/onnwee/vod-tender/backend/vod"
+)
+
+// errNeedsServer is returned in DB mode for commands that act on state held by the
+// server process.
+var errNeedsServer = errors.New("needs the running server; use -mode http")
+
+// dbBackend is the backend that works on the database directly, for use when the API
+// is unreachable. Scan and catalog call Twitch with the TWITCH_* credentials of the
+// environment, like the server does.
+type dbBackend struct {
+	db     *sql.DB
+	stderr io.Writer // warnings
+}
+
+// openDB connects to DB_DSN. The schema is expected to be migrated by the server.
+func openDB(ctx context.Context, stderr io.Writer) (*dbBackend, error) {
+	db, err := dbpkg.Connect()
+	if err != nil {
+		return nil, err
+	}
+	if err := db.PingContext(ctx); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("connect to database: %w", err)
+	}
+	return &dbBackend{db: db, stderr: stderr}, nil
+}
+
+func (d *dbBackend) Close() error { return d.db.Close() }
+
+// notFound gives sql.ErrNoRows the wording of the API.
+func notFound(id string, err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("vod %s not found", id)
+	}
+	return err
+}
+
+func (d *dbBackend) ListVODs(ctx context.Context, q listQuery) ([]vodSummary, error) {
+	if q.Limit <= 0 || q.Limit > 200 {
+		q.Limit = 50
+	}
+	rows, err := d.db.QueryContext(ctx, `
+        SELECT twitch_vod_id,
+               channel,
+               COALESCE(title, ''),
+               COALESCE(date, to_timestamp(0)),
+               COALESCE(processed, FALSE),
+               COALESCE(youtube_url, ''),
+               status,
+               twitch_deleted_at
+        FROM vods
+        WHERE $3 = FALSE OR channel = $4
+        ORDER BY COALESCE(date, to_timestamp(0)) DESC
+        LIMIT $1 OFFSET $2
+    `, q.Limit, q.Offset, q.ByChannel, q.Channel)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	list := []vodSummary{}
+	for rows.Next() {
+		var v vodSummary
+		if err := rows.Scan(&v.ID, &v.Channel, &v.Title, &v.Date, &v.Processed, &v.YouTube, &v.Status, &v.TwitchDeleted); err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+	}
+	return list, rows.Err()
+}
+
+func (d *dbBackend) InspectVOD(ctx context.Context, id string) (vodDetail, error) {
+	var v vodDetail
+	err := d.db.QueryRowContext(ctx, `
+        SELECT twitch_vod_id,
+               channel,
+               COALESCE(title, ''),
+               COALESCE(date, to_timestamp(0)),
+               COALESCE(duration_seconds, 0),
+               COALESCE(processed, FALSE),
+               COALESCE(youtube_url, ''),
+               COALESCE(downloaded_path, ''),
+               COALESCE(download_state, ''),
+               COALESCE(download_retries, 0),
+               status,
+               twitch_deleted_at,
+               COALESCE(priority, 0),
+               COALESCE(skip_upload, FALSE),
+               COALESCE(processing_error, '')
+        FROM vods WHERE twitch_vod_id=$1
+    `, id).Scan(&v.ID, &v.Channel, &v.Title, &v.Date, &v.Duration, &v.Processed, &v.YouTube,
+		&v.DownloadedPath, &v.DownloadState, &v.DownloadRetries, &v.Status, &v.TwitchDeleted,
+		&v.Priority, &v.SkipUpload, &v.ProcessingError)
+	if err != nil {
+		return v, notFound(id, err)
+	}
+	if v.StatusHistory, err = vod.StatusHistory(ctx, d.db, id); err != nil {
+		return v, err
+	}
+	if v.Stages, err = vod.LoadStageResults(ctx, d.db, id); err != nil {
+		return v, err
+	}
+	return v, nil
+}
+
+func (d *dbBackend) Reprocess(ctx context.Context, id string) error {
+	return notFound(id, vod.Reprocess(ctx, d.db, id))
+}
+
+func (d *dbBackend) Cancel(context.Context, string) (bool, error) {
+	return false, fmt.Errorf("cancel %w: downloads run inside the server", errNeedsServer)
+}
+
+func (d *dbBackend) SetPriority(ctx context.Context, id string, priority int) error {
+	return notFound(id, vod.SetPriority(ctx, d.db, id, priority))
+}
+
+func (d *dbBackend) SetSkipUpload(ctx context.Context, id string, skip bool) error {
+	return notFound(id, vod.SetSkipUpload(ctx, d.db, id, skip))
+}
+
+func (d *dbBackend) Scan(ctx context.Context, channel string) error {
+	return vod.DiscoverAndUpsert(ctx, d.db, defaultChannel(channel))
+}
+
+func (d *dbBackend) Catalog(ctx context.Context, channel string, maxCount, maxAgeDays int) error {
+	return vod.BackfillCatalog(ctx, d.db, defaultChannel(channel), maxCount, time.Duration(maxAgeDays)*24*time.Hour)
+}
+
+func (d *dbBackend) Circuit(ctx context.Context, channel string) (vod.Circuit, error) {
+	return vod.LoadCircuit(ctx, d.db, channel)
+}
+
+func (d *dbBackend) ExportChat(ctx context.Context, id, format string, w io.Writer) error {
+	f, err := export.ParseFormat(format)
+	if err != nil {
+		return err
+	}
+	var exists bool
+	if err := d.db.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM vods WHERE twitch_vod_id=$1)`, id).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return notFound(id, sql.ErrNoRows)
+	}
+	_, err = export.Write(ctx, d.db, w, id, f, export.Options{})
+	return err
+}
+
+func (d *dbBackend) Retention(ctx context.Context, channel string) (vod.RetentionReport, error) {
+	// Like the admin retention endpoint, an unreadable config source is not fatal: the
+	// settings come from the sources that could be read.
+	cfg, err := config.LoadChannelConfig(ctx, d.db, channel)
+	if err != nil {
+		fmt.Fprintf(d.stderr, "vodctl: warning: channel config: %v; using remaining sources\n", err)
+	}
+	return vod.PreviewRetention(ctx, d.db, channel, vod.RetentionPolicyFor(cfg))
+}
+
+// defaultChannel mirrors the admin scan and catalog endpoints, which fall back to
+// TWITCH_CHANNEL.
+func defaultChannel(channel string) string {
+	if channel == "" {
+		return os.Getenv("TWITCH_CHANNEL")
+	}
+	return channel
+}
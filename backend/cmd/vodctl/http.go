@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/onnwee/vod-tender/backend/vod"
+)
+
+// apiClient is the backend that calls the admin and VOD endpoints of a running server.
+type apiClient struct {
+	http     *http.Client
+	base     string
+	token    string
+	username string
+	password string
+}
+
+func newAPIClient(base, token, username, password string) *apiClient {
+	return &apiClient{
+		http:     &http.Client{},
+		base:     strings.TrimRight(base, "/"),
+		token:    token,
+		username: username,
+		password: password,
+	}
+}
+
+// do sends a request and decodes a JSON response into out (when non-nil). Responses
+// outside 2xx become errors carrying the server's message.
+func (c *apiClient) do(ctx context.Context, method, path string, query url.Values, body, out any) (int, error) {
+	resp, err := c.send(ctx, method, path, query, body)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if out != nil && resp.StatusCode != http.StatusNoContent {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp.StatusCode, fmt.Errorf("%s %s: decode response: %w", method, path, err)
+		}
+	}
+	return resp.StatusCode, nil
+}
+
+// send performs a request and returns the response if its status is 2xx.
+func (c *apiClient) send(ctx context.Context, method, path string, query url.Values, body any) (*http.Response, error) {
+	u := c.base + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	var rd io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		rd = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, rd)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	switch {
+	case c.token != "":
+		req.Header.Set("X-Admin-Token", c.token)
+	case c.username != "":
+		req.SetBasicAuth(c.username, c.password)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return resp, nil
+}
+
+func vodPath(id, tail string) string {
+	p := "/vods/" + url.PathEscape(id)
+	if tail != "" {
+		p += "/" + tail
+	}
+	return p
+}
+
+func (c *apiClient) ListVODs(ctx context.Context, q listQuery) ([]vodSummary, error) {
+	v := url.Values{"limit": {strconv.Itoa(q.Limit)}, "offset": {strconv.Itoa(q.Offset)}}
+	if q.ByChannel {
+		v.Set("channel", q.Channel)
+	}
+	var out []vodSummary
+	_, err := c.do(ctx, http.MethodGet, "/vods", v, nil, &out)
+	return out, err
+}
+
+func (c *apiClient) InspectVOD(ctx context.Context, id string) (vodDetail, error) {
+	var out vodDetail
+	_, err := c.do(ctx, http.MethodGet, vodPath(id, ""), nil, nil, &out)
+	return out, err
+}
+
+func (c *apiClient) Reprocess(ctx context.Context, id string) error {
+	_, err := c.do(ctx, http.MethodPost, vodPath(id, "reprocess"), nil, nil, nil)
+	return err
+}
+
+func (c *apiClient) Cancel(ctx context.Context, id string) (bool, error) {
+	code, err := c.do(ctx, http.MethodPost, vodPath(id, "cancel"), nil, nil, nil)
+	return code == http.StatusAccepted, err
+}
+
+func (c *apiClient) SetPriority(ctx context.Context, id string, priority int) error {
+	body := map[string]any{"vod_id": id, "priority": priority}
+	_, err := c.do(ctx, http.MethodPost, "/admin/vod/priority", nil, body, nil)
+	return err
+}
+
+func (c *apiClient) SetSkipUpload(ctx context.Context, id string, skip bool) error {
+	body := map[string]any{"vod_id": id, "skip_upload": skip}
+	_, err := c.do(ctx, http.MethodPost, "/admin/vod/skip-upload", nil, body, nil)
+	return err
+}
+
+func (c *apiClient) Scan(ctx context.Context, channel string) error {
+	_, err := c.do(ctx, http.MethodPost, "/admin/vod/scan", channelQuery(channel), nil, nil)
+	return err
+}
+
+func (c *apiClient) Catalog(ctx context.Context, channel string, maxCount, maxAgeDays int) error {
+	q := channelQuery(channel)
+	if maxCount > 0 {
+		q.Set("max", strconv.Itoa(maxCount))
+	}
+	if maxAgeDays > 0 {
+		q.Set("max_age_days", strconv.Itoa(maxAgeDays))
+	}
+	_, err := c.do(ctx, http.MethodPost, "/admin/vod/catalog", q, nil, nil)
+	return err
+}
+
+func (c *apiClient) Circuit(ctx context.Context, channel string) (vod.Circuit, error) {
+	var status struct {
+		State     string `json:"circuit_state"`
+		Failures  string `json:"circuit_failures"`
+		OpenUntil string `json:"circuit_open_until"`
+	}
+	_, err := c.do(ctx, http.MethodGet, "/status", url.Values{"channel": {channel}}, nil, &status)
+	return vod.Circuit{Channel: channel, State: status.State, Failures: status.Failures, OpenUntil: status.OpenUntil}, err
+}
+
+func (c *apiClient) ExportChat(ctx context.Context, id, format string, w io.Writer) error {
+	resp, err := c.send(ctx, http.MethodGet, vodPath(id, "chat/export"), url.Values{"format": {format}}, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+func (c *apiClient) Retention(ctx context.Context, channel string) (vod.RetentionReport, error) {
+	var out vod.RetentionReport
+	_, err := c.do(ctx, http.MethodGet, "/admin/retention", url.Values{"channel": {channel}}, nil, &out)
+	return out, err
+}
+
+// channelQuery passes channel to the admin endpoints, which use TWITCH_CHANNEL when
+// it is empty.
+func channelQuery(channel string) url.Values {
+	q := url.Values{}
+	if channel != "" {
+		q.Set("channel", channel)
+	}
+	return q
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/onnwee/vod-tender/backend/vod"
+)
+
+// fakeAPI serves canned responses and records the requests vodctl makes.
+type fakeAPI struct {
+	mu       sync.Mutex
+	requests []string // "METHOD /path?query body"
+	tokens   []string
+}
+
+func (f *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	f.mu.Lock()
+	f.requests = append(f.requests, strings.TrimSpace(r.Method+" "+r.URL.RequestURI()+" "+string(body)))
+	f.tokens = append(f.tokens, r.Header.Get("X-Admin-Token"))
+	f.mu.Unlock()
+	switch r.URL.Path {
+	case "/vods":
+		_ = json.NewEncoder(w).Encode([]vodSummary{
+			{ID: "111", Channel: "streamer1", Title: "Speedrun", Status: "uploaded", Date: time.Date(2024, 5, 1, 18, 0, 0, 0, time.UTC)},
+		})
+	case "/vods/111":
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"id": "111", "channel": "streamer1", "title": "Speedrun", "status": "failed", "priority": 5,
+			"processing_error": "disk full", "duration_seconds": 3600,
+			"stages": []map[string]any{{"stage": "download", "status": "failed", "attempts": 3, "error": "disk full"}},
+		})
+	case "/vods/404/reprocess":
+		http.NotFound(w, r)
+	case "/vods/111/cancel":
+		w.WriteHeader(http.StatusAccepted)
+	case "/vods/111/chat/export":
+		_, _ = io.WriteString(w, "WEBVTT\n")
+	case "/status":
+		_ = json.NewEncoder(w).Encode(map[string]any{"circuit_state": "open", "circuit_failures": "3", "circuit_open_until": "2024-05-01T18:05:00Z", "pending": 2})
+	case "/admin/retention":
+		_ = json.NewEncoder(w).Encode(vod.RetentionReport{
+			Channel: r.URL.Query().Get("channel"), KeepCount: 2, DryRun: true, BytesFreed: 3 << 30,
+			Files: []vod.RetentionFile{{VodID: "100", Path: "/data/100.mp4", SizeBytes: 3 << 30}},
+		})
+	default:
+		_ = json.NewEncoder(w).Encode(map[string]any{"status": "ok"})
+	}
+}
+
+func runCLI(t *testing.T, api *fakeAPI, args ...string) (string, error) {
+	t.Helper()
+	srv := httptest.NewServer(api)
+	t.Cleanup(srv.Close)
+	t.Setenv("ADMIN_TOKEN", "secret")
+	var stdout, stderr bytes.Buffer
+	err := run(context.Background(), append([]string{"-server", srv.URL}, args...), &stdout, &stderr)
+	return stdout.String() + stderr.String(), err
+}
+
+func TestHTTPCommands(t *testing.T) {
+	cases := []struct {
+		args    []string
+		request string
+		output  string
+	}{
+		{[]string{"list", "-limit", "10"}, "GET /vods?limit=10&offset=0", "Speedrun"},
+		{[]string{"-channel", "streamer1", "list"}, "GET /vods?channel=streamer1&limit=50&offset=0", "streamer1"},
+		{[]string{"inspect", "111"}, "GET /vods/111", "disk full"},
+		{[]string{"reprocess", "111"}, "POST /vods/111/reprocess", "vod 111: queued for reprocessing"},
+		{[]string{"cancel", "111"}, "POST /vods/111/cancel", "download cancelled"},
+		{[]string{"priority", "111", "10"}, `POST /admin/vod/priority {"priority":10,"vod_id":"111"}`, "priority set to 10"},
+		{[]string{"skip-upload", "111", "on"}, `POST /admin/vod/skip-upload {"skip_upload":true,"vod_id":"111"}`, "upload skipped"},
+		{[]string{"-channel", "streamer1", "scan"}, "POST /admin/vod/scan?channel=streamer1", "scan complete"},
+		{[]string{"catalog", "-max", "20"}, "POST /admin/vod/catalog?max=20", "catalog backfill complete"},
+		{[]string{"-channel", "streamer1", "circuit"}, "GET /status?channel=streamer1", "2024-05-01T18:05:00Z"},
+		{[]string{"chat-export", "111", "-format", "vtt"}, "GET /vods/111/chat/export?format=vtt", "WEBVTT"},
+		{[]string{"retention"}, "GET /admin/retention?channel=", "3.0 GiB"},
+	}
+	for _, c := range cases {
+		t.Run(strings.Join(c.args, " "), func(t *testing.T) {
+			api := &fakeAPI{}
+			out, err := runCLI(t, api, c.args...)
+			if err != nil {
+				t.Fatalf("run: %v\n%s", err, out)
+			}
+			if len(api.requests) != 1 || api.requests[0] != c.request {
+				t.Fatalf("requests = %q, want %q", api.requests, c.request)
+			}
+			if api.tokens[0] != "secret" {
+				t.Errorf("X-Admin-Token = %q", api.tokens[0])
+			}
+			if !strings.Contains(out, c.output) {
+				t.Errorf("output does not contain %q:\n%s", c.output, out)
+			}
+		})
+	}
+}
+
+func TestHTTPErrors(t *testing.T) {
+	out, err := runCLI(t, &fakeAPI{}, "reprocess", "404")
+	if err == nil || !strings.Contains(err.Error(), "404 Not Found") {
+		t.Fatalf("reprocess of unknown vod: err = %v, output %q", err, out)
+	}
+	for _, args := range [][]string{{}, {"bogus"}, {"inspect"}, {"priority", "111", "high"}, {"skip-upload", "111", "maybe"}, {"-o", "yaml", "list"}} {
+		api := &fakeAPI{}
+		if _, err := runCLI(t, api, args...); err == nil {
+			t.Errorf("%q: expected error", args)
+		}
+		if len(api.requests) != 0 {
+			t.Errorf("%q: sent %q", args, api.requests)
+		}
+	}
+}
+
+func TestJSONOutput(t *testing.T) {
+	out, err := runCLI(t, &fakeAPI{}, "-o", "json", "inspect", "111")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v vodDetail
+	if err := json.Unmarshal([]byte(out), &v); err != nil {
+		t.Fatalf("not JSON: %v\n%s", err, out)
+	}
+	if v.ID != "111" || v.Priority != 5 || len(v.Stages) != 1 {
+		t.Fatalf("decoded %+v", v)
+	}
+
+	out, err = runCLI(t, &fakeAPI{}, "-o", "json", "circuit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var c vod.Circuit
+	if err := json.Unmarshal([]byte(out), &c); err != nil || c.State != "open" || c.Failures != "3" {
+		t.Fatalf("circuit = %+v, %v", c, err)
+	}
+}
+
+func TestDBModeCancelNeedsServer(t *testing.T) {
+	d := &dbBackend{}
+	if _, err := d.Cancel(context.Background(), "111"); !errors.Is(err, errNeedsServer) {
+		t.Fatalf("err = %v, want errNeedsServer", err)
+	}
+}
+
+func TestDBModeRetentionWarnsOnConfigError(t *testing.T) {
+	dsn := os.Getenv("TEST_PG_DSN")
+	if dsn == "" {
+		t.Skip("TEST_PG_DSN not set")
+	}
+	t.Setenv("DB_DSN", dsn)
+	path := filepath.Join(t.TempDir(), "channels.json")
+	if err := os.WriteFile(path, []byte(`{"defaults":`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CHANNEL_CONFIG_FILE", path)
+	var stdout, stderr bytes.Buffer
+	if err := run(context.Background(), []string{"-mode", "db", "-channel", "vodctl_retention", "retention"}, &stdout, &stderr); err != nil {
+		t.Fatalf("run: %v\n%s", err, stderr.String())
+	}
+	if !strings.Contains(stderr.String(), "warning: channel config") {
+		t.Errorf("stderr = %q, want a config warning", stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "no retention policy configured") {
+		t.Errorf("stdout = %q", stdout.String())
+	}
+}
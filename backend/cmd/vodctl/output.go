@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/onnwee/vod-tender/backend/vod"
+)
+
+// printer writes command results as aligned tables or as indented JSON.
+type printer struct {
+	w    io.Writer
+	json bool
+}
+
+func newPrinter(format string, w io.Writer) (*printer, error) {
+	switch format {
+	case "table", "":
+		return &printer{w: w}, nil
+	case "json":
+		return &printer{w: w, json: true}, nil
+	}
+	return nil, fmt.Errorf("unknown output format %q (want table or json)", format)
+}
+
+func (p *printer) encode(v any) error {
+	enc := json.NewEncoder(p.w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// table writes rows separated by tabs, aligned in columns.
+func (p *printer) table(header []string, rows [][]string) error {
+	tw := tabwriter.NewWriter(p.w, 0, 0, 2, ' ', 0)
+	if header != nil {
+		fmt.Fprintln(tw, strings.Join(header, "\t"))
+	}
+	for _, r := range rows {
+		fmt.Fprintln(tw, strings.Join(r, "\t"))
+	}
+	return tw.Flush()
+}
+
+func (p *printer) vods(vods []vodSummary) error {
+	if p.json {
+		return p.encode(vods)
+	}
+	rows := make([][]string, 0, len(vods))
+	for _, v := range vods {
+		status := v.Status
+		if v.TwitchDeleted != nil {
+			status += " (gone from twitch)"
+		}
+		rows = append(rows, []string{v.ID, channelName(v.Channel), formatTime(v.Date), status, truncate(v.Title, 60)})
+	}
+	return p.table([]string{"ID", "CHANNEL", "DATE", "STATUS", "TITLE"}, rows)
+}
+
+func (p *printer) vod(v vodDetail) error {
+	if p.json {
+		return p.encode(v)
+	}
+	fields := [][]string{
+		{"ID:", v.ID},
+		{"Channel:", channelName(v.Channel)},
+		{"Title:", v.Title},
+		{"Date:", formatTime(v.Date)},
+		{"Duration:", (time.Duration(v.Duration) * time.Second).String()},
+		{"Status:", v.Status},
+		{"Priority:", fmt.Sprint(v.Priority)},
+		{"Skip upload:", fmt.Sprint(v.SkipUpload)},
+		{"YouTube:", orDash(v.YouTube)},
+		{"File:", orDash(v.DownloadedPath)},
+		{"Download:", fmt.Sprintf("%s (retries %d)", orDash(v.DownloadState), v.DownloadRetries)},
+	}
+	if v.ProcessingError != "" {
+		fields = append(fields, []string{"Error:", v.ProcessingError})
+	}
+	if v.TwitchDeleted != nil {
+		fields = append(fields, []string{"Gone from Twitch:", formatTime(*v.TwitchDeleted)})
+	}
+	if err := p.table(nil, fields); err != nil {
+		return err
+	}
+	if len(v.Stages) > 0 {
+		rows := make([][]string, 0, len(v.Stages))
+		for _, s := range v.Stages {
+			rows = append(rows, []string{s.Stage, s.Status, fmt.Sprint(s.Attempts), formatTimePtr(s.FinishedAt), s.Error})
+		}
+		fmt.Fprintln(p.w)
+		if err := p.table([]string{"STAGE", "STATUS", "ATTEMPTS", "FINISHED", "ERROR"}, rows); err != nil {
+			return err
+		}
+	}
+	if len(v.StatusHistory) > 0 {
+		rows := make([][]string, 0, len(v.StatusHistory))
+		for _, t := range v.StatusHistory {
+			rows = append(rows, []string{formatTime(t.At), string(t.From), string(t.To), t.Reason})
+		}
+		fmt.Fprintln(p.w)
+		return p.table([]string{"AT", "FROM", "TO", "REASON"}, rows)
+	}
+	return nil
+}
+
+func (p *printer) result(r result) error {
+	if p.json {
+		return p.encode(r)
+	}
+	switch {
+	case r.VodID != "":
+		_, err := fmt.Fprintf(p.w, "vod %s: %s\n", r.VodID, r.Message)
+		return err
+	case r.Channel != nil:
+		_, err := fmt.Fprintf(p.w, "channel %s: %s\n", channelName(*r.Channel), r.Message)
+		return err
+	}
+	_, err := fmt.Fprintln(p.w, r.Message)
+	return err
+}
+
+func (p *printer) circuit(c vod.Circuit) error {
+	if p.json {
+		return p.encode(c)
+	}
+	state := c.State
+	if state == "" {
+		state = "closed"
+	}
+	failures := c.Failures
+	if failures == "" {
+		failures = "0"
+	}
+	rows := [][]string{{"Channel:", channelName(c.Channel)}, {"State:", state}, {"Failures:", failures}}
+	if c.OpenUntil != "" {
+		rows = append(rows, []string{"Open until:", c.OpenUntil})
+	}
+	return p.table(nil, rows)
+}
+
+func (p *printer) retention(r vod.RetentionReport) error {
+	if p.json {
+		return p.encode(r)
+	}
+	if r.KeepDays == 0 && r.KeepCount == 0 {
+		_, err := fmt.Fprintf(p.w, "channel %s: no retention policy configured\n", channelName(r.Channel))
+		return err
+	}
+	rows := make([][]string, 0, len(r.Files))
+	for _, f := range r.Files {
+		rows = append(rows, []string{f.VodID, formatTime(f.Date), formatBytes(f.SizeBytes), f.Path})
+	}
+	if err := p.table([]string{"VOD", "DATE", "SIZE", "PATH"}, rows); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(p.w, "\nchannel %s (keep %d days, %d newest): would delete %d file(s), %s; %d kept, %d error(s)\n",
+		channelName(r.Channel), r.KeepDays, r.KeepCount, len(r.Files), formatBytes(r.BytesFreed), r.Skipped, r.Errors)
+	return err
+}
+
+// channelName shows the default channel, which has an empty name, readably.
+func channelName(c string) string {
+	if c == "" {
+		return "(default)"
+	}
+	return c
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() || t.Unix() == 0 {
+		return "-"
+	}
+	return t.UTC().Format("2006-01-02 15:04")
+}
+
+func formatTimePtr(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return formatTime(*t)
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// truncate shortens s to at most n runes.
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
@@ -0,0 +1,350 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ChannelConfig holds the settings the VOD jobs apply to one channel. Each field is
+// set by the environment variable named in its comment; LoadChannelConfig layers
+// CHANNEL_CONFIG_FILE, runtime overrides and the channel_settings table on top, so
+// any of them can differ between channels.
+type ChannelConfig struct {
+	Channel string
+
+	UploadDailyLimit         int           // UPLOAD_DAILY_LIMIT: uploads per rolling 24h (default 10)
+	BackfillUploadDailyLimit int           // BACKFILL_UPLOAD_DAILY_LIMIT: back-catalog uploads per rolling 24h (default 10)
+	BackfillAfterDays        int           // RETAIN_KEEP_NEWER_THAN_DAYS: VODs older than this are back-catalog (default 7)
+	SweepOrphans             bool          // ORPHAN_SWEEP=1: delete video files no VOD references once older than BackfillAfterDays
+	UploadMaxAttempts        int           // UPLOAD_MAX_ATTEMPTS: attempts per destination (default 5)
+	UploadBackoffBase        time.Duration // UPLOAD_BACKOFF_BASE (default 2s)
+
+	ProcessInterval         time.Duration // VOD_PROCESS_INTERVAL: time between processing cycles (default 1m)
+	DownloadMaxAttempts     int           // DOWNLOAD_MAX_ATTEMPTS (default 5)
+	DownloadBackoffBase     time.Duration // DOWNLOAD_BACKOFF_BASE (default 2s)
+	DownloadRateLimit       string        // DOWNLOAD_RATE_LIMIT: yt-dlp --limit-rate, e.g. 2M
+	YtdlpArgs               string        // YTDLP_ARGS: extra yt-dlp flags
+	ProcessingRetryCooldown time.Duration // PROCESSING_RETRY_COOLDOWN: wait before retrying a failed VOD (default 10m)
+
+	CircuitFailureThreshold int           // CIRCUIT_FAILURE_THRESHOLD: consecutive failures that open the breaker (0 disables)
+	CircuitOpenCooldown     time.Duration // CIRCUIT_OPEN_COOLDOWN (default 5m)
+
+	RetentionKeepDays  int           // RETENTION_KEEP_DAYS (0 disables)
+	RetentionKeepCount int           // RETENTION_KEEP_COUNT (0 disables)
+	RetentionDryRun    bool          // RETENTION_DRY_RUN=1
+	RetentionInterval  time.Duration // RETENTION_INTERVAL (default 6h)
+}
+
+// ChannelProfiles is the content of CHANNEL_CONFIG_FILE: setting values keyed by
+// environment variable name, as defaults for every channel and overrides per channel.
+//
+//	{"defaults": {"UPLOAD_DAILY_LIMIT": 5},
+//	 "channels": {"streamer1": {"DOWNLOAD_RATE_LIMIT": "2M", "YOUTUBE_PRIVACY": "unlisted"}}}
+type ChannelProfiles struct {
+	Defaults map[string]string            `json:"defaults"`
+	Channels map[string]map[string]string `json:"channels"`
+}
+
+// UnmarshalJSON accepts numbers and booleans as well as strings for setting values.
+func (p *ChannelProfiles) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Defaults map[string]json.RawMessage            `json:"defaults"`
+		Channels map[string]map[string]json.RawMessage `json:"channels"`
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&raw); err != nil {
+		return err
+	}
+	values := func(in map[string]json.RawMessage) (map[string]string, error) {
+		out := make(map[string]string, len(in))
+		for k, v := range in {
+			var s string
+			if err := json.Unmarshal(v, &s); err != nil {
+				var scalar any
+				if err := json.Unmarshal(v, &scalar); err != nil {
+					return nil, err
+				}
+				switch scalar.(type) {
+				case float64, bool:
+					s = strings.TrimSpace(string(v))
+				default:
+					return nil, fmt.Errorf("%s: value must be a string, number or boolean", k)
+				}
+			}
+			out[strings.ToUpper(strings.TrimSpace(k))] = s
+		}
+		return out, nil
+	}
+	var err error
+	if p.Defaults, err = values(raw.Defaults); err != nil {
+		return fmt.Errorf("defaults: %w", err)
+	}
+	p.Channels = make(map[string]map[string]string, len(raw.Channels))
+	for ch, settings := range raw.Channels {
+		vals, err := values(settings)
+		if err != nil {
+			return fmt.Errorf("channel %s: %w", ch, err)
+		}
+		p.Channels[strings.ToLower(strings.TrimSpace(ch))] = vals
+	}
+	return nil
+}
+
+// channelValue returns the value for key from channel's own section of the file.
+func (p *ChannelProfiles) channelValue(channel, key string) (string, bool) {
+	if p == nil {
+		return "", false
+	}
+	v, ok := p.Channels[strings.ToLower(channel)][key]
+	return v, ok
+}
+
+// defaultValue returns the value for key from the file's defaults section.
+func (p *ChannelProfiles) defaultValue(key string) (string, bool) {
+	if p == nil {
+		return "", false
+	}
+	v, ok := p.Defaults[key]
+	return v, ok
+}
+
+// LoadChannelProfiles reads a channel profile file. An empty path yields no profiles.
+func LoadChannelProfiles(path string) (*ChannelProfiles, error) {
+	if path == "" {
+		return &ChannelProfiles{}, nil
+	}
+	data, err := os.ReadFile(path) //nolint:gosec // G304: path comes from operator configuration
+	if err != nil {
+		return nil, err
+	}
+	var p ChannelProfiles
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return &p, nil
+}
+
+var (
+	profilesMu    sync.Mutex
+	profilesPath  string
+	profilesMTime time.Time
+	profiles      *ChannelProfiles
+)
+
+// currentProfiles returns CHANNEL_CONFIG_FILE's profiles, re-reading the file when it
+// changes. A file that fails to load yields the error and no profiles.
+func currentProfiles() (*ChannelProfiles, error) {
+	path := strings.TrimSpace(os.Getenv("CHANNEL_CONFIG_FILE"))
+	if path == "" {
+		return nil, nil
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	profilesMu.Lock()
+	defer profilesMu.Unlock()
+	if profiles != nil && path == profilesPath && fi.ModTime().Equal(profilesMTime) {
+		return profiles, nil
+	}
+	p, err := LoadChannelProfiles(path)
+	if err != nil {
+		return nil, err
+	}
+	profiles, profilesPath, profilesMTime = p, path, fi.ModTime()
+	return p, nil
+}
+
+// channelSettingsRows returns channel's channel_settings rows keyed by setting name.
+func channelSettingsRows(ctx context.Context, db *sql.DB, channel string) (map[string]string, error) {
+	out := map[string]string{}
+	if db == nil {
+		return out, nil
+	}
+	rows, err := db.QueryContext(ctx, `SELECT key, value FROM channel_settings WHERE LOWER(channel)=LOWER($1)`, channel)
+	if err != nil {
+		return out, err
+	}
+	defer func() { _ = rows.Close() }()
+	for rows.Next() {
+		var k, v string
+		if err := rows.Scan(&k, &v); err != nil {
+			return out, err
+		}
+		out[strings.ToUpper(k)] = v
+	}
+	return out, rows.Err()
+}
+
+// Sources of a setting's value, as reported by Lookup.
+const (
+	SourceChannelSettings = "channel_settings" // a channel_settings row
+	SourceChannelFile     = "file:channel"     // the channel's section of CHANNEL_CONFIG_FILE
+	SourceKV              = "kv"               // a cfg:<KEY> override set through PUT /config
+	SourceFile            = "file"             // the defaults section of CHANNEL_CONFIG_FILE
+	SourceEnv             = "env"
+	SourceDefault         = "default"
+)
+
+// channelLookup layers the sources of channel's settings, highest first: channel_settings
+// rows, the channel's section of CHANNEL_CONFIG_FILE, runtime overrides in kv, the file's
+// defaults, the environment. The returned function also reports which source answered.
+func channelLookup(ctx context.Context, db *sql.DB, channel string) (func(key string) (string, string), error) {
+	p, perr := currentProfiles()
+	rows, rerr := channelSettingsRows(ctx, db, channel)
+	overrides, oerr := runtimeOverrides(ctx, db)
+	get := func(key string) (string, string) {
+		if v, ok := rows[key]; ok {
+			return v, SourceChannelSettings
+		}
+		if v, ok := p.channelValue(channel, key); ok {
+			return v, SourceChannelFile
+		}
+		if v, ok := overrides[key]; ok {
+			return v, SourceKV
+		}
+		if v, ok := p.defaultValue(key); ok {
+			return v, SourceFile
+		}
+		if v := os.Getenv(key); v != "" {
+			return v, SourceEnv
+		}
+		return "", SourceDefault
+	}
+	var errs []error
+	if perr != nil {
+		errs = append(errs, fmt.Errorf("channel config file: %w", perr))
+	}
+	if rerr != nil {
+		errs = append(errs, fmt.Errorf("channel_settings: %w", rerr))
+	}
+	if oerr != nil {
+		errs = append(errs, fmt.Errorf("runtime overrides: %w", oerr))
+	}
+	return get, errors.Join(errs...)
+}
+
+// ChannelValue returns channel's value for the setting named by environment variable
+// key, from the same layers as LoadChannelConfig. Sources that fail to load are skipped.
+func ChannelValue(ctx context.Context, db *sql.DB, channel, key string) string {
+	v, _ := Lookup(ctx, db, channel, key)
+	return v
+}
+
+// Lookup is ChannelValue that also reports the source of the value (one of the Source
+// constants). Unset runtime settings report their built-in default.
+func Lookup(ctx context.Context, db *sql.DB, channel, key string) (value, source string) {
+	get, _ := channelLookup(ctx, db, channel)
+	key = strings.ToUpper(key)
+	value, source = get(key)
+	if source == SourceDefault {
+		value = runtimeSettings[key].def
+	}
+	return value, source
+}
+
+// LoadChannelConfig resolves channel's settings. Each is taken from, in order: the
+// channel's channel_settings rows, its section of CHANNEL_CONFIG_FILE, runtime
+// overrides in kv, the file's defaults, the environment, the built-in default. A nil db skips the table. When a
+// source fails to load, the error is returned together with the config resolved from
+// the remaining sources.
+func LoadChannelConfig(ctx context.Context, db *sql.DB, channel string) (ChannelConfig, error) {
+	get, err := channelLookup(ctx, db, channel)
+	return resolveChannelConfig(channel, func(key string) string {
+		v, _ := get(key)
+		return v
+	}), err
+}
+
+// ChannelConfigFromEnv resolves channel's settings from the environment alone.
+func ChannelConfigFromEnv(channel string) ChannelConfig {
+	return resolveChannelConfig(channel, os.Getenv)
+}
+
+// resolveChannelConfig fills a ChannelConfig from get, keeping the default for
+// settings that are unset or invalid.
+func resolveChannelConfig(channel string, get func(key string) string) ChannelConfig {
+	c := ChannelConfig{
+		Channel:                  channel,
+		UploadDailyLimit:         10,
+		BackfillUploadDailyLimit: 10,
+		BackfillAfterDays:        7,
+		UploadMaxAttempts:        5,
+		UploadBackoffBase:        2 * time.Second,
+		ProcessInterval:          time.Minute,
+		DownloadMaxAttempts:      5,
+		DownloadBackoffBase:      2 * time.Second,
+		ProcessingRetryCooldown:  10 * time.Minute,
+		CircuitOpenCooldown:      5 * time.Minute,
+		RetentionInterval:        6 * time.Hour,
+	}
+	intSetting(get, "UPLOAD_DAILY_LIMIT", &c.UploadDailyLimit)
+	intSetting(get, "BACKFILL_UPLOAD_DAILY_LIMIT", &c.BackfillUploadDailyLimit)
+	intSetting(get, "RETAIN_KEEP_NEWER_THAN_DAYS", &c.BackfillAfterDays)
+	c.SweepOrphans = strings.TrimSpace(get("ORPHAN_SWEEP")) == "1"
+	intSetting(get, "UPLOAD_MAX_ATTEMPTS", &c.UploadMaxAttempts)
+	durationSetting(get, "UPLOAD_BACKOFF_BASE", &c.UploadBackoffBase)
+	durationSetting(get, "VOD_PROCESS_INTERVAL", &c.ProcessInterval)
+	intSetting(get, "DOWNLOAD_MAX_ATTEMPTS", &c.DownloadMaxAttempts)
+	durationSetting(get, "DOWNLOAD_BACKOFF_BASE", &c.DownloadBackoffBase)
+	c.DownloadRateLimit = strings.TrimSpace(get("DOWNLOAD_RATE_LIMIT"))
+	c.YtdlpArgs = strings.TrimSpace(get("YTDLP_ARGS"))
+	durationSetting(get, "PROCESSING_RETRY_COOLDOWN", &c.ProcessingRetryCooldown)
+	intSetting(get, "CIRCUIT_FAILURE_THRESHOLD", &c.CircuitFailureThreshold)
+	durationSetting(get, "CIRCUIT_OPEN_COOLDOWN", &c.CircuitOpenCooldown)
+	intSetting(get, "RETENTION_KEEP_DAYS", &c.RetentionKeepDays)
+	intSetting(get, "RETENTION_KEEP_COUNT", &c.RetentionKeepCount)
+	c.RetentionDryRun = strings.TrimSpace(get("RETENTION_DRY_RUN")) == "1"
+	durationSetting(get, "RETENTION_INTERVAL", &c.RetentionInterval)
+	return c
+}
+
+// minJobInterval is the shortest interval a periodic job accepts; anything lower would
+// keep it looping.
+const minJobInterval = 10 * time.Second
+
+// intMinimums and durationMinimums are the smallest accepted values of numeric settings.
+// resolveChannelConfig ignores smaller values and ValidateRuntimeSetting rejects them.
+var (
+	intMinimums = map[string]int{
+		"UPLOAD_DAILY_LIMIT":          1,
+		"BACKFILL_UPLOAD_DAILY_LIMIT": 1,
+		"RETAIN_KEEP_NEWER_THAN_DAYS": 0,
+		"UPLOAD_MAX_ATTEMPTS":         1,
+		"DOWNLOAD_MAX_ATTEMPTS":       1,
+		"CIRCUIT_FAILURE_THRESHOLD":   math.MinInt,
+		"RETENTION_KEEP_DAYS":         0,
+		"RETENTION_KEEP_COUNT":        0,
+	}
+	durationMinimums = map[string]time.Duration{
+		"UPLOAD_BACKOFF_BASE":       1,
+		"VOD_PROCESS_INTERVAL":      minJobInterval,
+		"DOWNLOAD_BACKOFF_BASE":     1,
+		"PROCESSING_RETRY_COOLDOWN": 1,
+		"CIRCUIT_OPEN_COOLDOWN":     math.MinInt64,
+		"RETENTION_INTERVAL":        minJobInterval,
+	}
+)
+
+func intSetting(get func(string) string, key string, dst *int) {
+	if n, err := strconv.Atoi(strings.TrimSpace(get(key))); err == nil && n >= intMinimums[key] {
+		*dst = n
+	}
+}
+
+func durationSetting(get func(string) string, key string, dst *time.Duration) {
+	if d, err := time.ParseDuration(strings.TrimSpace(get(key))); err == nil && d >= durationMinimums[key] {
+		*dst = d
+	}
+}
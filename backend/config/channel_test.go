@@ -0,0 +1,90 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestChannelProfilesUnmarshal(t *testing.T) {
+	var p ChannelProfiles
+	data := `{"defaults":{"upload_daily_limit":5,"RETENTION_DRY_RUN":true},"channels":{"Streamer1":{"DOWNLOAD_RATE_LIMIT":"2M"}}}`
+	if err := json.Unmarshal([]byte(data), &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Defaults["UPLOAD_DAILY_LIMIT"] != "5" || p.Defaults["RETENTION_DRY_RUN"] != "true" {
+		t.Fatalf("defaults = %v", p.Defaults)
+	}
+	if p.Channels["streamer1"]["DOWNLOAD_RATE_LIMIT"] != "2M" {
+		t.Fatalf("channels = %v", p.Channels)
+	}
+	if err := json.Unmarshal([]byte(`{"default":{}}`), &p); err == nil {
+		t.Fatal("expected error for unknown top-level field")
+	}
+	if err := json.Unmarshal([]byte(`{"defaults":{"YTDLP_ARGS":["-4"]}}`), &p); err == nil {
+		t.Fatal("expected error for non-scalar value")
+	}
+}
+
+func TestLoadChannelConfigPrecedence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "channels.json")
+	profile := `{"defaults":{"UPLOAD_DAILY_LIMIT":5,"DOWNLOAD_MAX_ATTEMPTS":3},
+		"channels":{"streamer1":{"UPLOAD_DAILY_LIMIT":2,"RETENTION_INTERVAL":"1h","ORPHAN_SWEEP":1}}}`
+	if err := os.WriteFile(path, []byte(profile), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CHANNEL_CONFIG_FILE", path)
+	t.Setenv("UPLOAD_DAILY_LIMIT", "20")
+	t.Setenv("DOWNLOAD_MAX_ATTEMPTS", "9")
+	t.Setenv("UPLOAD_MAX_ATTEMPTS", "7")
+	t.Setenv("RETENTION_INTERVAL", "")
+
+	cfg, err := LoadChannelConfig(context.Background(), nil, "Streamer1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// channel section > file defaults > environment > built-in default
+	if cfg.UploadDailyLimit != 2 || cfg.DownloadMaxAttempts != 3 || cfg.UploadMaxAttempts != 7 || cfg.RetentionInterval != time.Hour || !cfg.SweepOrphans {
+		t.Fatalf("streamer1 config = %+v", cfg)
+	}
+	other, err := LoadChannelConfig(context.Background(), nil, "streamer2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.UploadDailyLimit != 5 || other.RetentionInterval != 6*time.Hour || other.SweepOrphans {
+		t.Fatalf("streamer2 config = %+v", other)
+	}
+	if v := ChannelValue(context.Background(), nil, "streamer1", "upload_daily_limit"); v != "2" {
+		t.Fatalf("ChannelValue = %q, want 2", v)
+	}
+}
+
+func TestLoadChannelConfigBadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "channels.json")
+	if err := os.WriteFile(path, []byte(`{"defaults":`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CHANNEL_CONFIG_FILE", path)
+	t.Setenv("UPLOAD_DAILY_LIMIT", "4")
+	cfg, err := LoadChannelConfig(context.Background(), nil, "streamer1")
+	if err == nil {
+		t.Fatal("expected error for malformed file")
+	}
+	if cfg.UploadDailyLimit != 4 {
+		t.Fatalf("env fallback not applied: %+v", cfg)
+	}
+}
+
+func TestChannelConfigFromEnvKeepsDefaultsForInvalidValues(t *testing.T) {
+	t.Setenv("UPLOAD_DAILY_LIMIT", "0")
+	t.Setenv("DOWNLOAD_BACKOFF_BASE", "soon")
+	t.Setenv("CIRCUIT_FAILURE_THRESHOLD", "3")
+	t.Setenv("RETENTION_INTERVAL", "1ns")
+	cfg := ChannelConfigFromEnv("")
+	if cfg.UploadDailyLimit != 10 || cfg.DownloadBackoffBase != 2*time.Second || cfg.CircuitFailureThreshold != 3 || cfg.RetentionInterval != 6*time.Hour {
+		t.Fatalf("config = %+v", cfg)
+	}
+}
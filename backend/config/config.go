@@ -136,12 +136,22 @@ func parseBoolEnv(v string) bool {
 
 // ValidateChatReady checks required fields when chat is enabled (manual recorder path).
 func (c *Config) ValidateChatReady() error {
-	if c.TwitchChannel == DefaultChannel || c.TwitchBotUsername == "" || c.TwitchOAuthToken == "" {
-		return fmt.Errorf("missing twitch env: require TWITCH_CHANNEL, TWITCH_BOT_USERNAME, TWITCH_OAUTH_TOKEN")
+	if len(c.TwitchChannels) == 0 || c.TwitchBotUsername == "" || c.TwitchOAuthToken == "" {
+		return fmt.Errorf("missing twitch env: require TWITCH_CHANNEL (or TWITCH_CHANNELS), TWITCH_BOT_USERNAME, TWITCH_OAUTH_TOKEN")
 	}
 	return nil
 }
 
+// ChatVODID is the VOD id a manual chat recording of channel is stored under: TWITCH_VOD_ID
+// in single-channel mode, or TWITCH_VOD_ID suffixed with the channel when several channels
+// are configured so their chat does not mix.
+func (c *Config) ChatVODID(channel string) string {
+	if len(c.TwitchChannels) <= 1 {
+		return c.TwitchVODID
+	}
+	return c.TwitchVODID + "-" + strings.ToLower(channel)
+}
+
 // ValidateYouTubeUploadPolicy enforces explicit operator ownership declaration
 // when YouTube upload is enabled.
 func (c *Config) ValidateYouTubeUploadPolicy() error {
@@ -56,6 +56,30 @@ func TestValidateChatReadyWithDefaultChannel(t *testing.T) {
 	}
 }
 
+func TestValidateChatReadyWithChannelList(t *testing.T) {
+	t.Setenv("TWITCH_CHANNEL", "")
+	t.Setenv("TWITCH_CHANNELS", "alpha, Beta")
+	t.Setenv("TWITCH_BOT_USERNAME", "bot")
+	t.Setenv("TWITCH_OAUTH_TOKEN", "oauth:token")
+	t.Setenv("TWITCH_VOD_ID", "manual")
+	cfg, _ := Load()
+	if err := cfg.ValidateChatReady(); err != nil {
+		t.Errorf("expected valid chat config with TWITCH_CHANNELS, got %v", err)
+	}
+	if got := cfg.ChatVODID("Beta"); got != "manual-beta" {
+		t.Errorf("ChatVODID(Beta) = %q, want manual-beta", got)
+	}
+}
+
+func TestChatVODIDSingleChannel(t *testing.T) {
+	t.Setenv("TWITCH_CHANNEL", "alpha")
+	t.Setenv("TWITCH_VOD_ID", "manual")
+	cfg, _ := Load()
+	if got := cfg.ChatVODID("alpha"); got != "manual" {
+		t.Errorf("ChatVODID(alpha) = %q, want manual", got)
+	}
+}
+
 func TestValidateYouTubeUploadPolicyDisabled(t *testing.T) {
 	t.Setenv("YOUTUBE_UPLOAD_ENABLED", "0")
 	t.Setenv("YOUTUBE_UPLOAD_OWNERSHIP", "")
@@ -0,0 +1,271 @@
+package config
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// runtimeKeyPrefix prefixes the kv keys of runtime overrides, stored for the default channel.
+const runtimeKeyPrefix = "cfg:"
+
+type settingKind int
+
+const (
+	kindString settingKind = iota
+	kindInt
+	kindDuration
+	kindFlag // "0" or "1"
+	kindLogLevel
+)
+
+// runtimeSetting describes a setting that can be overridden through PUT /config.
+type runtimeSetting struct {
+	kind settingKind
+	def  string // built-in default, as reported by /config
+}
+
+// runtimeSettings are the settings that can be changed without a restart. Secrets
+// and settings only read at startup are deliberately absent.
+var runtimeSettings = map[string]runtimeSetting{
+	"LOG_LEVEL":                   {kindLogLevel, "info"},
+	"VOD_PROCESS_INTERVAL":        {kindDuration, "1m0s"},
+	"PROCESSING_RETRY_COOLDOWN":   {kindDuration, "10m0s"},
+	"DOWNLOAD_MAX_ATTEMPTS":       {kindInt, "5"},
+	"DOWNLOAD_BACKOFF_BASE":       {kindDuration, "2s"},
+	"DOWNLOAD_RATE_LIMIT":         {kindString, ""},
+	"UPLOAD_MAX_ATTEMPTS":         {kindInt, "5"},
+	"UPLOAD_BACKOFF_BASE":         {kindDuration, "2s"},
+	"UPLOAD_DAILY_LIMIT":          {kindInt, "10"},
+	"BACKFILL_UPLOAD_DAILY_LIMIT": {kindInt, "10"},
+	"RETAIN_KEEP_NEWER_THAN_DAYS": {kindInt, "7"},
+	"ORPHAN_SWEEP":                {kindFlag, "0"},
+	"CIRCUIT_FAILURE_THRESHOLD":   {kindInt, "0"},
+	"CIRCUIT_OPEN_COOLDOWN":       {kindDuration, "5m0s"},
+	"RETENTION_KEEP_DAYS":         {kindInt, "0"},
+	"RETENTION_KEEP_COUNT":        {kindInt, "0"},
+	"RETENTION_DRY_RUN":           {kindFlag, "0"},
+	"RETENTION_INTERVAL":          {kindDuration, "6h0m0s"},
+}
+
+// RuntimeKeys returns the names of the settings that can be overridden at runtime.
+func RuntimeKeys() []string {
+	keys := make([]string, 0, len(runtimeSettings))
+	for k := range runtimeSettings {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// ValidateRuntimeSetting checks that key can be overridden at runtime and that value
+// parses as its type and is not below the minimum the VOD jobs accept. An empty value
+// is valid: it removes the override.
+func ValidateRuntimeSetting(key, value string) error {
+	s, ok := runtimeSettings[key]
+	if !ok {
+		return fmt.Errorf("%s cannot be changed at runtime", key)
+	}
+	if value == "" {
+		return nil
+	}
+	switch s.kind {
+	case kindInt:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%s: not an integer", key)
+		}
+		if n < intMinimums[key] {
+			return fmt.Errorf("%s: must be at least %d", key, intMinimums[key])
+		}
+	case kindDuration:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("%s: not a duration", key)
+		}
+		if d < durationMinimums[key] {
+			return fmt.Errorf("%s: must be at least %s", key, durationMinimums[key])
+		}
+	case kindFlag:
+		if value != "0" && value != "1" {
+			return fmt.Errorf("%s: must be 0 or 1", key)
+		}
+	case kindLogLevel:
+		if _, ok := ParseLogLevel(value); !ok {
+			return fmt.Errorf("%s: must be debug, info, warn or error", key)
+		}
+	}
+	return nil
+}
+
+// ParseLogLevel parses a LOG_LEVEL value. An empty value is info.
+func ParseLogLevel(s string) (slog.Level, bool) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return slog.LevelDebug, true
+	case "info", "":
+		return slog.LevelInfo, true
+	case "warn":
+		return slog.LevelWarn, true
+	case "error":
+		return slog.LevelError, true
+	}
+	return slog.LevelInfo, false
+}
+
+// runtimeOverrides returns the cfg:<KEY> rows of kv keyed by setting name. Rows for
+// settings that cannot be changed at runtime are ignored.
+func runtimeOverrides(ctx context.Context, db *sql.DB) (map[string]string, error) {
+	out := map[string]string{}
+	if db == nil {
+		return out, nil
+	}
+	rows, err := db.QueryContext(ctx, `SELECT key, value FROM kv WHERE channel='' AND key LIKE 'cfg:%'`)
+	if err != nil {
+		return out, err
+	}
+	defer func() { _ = rows.Close() }()
+	for rows.Next() {
+		var k, v string
+		if err := rows.Scan(&k, &v); err != nil {
+			return out, err
+		}
+		k = strings.ToUpper(strings.TrimPrefix(k, runtimeKeyPrefix))
+		if _, ok := runtimeSettings[k]; ok && v != "" {
+			out[k] = v
+		}
+	}
+	return out, rows.Err()
+}
+
+// SetRuntimeOverride stores value as the runtime override of key, or removes the
+// override when value is empty. Call ReloadRuntime afterwards to notify watchers.
+func SetRuntimeOverride(ctx context.Context, db *sql.DB, key, value string) error {
+	if err := ValidateRuntimeSetting(key, value); err != nil {
+		return err
+	}
+	if value == "" {
+		_, err := db.ExecContext(ctx, `DELETE FROM kv WHERE channel='' AND key=$1`, runtimeKeyPrefix+key)
+		return err
+	}
+	_, err := db.ExecContext(ctx, `INSERT INTO kv (channel,key,value,updated_at) VALUES ('',$1,$2,NOW())
+		ON CONFLICT(channel,key) DO UPDATE SET value=EXCLUDED.value, updated_at=NOW()`, runtimeKeyPrefix+key, value)
+	return err
+}
+
+var (
+	runtimeMu       sync.Mutex
+	runtimeSeen     string // fingerprint of the sources at the last reload
+	runtimeWatchers = map[chan struct{}]struct{}{}
+)
+
+// WatchRuntime returns a channel that receives a value whenever ReloadRuntime sees
+// a changed setting source, and a function that ends the watch. Notifications do not
+// queue: a slow watcher sees one pending notification covering every change before it.
+func WatchRuntime() (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+	runtimeMu.Lock()
+	runtimeWatchers[ch] = struct{}{}
+	runtimeMu.Unlock()
+	return ch, func() {
+		runtimeMu.Lock()
+		delete(runtimeWatchers, ch)
+		runtimeMu.Unlock()
+	}
+}
+
+// ReloadRuntime checks whether the runtime overrides, the channel_settings or
+// channels tables, or CHANNEL_CONFIG_FILE changed since the previous call and, if so,
+// notifies watchers so they re-resolve their settings. The first call only records
+// the current state.
+func ReloadRuntime(ctx context.Context, db *sql.DB) (bool, error) {
+	fp, err := runtimeFingerprint(ctx, db)
+	if err != nil {
+		return false, err
+	}
+	runtimeMu.Lock()
+	defer runtimeMu.Unlock()
+	first := runtimeSeen == ""
+	if fp == runtimeSeen {
+		return false, nil
+	}
+	runtimeSeen = fp
+	if first {
+		return false, nil
+	}
+	for ch := range runtimeWatchers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+	return true, nil
+}
+
+// runtimeFingerprint hashes everything a runtime reload can pick up.
+func runtimeFingerprint(ctx context.Context, db *sql.DB) (string, error) {
+	h := sha256.New()
+	if path := strings.TrimSpace(os.Getenv("CHANNEL_CONFIG_FILE")); path != "" {
+		if fi, err := os.Stat(path); err == nil {
+			fmt.Fprintf(h, "file %s %d %d\n", path, fi.ModTime().UnixNano(), fi.Size())
+		} else {
+			fmt.Fprintf(h, "file %s missing\n", path)
+		}
+	}
+	if db != nil {
+		rows, err := db.QueryContext(ctx, `SELECT 'kv', channel, key, value FROM kv WHERE key LIKE 'cfg:%'
+			UNION ALL SELECT 'channel_settings', channel, key, value FROM channel_settings
+			UNION ALL SELECT 'channels', name, '', enabled::text FROM channels
+			ORDER BY 1, 2, 3`)
+		if err != nil {
+			return "", err
+		}
+		defer func() { _ = rows.Close() }()
+		for rows.Next() {
+			var src, channel, key, value string
+			if err := rows.Scan(&src, &channel, &key, &value); err != nil {
+				return "", err
+			}
+			fmt.Fprintf(h, "%s %q %q %q\n", src, channel, key, value)
+		}
+		if err := rows.Err(); err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// StartRuntimeReloader calls ReloadRuntime every CONFIG_RELOAD_INTERVAL (default 30s)
+// until ctx is cancelled, so changes made by other replicas or directly in the
+// database are picked up.
+func StartRuntimeReloader(ctx context.Context, db *sql.DB) {
+	interval := 30 * time.Second
+	if v := os.Getenv("CONFIG_RELOAD_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			interval = d
+		}
+	}
+	slog.Info("runtime config reloader starting", slog.Duration("interval", interval))
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			changed, err := ReloadRuntime(ctx, db)
+			if err != nil {
+				slog.Warn("runtime config reload", slog.Any("err", err))
+			} else if changed {
+				slog.Info("runtime config changed")
+			}
+		}
+	}
+}
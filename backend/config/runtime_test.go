@@ -0,0 +1,140 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/onnwee/vod-tender/backend/testutil"
+)
+
+func TestValidateRuntimeSetting(t *testing.T) {
+	valid := map[string]string{
+		"LOG_LEVEL":            "debug",
+		"VOD_PROCESS_INTERVAL": "30s",
+		"UPLOAD_MAX_ATTEMPTS":  "3",
+		"RETENTION_DRY_RUN":    "1",
+		"DOWNLOAD_RATE_LIMIT":  "2M",
+		"RETENTION_INTERVAL":   "",
+	}
+	for k, v := range valid {
+		if err := ValidateRuntimeSetting(k, v); err != nil {
+			t.Errorf("%s=%q: %v", k, v, err)
+		}
+	}
+	invalid := map[string]string{
+		"LOG_LEVEL":            "verbose",
+		"VOD_PROCESS_INTERVAL": "soon",
+		"UPLOAD_MAX_ATTEMPTS":  "three",
+		"RETENTION_DRY_RUN":    "yes",
+		"TWITCH_CLIENT_SECRET": "x",
+		"YTDLP_ARGS":           "--exec rm",
+		"UPLOAD_DAILY_LIMIT":   "0",
+		"RETENTION_INTERVAL":   "1ns",
+		"UPLOAD_BACKOFF_BASE":  "0s",
+	}
+	for k, v := range invalid {
+		if err := ValidateRuntimeSetting(k, v); err == nil {
+			t.Errorf("%s=%q: expected error", k, v)
+		}
+	}
+}
+
+func TestLookupSources(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "channels.json")
+	if err := os.WriteFile(path, []byte(`{"defaults":{"UPLOAD_DAILY_LIMIT":5},"channels":{"streamer1":{"UPLOAD_DAILY_LIMIT":2}}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CHANNEL_CONFIG_FILE", path)
+	t.Setenv("UPLOAD_MAX_ATTEMPTS", "7")
+	t.Setenv("RETENTION_INTERVAL", "")
+	ctx := context.Background()
+	cases := []struct{ channel, key, value, source string }{
+		{"streamer1", "UPLOAD_DAILY_LIMIT", "2", SourceChannelFile},
+		{"streamer2", "UPLOAD_DAILY_LIMIT", "5", SourceFile},
+		{"", "UPLOAD_MAX_ATTEMPTS", "7", SourceEnv},
+		{"", "RETENTION_INTERVAL", "6h0m0s", SourceDefault},
+	}
+	for _, c := range cases {
+		if v, src := Lookup(ctx, nil, c.channel, c.key); v != c.value || src != c.source {
+			t.Errorf("Lookup(%q, %s) = %q from %s, want %q from %s", c.channel, c.key, v, src, c.value, c.source)
+		}
+	}
+}
+
+func TestReloadRuntimeNotifiesOnFileChange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "channels.json")
+	if err := os.WriteFile(path, []byte(`{"defaults":{"UPLOAD_DAILY_LIMIT":5}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CHANNEL_CONFIG_FILE", path)
+	ctx := context.Background()
+	changes, stop := WatchRuntime()
+	defer stop()
+
+	if _, err := ReloadRuntime(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := ReloadRuntime(ctx, nil); err != nil || changed {
+		t.Fatalf("unchanged reload = %v, %v", changed, err)
+	}
+	select {
+	case <-changes:
+	default:
+	}
+
+	if err := os.WriteFile(path, []byte(`{"defaults":{"UPLOAD_DAILY_LIMIT":15}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// Make sure the change is visible even on filesystems with coarse mtimes.
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := ReloadRuntime(ctx, nil); err != nil || !changed {
+		t.Fatalf("reload after edit = %v, %v", changed, err)
+	}
+	select {
+	case <-changes:
+	default:
+		t.Fatal("watcher not notified")
+	}
+	if cfg, _ := LoadChannelConfig(ctx, nil, ""); cfg.UploadDailyLimit != 15 {
+		t.Fatalf("UploadDailyLimit = %d, want 15", cfg.UploadDailyLimit)
+	}
+}
+
+func TestRuntimeOverridePrecedence(t *testing.T) {
+	db := testutil.SetupTestDB(t)
+	ctx := context.Background()
+	channel := "test_runtime_override"
+	cleanup := func() {
+		_, _ = db.ExecContext(context.Background(), `DELETE FROM kv WHERE channel='' AND key='cfg:UPLOAD_DAILY_LIMIT'`)
+		_, _ = db.ExecContext(context.Background(), `DELETE FROM channel_settings WHERE channel=$1`, channel)
+	}
+	cleanup()
+	t.Cleanup(cleanup)
+	t.Setenv("CHANNEL_CONFIG_FILE", "")
+	t.Setenv("UPLOAD_DAILY_LIMIT", "20")
+
+	if err := SetRuntimeOverride(ctx, db, "UPLOAD_DAILY_LIMIT", "4"); err != nil {
+		t.Fatal(err)
+	}
+	if v, src := Lookup(ctx, db, channel, "UPLOAD_DAILY_LIMIT"); v != "4" || src != SourceKV {
+		t.Fatalf("with override = %q from %s", v, src)
+	}
+	if _, err := db.ExecContext(ctx, `INSERT INTO channel_settings (channel, key, value) VALUES ($1, 'UPLOAD_DAILY_LIMIT', '1')`, channel); err != nil {
+		t.Fatal(err)
+	}
+	if cfg, err := LoadChannelConfig(ctx, db, channel); err != nil || cfg.UploadDailyLimit != 1 {
+		t.Fatalf("channel setting should win: %d, %v", cfg.UploadDailyLimit, err)
+	}
+	if err := SetRuntimeOverride(ctx, db, "UPLOAD_DAILY_LIMIT", ""); err != nil {
+		t.Fatal(err)
+	}
+	if v, src := Lookup(ctx, db, "", "UPLOAD_DAILY_LIMIT"); v != "20" || src != SourceEnv {
+		t.Fatalf("after removing override = %q from %s", v, src)
+	}
+}
@@ -222,6 +222,223 @@ func migratePostgres(ctx context.Context, db *sql.DB) error {
 		)`,
 		`CREATE INDEX IF NOT EXISTS idx_rate_limit_ip_time ON rate_limit_requests(ip, request_time)`,
 		`CREATE INDEX IF NOT EXISTS idx_rate_limit_time ON rate_limit_requests(request_time)`,
+		// Lease table for distributed VOD work claiming across replicas
+		`CREATE TABLE IF NOT EXISTS vod_leases (
+			twitch_vod_id TEXT PRIMARY KEY REFERENCES vods(twitch_vod_id) ON DELETE CASCADE,
+			owner TEXT NOT NULL,
+			acquired_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			heartbeat_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			expires_at TIMESTAMPTZ NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_vod_leases_expires_at ON vod_leases(expires_at)`,
+		// Explicit VOD lifecycle status + transition history
+		// Backfilled from the legacy columns as in 000006_add_vod_status.up.sql, but only
+		// when the column is new so discovered VODs are not requeued on every start.
+		`DO $$
+		BEGIN
+			IF NOT EXISTS (
+				SELECT 1 FROM information_schema.columns
+				WHERE table_schema = current_schema() AND table_name = 'vods' AND column_name = 'status'
+			) THEN
+				ALTER TABLE vods ADD COLUMN status TEXT NOT NULL DEFAULT 'discovered'
+					CHECK (status IN ('discovered','queued','downloading','downloaded','uploading','uploaded','skipped','archived','failed'));
+				UPDATE vods SET status = CASE
+					WHEN COALESCE(processed, FALSE) AND COALESCE(youtube_url, '') <> '' THEN 'uploaded'
+					WHEN COALESCE(processed, FALSE) THEN 'skipped'
+					WHEN COALESCE(processing_error, '') <> '' THEN 'failed'
+					WHEN COALESCE(downloaded_path, '') <> '' THEN 'downloaded'
+					ELSE 'queued'
+				END;
+			END IF;
+		END $$`,
+		`CREATE INDEX IF NOT EXISTS idx_vods_channel_status ON vods(channel, status)`,
+		`CREATE TABLE IF NOT EXISTS vod_state_transitions (
+			id BIGSERIAL PRIMARY KEY,
+			vod_id TEXT NOT NULL REFERENCES vods(twitch_vod_id) ON DELETE CASCADE,
+			from_status TEXT,
+			to_status TEXT NOT NULL,
+			reason TEXT,
+			actor TEXT,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_vod_state_transitions_vod_created ON vod_state_transitions(vod_id, created_at)`,
+		// Per-stage pipeline results for resumable processing
+		`CREATE TABLE IF NOT EXISTS vod_stage_results (
+			vod_id TEXT NOT NULL REFERENCES vods(twitch_vod_id) ON DELETE CASCADE,
+			stage TEXT NOT NULL,
+			status TEXT NOT NULL CHECK (status IN ('running','succeeded','failed')),
+			outputs JSONB NOT NULL DEFAULT '{}'::jsonb,
+			error TEXT,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			started_at TIMESTAMPTZ,
+			finished_at TIMESTAMPTZ,
+			PRIMARY KEY (vod_id, stage)
+		)`,
+		// Typed download progress (speed, ETA, fragment position)
+		`ALTER TABLE vods ADD COLUMN IF NOT EXISTS download_speed DOUBLE PRECISION`,
+		`ALTER TABLE vods ADD COLUMN IF NOT EXISTS download_eta_seconds INTEGER`,
+		`ALTER TABLE vods ADD COLUMN IF NOT EXISTS download_fragment_index INTEGER`,
+		`ALTER TABLE vods ADD COLUMN IF NOT EXISTS download_fragment_count INTEGER`,
+		// Per-destination upload state (YouTube, S3, local)
+		`CREATE TABLE IF NOT EXISTS vod_uploads (
+			vod_id TEXT NOT NULL REFERENCES vods(twitch_vod_id) ON DELETE CASCADE,
+			destination TEXT NOT NULL,
+			status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending','uploading','succeeded','failed')),
+			required BOOLEAN NOT NULL DEFAULT TRUE,
+			url TEXT,
+			remote_key TEXT,
+			retries INTEGER NOT NULL DEFAULT 0,
+			last_error TEXT,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			PRIMARY KEY (vod_id, destination)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_vod_uploads_destination_status ON vod_uploads(destination, status)`,
+		// Resumable upload sessions
+		`ALTER TABLE vod_uploads ADD COLUMN IF NOT EXISTS session_uri TEXT`,
+		`ALTER TABLE vod_uploads ADD COLUMN IF NOT EXISTS session_offset BIGINT NOT NULL DEFAULT 0`,
+		`ALTER TABLE vod_uploads ADD COLUMN IF NOT EXISTS session_size BIGINT`,
+		`ALTER TABLE vod_uploads ADD COLUMN IF NOT EXISTS session_updated_at TIMESTAMPTZ`,
+		// Chapters (Twitch markers, category changes, manual edits)
+		`CREATE TABLE IF NOT EXISTS vod_chapters (
+			id BIGSERIAL PRIMARY KEY,
+			vod_id TEXT NOT NULL REFERENCES vods(twitch_vod_id) ON DELETE CASCADE,
+			start_seconds INTEGER NOT NULL CHECK (start_seconds >= 0),
+			title TEXT NOT NULL,
+			source TEXT NOT NULL CHECK (source IN ('marker','category','manual')),
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			UNIQUE (vod_id, start_seconds)
+		)`,
+		// Segments (manual or automatic parts uploaded as separate videos)
+		`CREATE TABLE IF NOT EXISTS vod_segments (
+			id TEXT PRIMARY KEY,
+			vod_id TEXT NOT NULL REFERENCES vods(twitch_vod_id) ON DELETE CASCADE,
+			channel TEXT NOT NULL DEFAULT '',
+			type TEXT NOT NULL DEFAULT 'part' CHECK (type IN ('part','highlight','chapter','bookmark','clip')),
+			title TEXT NOT NULL,
+			start_time DOUBLE PRECISION NOT NULL CHECK (start_time >= 0),
+			end_time DOUBLE PRECISION NOT NULL,
+			description TEXT,
+			tags JSONB NOT NULL DEFAULT '[]',
+			metadata JSONB,
+			auto BOOLEAN NOT NULL DEFAULT FALSE,
+			upload_status TEXT CHECK (upload_status IN ('pending','uploading','succeeded','failed')),
+			upload_url TEXT,
+			upload_error TEXT,
+			upload_attempts INTEGER NOT NULL DEFAULT 0,
+			session_uri TEXT,
+			session_offset BIGINT NOT NULL DEFAULT 0,
+			session_size BIGINT,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			CHECK (end_time > start_time)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_vod_segments_vod_start ON vod_segments(vod_id, start_time)`,
+		`CREATE INDEX IF NOT EXISTS idx_vod_segments_vod_type ON vod_segments(vod_id, type)`,
+		// Chat full-text search
+		`ALTER TABLE chat_messages ADD COLUMN IF NOT EXISTS message_tsv tsvector GENERATED ALWAYS AS (to_tsvector('simple', COALESCE(message, ''))) STORED`,
+		`CREATE INDEX IF NOT EXISTS idx_chat_messages_tsv ON chat_messages USING GIN (message_tsv)`,
+		// Chat spike highlights
+		`CREATE TABLE IF NOT EXISTS vod_highlights (
+			id BIGSERIAL PRIMARY KEY,
+			vod_id TEXT NOT NULL REFERENCES vods(twitch_vod_id) ON DELETE CASCADE,
+			start_seconds DOUBLE PRECISION NOT NULL,
+			end_seconds DOUBLE PRECISION NOT NULL,
+			peak_seconds DOUBLE PRECISION NOT NULL,
+			message_count INTEGER NOT NULL,
+			baseline DOUBLE PRECISION NOT NULL,
+			score DOUBLE PRECISION NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_vod_highlights_vod_start ON vod_highlights(vod_id, start_seconds)`,
+		// Chat events (subs, raids, cheers, moderation) and moderated message flags
+		`CREATE TABLE IF NOT EXISTS chat_events (
+			id BIGSERIAL PRIMARY KEY,
+			vod_id TEXT NOT NULL REFERENCES vods(twitch_vod_id) ON DELETE CASCADE,
+			channel TEXT NOT NULL DEFAULT '',
+			type TEXT NOT NULL,
+			username TEXT,
+			recipient TEXT,
+			message TEXT,
+			system_message TEXT,
+			target_message_id TEXT,
+			amount INTEGER NOT NULL DEFAULT 0,
+			duration_seconds INTEGER NOT NULL DEFAULT 0,
+			tags JSONB,
+			abs_timestamp TIMESTAMPTZ NOT NULL,
+			rel_timestamp DOUBLE PRECISION NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_chat_events_vod_rel ON chat_events(vod_id, rel_timestamp)`,
+		`ALTER TABLE chat_messages ADD COLUMN IF NOT EXISTS moderated_at TIMESTAMPTZ`,
+		`ALTER TABLE chat_messages ADD COLUMN IF NOT EXISTS moderation TEXT`,
+		// Twitch IRC tags on chat messages
+		`ALTER TABLE chat_messages ADD COLUMN IF NOT EXISTS message_id TEXT`,
+		`ALTER TABLE chat_messages ADD COLUMN IF NOT EXISTS user_id TEXT`,
+		`ALTER TABLE chat_messages ADD COLUMN IF NOT EXISTS display_name TEXT`,
+		`ALTER TABLE chat_messages ADD COLUMN IF NOT EXISTS emote_positions JSONB`,
+		`ALTER TABLE chat_messages ADD COLUMN IF NOT EXISTS bits INTEGER NOT NULL DEFAULT 0`,
+		`ALTER TABLE chat_messages ADD COLUMN IF NOT EXISTS first_message BOOLEAN NOT NULL DEFAULT FALSE`,
+		`ALTER TABLE chat_messages ADD COLUMN IF NOT EXISTS tags JSONB`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_chat_messages_message_id ON chat_messages(message_id) WHERE message_id IS NOT NULL`,
+		`CREATE INDEX IF NOT EXISTS idx_chat_messages_reply_to ON chat_messages(reply_to_id) WHERE reply_to_id <> ''`,
+		// Chat recorder connection gaps
+		`CREATE TABLE IF NOT EXISTS chat_gaps (
+			id BIGSERIAL PRIMARY KEY,
+			vod_id TEXT NOT NULL REFERENCES vods(twitch_vod_id) ON DELETE CASCADE,
+			channel TEXT NOT NULL DEFAULT '',
+			start_abs TIMESTAMPTZ NOT NULL,
+			end_abs TIMESTAMPTZ,
+			start_rel DOUBLE PRECISION NOT NULL,
+			end_rel DOUBLE PRECISION,
+			reason TEXT,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_chat_gaps_vod_start ON chat_gaps(vod_id, start_abs)`,
+		// Historical chat import jobs
+		`CREATE TABLE IF NOT EXISTS chat_imports (
+			vod_id TEXT PRIMARY KEY REFERENCES vods(twitch_vod_id) ON DELETE CASCADE,
+			source TEXT NOT NULL,
+			state TEXT NOT NULL,
+			imported BIGINT NOT NULL DEFAULT 0,
+			duplicates BIGINT NOT NULL DEFAULT 0,
+			offset_seconds DOUBLE PRECISION NOT NULL DEFAULT 0,
+			duration_seconds DOUBLE PRECISION NOT NULL DEFAULT 0,
+			error TEXT,
+			started_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			finished_at TIMESTAMPTZ
+		)`,
+		// VODs removed or retitled on Twitch
+		`ALTER TABLE vods ADD COLUMN IF NOT EXISTS twitch_deleted_at TIMESTAMPTZ`,
+		`CREATE TABLE IF NOT EXISTS vod_title_history (
+			id BIGSERIAL PRIMARY KEY,
+			vod_id TEXT NOT NULL REFERENCES vods(twitch_vod_id) ON DELETE CASCADE,
+			old_title TEXT NOT NULL,
+			new_title TEXT NOT NULL,
+			changed_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_vod_title_history_vod_changed ON vod_title_history(vod_id, changed_at)`,
+		// Per-channel setting overrides (keys are environment variable names)
+		`CREATE TABLE IF NOT EXISTS channel_settings (
+			channel TEXT NOT NULL,
+			key TEXT NOT NULL,
+			value TEXT NOT NULL,
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			PRIMARY KEY (channel, key)
+		)`,
+		// Channels managed at runtime by the channel supervisor
+		`CREATE TABLE IF NOT EXISTS channels (
+			name TEXT PRIMARY KEY,
+			enabled BOOLEAN NOT NULL DEFAULT TRUE,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_channels_name_lower ON channels(LOWER(name))`,
+		// Chapter sync attempts
+		`ALTER TABLE vods ADD COLUMN IF NOT EXISTS chapters_synced_at TIMESTAMPTZ`,
+		// Highlight detection runs
+		`ALTER TABLE vods ADD COLUMN IF NOT EXISTS highlights_analyzed_at TIMESTAMPTZ`,
 	}
 	for i, s := range stmts {
 		if _, err := db.ExecContext(ctx, s); err != nil {
@@ -351,14 +568,143 @@ func GetOAuthTokenForChannel(ctx context.Context, dbx *sql.DB, provider, channel
 	return access, refresh, expiry, scope, nil
 }
 
+// OAuthTokenChannels lists the channels that have a stored token for provider,
+// including the default (empty) channel when it has one.
+func OAuthTokenChannels(ctx context.Context, dbx *sql.DB, provider string) ([]string, error) {
+	rows, err := dbx.QueryContext(ctx, `SELECT channel FROM oauth_tokens WHERE provider=$1 ORDER BY channel`, provider)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	var out []string
+	for rows.Next() {
+		var ch string
+		if err := rows.Scan(&ch); err != nil {
+			return nil, err
+		}
+		out = append(out, ch)
+	}
+	return out, rows.Err()
+}
+
+// ResolveOAuthChannel returns channel when it has its own stored token for provider,
+// otherwise the default (empty) channel, whose token is shared by channels without one.
+// Channel names match case-insensitively.
+func ResolveOAuthChannel(ctx context.Context, dbx *sql.DB, provider, channel string) (string, error) {
+	if channel == "" {
+		return "", nil
+	}
+	var stored string
+	err := dbx.QueryRowContext(ctx, `SELECT channel FROM oauth_tokens WHERE provider=$1 AND LOWER(channel)=LOWER($2) LIMIT 1`, provider, channel).Scan(&stored)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return stored, nil
+}
+
+// SetTwitchBotLogin records the Twitch login that owns channel's stored twitch token,
+// so the chat bot can log in as that account.
+func SetTwitchBotLogin(ctx context.Context, dbx *sql.DB, channel, login string) error {
+	_, err := dbx.ExecContext(ctx, `INSERT INTO kv (channel,key,value,updated_at) VALUES ($1,'twitch_bot_login',$2,NOW())
+		ON CONFLICT(channel,key) DO UPDATE SET value=EXCLUDED.value, updated_at=NOW()`, channel, login)
+	return err
+}
+
+// GetTwitchBotLogin returns the login recorded by SetTwitchBotLogin, or "" if none.
+func GetTwitchBotLogin(ctx context.Context, dbx *sql.DB, channel string) (string, error) {
+	var login string
+	err := dbx.QueryRowContext(ctx, `SELECT value FROM kv WHERE channel=$1 AND key='twitch_bot_login'`, channel).Scan(&login)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return login, err
+}
+
+// Channel is a row of the channels table.
+type Channel struct {
+	Name      string    `json:"name"`
+	Enabled   bool      `json:"enabled"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SeedChannels adds names to the channels table as enabled. Channels already in the
+// table keep their row, so one disabled at runtime stays disabled. An empty list seeds
+// the default channel (empty name), so it keeps running when other channels are added.
+func SeedChannels(ctx context.Context, dbx *sql.DB, names []string) error {
+	if len(names) == 0 {
+		_, err := dbx.ExecContext(ctx, `INSERT INTO channels (name) VALUES ('') ON CONFLICT DO NOTHING`)
+		return err
+	}
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		if _, err := dbx.ExecContext(ctx, `INSERT INTO channels (name) VALUES ($1) ON CONFLICT DO NOTHING`, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListChannels returns every row of the channels table ordered by name.
+func ListChannels(ctx context.Context, dbx *sql.DB) ([]Channel, error) {
+	rows, err := dbx.QueryContext(ctx, `SELECT name, enabled, created_at, updated_at FROM channels ORDER BY LOWER(name)`)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	out := []Channel{}
+	for rows.Next() {
+		var c Channel
+		if err := rows.Scan(&c.Name, &c.Enabled, &c.CreatedAt, &c.UpdatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// EnableChannel enables the channel named name (matched case-insensitively), adding
+// it when it is not in the table yet.
+func EnableChannel(ctx context.Context, dbx *sql.DB, name string) (Channel, error) {
+	c, err := setChannelEnabled(ctx, dbx, name, true)
+	if err != sql.ErrNoRows {
+		return c, err
+	}
+	err = dbx.QueryRowContext(ctx, `INSERT INTO channels (name) VALUES ($1) RETURNING name, enabled, created_at, updated_at`, name).
+		Scan(&c.Name, &c.Enabled, &c.CreatedAt, &c.UpdatedAt)
+	return c, err
+}
+
+// DisableChannel disables the channel named name (matched case-insensitively). Its
+// data is kept. Returns sql.ErrNoRows when the channel is not in the table.
+func DisableChannel(ctx context.Context, dbx *sql.DB, name string) (Channel, error) {
+	return setChannelEnabled(ctx, dbx, name, false)
+}
+
+func setChannelEnabled(ctx context.Context, dbx *sql.DB, name string, enabled bool) (Channel, error) {
+	var c Channel
+	err := dbx.QueryRowContext(ctx, `UPDATE channels SET enabled=$2, updated_at=NOW() WHERE LOWER(name)=LOWER($1)
+		RETURNING name, enabled, created_at, updated_at`, name, enabled).Scan(&c.Name, &c.Enabled, &c.CreatedAt, &c.UpdatedAt)
+	return c, err
+}
+
 // TokenStoreAdapter implements youtubeapi.TokenStore and reuses the table structure here.
-type TokenStoreAdapter struct{ DB *sql.DB }
+// Channel selects the oauth_tokens row; empty is the default channel.
+type TokenStoreAdapter struct {
+	DB      *sql.DB
+	Channel string
+}
 
 func (t *TokenStoreAdapter) UpsertOAuthToken(ctx context.Context, provider string, accessToken string, refreshToken string, expiry time.Time, raw string) error {
-	return UpsertOAuthToken(ctx, t.DB, provider, accessToken, refreshToken, expiry, raw, "")
+	return UpsertOAuthTokenForChannel(ctx, t.DB, provider, t.Channel, accessToken, refreshToken, expiry, raw, "")
 }
 
 func (t *TokenStoreAdapter) GetOAuthToken(ctx context.Context, provider string) (accessToken string, refreshToken string, expiry time.Time, raw string, err error) {
-	access, refresh, exp, scope, err := GetOAuthToken(ctx, t.DB, provider)
+	access, refresh, exp, scope, err := GetOAuthTokenForChannel(ctx, t.DB, provider, t.Channel)
 	return access, refresh, exp, scope, err
 }
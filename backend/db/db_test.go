@@ -3,11 +3,13 @@ package db
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"os"
 	"testing"
 	"time"
 
-	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
 )
 
 func TestMigrate(t *testing.T) {
@@ -194,6 +196,212 @@ func TestTokenStoreAdapter(t *testing.T) {
 	}
 }
 
+func TestResolveOAuthChannel(t *testing.T) {
+	dsn := os.Getenv("TEST_PG_DSN")
+	if dsn == "" {
+		t.Skip("TEST_PG_DSN not set")
+	}
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+
+	if err := Migrate(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _, _ = db.Exec(`DELETE FROM oauth_tokens WHERE provider='resolve-test'`) }()
+
+	expiry := time.Now().Add(1 * time.Hour)
+	if err := (&TokenStoreAdapter{DB: db}).UpsertOAuthToken(ctx, "resolve-test", "default-access", "r", expiry, ""); err != nil {
+		t.Fatal(err)
+	}
+	own := &TokenStoreAdapter{DB: db, Channel: "OwnChannel"}
+	if err := own.UpsertOAuthToken(ctx, "resolve-test", "own-access", "r", expiry, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct{ channel, want string }{
+		{"", ""},
+		{"ownchannel", "OwnChannel"},
+		{"otherchannel", ""},
+	}
+	for _, tt := range tests {
+		got, err := ResolveOAuthChannel(ctx, db, "resolve-test", tt.channel)
+		if err != nil {
+			t.Fatalf("ResolveOAuthChannel(%q) error = %v", tt.channel, err)
+		}
+		if got != tt.want {
+			t.Errorf("ResolveOAuthChannel(%q) = %q, want %q", tt.channel, got, tt.want)
+		}
+	}
+	if access, _, _, _, err := own.GetOAuthToken(ctx, "resolve-test"); err != nil || access != "own-access" {
+		t.Errorf("channel adapter access = %q, %v; want own-access", access, err)
+	}
+	channels, err := OAuthTokenChannels(ctx, db, "resolve-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(channels) != 2 || channels[0] != "" || channels[1] != "OwnChannel" {
+		t.Errorf("OAuthTokenChannels() = %q", channels)
+	}
+}
+
+func TestMigrateBackfillsStatus(t *testing.T) {
+	dsn := os.Getenv("TEST_PG_DSN")
+	if dsn == "" {
+		t.Skip("TEST_PG_DSN not set")
+	}
+	// The test drops vods.status, so it runs in a schema of its own: other packages'
+	// tests use the shared database in parallel.
+	db := openSchemaDB(t, dsn)
+
+	ctx := context.Background()
+	if err := Migrate(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+	// Simulate a database from before the status column.
+	if _, err := db.ExecContext(ctx, `ALTER TABLE vods DROP COLUMN status CASCADE`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.ExecContext(ctx, `INSERT INTO vods (twitch_vod_id, processed, youtube_url, created_at) VALUES
+		('backfill_uploaded', TRUE, 'https://youtu.be/x', NOW()),
+		('backfill_skipped', TRUE, NULL, NOW()),
+		('backfill_pending', FALSE, NULL, NOW())`); err != nil {
+		t.Fatal(err)
+	}
+	if err := Migrate(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+	// A second run must not touch statuses set since.
+	if _, err := db.ExecContext(ctx, `UPDATE vods SET status='discovered' WHERE twitch_vod_id='backfill_pending'`); err != nil {
+		t.Fatal(err)
+	}
+	if err := Migrate(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"backfill_uploaded": "uploaded", "backfill_skipped": "skipped", "backfill_pending": "discovered"}
+	for id, st := range want {
+		var got string
+		if err := db.QueryRowContext(ctx, `SELECT status FROM vods WHERE twitch_vod_id=$1`, id).Scan(&got); err != nil {
+			t.Fatal(err)
+		}
+		if got != st {
+			t.Errorf("%s: status %q, want %q", id, got, st)
+		}
+	}
+}
+
+// openSchemaDB creates a fresh schema in the database at dsn, dropped when the test ends,
+// and returns a pool whose connections use it as search_path.
+func openSchemaDB(t *testing.T, dsn string) *sql.DB {
+	t.Helper()
+	admin, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = admin.Close() })
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec(`CREATE SCHEMA ` + schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _, _ = admin.Exec(`DROP SCHEMA ` + schema + ` CASCADE`) })
+
+	cfg, err := pgx.ParseConfig(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.RuntimeParams["search_path"] = schema
+	db := stdlib.OpenDB(*cfg)
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+func TestChannels(t *testing.T) {
+	dsn := os.Getenv("TEST_PG_DSN")
+	if dsn == "" {
+		t.Skip("TEST_PG_DSN not set")
+	}
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	if err := Migrate(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _, _ = db.Exec(`DELETE FROM channels WHERE LOWER(name) LIKE 'chantest_%'`) }()
+
+	if err := SeedChannels(ctx, db, []string{"ChanTest_A", ""}); err != nil {
+		t.Fatal(err)
+	}
+	if c, err := DisableChannel(ctx, db, "chantest_a"); err != nil || c.Name != "ChanTest_A" || c.Enabled {
+		t.Fatalf("DisableChannel() = %+v, %v", c, err)
+	}
+	// Seeding again leaves the disabled row alone.
+	if err := SeedChannels(ctx, db, []string{"chantest_a"}); err != nil {
+		t.Fatal(err)
+	}
+	if c, err := EnableChannel(ctx, db, "chantest_b"); err != nil || !c.Enabled {
+		t.Fatalf("EnableChannel(new) = %+v, %v", c, err)
+	}
+	if _, err := DisableChannel(ctx, db, "chantest_missing"); err != sql.ErrNoRows {
+		t.Fatalf("DisableChannel(unknown) error = %v, want sql.ErrNoRows", err)
+	}
+
+	all, err := ListChannels(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]bool{}
+	for _, c := range all {
+		got[c.Name] = c.Enabled
+	}
+	if len(got) < 2 || got["ChanTest_A"] || !got["chantest_b"] {
+		t.Errorf("ListChannels() = %+v", all)
+	}
+	if _, ok := got["chantest_a"]; ok {
+		t.Error("seeding created a second row differing only in case")
+	}
+}
+
+func TestSeedDefaultChannel(t *testing.T) {
+	dsn := os.Getenv("TEST_PG_DSN")
+	if dsn == "" {
+		t.Skip("TEST_PG_DSN not set")
+	}
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	if err := Migrate(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = db.Exec(`DELETE FROM channels WHERE name=''`)
+	defer func() { _, _ = db.Exec(`DELETE FROM channels WHERE name=''`) }()
+
+	if err := SeedChannels(ctx, db, nil); err != nil {
+		t.Fatal(err)
+	}
+	if c, err := DisableChannel(ctx, db, ""); err != nil || c.Name != "" || c.Enabled {
+		t.Fatalf("DisableChannel(default) = %+v, %v", c, err)
+	}
+	// Seeding again leaves the disabled default alone; enabling it works like any channel.
+	if err := SeedChannels(ctx, db, nil); err != nil {
+		t.Fatal(err)
+	}
+	if c, err := EnableChannel(ctx, db, ""); err != nil || !c.Enabled {
+		t.Fatalf("EnableChannel(default) = %+v, %v", c, err)
+	}
+}
+
 func TestConnect(t *testing.T) {
 	// Save original env
 	origDSN := os.Getenv("DB_DSN")
@@ -333,6 +333,19 @@ func cleanDatabase(t *testing.T, ctx context.Context, db *sql.DB) {
 	t.Helper()
 
 	statements := []string{
+		`DROP TABLE IF EXISTS channels CASCADE`,
+		`DROP TABLE IF EXISTS channel_settings CASCADE`,
+		`DROP TABLE IF EXISTS vod_title_history CASCADE`,
+		`DROP TABLE IF EXISTS chat_imports CASCADE`,
+		`DROP TABLE IF EXISTS chat_gaps CASCADE`,
+		`DROP TABLE IF EXISTS chat_events CASCADE`,
+		`DROP TABLE IF EXISTS vod_highlights CASCADE`,
+		`DROP TABLE IF EXISTS vod_segments CASCADE`,
+		`DROP TABLE IF EXISTS vod_chapters CASCADE`,
+		`DROP TABLE IF EXISTS vod_uploads CASCADE`,
+		`DROP TABLE IF EXISTS vod_stage_results CASCADE`,
+		`DROP TABLE IF EXISTS vod_state_transitions CASCADE`,
+		`DROP TABLE IF EXISTS vod_leases CASCADE`,
 		`DROP TABLE IF EXISTS chat_messages CASCADE`,
 		`DROP TABLE IF EXISTS vods CASCADE`,
 		`DROP TABLE IF EXISTS oauth_tokens CASCADE`,
@@ -0,0 +1,8 @@
+-- Rollback distributed VOD work claiming.
+
+BEGIN;
+
+DROP INDEX IF EXISTS idx_vod_leases_expires_at;
+DROP TABLE IF EXISTS vod_leases;
+
+COMMIT;
@@ -0,0 +1,20 @@
+-- Add lease table for distributed VOD work claiming.
+-- Each row records which worker currently owns a VOD and until when. A worker
+-- keeps its lease alive with periodic heartbeats; expired leases are reclaimed
+-- by the next worker that claims the VOD.
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS vod_leases (
+    twitch_vod_id TEXT PRIMARY KEY REFERENCES vods(twitch_vod_id) ON DELETE CASCADE,
+    owner TEXT NOT NULL,
+    acquired_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    heartbeat_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+-- Index for expiry checks during claim and for lease monitoring
+CREATE INDEX IF NOT EXISTS idx_vod_leases_expires_at
+    ON vod_leases(expires_at);
+
+COMMIT;
@@ -0,0 +1,10 @@
+-- Rollback VOD lifecycle status and transition history.
+
+BEGIN;
+
+DROP INDEX IF EXISTS idx_vod_state_transitions_vod_created;
+DROP TABLE IF EXISTS vod_state_transitions;
+DROP INDEX IF EXISTS idx_vods_channel_status;
+ALTER TABLE vods DROP COLUMN IF EXISTS status;
+
+COMMIT;
@@ -0,0 +1,39 @@
+-- Add explicit VOD lifecycle status and transition history.
+-- `status` replaces inference from processed/processing_error/download_state/
+-- downloaded_path/youtube_url. Legacy columns are still written for
+-- compatibility; existing rows are backfilled from them below.
+
+BEGIN;
+
+ALTER TABLE vods
+    ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'discovered'
+    CHECK (status IN ('discovered', 'queued', 'downloading', 'downloaded', 'uploading', 'uploaded', 'skipped', 'archived', 'failed'));
+
+-- Backfill from legacy columns (in-flight downloads are requeued; no worker runs during migration)
+UPDATE vods SET status = CASE
+    WHEN COALESCE(processed, FALSE) AND COALESCE(youtube_url, '') <> '' THEN 'uploaded'
+    WHEN COALESCE(processed, FALSE) THEN 'skipped'
+    WHEN COALESCE(processing_error, '') <> '' THEN 'failed'
+    WHEN COALESCE(downloaded_path, '') <> '' THEN 'downloaded'
+    ELSE 'queued'
+END
+WHERE status = 'discovered';
+
+CREATE INDEX IF NOT EXISTS idx_vods_channel_status
+    ON vods(channel, status);
+
+CREATE TABLE IF NOT EXISTS vod_state_transitions (
+    id BIGSERIAL PRIMARY KEY,
+    vod_id TEXT NOT NULL REFERENCES vods(twitch_vod_id) ON DELETE CASCADE,
+    from_status TEXT,
+    to_status TEXT NOT NULL,
+    reason TEXT,
+    actor TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Index for per-VOD history lookups in chronological order
+CREATE INDEX IF NOT EXISTS idx_vod_state_transitions_vod_created
+    ON vod_state_transitions(vod_id, created_at);
+
+COMMIT;
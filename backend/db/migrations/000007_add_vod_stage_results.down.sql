@@ -0,0 +1,7 @@
+-- Rollback per-stage pipeline results.
+
+BEGIN;
+
+DROP TABLE IF EXISTS vod_stage_results;
+
+COMMIT;
@@ -0,0 +1,20 @@
+-- Add per-stage results for the VOD processing pipeline.
+-- One row per (VOD, stage) holds the latest outcome and the artifacts the
+-- stage produced (e.g. local file path, upload URL) so a failed run resumes
+-- from the first incomplete stage instead of starting over.
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS vod_stage_results (
+    vod_id TEXT NOT NULL REFERENCES vods(twitch_vod_id) ON DELETE CASCADE,
+    stage TEXT NOT NULL,
+    status TEXT NOT NULL CHECK (status IN ('running', 'succeeded', 'failed')),
+    outputs JSONB NOT NULL DEFAULT '{}'::jsonb,
+    error TEXT,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    started_at TIMESTAMPTZ,
+    finished_at TIMESTAMPTZ,
+    PRIMARY KEY (vod_id, stage)
+);
+
+COMMIT;
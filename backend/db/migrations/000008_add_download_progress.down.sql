@@ -0,0 +1,11 @@
+-- Rollback typed download progress columns.
+
+BEGIN;
+
+ALTER TABLE vods
+    DROP COLUMN IF EXISTS download_speed,
+    DROP COLUMN IF EXISTS download_eta_seconds,
+    DROP COLUMN IF EXISTS download_fragment_index,
+    DROP COLUMN IF EXISTS download_fragment_count;
+
+COMMIT;
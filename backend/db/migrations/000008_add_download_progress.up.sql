@@ -0,0 +1,16 @@
+-- Add typed download progress columns.
+-- The downloader used to store raw yt-dlp progress lines in download_state;
+-- speed, ETA and fragment position now get their own columns and
+-- download_state holds only a short state name.
+
+BEGIN;
+
+ALTER TABLE vods
+    ADD COLUMN IF NOT EXISTS download_speed DOUBLE PRECISION,
+    ADD COLUMN IF NOT EXISTS download_eta_seconds INTEGER,
+    ADD COLUMN IF NOT EXISTS download_fragment_index INTEGER,
+    ADD COLUMN IF NOT EXISTS download_fragment_count INTEGER;
+
+UPDATE vods SET download_state = 'downloading' WHERE download_state LIKE '[download]%';
+
+COMMIT;
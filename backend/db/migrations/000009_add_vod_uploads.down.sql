@@ -0,0 +1,7 @@
+-- Rollback per-destination upload state.
+
+BEGIN;
+
+DROP TABLE IF EXISTS vod_uploads;
+
+COMMIT;
@@ -0,0 +1,31 @@
+-- Add per-destination upload state.
+-- A VOD can be uploaded to several destinations (YouTube, S3-compatible
+-- storage, a local/NAS path). Each destination keeps its own URL/key, status
+-- and retry count; a VOD is processed once all required destinations succeed.
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS vod_uploads (
+    vod_id TEXT NOT NULL REFERENCES vods(twitch_vod_id) ON DELETE CASCADE,
+    destination TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'uploading', 'succeeded', 'failed')),
+    required BOOLEAN NOT NULL DEFAULT TRUE,
+    url TEXT,
+    remote_key TEXT,
+    retries INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (vod_id, destination)
+);
+
+CREATE INDEX IF NOT EXISTS idx_vod_uploads_destination_status ON vod_uploads(destination, status);
+
+-- Existing YouTube uploads become succeeded youtube rows.
+INSERT INTO vod_uploads (vod_id, destination, status, url, created_at, updated_at)
+SELECT twitch_vod_id, 'youtube', 'succeeded', youtube_url, COALESCE(updated_at, NOW()), COALESCE(updated_at, NOW())
+FROM vods
+WHERE youtube_url IS NOT NULL AND youtube_url <> ''
+ON CONFLICT (vod_id, destination) DO NOTHING;
+
+COMMIT;
@@ -0,0 +1,11 @@
+-- Rollback resumable upload session state.
+
+BEGIN;
+
+ALTER TABLE vod_uploads
+    DROP COLUMN IF EXISTS session_uri,
+    DROP COLUMN IF EXISTS session_offset,
+    DROP COLUMN IF EXISTS session_size,
+    DROP COLUMN IF EXISTS session_updated_at;
+
+COMMIT;
@@ -0,0 +1,14 @@
+-- Add resumable upload session state to vod_uploads.
+-- YouTube uploads use the resumable protocol; the session URI and the byte
+-- offset YouTube has committed are stored so a retry or a restarted process
+-- continues the same session instead of starting over.
+
+BEGIN;
+
+ALTER TABLE vod_uploads
+    ADD COLUMN IF NOT EXISTS session_uri TEXT,
+    ADD COLUMN IF NOT EXISTS session_offset BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS session_size BIGINT,
+    ADD COLUMN IF NOT EXISTS session_updated_at TIMESTAMPTZ;
+
+COMMIT;
@@ -0,0 +1,7 @@
+-- Rollback per-VOD chapters.
+
+BEGIN;
+
+DROP TABLE IF EXISTS vod_chapters;
+
+COMMIT;
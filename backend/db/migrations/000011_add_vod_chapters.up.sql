@@ -0,0 +1,19 @@
+-- Add per-VOD chapters.
+-- Chapters come from Twitch stream markers and category changes, or are
+-- entered by an admin (source 'manual'). Manual chapters are never
+-- overwritten by the automatic sync. They are written into the YouTube
+-- description as a timestamp list.
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS vod_chapters (
+    id BIGSERIAL PRIMARY KEY,
+    vod_id TEXT NOT NULL REFERENCES vods(twitch_vod_id) ON DELETE CASCADE,
+    start_seconds INTEGER NOT NULL CHECK (start_seconds >= 0),
+    title TEXT NOT NULL,
+    source TEXT NOT NULL CHECK (source IN ('marker', 'category', 'manual')),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (vod_id, start_seconds)
+);
+
+COMMIT;
@@ -0,0 +1,9 @@
+-- Rollback VOD segments.
+
+BEGIN;
+
+DROP INDEX IF EXISTS idx_vod_segments_vod_type;
+DROP INDEX IF EXISTS idx_vod_segments_vod_start;
+DROP TABLE IF EXISTS vod_segments;
+
+COMMIT;
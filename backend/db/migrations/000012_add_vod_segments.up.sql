@@ -0,0 +1,38 @@
+-- Add VOD segments.
+-- A segment is a named time range of a VOD. Segments of type 'part' are cut
+-- out with ffmpeg stream copy and uploaded to YouTube as separate videos;
+-- each part tracks its own upload status and resumable session so one failed
+-- part is retried without re-uploading the others. Parts are created manually
+-- through the API or automatically (auto = TRUE) when a VOD exceeds the
+-- maximum video length.
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS vod_segments (
+    id TEXT PRIMARY KEY,
+    vod_id TEXT NOT NULL REFERENCES vods(twitch_vod_id) ON DELETE CASCADE,
+    channel TEXT NOT NULL DEFAULT '',
+    type TEXT NOT NULL DEFAULT 'part' CHECK (type IN ('part', 'highlight', 'chapter', 'bookmark', 'clip')),
+    title TEXT NOT NULL,
+    start_time DOUBLE PRECISION NOT NULL CHECK (start_time >= 0),
+    end_time DOUBLE PRECISION NOT NULL,
+    description TEXT,
+    tags JSONB NOT NULL DEFAULT '[]',
+    metadata JSONB,
+    auto BOOLEAN NOT NULL DEFAULT FALSE,
+    upload_status TEXT CHECK (upload_status IN ('pending', 'uploading', 'succeeded', 'failed')),
+    upload_url TEXT,
+    upload_error TEXT,
+    upload_attempts INTEGER NOT NULL DEFAULT 0,
+    session_uri TEXT,
+    session_offset BIGINT NOT NULL DEFAULT 0,
+    session_size BIGINT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK (end_time > start_time)
+);
+
+CREATE INDEX IF NOT EXISTS idx_vod_segments_vod_start ON vod_segments(vod_id, start_time);
+CREATE INDEX IF NOT EXISTS idx_vod_segments_vod_type ON vod_segments(vod_id, type);
+
+COMMIT;
@@ -0,0 +1,8 @@
+-- Rollback chat full-text search.
+
+BEGIN;
+
+DROP INDEX IF EXISTS idx_chat_messages_tsv;
+ALTER TABLE chat_messages DROP COLUMN IF EXISTS message_tsv;
+
+COMMIT;
@@ -0,0 +1,14 @@
+-- Add full-text search over chat messages.
+-- message_tsv is a generated tsvector using the 'simple' configuration (no
+-- stemming or stop words, which suits chat slang, emotes and usernames) and is
+-- GIN indexed for /chat/search. Adding the stored column rewrites
+-- chat_messages, so expect this migration to take a while on large archives.
+
+BEGIN;
+
+ALTER TABLE chat_messages ADD COLUMN IF NOT EXISTS message_tsv tsvector
+    GENERATED ALWAYS AS (to_tsvector('simple', COALESCE(message, ''))) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_chat_messages_tsv ON chat_messages USING GIN (message_tsv);
+
+COMMIT;
@@ -0,0 +1,8 @@
+-- Rollback VOD highlights.
+
+BEGIN;
+
+DROP INDEX IF EXISTS idx_vod_highlights_vod_start;
+DROP TABLE IF EXISTS vod_highlights;
+
+COMMIT;
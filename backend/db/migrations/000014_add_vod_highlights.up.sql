@@ -0,0 +1,23 @@
+-- Add VOD highlights.
+-- Candidate highlights are chat spikes: runs of time windows whose message
+-- count stands well above the preceding baseline. They are recomputed from
+-- chat_messages on demand (each detection replaces the VOD's rows) so editors
+-- know where to clip.
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS vod_highlights (
+    id BIGSERIAL PRIMARY KEY,
+    vod_id TEXT NOT NULL REFERENCES vods(twitch_vod_id) ON DELETE CASCADE,
+    start_seconds DOUBLE PRECISION NOT NULL,
+    end_seconds DOUBLE PRECISION NOT NULL,
+    peak_seconds DOUBLE PRECISION NOT NULL,
+    message_count INTEGER NOT NULL,
+    baseline DOUBLE PRECISION NOT NULL,
+    score DOUBLE PRECISION NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_vod_highlights_vod_start ON vod_highlights(vod_id, start_seconds);
+
+COMMIT;
@@ -0,0 +1,10 @@
+-- Rollback chat events and message moderation state.
+
+BEGIN;
+
+ALTER TABLE chat_messages DROP COLUMN IF EXISTS moderation;
+ALTER TABLE chat_messages DROP COLUMN IF EXISTS moderated_at;
+DROP INDEX IF EXISTS idx_chat_events_vod_rel;
+DROP TABLE IF EXISTS chat_events;
+
+COMMIT;
@@ -0,0 +1,33 @@
+-- Add chat events and message moderation state.
+-- chat_events records Twitch IRC occurrences that are not chat messages:
+-- USERNOTICE subs, gifts and raids, cheers, and the CLEARCHAT / CLEARMSG
+-- moderation actions, with the same absolute and relative timestamps as
+-- chat_messages. Messages removed by a timeout, ban or deletion are flagged
+-- (moderated_at, moderation) so replays can hide them.
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS chat_events (
+    id BIGSERIAL PRIMARY KEY,
+    vod_id TEXT NOT NULL REFERENCES vods(twitch_vod_id) ON DELETE CASCADE,
+    channel TEXT NOT NULL DEFAULT '',
+    type TEXT NOT NULL,
+    username TEXT,
+    recipient TEXT,
+    message TEXT,
+    system_message TEXT,
+    target_message_id TEXT,
+    amount INTEGER NOT NULL DEFAULT 0,
+    duration_seconds INTEGER NOT NULL DEFAULT 0,
+    tags JSONB,
+    abs_timestamp TIMESTAMPTZ NOT NULL,
+    rel_timestamp DOUBLE PRECISION NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_chat_events_vod_rel ON chat_events(vod_id, rel_timestamp);
+
+ALTER TABLE chat_messages ADD COLUMN IF NOT EXISTS moderated_at TIMESTAMPTZ;
+ALTER TABLE chat_messages ADD COLUMN IF NOT EXISTS moderation TEXT;
+
+COMMIT;
@@ -0,0 +1,15 @@
+-- Rollback chat message IRC tags.
+
+BEGIN;
+
+DROP INDEX IF EXISTS idx_chat_messages_reply_to;
+DROP INDEX IF EXISTS idx_chat_messages_message_id;
+ALTER TABLE chat_messages DROP COLUMN IF EXISTS tags;
+ALTER TABLE chat_messages DROP COLUMN IF EXISTS first_message;
+ALTER TABLE chat_messages DROP COLUMN IF EXISTS bits;
+ALTER TABLE chat_messages DROP COLUMN IF EXISTS emote_positions;
+ALTER TABLE chat_messages DROP COLUMN IF EXISTS display_name;
+ALTER TABLE chat_messages DROP COLUMN IF EXISTS user_id;
+ALTER TABLE chat_messages DROP COLUMN IF EXISTS message_id;
+
+COMMIT;
@@ -0,0 +1,21 @@
+-- Preserve Twitch IRC tags on chat messages.
+-- message_id (the IRC id tag) is unique when present, so a line received twice
+-- or imported later is stored once and CLEARMSG deletions match exactly.
+-- Replies fill the existing reply_to_* columns from reply-parent-* tags;
+-- emote_positions holds [{id, name, start, end}] code point ranges and tags
+-- the full raw tag map.
+
+BEGIN;
+
+ALTER TABLE chat_messages ADD COLUMN IF NOT EXISTS message_id TEXT;
+ALTER TABLE chat_messages ADD COLUMN IF NOT EXISTS user_id TEXT;
+ALTER TABLE chat_messages ADD COLUMN IF NOT EXISTS display_name TEXT;
+ALTER TABLE chat_messages ADD COLUMN IF NOT EXISTS emote_positions JSONB;
+ALTER TABLE chat_messages ADD COLUMN IF NOT EXISTS bits INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE chat_messages ADD COLUMN IF NOT EXISTS first_message BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE chat_messages ADD COLUMN IF NOT EXISTS tags JSONB;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_chat_messages_message_id ON chat_messages(message_id) WHERE message_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_chat_messages_reply_to ON chat_messages(reply_to_id) WHERE reply_to_id <> '';
+
+COMMIT;
@@ -0,0 +1,8 @@
+-- Rollback chat recorder connection gaps.
+
+BEGIN;
+
+DROP INDEX IF EXISTS idx_chat_gaps_vod_start;
+DROP TABLE IF EXISTS chat_gaps;
+
+COMMIT;
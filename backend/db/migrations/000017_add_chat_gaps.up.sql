@@ -0,0 +1,23 @@
+-- Add chat recorder connection gaps.
+-- chat_gaps records intervals in which the live chat recorder had no IRC
+-- connection (dropped connection, failed dial or login), so replay clients can
+-- tell missing chat caused by an outage from a quiet chat. end_abs and end_rel
+-- stay NULL while the gap is open.
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS chat_gaps (
+    id BIGSERIAL PRIMARY KEY,
+    vod_id TEXT NOT NULL REFERENCES vods(twitch_vod_id) ON DELETE CASCADE,
+    channel TEXT NOT NULL DEFAULT '',
+    start_abs TIMESTAMPTZ NOT NULL,
+    end_abs TIMESTAMPTZ,
+    start_rel DOUBLE PRECISION NOT NULL,
+    end_rel DOUBLE PRECISION,
+    reason TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_chat_gaps_vod_start ON chat_gaps(vod_id, start_abs);
+
+COMMIT;
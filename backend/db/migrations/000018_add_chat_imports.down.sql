@@ -0,0 +1,7 @@
+-- Rollback historical chat import jobs.
+
+BEGIN;
+
+DROP TABLE IF EXISTS chat_imports;
+
+COMMIT;
@@ -0,0 +1,23 @@
+-- Add historical chat import jobs.
+-- chat_imports tracks one import per VOD of replay chat from Twitch or an
+-- uploaded TwitchDownloader file: its state (running, done, failed), the
+-- messages stored and skipped as duplicates, and progress through the VOD
+-- (offset_seconds of duration_seconds).
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS chat_imports (
+    vod_id TEXT PRIMARY KEY REFERENCES vods(twitch_vod_id) ON DELETE CASCADE,
+    source TEXT NOT NULL,
+    state TEXT NOT NULL,
+    imported BIGINT NOT NULL DEFAULT 0,
+    duplicates BIGINT NOT NULL DEFAULT 0,
+    offset_seconds DOUBLE PRECISION NOT NULL DEFAULT 0,
+    duration_seconds DOUBLE PRECISION NOT NULL DEFAULT 0,
+    error TEXT,
+    started_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    finished_at TIMESTAMPTZ
+);
+
+COMMIT;
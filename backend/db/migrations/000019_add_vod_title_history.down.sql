@@ -0,0 +1,9 @@
+-- Rollback Twitch deletion tracking and VOD title history.
+
+BEGIN;
+
+DROP INDEX IF EXISTS idx_vod_title_history_vod_changed;
+DROP TABLE IF EXISTS vod_title_history;
+ALTER TABLE vods DROP COLUMN IF EXISTS twitch_deleted_at;
+
+COMMIT;
@@ -0,0 +1,22 @@
+-- Track VODs removed or retitled on Twitch.
+-- `twitch_deleted_at` is set when a VOD no longer appears in the channel's
+-- Helix archive list (expired or deleted) and cleared if it reappears.
+-- vod_title_history records each title change seen on Twitch.
+
+BEGIN;
+
+ALTER TABLE vods ADD COLUMN IF NOT EXISTS twitch_deleted_at TIMESTAMPTZ;
+
+CREATE TABLE IF NOT EXISTS vod_title_history (
+    id BIGSERIAL PRIMARY KEY,
+    vod_id TEXT NOT NULL REFERENCES vods(twitch_vod_id) ON DELETE CASCADE,
+    old_title TEXT NOT NULL,
+    new_title TEXT NOT NULL,
+    changed_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Index for per-VOD history lookups in chronological order
+CREATE INDEX IF NOT EXISTS idx_vod_title_history_vod_changed
+    ON vod_title_history(vod_id, changed_at);
+
+COMMIT;
@@ -0,0 +1,7 @@
+-- Rollback per-channel setting overrides.
+
+BEGIN;
+
+DROP TABLE IF EXISTS channel_settings;
+
+COMMIT;
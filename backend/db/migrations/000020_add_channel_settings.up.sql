@@ -0,0 +1,15 @@
+-- Per-channel setting overrides.
+-- Keys are environment variable names (e.g. UPLOAD_DAILY_LIMIT); a row overrides
+-- the environment and CHANNEL_CONFIG_FILE for that channel only.
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS channel_settings (
+    channel TEXT NOT NULL,
+    key TEXT NOT NULL,
+    value TEXT NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (channel, key)
+);
+
+COMMIT;
@@ -0,0 +1,8 @@
+-- Rollback runtime-managed channels.
+
+BEGIN;
+
+DROP INDEX IF EXISTS idx_channels_name_lower;
+DROP TABLE IF EXISTS channels;
+
+COMMIT;
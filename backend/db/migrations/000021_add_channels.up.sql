@@ -0,0 +1,17 @@
+-- Channels managed at runtime.
+-- Seeded from TWITCH_CHANNELS at startup; POST/DELETE /admin/channels enable and
+-- disable rows, and the channel supervisor runs the workers of enabled channels.
+
+BEGIN;
+
+CREATE TABLE IF NOT EXISTS channels (
+    name TEXT PRIMARY KEY,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Twitch logins are case-insensitive; keep one row per login.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_channels_name_lower ON channels(LOWER(name));
+
+COMMIT;
@@ -0,0 +1,7 @@
+-- Rollback chapter sync attempts.
+
+BEGIN;
+
+ALTER TABLE vods DROP COLUMN IF EXISTS chapters_synced_at;
+
+COMMIT;
@@ -0,0 +1,10 @@
+-- Record chapter sync attempts.
+-- chapters_synced_at is set once chapters were fetched from Twitch for a VOD
+-- (successfully or not), so the catalog backfill does not query Twitch for the
+-- same unprocessed VODs on every run.
+
+BEGIN;
+
+ALTER TABLE vods ADD COLUMN IF NOT EXISTS chapters_synced_at TIMESTAMPTZ;
+
+COMMIT;
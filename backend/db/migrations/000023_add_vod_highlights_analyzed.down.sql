@@ -0,0 +1,7 @@
+-- Rollback highlight detection runs.
+
+BEGIN;
+
+ALTER TABLE vods DROP COLUMN IF EXISTS highlights_analyzed_at;
+
+COMMIT;
@@ -0,0 +1,9 @@
+-- Record highlight detection runs.
+-- highlights_analyzed_at is set each time chat-spike detection runs for a VOD,
+-- so a VOD without highlights can be told apart from one never analysed.
+
+BEGIN;
+
+ALTER TABLE vods ADD COLUMN IF NOT EXISTS highlights_analyzed_at TIMESTAMPTZ;
+
+COMMIT;
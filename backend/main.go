@@ -2,8 +2,9 @@
 // It:
 //   - Loads configuration and initializes structured logging.
 //   - Connects to Postgres and runs idempotent migrations.
-//   - Starts background jobs: chat recorder (manual or auto), VOD processing,
-//     VOD catalog backfill, and OAuth token refreshers for Twitch/YouTube.
+//   - Starts background jobs: a channel supervisor running each channel's chat
+//     recorder (manual or auto), VOD processing and catalog backfill, and OAuth
+//     token refreshers for Twitch/YouTube.
 //   - Exposes a minimal HTTP server with /healthz, /status, and /metrics.
 //
 // Shutdown is graceful on SIGINT/SIGTERM.
@@ -11,6 +12,7 @@ package main
 
 import (
 	"context"
+	"database/sql"
 	"log/slog"
 	"net/http"
 	_ "net/http/pprof" //nolint:gosec // G108: pprof endpoints enabled only when ENABLE_PPROF=1
@@ -29,9 +31,9 @@ import (
 	"github.com/onnwee/vod-tender/backend/db"
 	"github.com/onnwee/vod-tender/backend/oauth"
 	"github.com/onnwee/vod-tender/backend/server"
+	"github.com/onnwee/vod-tender/backend/supervisor"
 	"github.com/onnwee/vod-tender/backend/telemetry"
 	"github.com/onnwee/vod-tender/backend/twitchapi"
-	"github.com/onnwee/vod-tender/backend/vod"
 )
 
 func main() {
@@ -39,17 +41,11 @@ func main() {
 	_ = godotenv.Load("backend/.env")
 
 	// Configure logging (level + format). Defaults: level=info, format=text.
-	lvl := slog.LevelInfo
-	switch strings.ToLower(os.Getenv("LOG_LEVEL")) {
-	case "debug":
-		lvl = slog.LevelDebug
-	case "warn":
-		lvl = slog.LevelWarn
-	case "error":
-		lvl = slog.LevelError
-	case "info", "":
-		// keep default
-	default:
+	// The level can later be changed at runtime (LOG_LEVEL via /config).
+	var logLevel slog.LevelVar
+	if lvl, ok := config.ParseLogLevel(os.Getenv("LOG_LEVEL")); ok {
+		logLevel.Set(lvl)
+	} else {
 		// unknown level -> keep info but note once using temporary logger
 		tmp := slog.New(slog.NewTextHandler(os.Stdout, nil))
 		tmp.Warn("unknown LOG_LEVEL, using info", slog.String("value", os.Getenv("LOG_LEVEL")))
@@ -58,12 +54,12 @@ func main() {
 	var handler slog.Handler
 	switch format {
 	case "json":
-		handler = slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: lvl})
+		handler = slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: &logLevel})
 	default:
-		handler = slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: lvl})
+		handler = slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: &logLevel})
 	}
 	slog.SetDefault(slog.New(handler))
-	slog.Info("logger initialized", slog.String("level", lvl.String()), slog.String("format", map[bool]string{true: "json", false: "text"}[format == "json"]))
+	slog.Info("logger initialized", slog.String("level", logLevel.Level().String()), slog.String("format", map[bool]string{true: "json", false: "text"}[format == "json"]))
 
 	// Config
 	cfg, err := config.Load()
@@ -144,32 +140,22 @@ func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
-	// Multi-channel support: start workers for each configured channel
-	// Falls back to single-channel mode if TwitchChannels is empty
-	channels := cfg.TwitchChannels
-	if len(channels) == 0 {
-		// Backward compatibility: if no channels configured, use default empty channel
-		channels = []string{""}
-	}
-	
-	slog.Info("starting workers", slog.Int("channel_count", len(channels)), slog.Any("channels", channels))
-	
-	for _, ch := range channels {
-		channel := ch // capture for goroutine
-		// Start per-channel jobs
-		// Chat recorder: either auto mode (poll live) or manual recorder when env has fixed VOD id/start
-		if os.Getenv("CHAT_AUTO_START") == "1" {
-			go chat.StartAutoChatRecorder(ctx, database, channel)
-		} else if err := cfg.ValidateChatReady(); err == nil && channel == os.Getenv("TWITCH_CHANNEL") {
-			// Manual recorder only for the configured TWITCH_CHANNEL
-			go chat.StartTwitchChatRecorder(ctx, database, cfg.TwitchVODID, cfg.TwitchVODStart)
-		} else if channel == "" && len(channels) == 1 {
-			slog.Info("chat recorder disabled (missing twitch creds or auto not enabled)")
-		}
-		go vod.StartVODProcessingJob(ctx, database, channel)
-		go vod.StartVODCatalogBackfillJob(ctx, database, channel)
-		go vod.StartRetentionJob(ctx, database, channel)
+	// Runtime config: record the current overrides, then poll for changes made via
+	// /config, channel_settings or CHANNEL_CONFIG_FILE and notify the workers.
+	if _, err := config.ReloadRuntime(ctx, database); err != nil {
+		slog.Warn("runtime config", slog.Any("err", err))
 	}
+	go config.StartRuntimeReloader(ctx, database)
+	go watchLogLevel(ctx, database, &logLevel)
+
+	// Multi-channel support: the supervisor runs each enabled channel's workers and
+	// starts or stops them as channels are added or removed via /admin/channels.
+	// TWITCH_CHANNELS (or TWITCH_CHANNEL) seeds the channels table.
+	slog.Info("starting workers", slog.Int("configured_channels", len(cfg.TwitchChannels)), slog.Any("channels", cfg.TwitchChannels))
+
+	// All channels record chat through one hub, which shares pooled IRC connections
+	chatHub := chat.NewHub(database)
+	go supervisor.New(database, cfg, chatHub).Run(ctx)
 
 	// Centralized OAuth token refreshers
 	oauth.StartRefresher(ctx, database, "twitch", 5*time.Minute, 15*time.Minute, func(rctx context.Context, refreshToken string) (string, string, time.Time, string, error) {
@@ -217,7 +203,6 @@ func main() {
 	}
 
 	// HTTP server (health/status/metrics)
-	// Allow config override via kv (cfg:HTTP_ADDR) if set through the admin API
 	addr := os.Getenv("HTTP_ADDR")
 	if addr == "" {
 		addr = ":8080"
@@ -232,3 +217,25 @@ func main() {
 	<-ctx.Done()
 	slog.Info("shutting down")
 }
+
+// watchLogLevel applies LOG_LEVEL overrides to level whenever the runtime config changes.
+func watchLogLevel(ctx context.Context, database *sql.DB, level *slog.LevelVar) {
+	changes, stop := config.WatchRuntime()
+	defer stop()
+	apply := func() {
+		v, src := config.Lookup(ctx, database, "", "LOG_LEVEL")
+		if lvl, ok := config.ParseLogLevel(v); ok && lvl != level.Level() {
+			level.Set(lvl)
+			slog.Info("log level changed", slog.String("level", lvl.String()), slog.String("source", src))
+		}
+	}
+	apply()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-changes:
+			apply()
+		}
+	}
+}
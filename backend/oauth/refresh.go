@@ -17,7 +17,8 @@ import (
 // RefreshFunc performs provider-specific refresh and returns (access, refresh, expiry, scope)
 type RefreshFunc func(ctx context.Context, refreshToken string) (string, string, time.Time, string, error)
 
-// StartRefresher launches a goroutine that periodically checks an oauth token row and refreshes it.
+// StartRefresher launches a goroutine that periodically checks every oauth token row
+// for provider (one per channel) and refreshes those close to expiry.
 // provider: key in oauth_tokens table.
 // interval: how often to wake up and check.
 // window: refresh when remaining lifetime <= window.
@@ -51,46 +52,54 @@ func StartRefresher(ctx context.Context, dbx *sql.DB, provider string, interval,
 				return
 			case <-time.After(nextSleep):
 			}
-			// Use db.GetOAuthToken to handle automatic decryption of encrypted tokens
-			_, rt, exp, scope, err := db.GetOAuthToken(ctx, dbx, provider)
+			channels, err := db.OAuthTokenChannels(ctx, dbx, provider)
 			if err != nil {
+				slog.Warn("token refresh: list channels", slog.String("provider", provider), slog.Any("err", err))
 				continue
 			}
-			if rt == "" {
-				continue
-			}
-			// If still outside window skip quickly
-			if time.Until(exp) > window {
-				continue
-			}
-			// Small pre-refresh jitter to avoid stampedes when many pods see same expiry
-			//nolint:gosec // G404: math/rand is sufficient for jitter, not used for security
-			pre := time.Duration(rand.Int63n(int64(5 * time.Second)))
-			select {
-				case <-ctx.Done():
-					return
-				case <-time.After(pre):
-			}
-			ctx2, cancel := context.WithTimeout(ctx, 15*time.Second)
-			newAT, newRT, newExp, newScope, err := fn(ctx2, rt)
-			cancel()
-			if err != nil {
-				slog.Warn("token refresh failed", slog.String("provider", provider), slog.Any("err", err))
-				continue
-			}
-			if newRT == "" {
-				newRT = rt
-			}
-			if newScope == "" {
-				newScope = scope
-			}
-			// Use db.UpsertOAuthToken to handle automatic encryption of tokens
-			err = db.UpsertOAuthToken(ctx, dbx, provider, newAT, newRT, newExp, "", strings.TrimSpace(newScope))
-			if err != nil {
-				slog.Warn("token persist failed", slog.String("provider", provider), slog.Any("err", err))
-				continue
+			for _, channel := range channels {
+				refreshChannel(ctx, dbx, provider, channel, window, fn)
 			}
-			slog.Info("token refreshed", slog.String("provider", provider))
 		}
 	}()
 }
+
+// refreshChannel refreshes one channel's token row for provider when it expires within window.
+func refreshChannel(ctx context.Context, dbx *sql.DB, provider, channel string, window time.Duration, fn RefreshFunc) {
+	// Use db.GetOAuthTokenForChannel to handle automatic decryption of encrypted tokens
+	_, rt, exp, scope, err := db.GetOAuthTokenForChannel(ctx, dbx, provider, channel)
+	if err != nil || rt == "" {
+		return
+	}
+	// If still outside window skip quickly
+	if time.Until(exp) > window {
+		return
+	}
+	// Small pre-refresh jitter to avoid stampedes when many pods see same expiry
+	//nolint:gosec // G404: math/rand is sufficient for jitter, not used for security
+	pre := time.Duration(rand.Int63n(int64(5 * time.Second)))
+	select {
+	case <-ctx.Done():
+		return
+	case <-time.After(pre):
+	}
+	ctx2, cancel := context.WithTimeout(ctx, 15*time.Second)
+	newAT, newRT, newExp, newScope, err := fn(ctx2, rt)
+	cancel()
+	if err != nil {
+		slog.Warn("token refresh failed", slog.String("provider", provider), slog.String("channel", channel), slog.Any("err", err))
+		return
+	}
+	if newRT == "" {
+		newRT = rt
+	}
+	if newScope == "" {
+		newScope = scope
+	}
+	// Use db.UpsertOAuthTokenForChannel to handle automatic encryption of tokens
+	if err := db.UpsertOAuthTokenForChannel(ctx, dbx, provider, channel, newAT, newRT, newExp, "", strings.TrimSpace(newScope)); err != nil {
+		slog.Warn("token persist failed", slog.String("provider", provider), slog.String("channel", channel), slog.Any("err", err))
+		return
+	}
+	slog.Info("token refreshed", slog.String("provider", provider), slog.String("channel", channel))
+}
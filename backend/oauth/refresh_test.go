@@ -281,3 +281,43 @@ func TestStartRefresherWithEncryption(t *testing.T) {
 		t.Error("refresh token should have been updated after refresh")
 	}
 }
+
+func TestStartRefresherPerChannel(t *testing.T) {
+	db := testutil.SetupTestDB(t)
+	t.Cleanup(func() { _, _ = db.Exec(`DELETE FROM oauth_tokens WHERE provider='test-per-channel'`) })
+
+	soonExpiry := time.Now().Add(5 * time.Minute)
+	for _, ch := range []string{"", "chan_a", "chan_b"} {
+		_, err := db.Exec(`INSERT INTO oauth_tokens (provider, channel, access_token, refresh_token, expires_at, scope, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, NOW(), NOW())`,
+			"test-per-channel", ch, "old-access-"+ch, "refresh-"+ch, soonExpiry, "scope1")
+		if err != nil {
+			t.Fatalf("failed to insert test token: %v", err)
+		}
+	}
+
+	refreshFunc := func(ctx context.Context, refreshToken string) (string, string, time.Time, string, error) {
+		return "new-" + refreshToken, "", time.Now().Add(2 * time.Hour), "", nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	StartRefresher(ctx, db, "test-per-channel", 100*time.Millisecond, 15*time.Minute, refreshFunc)
+
+	// Each row is refreshed with its own refresh token.
+	for {
+		var refreshed int
+		err := db.QueryRow(`SELECT COUNT(1) FROM oauth_tokens WHERE provider='test-per-channel' AND access_token = 'new-refresh-' || channel`).Scan(&refreshed)
+		if err != nil {
+			t.Fatalf("failed to query tokens: %v", err)
+		}
+		if refreshed == 3 {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatalf("only %d of 3 channel tokens refreshed", refreshed)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
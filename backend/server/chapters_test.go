@@ -0,0 +1,82 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	dbpkg "github.com/onnwee/vod-tender/backend/db"
+	vodpkg "github.com/onnwee/vod-tender/backend/vod"
+)
+
+func TestAdminVodChaptersEndpoint(t *testing.T) {
+	dsn := os.Getenv("TEST_PG_DSN")
+	if dsn == "" {
+		t.Skip("TEST_PG_DSN not set")
+	}
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("failed to close db: %v", err)
+		}
+	}()
+	ctx := context.Background()
+	if err := dbpkg.Migrate(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+	vodID := "test_chapters_vod_1"
+	if _, err := db.ExecContext(ctx, `INSERT INTO vods (channel, twitch_vod_id, title, date, duration_seconds, created_at)
+		VALUES ('', $1, 'Chapters VOD', NOW(), 3600, NOW()) ON CONFLICT (twitch_vod_id) DO NOTHING`, vodID); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _, _ = db.Exec(`DELETE FROM vods WHERE twitch_vod_id=$1`, vodID) })
+	mux := NewMux(ctx, db)
+
+	put := func(chapters []vodpkg.Chapter) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]any{"vod_id": vodID, "chapters": chapters})
+		req := httptest.NewRequest(http.MethodPut, "/admin/vod/chapters", bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		return w
+	}
+	if w := put([]vodpkg.Chapter{{StartSeconds: 0, Title: ""}}); w.Code != http.StatusBadRequest {
+		t.Fatalf("empty title: status %d", w.Code)
+	}
+	if w := put([]vodpkg.Chapter{{StartSeconds: 600, Title: "Ranked"}, {StartSeconds: 0, Title: "Warmup"}, {StartSeconds: 1800, Title: "Questions"}}); w.Code != http.StatusOK {
+		t.Fatalf("put: status %d body %s", w.Code, w.Body.String())
+	}
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/vod/chapters?vod_id="+vodID, nil))
+	var got struct {
+		Chapters []vodpkg.Chapter `json:"chapters"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Chapters) != 3 || got.Chapters[0].Title != "Warmup" || got.Chapters[0].Source != vodpkg.ChapterSourceManual {
+		t.Fatalf("chapters = %+v", got.Chapters)
+	}
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/vods/"+vodID+"/upload-preview", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `0:00 Warmup\n10:00 Ranked\n30:00 Questions`) {
+		t.Fatalf("upload-preview: status %d body %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/vod/chapters?vod_id=missing_vod", nil))
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("missing vod: status %d", w.Code)
+	}
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/onnwee/vod-tender/backend/chat"
+	dbpkg "github.com/onnwee/vod-tender/backend/db"
+)
+
+func TestAdminVodChatImportUpload(t *testing.T) {
+	dsn := os.Getenv("TEST_PG_DSN")
+	if dsn == "" {
+		t.Skip("TEST_PG_DSN not set")
+	}
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("failed to close db: %v", err)
+		}
+	}()
+	ctx := context.Background()
+	if err := dbpkg.Migrate(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+	vodID := "test_chat_import_vod_1"
+	if _, err := db.ExecContext(ctx, `INSERT INTO vods (channel, twitch_vod_id, title, date, duration_seconds, created_at)
+		VALUES ('', $1, 'Import VOD', NOW(), 60, NOW()) ON CONFLICT (twitch_vod_id) DO NOTHING`, vodID); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_, _ = db.ExecContext(ctx, `DELETE FROM chat_messages WHERE vod_id=$1`, vodID)
+		_, _ = db.ExecContext(ctx, `DELETE FROM vods WHERE twitch_vod_id=$1`, vodID)
+	}()
+	h := NewHandlers(ctx, db)
+
+	body := `{"comments": [
+		{"_id": "` + vodID + `-a", "content_offset_seconds": 3, "commenter": {"name": "viewer"}, "message": {"body": "hello"}},
+		{"_id": "` + vodID + `-b", "content_offset_seconds": 30, "commenter": {"name": "viewer"}, "message": {"body": "again"}}
+	]}`
+	rr := httptest.NewRecorder()
+	h.HandleAdminVodChatImport(rr, httptest.NewRequest(http.MethodPost, "/admin/vod/chat-import?vod_id="+vodID, strings.NewReader(body)))
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("POST status = %d: %s", rr.Code, rr.Body.String())
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("POST Content-Type = %q, want application/json", ct)
+	}
+
+	var st chat.ImportStatus
+	deadline := time.Now().Add(5 * time.Second)
+	for st.State != chat.ImportDone && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+		rr = httptest.NewRecorder()
+		h.HandleAdminVodChatImport(rr, httptest.NewRequest(http.MethodGet, "/admin/vod/chat-import?vod_id="+vodID, nil))
+		if err := json.Unmarshal(rr.Body.Bytes(), &st); err != nil {
+			t.Fatalf("decode status: %v (%s)", err, rr.Body.String())
+		}
+	}
+	if st.State != chat.ImportDone || st.Source != "file" || st.Imported != 2 {
+		t.Fatalf("status = %+v", st)
+	}
+
+	rr = httptest.NewRecorder()
+	h.HandleAdminVodChatImport(rr, httptest.NewRequest(http.MethodPost, "/admin/vod/chat-import?vod_id=missing_vod", strings.NewReader(body)))
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("unknown vod status = %d", rr.Code)
+	}
+}
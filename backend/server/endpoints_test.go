@@ -6,9 +6,12 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
 	"time"
 
+	dbpkg "github.com/onnwee/vod-tender/backend/db"
 	"github.com/onnwee/vod-tender/backend/testutil"
 )
 
@@ -87,27 +90,65 @@ func TestMetricsEndpoint(t *testing.T) {
 func TestConfigEndpoint(t *testing.T) {
 	db := testutil.SetupTestDB(t)
 	handler := NewMux(context.Background(), db)
+	t.Cleanup(func() {
+		_, _ = db.Exec(`DELETE FROM kv WHERE key='cfg:VOD_PROCESS_INTERVAL'`)
+	})
+
+	t.Setenv("VOD_PROCESS_INTERVAL", "5m")
+	t.Setenv("CHANNEL_CONFIG_FILE", "")
+
+	get := func() map[string]configValue {
+		t.Helper()
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/config", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("config status = %d, want %d", w.Code, http.StatusOK)
+		}
+		var cfg map[string]configValue
+		if err := json.NewDecoder(w.Body).Decode(&cfg); err != nil {
+			t.Fatalf("failed to decode config response: %v", err)
+		}
+		return cfg
+	}
 
-	t.Setenv("TWITCH_CHANNEL", "test_channel")
-	t.Setenv("TWITCH_VOD_ID", "test_vod")
+	if got := get()["VOD_PROCESS_INTERVAL"]; got != (configValue{Value: "5m", Source: "env"}) {
+		t.Errorf("VOD_PROCESS_INTERVAL = %+v, want 5m from env", got)
+	}
 
-	req := httptest.NewRequest(http.MethodGet, "/config", nil)
+	req := httptest.NewRequest(http.MethodPut, "/config", strings.NewReader(`{"VOD_PROCESS_INTERVAL":"30s"}`))
 	w := httptest.NewRecorder()
-
 	handler.ServeHTTP(w, req)
-
-	resp := w.Result()
-	if resp.StatusCode != http.StatusOK {
-		t.Errorf("config status = %d, want %d", resp.StatusCode, http.StatusOK)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("put status = %d: %s", w.Code, w.Body.String())
+	}
+	if got := get()["VOD_PROCESS_INTERVAL"]; got != (configValue{Value: "30s", Source: "kv"}) {
+		t.Errorf("VOD_PROCESS_INTERVAL = %+v, want 30s from kv", got)
 	}
+}
 
-	var cfg map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&cfg); err != nil {
-		t.Fatalf("failed to decode config response: %v", err)
+func TestConfigRejectsUnknownAndInvalidKeys(t *testing.T) {
+	t.Setenv("RETENTION_INTERVAL", "")
+	h := NewHandlers(context.Background(), nil)
+
+	for _, body := range []string{`{"TWITCH_CLIENT_SECRET":"x"}`, `{"UPLOAD_MAX_ATTEMPTS":"many"}`} {
+		rr := httptest.NewRecorder()
+		h.HandleConfig(rr, httptest.NewRequest(http.MethodPut, "/config", strings.NewReader(body)))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("PUT %s status = %d, want 400", body, rr.Code)
+		}
 	}
 
-	if cfg["twitch_channel"] != "test_channel" {
-		t.Errorf("twitch_channel = %v, want test_channel", cfg["twitch_channel"])
+	rr := httptest.NewRecorder()
+	h.HandleConfig(rr, httptest.NewRequest(http.MethodGet, "/config", nil))
+	var cfg map[string]configValue
+	if err := json.NewDecoder(rr.Body).Decode(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg["RETENTION_INTERVAL"]; got != (configValue{Value: "6h0m0s", Source: "default"}) {
+		t.Errorf("RETENTION_INTERVAL = %+v, want built-in default", got)
+	}
+	if _, ok := cfg["TWITCH_CLIENT_SECRET"]; ok {
+		t.Error("secret exposed by /config")
 	}
 }
 
@@ -246,6 +287,123 @@ func TestOAuthTokenStore_NotFound(t *testing.T) {
 	}
 }
 
+func TestOAuthStartChannel(t *testing.T) {
+	t.Setenv("TWITCH_CLIENT_ID", "cid")
+	t.Setenv("TWITCH_REDIRECT_URI", "http://localhost/auth/twitch/callback")
+	t.Setenv("TWITCH_CHANNELS", "ChanA,chanb")
+	h := NewHandlers(context.Background(), nil)
+
+	rr := httptest.NewRecorder()
+	h.HandleTwitchOAuthStart(rr, httptest.NewRequest(http.MethodGet, "/auth/twitch/start?channel=nobody", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("unknown channel status = %d, want 400", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	h.HandleTwitchOAuthStart(rr, httptest.NewRequest(http.MethodGet, "/auth/twitch/start?channel=chana", nil))
+	if rr.Code != http.StatusFound {
+		t.Fatalf("start status = %d, want 302", rr.Code)
+	}
+	loc, err := url.Parse(rr.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, ok := h.takeOAuthState(loc.Query().Get("state"))
+	if !ok || st.channel != "ChanA" {
+		t.Fatalf("state = %+v, %v; want channel ChanA", st, ok)
+	}
+	if _, ok := h.takeOAuthState(loc.Query().Get("state")); ok {
+		t.Fatal("state usable twice")
+	}
+}
+
+func TestAdminChannels(t *testing.T) {
+	db := testutil.SetupTestDB(t)
+	h := NewHandlers(context.Background(), db)
+	t.Cleanup(func() { _, _ = db.Exec(`DELETE FROM channels WHERE name='admintest_chan'`) })
+
+	rr := httptest.NewRecorder()
+	h.HandleAdminChannels(rr, httptest.NewRequest(http.MethodPost, "/admin/channels", strings.NewReader(`{"name":"admintest_chan"}`)))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("POST status = %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	h.HandleAdminChannels(rr, httptest.NewRequest(http.MethodGet, "/admin/channels", nil))
+	var list struct {
+		Channels []dbpkg.Channel `json:"channels"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, c := range list.Channels {
+		found = found || (c.Name == "admintest_chan" && c.Enabled)
+	}
+	if !found {
+		t.Fatalf("added channel not listed: %+v", list.Channels)
+	}
+
+	rr = httptest.NewRecorder()
+	h.HandleAdminChannels(rr, httptest.NewRequest(http.MethodDelete, "/admin/channels?name=AdminTest_Chan", nil))
+	var ch dbpkg.Channel
+	if err := json.NewDecoder(rr.Body).Decode(&ch); err != nil || rr.Code != http.StatusOK || ch.Enabled {
+		t.Fatalf("DELETE = %d %+v, %v", rr.Code, ch, err)
+	}
+
+	rr = httptest.NewRecorder()
+	h.HandleAdminChannels(rr, httptest.NewRequest(http.MethodDelete, "/admin/channels?name=admintest_nobody", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("DELETE unknown status = %d, want 404", rr.Code)
+	}
+}
+
+func TestAdminChannelsDefault(t *testing.T) {
+	db := testutil.SetupTestDB(t)
+	h := NewHandlers(context.Background(), db)
+	var existed bool
+	_ = db.QueryRow(`SELECT EXISTS(SELECT 1 FROM channels WHERE name='')`).Scan(&existed)
+	t.Cleanup(func() {
+		if !existed {
+			_, _ = db.Exec(`DELETE FROM channels WHERE name=''`)
+		}
+	})
+
+	for _, tc := range []struct {
+		method, target, body string
+		enabled              bool
+	}{
+		{http.MethodPost, "/admin/channels", `{"default":true}`, true},
+		{http.MethodDelete, "/admin/channels?default=1", "", false},
+		{http.MethodPost, "/admin/channels?default=1", "", true},
+	} {
+		rr := httptest.NewRecorder()
+		h.HandleAdminChannels(rr, httptest.NewRequest(tc.method, tc.target, strings.NewReader(tc.body)))
+		var ch dbpkg.Channel
+		if err := json.NewDecoder(rr.Body).Decode(&ch); err != nil || rr.Code != http.StatusOK || ch.Name != "" || ch.Enabled != tc.enabled {
+			t.Fatalf("%s %s %s = %d %+v, %v", tc.method, tc.target, tc.body, rr.Code, ch, err)
+		}
+	}
+}
+
+func TestAdminChannelsValidation(t *testing.T) {
+	h := NewHandlers(context.Background(), nil)
+	for _, tc := range []struct {
+		method, target, body string
+	}{
+		{http.MethodPost, "/admin/channels", `{"name":"not a login"}`},
+		{http.MethodPost, "/admin/channels", `{"name":""}`},
+		{http.MethodPost, "/admin/channels", `{`},
+		{http.MethodDelete, "/admin/channels", ""},
+	} {
+		rr := httptest.NewRecorder()
+		h.HandleAdminChannels(rr, httptest.NewRequest(tc.method, tc.target, strings.NewReader(tc.body)))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s %s %s status = %d, want 400", tc.method, tc.target, tc.body, rr.Code)
+		}
+	}
+}
+
 func TestParseFloat64Query(t *testing.T) {
 	tests := []struct {
 		name  string
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/onnwee/vod-tender/backend/chat"
+	"github.com/onnwee/vod-tender/backend/twitchapi"
+)
+
+const testEventSubSecret = "eventsub-test-secret"
+
+// fakeEventSub builds webhook requests signed the way Twitch signs them.
+type fakeEventSub struct {
+	secret string
+	n      int
+}
+
+func (f *fakeEventSub) request(msgType, id, body string, sentAt time.Time) *http.Request {
+	if id == "" {
+		f.n++
+		id = fmt.Sprintf("msg-%d", f.n)
+	}
+	ts := sentAt.UTC().Format(time.RFC3339Nano)
+	req := httptest.NewRequest(http.MethodPost, "/eventsub", strings.NewReader(body))
+	req.Header.Set(twitchapi.EventSubHeaderMessageID, id)
+	req.Header.Set(twitchapi.EventSubHeaderMessageTimestamp, ts)
+	req.Header.Set(twitchapi.EventSubHeaderMessageType, msgType)
+	req.Header.Set(twitchapi.EventSubHeaderMessageSignature, twitchapi.EventSubSignature(f.secret, id, ts, []byte(body)))
+	return req
+}
+
+func TestEventSubChallenge(t *testing.T) {
+	t.Setenv("TWITCH_EVENTSUB_SECRET", testEventSubSecret)
+	h := NewHandlers(context.Background(), nil)
+	signer := &fakeEventSub{secret: testEventSubSecret}
+
+	rr := httptest.NewRecorder()
+	h.HandleEventSub(rr, signer.request(twitchapi.EventSubVerification, "", `{"challenge":"pogchamp-kappa-360noscope","subscription":{"id":"s1","type":"stream.online"}}`, time.Now()))
+	if rr.Code != http.StatusOK || rr.Body.String() != "pogchamp-kappa-360noscope" {
+		t.Fatalf("challenge response = %d %q", rr.Code, rr.Body.String())
+	}
+
+	forged := &fakeEventSub{secret: "wrong"}
+	rr = httptest.NewRecorder()
+	h.HandleEventSub(rr, forged.request(twitchapi.EventSubVerification, "", `{"challenge":"x"}`, time.Now()))
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("forged signature status = %d, want 403", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	h.HandleEventSub(rr, signer.request(twitchapi.EventSubVerification, "", `{"challenge":"x"}`, time.Now().Add(-time.Hour)))
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("stale message status = %d, want 403", rr.Code)
+	}
+}
+
+func TestEventSubNotifiesChatRecorder(t *testing.T) {
+	t.Setenv("TWITCH_EVENTSUB_SECRET", testEventSubSecret)
+	h := NewHandlers(context.Background(), nil)
+	signer := &fakeEventSub{secret: testEventSubSecret}
+	live, stop := chat.WatchLive("EventSubChan")
+	defer stop()
+
+	online := `{"subscription":{"id":"s1","type":"stream.online"},"event":{"id":"9001","broadcaster_user_id":"42","broadcaster_user_login":"eventsubchan","type":"live","started_at":"2024-10-15T14:00:00Z"}}`
+	for i := 0; i < 2; i++ { // the redelivery carries the same message id
+		rr := httptest.NewRecorder()
+		h.HandleEventSub(rr, signer.request(twitchapi.EventSubNotification, "online-1", online, time.Now()))
+		if rr.Code != http.StatusNoContent {
+			t.Fatalf("notification status = %d", rr.Code)
+		}
+	}
+	rr := httptest.NewRecorder()
+	h.HandleEventSub(rr, signer.request(twitchapi.EventSubNotification, "", `{"subscription":{"id":"s2","type":"stream.offline"},"event":{"broadcaster_user_id":"42","broadcaster_user_login":"eventsubchan"}}`, time.Now()))
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("offline status = %d", rr.Code)
+	}
+
+	if n := len(live); n != 2 {
+		t.Fatalf("%d events delivered, want online then offline once each", n)
+	}
+	got := []chat.LiveEvent{<-live, <-live}
+	if !got[0].Online || !got[0].StartedAt.Equal(time.Date(2024, 10, 15, 14, 0, 0, 0, time.UTC)) || got[1].Online {
+		t.Fatalf("events = %+v", got)
+	}
+}
@@ -13,20 +13,31 @@ const (
 	maxOAuthStates = 10000
 )
 
+// oauthState is a pending OAuth authorization: when it expires and which channel's
+// token the callback stores ("" for the default).
+type oauthState struct {
+	expiry  time.Time
+	channel string
+}
+
 // Handlers holds dependencies for all HTTP handlers.
 type Handlers struct {
 	db         *sql.DB
 	ctx        context.Context
-	stateStore map[string]time.Time
-	stateMu    sync.RWMutex
+	stateStore map[string]oauthState
+	// eventSubSeen holds recent EventSub message ids so redeliveries are ignored.
+	eventSubSeen map[string]time.Time
+	stateMu      sync.RWMutex
+	eventSubMu   sync.Mutex
 }
 
 // NewHandlers creates a new Handlers instance with the given dependencies.
 func NewHandlers(ctx context.Context, db *sql.DB) *Handlers {
 	return &Handlers{
-		db:         db,
-		ctx:        ctx,
-		stateStore: make(map[string]time.Time),
+		db:           db,
+		ctx:          ctx,
+		stateStore:   make(map[string]oauthState),
+		eventSubSeen: make(map[string]time.Time),
 	}
 }
 
@@ -34,15 +45,15 @@ func NewHandlers(ctx context.Context, db *sql.DB) *Handlers {
 // This should be called with stateMu locked.
 func (h *Handlers) cleanExpiredStates() {
 	now := time.Now()
-	for state, expiry := range h.stateStore {
-		if now.After(expiry) {
+	for state, st := range h.stateStore {
+		if now.After(st.expiry) {
 			delete(h.stateStore, state)
 		}
 	}
 }
 
-// addOAuthState adds a new OAuth state to the store with cleanup if needed.
-func (h *Handlers) addOAuthState(state string, expiry time.Time) {
+// addOAuthState adds a new OAuth state for channel's authorization to the store with cleanup if needed.
+func (h *Handlers) addOAuthState(state, channel string, expiry time.Time) {
 	h.stateMu.Lock()
 	defer h.stateMu.Unlock()
 
@@ -58,5 +69,17 @@ func (h *Handlers) addOAuthState(state string, expiry time.Time) {
 		return
 	}
 
-	h.stateStore[state] = expiry
+	h.stateStore[state] = oauthState{expiry: expiry, channel: channel}
+}
+
+// takeOAuthState removes state from the store and returns it if it has not expired.
+func (h *Handlers) takeOAuthState(state string) (oauthState, bool) {
+	h.stateMu.Lock()
+	defer h.stateMu.Unlock()
+	st, ok := h.stateStore[state]
+	if !ok {
+		return oauthState{}, false
+	}
+	delete(h.stateStore, state)
+	return st, time.Now().Before(st.expiry)
 }
@@ -1,12 +1,16 @@
 package server
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"log/slog"
 	"net/http"
 	"os"
 	"strconv"
 	"time"
 
+	"github.com/onnwee/vod-tender/backend/config"
 	vodpkg "github.com/onnwee/vod-tender/backend/vod"
 )
 
@@ -115,6 +119,28 @@ func (h *Handlers) HandleAdminMonitor(w http.ResponseWriter, r *http.Request) {
 	_ = json.NewEncoder(w).Encode(stats)
 }
 
+// HandleAdminRetention reports the downloaded files the retention policy of ?channel=
+// would delete. It always runs as a dry run; nothing is deleted.
+func (h *Handlers) HandleAdminRetention(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ctx := r.Context()
+	channel := r.URL.Query().Get("channel")
+	cfg, err := config.LoadChannelConfig(ctx, h.db, channel)
+	if err != nil {
+		slog.Warn("retention preview: channel config", slog.Any("err", err), slog.String("channel", channel))
+	}
+	report, err := vodpkg.PreviewRetention(ctx, h.db, channel, vodpkg.RetentionPolicyFor(cfg))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(report)
+}
+
 // HandleAdminVodPriority handles VOD priority updates.
 func (h *Handlers) HandleAdminVodPriority(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost && r.Method != http.MethodPut {
@@ -136,21 +162,15 @@ func (h *Handlers) HandleAdminVodPriority(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// Update priority in database
-	result, err := h.db.ExecContext(r.Context(),
-		`UPDATE vods SET priority=$1, updated_at=NOW() WHERE twitch_vod_id=$2`,
-		req.Priority, req.VodID)
-	if err != nil {
+	if err := vodpkg.SetPriority(r.Context(), h.db, req.VodID, req.Priority); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "vod not found", http.StatusNotFound)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		http.Error(w, "vod not found", http.StatusNotFound)
-		return
-	}
-
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(map[string]any{
 		"status":   "ok",
@@ -180,20 +200,15 @@ func (h *Handlers) HandleAdminVodSkipUpload(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	result, err := h.db.ExecContext(r.Context(),
-		`UPDATE vods SET skip_upload=$1, updated_at=NOW() WHERE twitch_vod_id=$2`,
-		req.SkipUpload, req.VodID)
-	if err != nil {
+	if err := vodpkg.SetSkipUpload(r.Context(), h.db, req.VodID, req.SkipUpload); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "vod not found", http.StatusNotFound)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		http.Error(w, "vod not found", http.StatusNotFound)
-		return
-	}
-
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(map[string]any{
 		"status":      "ok",
@@ -201,3 +216,71 @@ func (h *Handlers) HandleAdminVodSkipUpload(w http.ResponseWriter, r *http.Reque
 		"skip_upload": req.SkipUpload,
 	})
 }
+
+// HandleAdminVodChapters reads and edits a VOD's chapters before upload.
+// GET ?vod_id= lists them, PUT {vod_id, chapters} replaces them with a manual list that the
+// automatic sync leaves alone, and DELETE ?vod_id= drops all chapters and re-syncs from Twitch.
+func (h *Handlers) HandleAdminVodChapters(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	vodID := r.URL.Query().Get("vod_id")
+	var body struct {
+		VodID    string           `json:"vod_id"`
+		Chapters []vodpkg.Chapter `json:"chapters"`
+	}
+	if r.Method == http.MethodPut {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+		vodID = body.VodID
+	}
+	if vodID == "" {
+		http.Error(w, "vod_id required", http.StatusBadRequest)
+		return
+	}
+	var channel string
+	if err := h.db.QueryRowContext(ctx, `SELECT channel FROM vods WHERE twitch_vod_id=$1`, vodID).Scan(&channel); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "vod not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		if _, err := vodpkg.ReplaceChapters(ctx, h.db, vodID, body.Chapters); err != nil {
+			if errors.Is(err, vodpkg.ErrInvalidChapters) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	case http.MethodDelete:
+		if _, err := vodpkg.ReplaceChapters(ctx, h.db, vodID, nil); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if _, err := vodpkg.SyncChapters(ctx, h.db, vodID, channel); err != nil {
+			http.Error(w, "chapter sync failed: "+err.Error(), http.StatusBadGateway)
+			return
+		}
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	chapters, err := vodpkg.LoadChapters(ctx, h.db, vodID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"vod_id":   vodID,
+		"chapters": chapters,
+	})
+}
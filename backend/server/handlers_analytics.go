@@ -0,0 +1,89 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/onnwee/vod-tender/backend/chat/analytics"
+)
+
+// handleChatStats (GET /vods/{id}/chat/stats) returns the chat histogram, unique chatters
+// and top emotes/chatters. Params: window_seconds (default 60), top (default 10, max 100).
+func (h *Handlers) handleChatStats(w http.ResponseWriter, r *http.Request, vodID string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.vodExists(w, r, vodID) {
+		return
+	}
+	window := time.Duration(parseFloat64Query(r, "window_seconds", 0) * float64(time.Second))
+	top := min(parseIntQuery(r, "top", analytics.DefaultTop), 100)
+	st, err := analytics.Compute(r.Context(), h.db, vodID, window, top)
+	if err != nil {
+		writeAnalyticsError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(st)
+}
+
+// handleVodHighlights serves /vods/{id}/highlights. GET returns the stored chat spikes and
+// when detection last ran (null if never); it does not write. POST, which needs admin auth,
+// re-runs detection with optional tuning ({window_seconds, baseline_windows, min_score, min_messages, max}).
+func (h *Handlers) handleVodHighlights(w http.ResponseWriter, r *http.Request, vodID string) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.vodExists(w, r, vodID) {
+		return
+	}
+	var hs []analytics.Highlight
+	var err error
+	if r.Method == http.MethodGet {
+		hs, err = analytics.LoadHighlights(r.Context(), h.db, vodID)
+	} else {
+		var body struct {
+			WindowSeconds   float64 `json:"window_seconds"`
+			BaselineWindows int     `json:"baseline_windows"`
+			MinScore        float64 `json:"min_score"`
+			MinMessages     int     `json:"min_messages"`
+			Max             int     `json:"max"`
+		}
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				http.Error(w, "invalid json", http.StatusBadRequest)
+				return
+			}
+		}
+		hs, err = analytics.DetectHighlights(r.Context(), h.db, vodID, analytics.DetectOptions{
+			Window:      time.Duration(body.WindowSeconds * float64(time.Second)),
+			Baseline:    body.BaselineWindows,
+			MinScore:    body.MinScore,
+			MinMessages: body.MinMessages,
+			Max:         body.Max,
+		})
+	}
+	if err != nil {
+		writeAnalyticsError(w, err)
+		return
+	}
+	analyzedAt, err := analytics.HighlightsAnalyzedAt(r.Context(), h.db, vodID)
+	if err != nil {
+		writeAnalyticsError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"vod_id": vodID, "highlights": hs, "analyzed_at": analyzedAt})
+}
+
+func writeAnalyticsError(w http.ResponseWriter, err error) {
+	if errors.Is(err, analytics.ErrInvalidWindow) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
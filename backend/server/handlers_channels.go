@@ -0,0 +1,87 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/onnwee/vod-tender/backend/config"
+	dbpkg "github.com/onnwee/vod-tender/backend/db"
+)
+
+// twitchLoginPattern matches a Twitch login name.
+var twitchLoginPattern = regexp.MustCompile(`^[A-Za-z0-9_]{1,25}$`)
+
+// HandleAdminChannels lists, adds and removes the channels the supervisor runs.
+// GET lists the channels table. POST {"name": "..."} (or ?name=) enables a channel,
+// adding it if needed; DELETE ?name= disables it. {"default": true} or ?default=1
+// selects the default channel, whose name is empty. Disabling stops the channel's
+// workers but keeps its VODs, chat and settings. Changes apply at once on this
+// replica and within CONFIG_RELOAD_INTERVAL on others.
+func (h *Handlers) HandleAdminChannels(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	name := strings.TrimSpace(r.URL.Query().Get("name"))
+	def := r.URL.Query().Get("default") == "1"
+	var ch dbpkg.Channel
+	var err error
+	switch r.Method {
+	case http.MethodGet:
+		channels, err := dbpkg.ListChannels(ctx, h.db)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"channels": channels})
+		return
+	case http.MethodPost:
+		if name == "" && !def {
+			var body struct {
+				Name    string `json:"name"`
+				Default bool   `json:"default"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				http.Error(w, "invalid json", http.StatusBadRequest)
+				return
+			}
+			name, def = strings.TrimSpace(body.Name), body.Default
+		}
+		if def {
+			name = config.DefaultChannel
+		} else if !twitchLoginPattern.MatchString(name) {
+			http.Error(w, "name must be a Twitch login (letters, digits, underscore; up to 25)", http.StatusBadRequest)
+			return
+		}
+		ch, err = dbpkg.EnableChannel(ctx, h.db, name)
+	case http.MethodDelete:
+		if def {
+			name = config.DefaultChannel
+		} else if name == "" {
+			http.Error(w, "name or default=1 required", http.StatusBadRequest)
+			return
+		}
+		ch, err = dbpkg.DisableChannel(ctx, h.db, name)
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "channel not found", http.StatusNotFound)
+			return
+		}
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	slog.Info("channel updated", slog.String("channel", ch.Name), slog.Bool("enabled", ch.Enabled))
+	// Wake the supervisor rather than waiting for the next reload tick.
+	if _, err := config.ReloadRuntime(ctx, h.db); err != nil {
+		slog.Warn("runtime config reload", slog.Any("err", err))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(ch)
+}
@@ -3,31 +3,74 @@ package server
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
 	"math"
 	"net/http"
+	"strings"
 	"time"
+
+	"github.com/onnwee/vod-tender/backend/chat"
+	"github.com/onnwee/vod-tender/backend/chat/export"
+	"github.com/onnwee/vod-tender/backend/chat/search"
 )
 
+// chatMessage is a chat_messages row as served by /chat and /chat/stream.
+type chatMessage struct {
+	Abs time.Time `json:"abs_timestamp"`
+	// EmotePositions lists emote occurrences as {id, name, start, end} code point offsets.
+	EmotePositions  json.RawMessage `json:"emote_positions,omitempty"`
+	User            string          `json:"username"`
+	Text            string          `json:"message"`
+	Badges          string          `json:"badges"`
+	Emotes          string          `json:"emotes"`
+	Color           string          `json:"color"`
+	MessageID       string          `json:"message_id,omitempty"`
+	UserID          string          `json:"user_id,omitempty"`
+	DisplayName     string          `json:"display_name,omitempty"`
+	ReplyToID       string          `json:"reply_to_id,omitempty"`
+	ReplyToUsername string          `json:"reply_to_username,omitempty"`
+	ReplyToMessage  string          `json:"reply_to_message,omitempty"`
+	// Moderation is timeout, ban or delete when a moderator removed the message.
+	Moderation   string  `json:"moderation,omitempty"`
+	Rel          float64 `json:"rel_timestamp"`
+	Bits         int     `json:"bits,omitempty"`
+	FirstMessage bool    `json:"first_message,omitempty"`
+}
+
+const chatMessageColumns = `username, message, abs_timestamp, rel_timestamp, badges, emotes, color, COALESCE(moderation,''),
+	COALESCE(message_id,''), COALESCE(user_id,''), COALESCE(display_name,''), COALESCE(reply_to_id,''), COALESCE(reply_to_username,''),
+	COALESCE(reply_to_message,''), emote_positions, bits, first_message`
+
+func scanChatMessage(rows *sql.Rows) (chatMessage, error) {
+	var m chatMessage
+	err := rows.Scan(&m.User, &m.Text, &m.Abs, &m.Rel, &m.Badges, &m.Emotes, &m.Color, &m.Moderation,
+		&m.MessageID, &m.UserID, &m.DisplayName, &m.ReplyToID, &m.ReplyToUsername,
+		&m.ReplyToMessage, &m.EmotePositions, &m.Bits, &m.FirstMessage)
+	return m, err
+}
+
 // handleChatJSON returns chat messages for a VOD within an optional time range.
 func (h *Handlers) handleChatJSON(w http.ResponseWriter, r *http.Request, vodID string) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	// Params: from, to (seconds), limit (default 1000)
+	// Params: from, to (seconds), limit (default 1000), hide_moderated
 	from := parseFloat64Query(r, "from", 0)
 	to := parseFloat64Query(r, "to", 0)
 	limit := parseIntQuery(r, "limit", 1000)
 	if limit <= 0 || limit > 5000 {
 		limit = 1000
 	}
+	visible := moderationFilter(r)
 	var rows *sql.Rows
 	var err error
 	if to > 0 {
-		rows, err = h.db.QueryContext(r.Context(), `SELECT username, message, abs_timestamp, rel_timestamp, badges, emotes, color FROM chat_messages WHERE vod_id=$1 AND rel_timestamp>=$2 AND rel_timestamp<=$3 ORDER BY rel_timestamp ASC LIMIT $4`, vodID, from, to, limit)
+		rows, err = h.db.QueryContext(r.Context(), `SELECT `+chatMessageColumns+` FROM chat_messages WHERE vod_id=$1 AND rel_timestamp>=$2 AND rel_timestamp<=$3`+visible+` ORDER BY rel_timestamp ASC LIMIT $4`, vodID, from, to, limit)
 	} else {
-		rows, err = h.db.QueryContext(r.Context(), `SELECT username, message, abs_timestamp, rel_timestamp, badges, emotes, color FROM chat_messages WHERE vod_id=$1 AND rel_timestamp>=$2 ORDER BY rel_timestamp ASC LIMIT $3`, vodID, from, limit)
+		rows, err = h.db.QueryContext(r.Context(), `SELECT `+chatMessageColumns+` FROM chat_messages WHERE vod_id=$1 AND rel_timestamp>=$2`+visible+` ORDER BY rel_timestamp ASC LIMIT $3`, vodID, from, limit)
 	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -38,19 +81,10 @@ func (h *Handlers) handleChatJSON(w http.ResponseWriter, r *http.Request, vodID
 			slog.Warn("failed to close rows", slog.Any("err", err))
 		}
 	}()
-	type msg struct {
-		Abs    time.Time `json:"abs_timestamp"`
-		User   string    `json:"username"`
-		Text   string    `json:"message"`
-		Badges string    `json:"badges"`
-		Emotes string    `json:"emotes"`
-		Color  string    `json:"color"`
-		Rel    float64   `json:"rel_timestamp"`
-	}
-	out := make([]msg, 0)
+	out := make([]chatMessage, 0)
 	for rows.Next() {
-		var m msg
-		if err := rows.Scan(&m.User, &m.Text, &m.Abs, &m.Rel, &m.Badges, &m.Emotes, &m.Color); err != nil {
+		m, err := scanChatMessage(rows)
+		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -83,7 +117,7 @@ func (h *Handlers) handleChatSSE(w http.ResponseWriter, r *http.Request, vodID s
 	}
 	
 	ctx := r.Context()
-	rows, err := h.db.QueryContext(ctx, `SELECT username, message, abs_timestamp, rel_timestamp, badges, emotes, color FROM chat_messages WHERE vod_id=$1 AND rel_timestamp>=$2 ORDER BY rel_timestamp ASC`, vodID, from)
+	rows, err := h.db.QueryContext(ctx, `SELECT `+chatMessageColumns+` FROM chat_messages WHERE vod_id=$1 AND rel_timestamp>=$2`+moderationFilter(r)+` ORDER BY rel_timestamp ASC`, vodID, from)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -98,20 +132,11 @@ func (h *Handlers) handleChatSSE(w http.ResponseWriter, r *http.Request, vodID s
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
 
-	type row struct {
-		Abs    time.Time
-		User   string
-		Text   string
-		Badges string
-		Emotes string
-		Color  string
-		Rel    float64
-	}
 	prev := from
 	enc := json.NewEncoder(w)
 	for rows.Next() {
-		var m row
-		if err := rows.Scan(&m.User, &m.Text, &m.Abs, &m.Rel, &m.Badges, &m.Emotes, &m.Color); err != nil {
+		m, err := scanChatMessage(rows)
+		if err != nil {
 			return
 		}
 		// sleep for the delta scaled by speed
@@ -128,15 +153,7 @@ func (h *Handlers) handleChatSSE(w http.ResponseWriter, r *http.Request, vodID s
 			slog.Warn("failed to write SSE data prefix", slog.Any("err", err))
 			return
 		}
-		_ = enc.Encode(map[string]any{
-			"username":      m.User,
-			"message":       m.Text,
-			"abs_timestamp": m.Abs,
-			"rel_timestamp": m.Rel,
-			"badges":        m.Badges,
-			"emotes":        m.Emotes,
-			"color":         m.Color,
-		})
+		_ = enc.Encode(m)
 		if _, err := w.Write([]byte("\n")); err != nil {
 			slog.Warn("failed to write SSE newline", slog.Any("err", err))
 			return
@@ -145,3 +162,138 @@ func (h *Handlers) handleChatSSE(w http.ResponseWriter, r *http.Request, vodID s
 		prev = m.Rel
 	}
 }
+
+// handleChatExport streams a VOD's chat as WebVTT, ASS, YouTube timed text or JSONL.
+// Params: format (required), from, to (seconds), cue_seconds (on-screen time per message), hide_moderated.
+func (h *Handlers) handleChatExport(w http.ResponseWriter, r *http.Request, vodID string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	format, err := export.ParseFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !h.vodExists(w, r, vodID) {
+		return
+	}
+	opts := export.Options{From: parseFloat64Query(r, "from", 0), To: parseFloat64Query(r, "to", 0), HideModerated: parseBoolQuery(r, "hide_moderated")}
+	if math.IsNaN(opts.From) || math.IsInf(opts.From, 0) || opts.From < 0 {
+		opts.From = 0
+	}
+	if math.IsNaN(opts.To) || math.IsInf(opts.To, 0) {
+		opts.To = 0
+	}
+	if cue := parseFloat64Query(r, "cue_seconds", 0); cue > 0 && cue <= 60 {
+		opts.CueDuration = time.Duration(cue * float64(time.Second))
+	}
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, vodID, format.Extension()))
+	if n, err := export.Write(r.Context(), h.db, w, vodID, format, opts); err != nil {
+		// Headers are already sent; the truncated body is all the client gets.
+		slog.Warn("chat export failed", slog.String("vod_id", vodID), slog.String("format", string(format)), slog.Int("written", n), slog.Any("err", err))
+	}
+}
+
+// handleChatEvents lists a VOD's chat events (subs, gifts, raids, cheers, timeouts, bans, deletions).
+// Params: type (comma-separated), from, to (seconds).
+func (h *Handlers) handleChatEvents(w http.ResponseWriter, r *http.Request, vodID string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.vodExists(w, r, vodID) {
+		return
+	}
+	var types []string
+	for _, t := range strings.Split(r.URL.Query().Get("type"), ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			types = append(types, t)
+		}
+	}
+	events, err := chat.ListEvents(r.Context(), h.db, vodID, types, parseFloat64Query(r, "from", 0), parseFloat64Query(r, "to", 0))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"vod_id": vodID, "events": events})
+}
+
+// handleChatGaps lists the intervals in which the live chat recorder was disconnected,
+// so clients can tell missing chat from silence.
+func (h *Handlers) handleChatGaps(w http.ResponseWriter, r *http.Request, vodID string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.vodExists(w, r, vodID) {
+		return
+	}
+	gaps, err := chat.ListGaps(r.Context(), h.db, vodID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"vod_id": vodID, "gaps": gaps})
+}
+
+// moderationFilter returns the condition that hides messages removed by moderators
+// when the request sets hide_moderated.
+func moderationFilter(r *http.Request) string {
+	if parseBoolQuery(r, "hide_moderated") {
+		return ` AND moderated_at IS NULL`
+	}
+	return ""
+}
+
+// HandleChatSearch runs a full-text search over all recorded chat.
+// Params: q (required), channel, username, vod_id, since/until (RFC3339 or YYYY-MM-DD), limit, cursor.
+func (h *Handlers) HandleChatSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	qs := r.URL.Query()
+	q := search.Query{
+		Text:     qs.Get("q"),
+		Channel:  qs.Get("channel"),
+		Username: qs.Get("username"),
+		VodID:    qs.Get("vod_id"),
+		Cursor:   qs.Get("cursor"),
+		Limit:    parseIntQuery(r, "limit", search.DefaultLimit),
+	}
+	var err error
+	if q.Since, err = parseSearchTime(qs.Get("since")); err != nil {
+		http.Error(w, "invalid since: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if q.Until, err = parseSearchTime(qs.Get("until")); err != nil {
+		http.Error(w, "invalid until: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	page, err := search.Search(r.Context(), h.db, q)
+	switch {
+	case errors.Is(err, search.ErrEmptyQuery), errors.Is(err, search.ErrInvalidCursor):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(page)
+}
+
+// parseSearchTime accepts RFC3339 or a bare date (midnight UTC); empty means unbounded.
+func parseSearchTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", s)
+}
@@ -4,45 +4,30 @@ import (
 	"encoding/json"
 	"log/slog"
 	"net/http"
-	"os"
 	"strings"
 
+	"github.com/onnwee/vod-tender/backend/config"
 	vodpkg "github.com/onnwee/vod-tender/backend/vod"
 )
 
-// HandleConfig handles GET and PUT requests for safe configuration keys.
+// configValue is a setting's effective value and the layer it came from.
+type configValue struct {
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
+
+// HandleConfig handles GET and PUT requests for the settings that can be changed at
+// runtime (config.RuntimeKeys); secrets are never exposed here. GET reports each
+// setting's effective value and its source, for ?channel= if given. PUT stores kv
+// overrides (an empty value removes one) and notifies the running jobs.
 func (h *Handlers) HandleConfig(w http.ResponseWriter, r *http.Request) {
-	// Only allow GET/PUT for known keys; secrets must not be exposed here.
-	safeKeys := map[string]bool{
-		"LOG_LEVEL":                   true,
-		"LOG_FORMAT":                  true,
-		"DATA_DIR":                    true,
-		"VOD_PROCESS_INTERVAL":        true,
-		"PROCESSING_RETRY_COOLDOWN":   true,
-		"DOWNLOAD_MAX_ATTEMPTS":       true,
-		"DOWNLOAD_BACKOFF_BASE":       true,
-		"UPLOAD_MAX_ATTEMPTS":         true,
-		"UPLOAD_BACKOFF_BASE":         true,
-		"RETAIN_KEEP_NEWER_THAN_DAYS": true,
-		"RETENTION_KEEP_DAYS":         true,
-		"RETENTION_KEEP_COUNT":        true,
-		"RETENTION_DRY_RUN":           true,
-		"RETENTION_INTERVAL":          true,
-		"BACKFILL_UPLOAD_DAILY_LIMIT": true,
-	}
 	switch r.Method {
 	case http.MethodGet:
-		// Return safe keys with values from env override (kv) if present
-		out := map[string]string{}
-		for k := range safeKeys {
-			var v string
-			_ = h.db.QueryRowContext(r.Context(), `SELECT value FROM kv WHERE key=$1`, "cfg:"+k).Scan(&v)
-			if v == "" {
-				v = os.Getenv(k)
-			}
-			if v != "" {
-				out[k] = v
-			}
+		channel := strings.TrimSpace(r.URL.Query().Get("channel"))
+		out := map[string]configValue{}
+		for _, k := range config.RuntimeKeys() {
+			v, src := config.Lookup(r.Context(), h.db, channel, k)
+			out[k] = configValue{Value: v, Source: src}
 		}
 		w.Header().Set("Content-Type", "application/json")
 		_ = json.NewEncoder(w).Encode(out)
@@ -53,19 +38,22 @@ func (h *Handlers) HandleConfig(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		for k, v := range body {
-			if !safeKeys[k] {
-				continue
+			if err := config.ValidateRuntimeSetting(k, strings.TrimSpace(v)); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
 			}
-			if _, err := h.db.ExecContext(
-				r.Context(),
-				`INSERT INTO kv (key,value,updated_at) VALUES ($1,$2,NOW()) ON CONFLICT(key) DO UPDATE SET value=EXCLUDED.value, updated_at=NOW()`,
-				"cfg:"+k,
-				strings.TrimSpace(v),
-			); err != nil {
+		}
+		for k, v := range body {
+			v = strings.TrimSpace(v)
+			if err := config.SetRuntimeOverride(r.Context(), h.db, k, v); err != nil {
 				slog.Error("failed to update config", slog.String("key", k), slog.Any("err", err))
 				http.Error(w, "failed to update config", http.StatusInternalServerError)
 				return
 			}
+			slog.Info("config override updated", slog.String("key", k), slog.String("value", v))
+		}
+		if _, err := config.ReloadRuntime(r.Context(), h.db); err != nil {
+			slog.Warn("runtime config reload", slog.Any("err", err))
 		}
 		w.WriteHeader(http.StatusNoContent)
 	default:
@@ -82,13 +70,35 @@ func (h *Handlers) HandleStatus(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	resp := map[string]any{}
 	// Queue depth & counts
-	var pending, errored, processed int
-	_ = h.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM vods WHERE COALESCE(processed,false)=false`).Scan(&pending)
-	_ = h.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM vods WHERE COALESCE(processed,false)=false AND processing_error IS NOT NULL AND processing_error!=''`).Scan(&errored)
-	_ = h.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM vods WHERE COALESCE(processed,false)=true`).Scan(&processed)
+	byStatus := map[string]int{}
+	for _, st := range vodpkg.AllStatuses() {
+		byStatus[string(st)] = 0
+	}
+	if rows, err := h.db.QueryContext(ctx, `SELECT status, COUNT(*) FROM vods GROUP BY status`); err == nil {
+		for rows.Next() {
+			var st string
+			var n int
+			if err := rows.Scan(&st, &n); err == nil {
+				byStatus[st] = n
+			}
+		}
+		if err := rows.Close(); err != nil {
+			slog.Warn("failed to close rows", slog.Any("err", err))
+		}
+	}
+	// pending/errored/processed are kept for existing clients and derived from status.
+	var pending, processed int
+	for st, n := range byStatus {
+		if vodpkg.Status(st).Terminal() {
+			processed += n
+		} else {
+			pending += n
+		}
+	}
 	resp["pending"] = pending
-	resp["errored"] = errored
+	resp["errored"] = byStatus[string(vodpkg.StatusFailed)]
 	resp["processed"] = processed
+	resp["by_status"] = byStatus
 
 	// Queue depth by priority (breakdown)
 	type priorityCount struct {
@@ -99,7 +109,7 @@ func (h *Handlers) HandleStatus(w http.ResponseWriter, r *http.Request) {
 	rows, err := h.db.QueryContext(ctx, `
 		SELECT COALESCE(priority, 0) as priority, COUNT(*) as count 
 		FROM vods 
-		WHERE COALESCE(processed,false)=false 
+		WHERE status NOT IN ('uploaded', 'skipped', 'archived')
 		GROUP BY priority 
 		ORDER BY priority DESC
 	`)
@@ -124,35 +134,37 @@ func (h *Handlers) HandleStatus(w http.ResponseWriter, r *http.Request) {
 	resp["active_downloads"] = vodpkg.GetActiveDownloads()
 	resp["max_concurrent_downloads"] = vodpkg.GetMaxConcurrentDownloads()
 
-	// Retry/backoff configuration
-	retryConfig := map[string]any{
-		"download_max_attempts":     getEnvInt("DOWNLOAD_MAX_ATTEMPTS", 5),
-		"download_backoff_base":     os.Getenv("DOWNLOAD_BACKOFF_BASE"),
-		"upload_max_attempts":       getEnvInt("UPLOAD_MAX_ATTEMPTS", 5),
-		"upload_backoff_base":       os.Getenv("UPLOAD_BACKOFF_BASE"),
-		"processing_retry_cooldown": os.Getenv("PROCESSING_RETRY_COOLDOWN"),
+	// Retry/backoff configuration, as currently in effect
+	cfg, err := config.LoadChannelConfig(ctx, h.db, "")
+	if err != nil {
+		slog.Warn("status: channel config", slog.Any("err", err))
+	}
+	resp["retry_config"] = map[string]any{
+		"download_max_attempts":     cfg.DownloadMaxAttempts,
+		"download_backoff_base":     cfg.DownloadBackoffBase.String(),
+		"upload_max_attempts":       cfg.UploadMaxAttempts,
+		"upload_backoff_base":       cfg.UploadBackoffBase.String(),
+		"processing_retry_cooldown": cfg.ProcessingRetryCooldown.String(),
 	}
-	if retryConfig["download_backoff_base"] == "" {
-		retryConfig["download_backoff_base"] = "2s"
-	}
-	if retryConfig["upload_backoff_base"] == "" {
-		retryConfig["upload_backoff_base"] = "2s"
-	}
-	if retryConfig["processing_retry_cooldown"] == "" {
-		retryConfig["processing_retry_cooldown"] = "600s"
-	}
-	resp["retry_config"] = retryConfig
 
 	// Bandwidth limit if configured
-	if limit := os.Getenv("DOWNLOAD_RATE_LIMIT"); limit != "" {
-		resp["download_rate_limit"] = limit
+	if cfg.DownloadRateLimit != "" {
+		resp["download_rate_limit"] = cfg.DownloadRateLimit
 	}
 
-	// Circuit breaker
+	// Circuit breaker; ?channel= selects that channel's breaker.
 	var cState, cFails, cUntil string
-	_ = h.db.QueryRowContext(ctx, `SELECT value FROM kv WHERE key='circuit_state'`).Scan(&cState)
-	_ = h.db.QueryRowContext(ctx, `SELECT value FROM kv WHERE key='circuit_failures'`).Scan(&cFails)
-	_ = h.db.QueryRowContext(ctx, `SELECT value FROM kv WHERE key='circuit_open_until'`).Scan(&cUntil)
+	if q := r.URL.Query(); q.Has("channel") {
+		c, err := vodpkg.LoadCircuit(ctx, h.db, q.Get("channel"))
+		if err != nil {
+			slog.Warn("status: circuit", slog.Any("err", err))
+		}
+		cState, cFails, cUntil = c.State, c.Failures, c.OpenUntil
+	} else {
+		_ = h.db.QueryRowContext(ctx, `SELECT value FROM kv WHERE key='circuit_state'`).Scan(&cState)
+		_ = h.db.QueryRowContext(ctx, `SELECT value FROM kv WHERE key='circuit_failures'`).Scan(&cFails)
+		_ = h.db.QueryRowContext(ctx, `SELECT value FROM kv WHERE key='circuit_open_until'`).Scan(&cUntil)
+	}
 	if cState != "" {
 		resp["circuit_state"] = cState
 	}
@@ -0,0 +1,120 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/onnwee/vod-tender/backend/chat"
+	"github.com/onnwee/vod-tender/backend/twitchapi"
+	vodpkg "github.com/onnwee/vod-tender/backend/vod"
+)
+
+const (
+	// maxEventSubBodyBytes caps a webhook body; notifications are a few KB.
+	maxEventSubBodyBytes = 1 << 20
+	// eventSubSeenTTL is how long message ids are remembered. Older redeliveries
+	// fail the timestamp check anyway.
+	eventSubSeenTTL = 10 * time.Minute
+)
+
+// HandleEventSub receives Twitch EventSub webhooks. Requests must be signed with
+// TWITCH_EVENTSUB_SECRET. Verification challenges are echoed back, and
+// stream.online/stream.offline notifications are passed to the channel's auto chat
+// recorder; an offline notification also runs VOD discovery at once.
+func (h *Handlers) HandleEventSub(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	secret := os.Getenv("TWITCH_EVENTSUB_SECRET")
+	if secret == "" {
+		http.Error(w, "eventsub not configured", http.StatusServiceUnavailable)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxEventSubBodyBytes))
+	if err != nil {
+		http.Error(w, "read body", http.StatusBadRequest)
+		return
+	}
+	if err := twitchapi.VerifyEventSub(secret, r.Header, body, time.Now()); err != nil {
+		slog.Warn("eventsub: rejected message", slog.Any("err", err), slog.String("remote_addr", r.RemoteAddr))
+		http.Error(w, "invalid signature", http.StatusForbidden)
+		return
+	}
+	var msg twitchapi.EventSubMessage
+	if err := json.Unmarshal(body, &msg); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	sub := msg.Subscription
+	switch r.Header.Get(twitchapi.EventSubHeaderMessageType) {
+	case twitchapi.EventSubVerification:
+		slog.Info("eventsub: subscription verified", slog.String("type", sub.Type), slog.String("id", sub.ID))
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = io.WriteString(w, msg.Challenge)
+		return
+	case twitchapi.EventSubRevocation:
+		slog.Warn("eventsub: subscription revoked", slog.String("type", sub.Type), slog.String("id", sub.ID), slog.String("status", sub.Status))
+	case twitchapi.EventSubNotification:
+		if h.eventSubDuplicate(r.Header.Get(twitchapi.EventSubHeaderMessageID)) {
+			break
+		}
+		if err := dispatchEventSub(sub.Type, msg.Event); err != nil {
+			slog.Warn("eventsub: bad notification", slog.String("type", sub.Type), slog.Any("err", err))
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// eventSubDuplicate records id and reports whether it was already seen.
+func (h *Handlers) eventSubDuplicate(id string) bool {
+	h.eventSubMu.Lock()
+	defer h.eventSubMu.Unlock()
+	now := time.Now()
+	for k, at := range h.eventSubSeen {
+		if now.Sub(at) > eventSubSeenTTL {
+			delete(h.eventSubSeen, k)
+		}
+	}
+	if _, ok := h.eventSubSeen[id]; ok {
+		return true
+	}
+	h.eventSubSeen[id] = now
+	return false
+}
+
+func dispatchEventSub(subType string, raw json.RawMessage) error {
+	switch subType {
+	case twitchapi.EventSubStreamOnline:
+		var ev twitchapi.StreamOnlineEvent
+		if err := json.Unmarshal(raw, &ev); err != nil {
+			return err
+		}
+		if ev.BroadcasterUserLogin == "" {
+			return errors.New("missing broadcaster_user_login")
+		}
+		if !chat.NotifyLive(ev.BroadcasterUserLogin, chat.LiveEvent{Online: true, StartedAt: ev.StartedAt}) {
+			slog.Debug("eventsub: no auto chat recorder for channel", slog.String("channel", ev.BroadcasterUserLogin))
+		}
+	case twitchapi.EventSubStreamOffline:
+		var ev twitchapi.StreamOfflineEvent
+		if err := json.Unmarshal(raw, &ev); err != nil {
+			return err
+		}
+		if ev.BroadcasterUserLogin == "" {
+			return errors.New("missing broadcaster_user_login")
+		}
+		if !chat.NotifyLive(ev.BroadcasterUserLogin, chat.LiveEvent{}) {
+			slog.Debug("eventsub: no auto chat recorder for channel", slog.String("channel", ev.BroadcasterUserLogin))
+		}
+		vodpkg.TriggerProcessing(ev.BroadcasterUserLogin)
+	default:
+		slog.Debug("eventsub: ignoring notification", slog.String("type", subType))
+	}
+	return nil
+}
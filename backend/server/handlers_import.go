@@ -0,0 +1,116 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+
+	"github.com/onnwee/vod-tender/backend/chat"
+)
+
+// maxChatImportBytes caps an uploaded chat file (TwitchDownloader JSON of a long VOD runs to hundreds of MB).
+const maxChatImportBytes = 1 << 30
+
+// HandleAdminVodChatImport imports historical chat for a VOD in the background.
+// GET ?vod_id= returns the import's progress. POST ?vod_id=&source=twitch fetches
+// Twitch replay chat; POST with source=file (the default when a body is sent)
+// imports an uploaded TwitchDownloader JSON file.
+func (h *Handlers) HandleAdminVodChatImport(w http.ResponseWriter, r *http.Request) {
+	vodID := r.URL.Query().Get("vod_id")
+	if vodID == "" {
+		http.Error(w, "vod_id required", http.StatusBadRequest)
+		return
+	}
+	status := http.StatusOK
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		if !h.vodExists(w, r, vodID) {
+			return
+		}
+		source := r.URL.Query().Get("source")
+		if source == "" {
+			source = "twitch"
+			if r.ContentLength > 0 {
+				source = "file"
+			}
+		}
+		var src chat.CommentSource
+		switch source {
+		case "twitch":
+			src = chat.NewTwitchCommentSource(nil, vodID)
+		case "file":
+			f, err := spoolUpload(w, r)
+			if err != nil {
+				http.Error(w, "read upload: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			src = chat.NewTwitchDownloaderSource(f)
+		default:
+			http.Error(w, "source must be twitch or file", http.StatusBadRequest)
+			return
+		}
+		// The import outlives the request, so it runs on the server context.
+		if err := chat.StartImport(h.ctx, h.db, vodID, source, src); err != nil {
+			if errors.Is(err, chat.ErrImportRunning) {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		status = http.StatusAccepted
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	st, err := chat.LoadImport(r.Context(), h.db, vodID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "no chat import for vod", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// The status is written only now, so a failed load above can still report an error.
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(st)
+}
+
+// spooledFile is an uploaded file copied to disk; closing it removes it.
+type spooledFile struct {
+	*os.File
+}
+
+func (f spooledFile) Close() error {
+	err := f.File.Close()
+	if rerr := os.Remove(f.Name()); rerr != nil {
+		slog.Warn("failed to remove chat import upload", slog.String("path", f.Name()), slog.Any("err", rerr))
+	}
+	return err
+}
+
+// spoolUpload copies the request body to a temporary file so the import can read it
+// after the request has finished.
+func spoolUpload(w http.ResponseWriter, r *http.Request) (io.ReadCloser, error) {
+	f, err := os.CreateTemp("", "chat-import-*.json")
+	if err != nil {
+		return nil, err
+	}
+	sf := spooledFile{f}
+	if _, err := io.Copy(f, http.MaxBytesReader(w, r.Body, maxChatImportBytes)); err != nil {
+		_ = sf.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		_ = sf.Close()
+		return nil, err
+	}
+	return sf, nil
+}
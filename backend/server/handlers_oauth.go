@@ -6,6 +6,7 @@ import (
 	"database/sql"
 	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"strings"
@@ -17,27 +18,64 @@ import (
 	"github.com/onnwee/vod-tender/backend/youtubeapi"
 )
 
-// oauthTokenStore adapts the DB to youtubeapi.TokenStore interface
-type oauthTokenStore struct{ db *sql.DB }
+// oauthTokenStore adapts the DB to youtubeapi.TokenStore interface for one channel's
+// token row ("" is the default row).
+type oauthTokenStore struct {
+	db      *sql.DB
+	channel string
+}
 
 func (o *oauthTokenStore) UpsertOAuthToken(ctx context.Context, provider string, accessToken string, refreshToken string, expiry time.Time, raw string) error {
-	// Use dbpkg.UpsertOAuthToken which handles encryption automatically
-	return dbpkg.UpsertOAuthToken(ctx, o.db, provider, accessToken, refreshToken, expiry, raw, "")
+	// Use dbpkg.UpsertOAuthTokenForChannel which handles encryption automatically
+	return dbpkg.UpsertOAuthTokenForChannel(ctx, o.db, provider, o.channel, accessToken, refreshToken, expiry, raw, "")
 }
 func (o *oauthTokenStore) GetOAuthToken(ctx context.Context, provider string) (accessToken string, refreshToken string, expiry time.Time, raw string, err error) {
-	// Use dbpkg.GetOAuthToken which handles decryption automatically
-	access, refresh, exp, scope, dbErr := dbpkg.GetOAuthToken(ctx, o.db, provider)
+	// Use dbpkg.GetOAuthTokenForChannel which handles decryption automatically
+	access, refresh, exp, scope, dbErr := dbpkg.GetOAuthTokenForChannel(ctx, o.db, provider, o.channel)
 	return access, refresh, exp, scope, dbErr
 }
 
+// oauthChannel returns the channel named by the channel query parameter, spelled as
+// in TWITCH_CHANNELS or the channels table, or "" (the default token row) when it is
+// absent.
+func oauthChannel(r *http.Request, cfg *config.Config, dbx *sql.DB) (string, error) {
+	ch := strings.TrimSpace(r.URL.Query().Get("channel"))
+	if ch == "" {
+		return "", nil
+	}
+	for _, c := range cfg.TwitchChannels {
+		if strings.EqualFold(c, ch) {
+			return c, nil
+		}
+	}
+	if dbx != nil {
+		channels, err := dbpkg.ListChannels(r.Context(), dbx)
+		if err != nil {
+			return "", err
+		}
+		for _, c := range channels {
+			if c.Enabled && strings.EqualFold(c.Name, ch) {
+				return c.Name, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("unknown channel %q", ch)
+}
 
 // HandleTwitchOAuthStart initiates the Twitch OAuth flow by redirecting to Twitch.
+// With ?channel=X the token is stored for that channel's chat bot and Helix calls;
+// without it, as the default token.
 func (h *Handlers) HandleTwitchOAuthStart(w http.ResponseWriter, r *http.Request) {
 	cfg, _ := config.Load() // ignore error; minimal usage
 	if cfg.TwitchClientID == "" || cfg.TwitchRedirectURI == "" {
 		http.Error(w, "oauth not configured (need TWITCH_CLIENT_ID + TWITCH_REDIRECT_URI)", http.StatusBadRequest)
 		return
 	}
+	channel, err := oauthChannel(r, cfg, h.db)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	// generate state
 	b := make([]byte, 16)
 	if _, err := rand.Read(b); err != nil {
@@ -45,7 +83,7 @@ func (h *Handlers) HandleTwitchOAuthStart(w http.ResponseWriter, r *http.Request
 		return
 	}
 	st := hex.EncodeToString(b)
-	h.addOAuthState(st, time.Now().Add(10*time.Minute))
+	h.addOAuthState(st, channel, time.Now().Add(10*time.Minute))
 	authURL, err := twitchapi.BuildAuthorizeURL(cfg.TwitchClientID, cfg.TwitchRedirectURI, cfg.TwitchScopes, st)
 	if err != nil {
 		http.Error(w, err.Error(), 500)
@@ -64,42 +102,54 @@ func (h *Handlers) HandleTwitchOAuthCallback(w http.ResponseWriter, r *http.Requ
 		return
 	}
 	// validate state
-	h.stateMu.RLock()
-	exp, ok := h.stateStore[st]
-	h.stateMu.RUnlock()
-	if !ok || time.Now().After(exp) {
+	state, ok := h.takeOAuthState(st)
+	if !ok {
 		http.Error(w, "invalid state", 400)
 		return
 	}
-	h.stateMu.Lock()
-	delete(h.stateStore, st)
-	h.stateMu.Unlock()
 	ctx := r.Context()
 	res, err := twitchapi.ExchangeAuthCode(ctx, cfg.TwitchClientID, cfg.TwitchClientSecret, code, cfg.TwitchRedirectURI)
 	if err != nil {
 		http.Error(w, err.Error(), 500)
 		return
 	}
-	// persist tokens using dbpkg.UpsertOAuthToken (handles encryption)
-	dbErr := dbpkg.UpsertOAuthToken(ctx, h.db, "twitch", res.AccessToken, res.RefreshToken,
+	// persist tokens using dbpkg.UpsertOAuthTokenForChannel (handles encryption)
+	dbErr := dbpkg.UpsertOAuthTokenForChannel(ctx, h.db, "twitch", state.channel, res.AccessToken, res.RefreshToken,
 		twitchapi.ComputeExpiry(res.ExpiresIn), "", strings.Join(res.Scope, " "))
 	if dbErr != nil {
 		http.Error(w, dbErr.Error(), 500)
 		return
 	}
+	// The chat bot logs in as the account that authorized, so remember its login.
+	login := ""
+	if v, err := twitchapi.ValidateToken(ctx, res.AccessToken); err != nil {
+		slog.Warn("twitch oauth: validate token", slog.Any("err", err), slog.String("channel", state.channel))
+	} else {
+		login = v.Login
+		if err := dbpkg.SetTwitchBotLogin(ctx, h.db, state.channel, login); err != nil {
+			slog.Warn("twitch oauth: store bot login", slog.Any("err", err), slog.String("channel", state.channel))
+		}
+	}
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(map[string]any{"status": "ok", "scopes": res.Scope, "expires_in": res.ExpiresIn}); err != nil {
+	if err := json.NewEncoder(w).Encode(map[string]any{"status": "ok", "channel": state.channel, "login": login, "scopes": res.Scope, "expires_in": res.ExpiresIn}); err != nil {
 		slog.Warn("failed to encode JSON response", slog.Any("err", err))
 	}
 }
 
-// HandleYouTubeOAuthStart initiates the YouTube OAuth flow.
+// HandleYouTubeOAuthStart initiates the YouTube OAuth flow. With ?channel=X the
+// authorized account becomes the upload destination for that channel's VODs;
+// without it, the default destination.
 func (h *Handlers) HandleYouTubeOAuthStart(w http.ResponseWriter, r *http.Request) {
 	cfg, _ := config.Load()
 	if cfg.YTClientID == "" || cfg.YTRedirectURI == "" {
 		http.Error(w, "youtube oauth not configured", 400)
 		return
 	}
+	channel, err := oauthChannel(r, cfg, h.db)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	// generate state
 	b := make([]byte, 16)
 	if _, err := rand.Read(b); err != nil {
@@ -107,9 +157,9 @@ func (h *Handlers) HandleYouTubeOAuthStart(w http.ResponseWriter, r *http.Reques
 		return
 	}
 	st := hex.EncodeToString(b)
-	h.addOAuthState(st, time.Now().Add(10*time.Minute))
+	h.addOAuthState(st, channel, time.Now().Add(10*time.Minute))
 	// Build auth URL manually (reuse youtubeapi oauth config)
-	ts := &oauthTokenStore{db: h.db}
+	ts := &oauthTokenStore{db: h.db, channel: channel}
 	yts := youtubeapi.New(cfg, ts)
 	authURL := yts.AuthCodeURL(st)
 	http.Redirect(w, r, authURL, http.StatusFound)
@@ -124,17 +174,12 @@ func (h *Handlers) HandleYouTubeOAuthCallback(w http.ResponseWriter, r *http.Req
 		http.Error(w, "missing code/state", 400)
 		return
 	}
-	h.stateMu.RLock()
-	exp, ok := h.stateStore[st]
-	h.stateMu.RUnlock()
-	if !ok || time.Now().After(exp) {
+	state, ok := h.takeOAuthState(st)
+	if !ok {
 		http.Error(w, "invalid state", 400)
 		return
 	}
-	h.stateMu.Lock()
-	delete(h.stateStore, st)
-	h.stateMu.Unlock()
-	ts := &oauthTokenStore{db: h.db}
+	ts := &oauthTokenStore{db: h.db, channel: state.channel}
 	yts := youtubeapi.New(cfg, ts)
 	tok, err := yts.Exchange(r.Context(), code)
 	if err != nil {
@@ -142,7 +187,7 @@ func (h *Handlers) HandleYouTubeOAuthCallback(w http.ResponseWriter, r *http.Req
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(map[string]any{"status": "ok", "expiry": tok.Expiry, "access_token_present": tok.AccessToken != "", "refresh_token_present": tok.RefreshToken != ""}); err != nil {
+	if err := json.NewEncoder(w).Encode(map[string]any{"status": "ok", "channel": state.channel, "expiry": tok.Expiry, "access_token_present": tok.AccessToken != "", "refresh_token_present": tok.RefreshToken != ""}); err != nil {
 		slog.Warn("failed to encode JSON response", slog.Any("err", err))
 	}
 }
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	vodpkg "github.com/onnwee/vod-tender/backend/vod"
+)
+
+// handleVodSegments serves GET (list) and POST (create) on /vods/{id}/segments.
+func (h *Handlers) handleVodSegments(w http.ResponseWriter, r *http.Request, vodID string) {
+	switch r.Method {
+	case http.MethodGet:
+		if !h.vodExists(w, r, vodID) {
+			return
+		}
+		var types []string
+		for _, t := range strings.Split(r.URL.Query().Get("type"), ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				types = append(types, t)
+			}
+		}
+		segs, err := vodpkg.ListSegments(r.Context(), h.db, vodID, types, r.URL.Query().Get("sort"))
+		if err != nil {
+			writeSegmentError(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"vod_id": vodID, "segments": segs})
+	case http.MethodPost:
+		var in vodpkg.SegmentInput
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+		seg, err := vodpkg.CreateSegment(r.Context(), h.db, vodID, in)
+		if err != nil {
+			writeSegmentError(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(seg)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleVodSegmentsAuto (POST /vods/{id}/segments/auto) replaces the automatic parts of a
+// VOD with equal parts no longer than max_seconds (default 12h).
+func (h *Handlers) handleVodSegmentsAuto(w http.ResponseWriter, r *http.Request, vodID string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var body struct {
+		MaxSeconds int `json:"max_seconds"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+	}
+	max := vodpkg.DefaultMaxPartDuration
+	if body.MaxSeconds > 0 {
+		max = time.Duration(body.MaxSeconds) * time.Second
+	}
+	parts, err := vodpkg.AutoSplitParts(r.Context(), h.db, vodID, max)
+	if err != nil {
+		writeSegmentError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"vod_id": vodID, "segments": parts})
+}
+
+// handleVodSegment serves GET, PATCH and DELETE on /vods/{id}/segments/{segId}.
+func (h *Handlers) handleVodSegment(w http.ResponseWriter, r *http.Request, vodID, segID string) {
+	var seg vodpkg.Segment
+	var err error
+	switch r.Method {
+	case http.MethodGet:
+		seg, err = vodpkg.GetSegment(r.Context(), h.db, vodID, segID)
+	case http.MethodPatch:
+		var in vodpkg.SegmentInput
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+		seg, err = vodpkg.UpdateSegment(r.Context(), h.db, vodID, segID, in)
+	case http.MethodDelete:
+		if err := vodpkg.DeleteSegment(r.Context(), h.db, vodID, segID); err != nil {
+			writeSegmentError(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		writeSegmentError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(seg)
+}
+
+// vodExists writes a 404 and returns false when the VOD is unknown.
+func (h *Handlers) vodExists(w http.ResponseWriter, r *http.Request, vodID string) bool {
+	var one int
+	err := h.db.QueryRowContext(r.Context(), `SELECT 1 FROM vods WHERE twitch_vod_id=$1`, vodID).Scan(&one)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		http.Error(w, "vod not found", http.StatusNotFound)
+		return false
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+func writeSegmentError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		http.Error(w, "vod not found", http.StatusNotFound)
+	case errors.Is(err, vodpkg.ErrSegmentNotFound):
+		http.NotFound(w, r)
+	case errors.Is(err, vodpkg.ErrInvalidSegmentTimes):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	case errors.Is(err, vodpkg.ErrInvalidSegment):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -3,6 +3,7 @@ package server
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"log/slog"
 	"net/http"
 	"strings"
@@ -17,22 +18,27 @@ func (h *Handlers) HandleVodsList(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	// Basic pagination: ?limit=50&offset=0
+	// Basic pagination: ?limit=50&offset=0, optionally for one ?channel=
 	limit := parseIntQuery(r, "limit", 50)
 	if limit <= 0 || limit > 200 {
 		limit = 50
 	}
 	offset := parseIntQuery(r, "offset", 0)
+	q := r.URL.Query()
 	rows, err := h.db.QueryContext(r.Context(), `
         SELECT twitch_vod_id,
+               channel,
                COALESCE(title, ''),
                COALESCE(date, to_timestamp(0)),
                COALESCE(processed, FALSE),
-               COALESCE(youtube_url, '')
+               COALESCE(youtube_url, ''),
+               status,
+               twitch_deleted_at
         FROM vods
+        WHERE $3 = FALSE OR channel = $4
         ORDER BY COALESCE(date, to_timestamp(0)) DESC
         LIMIT $1 OFFSET $2
-    `, limit, offset)
+    `, limit, offset, q.Has("channel"), q.Get("channel"))
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -43,16 +49,19 @@ func (h *Handlers) HandleVodsList(w http.ResponseWriter, r *http.Request) {
 		}
 	}()
 	type vod struct {
-		Date      time.Time `json:"date"`
-		ID        string    `json:"id"`
-		Title     string    `json:"title"`
-		YouTube   string    `json:"youtube_url"`
-		Processed bool      `json:"processed"`
+		Date          time.Time  `json:"date"`
+		TwitchDeleted *time.Time `json:"twitch_deleted_at,omitempty"`
+		ID            string     `json:"id"`
+		Channel       string     `json:"channel"`
+		Title         string     `json:"title"`
+		YouTube       string     `json:"youtube_url"`
+		Status        string     `json:"status"`
+		Processed     bool       `json:"processed"`
 	}
 	list := make([]vod, 0)
 	for rows.Next() {
 		var v vod
-		if err := rows.Scan(&v.ID, &v.Title, &v.Date, &v.Processed, &v.YouTube); err != nil {
+		if err := rows.Scan(&v.ID, &v.Channel, &v.Title, &v.Date, &v.Processed, &v.YouTube, &v.Status, &v.TwitchDeleted); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -85,12 +94,28 @@ func (h *Handlers) HandleVodsDispatcher(w http.ResponseWriter, r *http.Request)
 		h.handleVodCancel(w, r, vodID)
 	case tail == "segments":
 		h.handleVodSegments(w, r, vodID)
+	case tail == "segments/auto":
+		h.handleVodSegmentsAuto(w, r, vodID)
+	case strings.HasPrefix(tail, "segments/") && !strings.Contains(strings.TrimPrefix(tail, "segments/"), "/"):
+		h.handleVodSegment(w, r, vodID, strings.TrimPrefix(tail, "segments/"))
 	case tail == "chat":
 		h.handleChatJSON(w, r, vodID)
 	case tail == "chat/stream":
 		h.handleChatSSE(w, r, vodID)
+	case tail == "chat/export":
+		h.handleChatExport(w, r, vodID)
+	case tail == "chat/events":
+		h.handleChatEvents(w, r, vodID)
+	case tail == "chat/gaps":
+		h.handleChatGaps(w, r, vodID)
+	case tail == "chat/stats":
+		h.handleChatStats(w, r, vodID)
+	case tail == "highlights":
+		h.handleVodHighlights(w, r, vodID)
 	case tail == "description":
 		h.handleVodDescription(w, r, vodID)
+	case tail == "upload-preview":
+		h.handleVodUploadPreview(w, r, vodID)
 	default:
 		http.NotFound(w, r)
 	}
@@ -103,6 +128,7 @@ func (h *Handlers) handleVodDetail(w http.ResponseWriter, r *http.Request, vodID
 	}
 	row := h.db.QueryRowContext(r.Context(), `
         SELECT twitch_vod_id,
+               channel,
                COALESCE(title, ''),
                COALESCE(date, to_timestamp(0)),
                COALESCE(duration_seconds, 0),
@@ -112,26 +138,43 @@ func (h *Handlers) handleVodDetail(w http.ResponseWriter, r *http.Request, vodID
                COALESCE(download_state, ''),
                COALESCE(download_retries, 0),
                COALESCE(download_total, 0),
-               progress_updated_at
+               progress_updated_at,
+               status,
+               twitch_deleted_at,
+               COALESCE(priority, 0),
+               COALESCE(skip_upload, FALSE),
+               COALESCE(processing_error, '')
     FROM vods WHERE twitch_vod_id=$1
     `, vodID)
 	type vod struct {
-		Date            time.Time  `json:"date"`
-		ProgressUpdated *time.Time `json:"progress_updated_at,omitempty"`
-		ID              string     `json:"id"`
-		Title           string     `json:"title"`
-		YouTube         string     `json:"youtube_url"`
-		DownloadedPath  string     `json:"downloaded_path"`
-		DownloadState   string     `json:"download_state"`
-		Description     string     `json:"description"`
-		Duration        int        `json:"duration_seconds"`
-		DownloadRetries int        `json:"download_retries"`
-		DownloadTotal   int64      `json:"download_total"`
-		Processed       bool       `json:"processed"`
+		Date            time.Time                `json:"date"`
+		ProgressUpdated *time.Time               `json:"progress_updated_at,omitempty"`
+		TwitchDeleted   *time.Time               `json:"twitch_deleted_at,omitempty"`
+		ID              string                   `json:"id"`
+		Channel         string                   `json:"channel"`
+		Title           string                   `json:"title"`
+		YouTube         string                   `json:"youtube_url"`
+		DownloadedPath  string                   `json:"downloaded_path"`
+		DownloadState   string                   `json:"download_state"`
+		Description     string                   `json:"description"`
+		Status          string                   `json:"status"`
+		ProcessingError string                   `json:"processing_error,omitempty"`
+		StatusHistory   []vodpkg.StateTransition `json:"status_history"`
+		Stages          []vodpkg.StageResult     `json:"stages"`
+		Uploads         []vodpkg.UploadRecord    `json:"uploads"`
+		Chapters        []vodpkg.Chapter         `json:"chapters"`
+		TitleHistory    []vodpkg.TitleChange     `json:"title_history"`
+		Duration        int                      `json:"duration_seconds"`
+		DownloadRetries int                      `json:"download_retries"`
+		DownloadTotal   int64                    `json:"download_total"`
+		Priority        int                      `json:"priority"`
+		Processed       bool                     `json:"processed"`
+		SkipUpload      bool                     `json:"skip_upload"`
 	}
 	var v vod
-	if err := row.Scan(&v.ID, &v.Title, &v.Date, &v.Duration, &v.Processed, &v.YouTube,
-		&v.DownloadedPath, &v.DownloadState, &v.DownloadRetries, &v.DownloadTotal, &v.ProgressUpdated); err != nil {
+	if err := row.Scan(&v.ID, &v.Channel, &v.Title, &v.Date, &v.Duration, &v.Processed, &v.YouTube,
+		&v.DownloadedPath, &v.DownloadState, &v.DownloadRetries, &v.DownloadTotal, &v.ProgressUpdated, &v.Status, &v.TwitchDeleted,
+		&v.Priority, &v.SkipUpload, &v.ProcessingError); err != nil {
 		if err == sql.ErrNoRows {
 			http.NotFound(w, r)
 			return
@@ -141,6 +184,36 @@ func (h *Handlers) handleVodDetail(w http.ResponseWriter, r *http.Request, vodID
 	}
 	// Load description separately to preserve compatibility with older schemas
 	_ = h.db.QueryRowContext(r.Context(), `SELECT COALESCE(description,'') FROM vods WHERE twitch_vod_id=$1`, vodID).Scan(&v.Description)
+	history, err := vodpkg.StatusHistory(r.Context(), h.db, vodID)
+	if err != nil {
+		slog.Warn("failed to load status history", slog.String("vod_id", vodID), slog.Any("err", err))
+		history = []vodpkg.StateTransition{}
+	}
+	v.StatusHistory = history
+	stages, err := vodpkg.LoadStageResults(r.Context(), h.db, vodID)
+	if err != nil {
+		slog.Warn("failed to load stage results", slog.String("vod_id", vodID), slog.Any("err", err))
+		stages = []vodpkg.StageResult{}
+	}
+	v.Stages = stages
+	uploads, err := vodpkg.LoadUploads(r.Context(), h.db, vodID)
+	if err != nil {
+		slog.Warn("failed to load upload destinations", slog.String("vod_id", vodID), slog.Any("err", err))
+		uploads = []vodpkg.UploadRecord{}
+	}
+	v.Uploads = uploads
+	chapters, err := vodpkg.LoadChapters(r.Context(), h.db, vodID)
+	if err != nil {
+		slog.Warn("failed to load chapters", slog.String("vod_id", vodID), slog.Any("err", err))
+		chapters = []vodpkg.Chapter{}
+	}
+	v.Chapters = chapters
+	titles, err := vodpkg.LoadTitleHistory(r.Context(), h.db, vodID)
+	if err != nil {
+		slog.Warn("failed to load title history", slog.String("vod_id", vodID), slog.Any("err", err))
+		titles = []vodpkg.TitleChange{}
+	}
+	v.TitleHistory = titles
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(v)
 }
@@ -156,6 +229,10 @@ func (h *Handlers) handleVodProgress(w http.ResponseWriter, r *http.Request, vod
                COALESCE(download_retries, 0),
                COALESCE(download_total, 0),
                COALESCE(download_bytes, 0),
+               download_speed,
+               download_eta_seconds,
+               download_fragment_index,
+               download_fragment_count,
                COALESCE(downloaded_path, ''),
                COALESCE(processed, FALSE),
                COALESCE(youtube_url, ''),
@@ -167,9 +244,11 @@ func (h *Handlers) handleVodProgress(w http.ResponseWriter, r *http.Request, vod
 	var retries int
 	var total int64
 	var bytes int64
+	var speed sql.NullFloat64
+	var eta, fragIndex, fragCount sql.NullInt64
 	var processed bool
 	var updated *time.Time
-	if err := row.Scan(&state, &retries, &total, &bytes, &path, &processed, &yt, &processingError, &updated); err != nil {
+	if err := row.Scan(&state, &retries, &total, &bytes, &speed, &eta, &fragIndex, &fragCount, &path, &processed, &yt, &processingError, &updated); err != nil {
 		if err == sql.ErrNoRows {
 			http.NotFound(w, r)
 			return
@@ -177,10 +256,11 @@ func (h *Handlers) handleVodProgress(w http.ResponseWriter, r *http.Request, vod
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	// Derive percent from state string; if absent, fall back to bytes/total.
+	// Percent comes from the typed byte counters; rows written before typed progress
+	// may still carry a raw yt-dlp line in download_state.
 	var percentVal float64
-	if p := derivePercent(state); p != nil {
-		percentVal = *p
+	if processed || strings.EqualFold(state, "complete") {
+		percentVal = 100
 	} else if total > 0 && bytes >= 0 {
 		// Clamp to [0,100]
 		percentVal = (float64(bytes) / float64(total)) * 100.0
@@ -190,8 +270,8 @@ func (h *Handlers) handleVodProgress(w http.ResponseWriter, r *http.Request, vod
 		if percentVal > 100 {
 			percentVal = 100
 		}
-	} else if processed || strings.EqualFold(state, "complete") {
-		percentVal = 100
+	} else if p := derivePercent(state); p != nil {
+		percentVal = *p
 	} else {
 		percentVal = 0
 	}
@@ -200,7 +280,12 @@ func (h *Handlers) handleVodProgress(w http.ResponseWriter, r *http.Request, vod
 		"state":               state,
 		"percent":             percentVal,
 		"retries":             retries,
+		"downloaded_bytes":    bytes,
 		"total_bytes":         total,
+		"speed_bytes_per_sec": nullFloat(speed),
+		"eta_seconds":         nullInt(eta),
+		"fragment_index":      nullInt(fragIndex),
+		"fragment_count":      nullInt(fragCount),
 		"downloaded_path":     path,
 		"processed":           processed,
 		"processing_error":    processingError,
@@ -216,21 +301,11 @@ func (h *Handlers) handleVodReprocess(w http.ResponseWriter, r *http.Request, vo
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	_, err := h.db.ExecContext(r.Context(), `
-        UPDATE vods
-        SET processed=0,
-            processing_error=NULL,
-            youtube_url=NULL,
-            downloaded_path=NULL,
-            download_state=NULL,
-            download_retries=0,
-            download_bytes=0,
-            download_total=0,
-            progress_updated_at=NULL,
-            updated_at=CURRENT_TIMESTAMP
-        WHERE twitch_vod_id=$1
-    `, vodID)
-	if err != nil {
+	if err := vodpkg.Reprocess(r.Context(), h.db, vodID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.NotFound(w, r)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -251,9 +326,27 @@ func (h *Handlers) handleVodCancel(w http.ResponseWriter, r *http.Request, vodID
 	w.WriteHeader(http.StatusNoContent)
 }
 
-// handleVodSegments is a placeholder if future segmentation is added.
-func (h *Handlers) handleVodSegments(w http.ResponseWriter, r *http.Request, _ string) {
-	http.Error(w, "not implemented", http.StatusNotImplemented)
+// handleVodUploadPreview renders the YouTube title, description, tags, privacy and category
+// the upload stage would use for this VOD, without uploading anything.
+func (h *Handlers) handleVodUploadPreview(w http.ResponseWriter, r *http.Request, vodID string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	md, err := vodpkg.PreviewVideoMetadata(r.Context(), h.db, vodID)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		http.NotFound(w, r)
+		return
+	case errors.Is(err, vodpkg.ErrInvalidMetadataSettings):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"vod_id": vodID, "metadata": md})
 }
 
 // handleVodDescription allows GET to read and PUT/PATCH to update the custom video description stored in DB.
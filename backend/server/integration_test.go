@@ -15,6 +15,7 @@ func TestAdminEndpointsProtection(t *testing.T) {
 
 	tests := []struct {
 		name           string
+		method         string
 		path           string
 		authHeader     string
 		basicAuth      bool
@@ -55,6 +56,47 @@ func TestAdminEndpointsProtection(t *testing.T) {
 			authHeader:     "wrong-token",
 			expectedStatus: http.StatusUnauthorized,
 		},
+		{
+			name:           "config change without auth",
+			method:         http.MethodPut,
+			path:           "/config",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "segment create without auth",
+			method:         http.MethodPost,
+			path:           "/vods/123/segments",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "segment auto-split without auth",
+			method:         http.MethodPost,
+			path:           "/vods/123/segments/auto",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "segment update without auth",
+			method:         http.MethodPatch,
+			path:           "/vods/123/segments/1",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "segment delete without auth",
+			method:         http.MethodDelete,
+			path:           "/vods/123/segments/1",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "highlight detection without auth",
+			method:         http.MethodPost,
+			path:           "/vods/123/highlights",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "segment list stays public",
+			path:           "/vods/no_such_vod/segments",
+			expectedStatus: http.StatusNotFound,
+		},
 	}
 
 	for _, tt := range tests {
@@ -66,7 +108,11 @@ func TestAdminEndpointsProtection(t *testing.T) {
 
 			handler := NewMux(context.Background(), db)
 
-			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			req := httptest.NewRequest(method, tt.path, nil)
 			if tt.basicAuth {
 				req.SetBasicAuth(tt.username, tt.password)
 			}
@@ -824,6 +824,35 @@ func TestVodSensitiveEndpointPattern(t *testing.T) {
 	}
 }
 
+func TestIsAdminRequest(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		want   bool
+	}{
+		{http.MethodGet, "/admin/monitor", true},
+		{http.MethodPut, "/config", true},
+		{http.MethodGet, "/config", false},
+		{http.MethodPost, "/vods/123/segments", true},
+		{http.MethodPost, "/vods/123/segments/auto", true},
+		{http.MethodPatch, "/vods/123/segments/7", true},
+		{http.MethodDelete, "/vods/123/segments/7", true},
+		{http.MethodGet, "/vods/123/segments", false},
+		{http.MethodGet, "/vods/123/segments/7", false},
+		{http.MethodPost, "/vods/123/reprocess", false},
+		{http.MethodPost, "/vods//segments", false},
+		{http.MethodPost, "/vods/123/highlights", true},
+		{http.MethodGet, "/vods/123/highlights", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			if got := isAdminRequest(httptest.NewRequest(tt.method, tt.path, nil)); got != tt.want {
+				t.Errorf("isAdminRequest(%s %s) = %v, want %v", tt.method, tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
 func TestPostgresRateLimiter(t *testing.T) {
 	db := testutil.SetupTestDB(t)
 
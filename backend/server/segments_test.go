@@ -0,0 +1,86 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	dbpkg "github.com/onnwee/vod-tender/backend/db"
+	vodpkg "github.com/onnwee/vod-tender/backend/vod"
+)
+
+func TestVodSegmentsEndpoints(t *testing.T) {
+	dsn := os.Getenv("TEST_PG_DSN")
+	if dsn == "" {
+		t.Skip("TEST_PG_DSN not set")
+	}
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("failed to close db: %v", err)
+		}
+	}()
+	ctx := context.Background()
+	if err := dbpkg.Migrate(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+	vodID := "test_segments_vod_1"
+	if _, err := db.ExecContext(ctx, `INSERT INTO vods (channel, twitch_vod_id, title, date, duration_seconds, created_at)
+		VALUES ('', $1, 'Segments VOD', NOW(), 3600, NOW()) ON CONFLICT (twitch_vod_id) DO NOTHING`, vodID); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _, _ = db.Exec(`DELETE FROM vods WHERE twitch_vod_id=$1`, vodID) })
+	mux := NewMux(ctx, db)
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+	base := "/vods/" + vodID + "/segments"
+
+	if w := do(http.MethodPost, base, `{"type":"highlight","title":"x","start_time":10,"end_time":5}`); w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("end before start: status %d", w.Code)
+	}
+	if w := do(http.MethodPost, base, `{"type":"scene","title":"x","start_time":0,"end_time":5}`); w.Code != http.StatusBadRequest {
+		t.Fatalf("bad type: status %d", w.Code)
+	}
+	w := do(http.MethodPost, base, `{"type":"highlight","title":"Clutch","start_time":60,"end_time":90,"tags":["fps"]}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: status %d body %s", w.Code, w.Body.String())
+	}
+	var seg vodpkg.Segment
+	if err := json.Unmarshal(w.Body.Bytes(), &seg); err != nil {
+		t.Fatal(err)
+	}
+	if w := do(http.MethodPatch, base+"/"+seg.ID, `{"end_time":120}`); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"duration":60`) {
+		t.Fatalf("patch: status %d body %s", w.Code, w.Body.String())
+	}
+	w = do(http.MethodGet, base+"?type=highlight", "")
+	var list struct {
+		Segments []vodpkg.Segment `json:"segments"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil || len(list.Segments) != 1 || list.Segments[0].Tags[0] != "fps" {
+		t.Fatalf("list: %s", w.Body.String())
+	}
+	if w := do(http.MethodPost, base+"/auto", `{"max_seconds":1500}`); w.Code != http.StatusOK || strings.Count(w.Body.String(), `"type":"part"`) != 3 {
+		t.Fatalf("auto: status %d body %s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodDelete, base+"/"+seg.ID, ""); w.Code != http.StatusNoContent {
+		t.Fatalf("delete: status %d", w.Code)
+	}
+	if w := do(http.MethodGet, base+"/"+seg.ID, ""); w.Code != http.StatusNotFound {
+		t.Fatalf("get deleted: status %d", w.Code)
+	}
+	if w := do(http.MethodGet, "/vods/no_such_vod/segments", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("unknown vod: status %d", w.Code)
+	}
+}
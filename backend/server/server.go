@@ -27,6 +27,26 @@ var getVodSensitiveEndpointPattern = sync.OnceValue(func() *regexp.Regexp {
 	return regexp.MustCompile(`^/vods/[^/]+/(cancel|reprocess)$`)
 })
 
+// getVodAdminWritePattern returns a compiled regex pattern to match VOD sub-resources
+// whose non-GET methods need admin auth: creating, splitting, retitling or deleting the
+// YouTube parts of a VOD under /vods/{id}/segments, and re-running highlight detection.
+var getVodAdminWritePattern = sync.OnceValue(func() *regexp.Regexp {
+	return regexp.MustCompile(`^/vods/[^/]+/(segments(/.*)?|highlights)$`)
+})
+
+// isAdminRequest reports whether r needs admin auth and rate limiting.
+func isAdminRequest(r *http.Request) bool {
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/admin/"):
+		return true
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		return false
+	case r.URL.Path == "/config":
+		return r.Method == http.MethodPut
+	}
+	return getVodAdminWritePattern().MatchString(r.URL.Path)
+}
+
 // NewMux returns the HTTP handler with all routes.
 // The provided context is used for rate limiter cleanup goroutines lifecycle.
 func NewMux(ctx context.Context, db *sql.DB) http.Handler {
@@ -65,6 +85,9 @@ func NewMux(ctx context.Context, db *sql.DB) http.Handler {
 	mux.HandleFunc("/auth/youtube/start", handlers.HandleYouTubeOAuthStart)
 	mux.HandleFunc("/auth/youtube/callback", handlers.HandleYouTubeOAuthCallback)
 
+	// Twitch EventSub webhook (authenticated by HMAC signature, not admin auth)
+	mux.HandleFunc("/eventsub", handlers.HandleEventSub)
+
 	// Health and readiness endpoints
 	mux.HandleFunc("/healthz", handlers.HandleHealthz)
 	mux.HandleFunc("/readyz", handlers.HandleReadyz)
@@ -76,6 +99,7 @@ func NewMux(ctx context.Context, db *sql.DB) http.Handler {
 	// VOD endpoints
 	mux.HandleFunc("/vods", handlers.HandleVodsList)
 	mux.HandleFunc("/vods/", handlers.HandleVodsDispatcher)
+	mux.HandleFunc("/chat/search", handlers.HandleChatSearch)
 
 	// Admin endpoints
 	mux.HandleFunc("/admin/vod/scan", handlers.HandleAdminVodScan)
@@ -83,11 +107,16 @@ func NewMux(ctx context.Context, db *sql.DB) http.Handler {
 	mux.HandleFunc("/admin/monitor", handlers.HandleAdminMonitor)
 	mux.HandleFunc("/admin/vod/priority", handlers.HandleAdminVodPriority)
 	mux.HandleFunc("/admin/vod/skip-upload", handlers.HandleAdminVodSkipUpload)
+	mux.HandleFunc("/admin/vod/chapters", handlers.HandleAdminVodChapters)
+	mux.HandleFunc("/admin/vod/chat-import", handlers.HandleAdminVodChatImport)
+	mux.HandleFunc("/admin/retention", handlers.HandleAdminRetention)
+	mux.HandleFunc("/admin/channels", handlers.HandleAdminChannels)
 
 	// Create a selective middleware wrapper that applies auth and rate limiting to admin endpoints
 	selectiveHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Apply auth and rate limiting to admin endpoints
-		if strings.HasPrefix(r.URL.Path, "/admin/") {
+		// Apply auth and rate limiting to admin endpoints, config changes, segment edits and
+		// highlight detection
+		if isAdminRequest(r) {
 			// Apply auth first, then rate limiting
 			adminAuth(rateLimitMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 				mux.ServeHTTP(w, r)
@@ -161,7 +190,6 @@ func (r *statusRecorder) Flush() {
 	}
 }
 
-// cfgGet returns an override value from kv for a given key (with cfg: prefix) or falls back to env.
 // Start runs the HTTP server and shuts down gracefully on context cancellation.
 func Start(ctx context.Context, db *sql.DB, addr string) error {
 	srv := &http.Server{
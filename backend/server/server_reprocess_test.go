@@ -55,4 +55,11 @@ func TestReprocess(t *testing.T) {
 	if retries != 0 || bytes != 0 || total != 0 {
 		t.Fatalf("expected counters reset, got retries=%d bytes=%d total=%d", retries, bytes, total)
 	}
+	var status string
+	if err := db.QueryRowContext(context.Background(), `SELECT status FROM vods WHERE twitch_vod_id='123'`).Scan(&status); err != nil {
+		t.Fatal(err)
+	}
+	if status != "queued" {
+		t.Fatalf("expected status=queued after reprocess, got %s", status)
+	}
 }
@@ -1,8 +1,8 @@
 package server
 
 import (
+	"database/sql"
 	"net/http"
-	"os"
 	"strconv"
 	"strings"
 )
@@ -17,6 +17,15 @@ func parseFloat64Query(r *http.Request, key string, def float64) float64 {
 	return def
 }
 
+// parseBoolQuery reports whether a query parameter is set to 1, true or yes.
+func parseBoolQuery(r *http.Request, key string) bool {
+	switch strings.ToLower(r.URL.Query().Get(key)) {
+	case "1", "true", "yes":
+		return true
+	}
+	return false
+}
+
 // parseIntQuery extracts an int parameter from query string with a default value.
 func parseIntQuery(r *http.Request, key string, def int) int {
 	if v := r.URL.Query().Get(key); v != "" {
@@ -27,7 +36,7 @@ func parseIntQuery(r *http.Request, key string, def int) int {
 	return def
 }
 
-// derivePercent extracts a float percent from yt-dlp progress string, if present.
+// derivePercent extracts a float percent from a legacy raw yt-dlp progress line, if present.
 func derivePercent(state string) *float64 {
 	// example: "[download]   4.3% of ~2.19GiB at  3.05MiB/s ETA 11:22"
 	i := strings.Index(state, "%")
@@ -49,12 +58,18 @@ func derivePercent(state string) *float64 {
 	return nil
 }
 
-// getEnvInt returns an integer environment variable value or default if not set or invalid.
-func getEnvInt(key string, defaultVal int) int {
-	if s := os.Getenv(key); s != "" {
-		if n, err := strconv.Atoi(s); err == nil {
-			return n
-		}
+// nullFloat returns nil for SQL NULL so JSON encodes it as null.
+func nullFloat(v sql.NullFloat64) any {
+	if !v.Valid {
+		return nil
+	}
+	return v.Float64
+}
+
+// nullInt returns nil for SQL NULL so JSON encodes it as null.
+func nullInt(v sql.NullInt64) any {
+	if !v.Valid {
+		return nil
 	}
-	return defaultVal
+	return v.Int64
 }
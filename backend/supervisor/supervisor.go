@@ -0,0 +1,262 @@
+// Package supervisor runs each channel's background workers (VOD processing, catalog
+// backfill and reconciliation, retention, chat recording and import, EventSub
+// subscriptions) and starts or stops them as channels are enabled or disabled in the
+// channels table, without a restart.
+package supervisor
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/onnwee/vod-tender/backend/chat"
+	"github.com/onnwee/vod-tender/backend/config"
+	dbpkg "github.com/onnwee/vod-tender/backend/db"
+	"github.com/onnwee/vod-tender/backend/vod"
+)
+
+// stopTimeout bounds how long the supervisor waits for a stopped channel's workers
+// to return before moving on.
+const stopTimeout = 30 * time.Second
+
+// listChannels returns the rows of the channels table. Replaced in tests.
+var listChannels = dbpkg.ListChannels
+
+// Supervisor owns the workers of every running channel. Each channel's workers run
+// under their own context, so one channel can be stopped without touching the others.
+type Supervisor struct {
+	db  *sql.DB
+	cfg *config.Config
+	hub *chat.Hub
+	// workers returns the long-running functions to start for channel. Each must
+	// return once its context is cancelled.
+	workers func(ctx context.Context, channel string) []func(context.Context)
+
+	mu      sync.Mutex
+	running map[string]*channelRun // keyed by lowercased channel name
+}
+
+// channelRun is one channel's running workers.
+type channelRun struct {
+	name   string
+	cancel context.CancelFunc
+	done   chan struct{} // closed once every worker has returned
+}
+
+// New returns a Supervisor whose channels record chat through hub. cfg decides the
+// chat mode (auto or manual) and seeds the channels table.
+func New(database *sql.DB, cfg *config.Config, hub *chat.Hub) *Supervisor {
+	s := &Supervisor{db: database, cfg: cfg, hub: hub, running: map[string]*channelRun{}}
+	s.workers = s.channelWorkers
+	return s
+}
+
+// Run adds cfg.TwitchChannels to the channels table (or the default channel when none
+// is configured), starts the workers of every enabled channel and keeps them in step
+// with the table, re-checking it on each runtime config change (see
+// config.WatchRuntime), until ctx is cancelled. While the table is empty the default
+// channel runs, as in a setup without TWITCH_CHANNEL.
+// Run returns once every worker has stopped.
+func (s *Supervisor) Run(ctx context.Context) {
+	if err := dbpkg.SeedChannels(ctx, s.db, s.cfg.TwitchChannels); err != nil {
+		slog.Warn("supervisor: seed channels", slog.Any("err", err))
+	}
+	changes, stop := config.WatchRuntime()
+	defer stop()
+	s.Sync(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			s.stopAll()
+			return
+		case <-changes:
+			s.Sync(ctx)
+		}
+	}
+}
+
+// Sync starts the workers of enabled channels that are not running and stops those
+// of channels that are no longer enabled. If the channels table cannot be read, the
+// running workers are kept; at startup TWITCH_CHANNELS is used instead.
+func (s *Supervisor) Sync(ctx context.Context) {
+	want, err := s.desired(ctx)
+	if err != nil {
+		if len(s.Running()) > 0 {
+			slog.Warn("supervisor: list channels; keeping current workers", slog.Any("err", err))
+			return
+		}
+		slog.Warn("supervisor: list channels; using TWITCH_CHANNELS", slog.Any("err", err))
+		want = map[string]string{}
+		for _, ch := range s.cfg.TwitchChannels {
+			want[strings.ToLower(ch)] = ch
+		}
+		if len(want) == 0 {
+			want[config.DefaultChannel] = config.DefaultChannel
+		}
+	}
+
+	s.mu.Lock()
+	var stopping []*channelRun
+	for key, run := range s.running {
+		if _, ok := want[key]; !ok {
+			run.cancel()
+			delete(s.running, key)
+			stopping = append(stopping, run)
+		}
+	}
+	s.mu.Unlock()
+	for _, run := range stopping {
+		wait(run)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, name := range want {
+		if _, ok := s.running[key]; !ok {
+			s.running[key] = s.start(ctx, name)
+		}
+	}
+}
+
+// Running returns the names of the channels whose workers are running, sorted.
+func (s *Supervisor) Running() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]string, 0, len(s.running))
+	for _, run := range s.running {
+		out = append(out, run.name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// desired returns the enabled channels keyed by lowercased name.
+func (s *Supervisor) desired(ctx context.Context) (map[string]string, error) {
+	rows, err := listChannels(ctx, s.db)
+	if err != nil {
+		return nil, err
+	}
+	want := map[string]string{}
+	for _, c := range rows {
+		if c.Enabled {
+			want[strings.ToLower(c.Name)] = c.Name
+		}
+	}
+	if len(rows) == 0 {
+		want[config.DefaultChannel] = config.DefaultChannel
+	}
+	return want, nil
+}
+
+// start launches channel's workers under a context derived from ctx.
+func (s *Supervisor) start(ctx context.Context, channel string) *channelRun {
+	runCtx, cancel := context.WithCancel(ctx)
+	run := &channelRun{name: channel, cancel: cancel, done: make(chan struct{})}
+	var wg sync.WaitGroup
+	for _, w := range s.workers(runCtx, channel) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w(runCtx)
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(run.done)
+	}()
+	slog.Info("channel workers started", slog.String("channel", channel))
+	return run
+}
+
+// stopAll cancels every channel's workers and waits for them.
+func (s *Supervisor) stopAll() {
+	s.mu.Lock()
+	runs := make([]*channelRun, 0, len(s.running))
+	for key, run := range s.running {
+		run.cancel()
+		delete(s.running, key)
+		runs = append(runs, run)
+	}
+	s.mu.Unlock()
+	for _, run := range runs {
+		wait(run)
+	}
+}
+
+// wait blocks until run's workers have returned or stopTimeout passes.
+func wait(run *channelRun) {
+	select {
+	case <-run.done:
+		slog.Info("channel workers stopped", slog.String("channel", run.name))
+	case <-time.After(stopTimeout):
+		slog.Warn("channel workers still stopping", slog.String("channel", run.name), slog.Duration("waited", stopTimeout))
+	}
+}
+
+// channelWorkers returns the jobs run for each channel.
+func (s *Supervisor) channelWorkers(ctx context.Context, channel string) []func(context.Context) {
+	chCfg, err := config.LoadChannelConfig(ctx, s.db, channel)
+	if err != nil {
+		slog.Warn("channel config: using remaining sources", slog.Any("err", err), slog.String("channel", channel))
+	}
+	workers := []func(context.Context){
+		func(ctx context.Context) { vod.StartVODProcessingJob(ctx, s.db, chCfg) },
+		func(ctx context.Context) { vod.StartVODCatalogBackfillJob(ctx, s.db, channel) },
+		func(ctx context.Context) { vod.StartCatalogReconcileJob(ctx, s.db, channel) },
+		func(ctx context.Context) { vod.StartRetentionJob(ctx, s.db, chCfg) },
+		func(ctx context.Context) { chat.StartChatImportJob(ctx, s.db, channel) },
+		func(ctx context.Context) { chat.StartEventSubSubscriptions(ctx, channel) },
+	}
+	// Chat recorder: either auto mode (poll live) or manual recorder when env has fixed
+	// VOD id/start. Manual recordings are only kept apart for TWITCH_CHANNELS, so
+	// channels added at runtime record chat in auto mode only.
+	switch {
+	case os.Getenv("CHAT_AUTO_START") == "1":
+		workers = append(workers, func(ctx context.Context) { chat.StartAutoChatRecorder(ctx, s.db, s.hub, channel) })
+	case channel == "":
+		slog.Info("chat recorder disabled (missing twitch creds or auto not enabled)")
+	case s.cfg.ValidateChatReady() != nil:
+	case !s.configured(channel):
+		slog.Info("manual chat recorder skipped for channel not in TWITCH_CHANNELS", slog.String("channel", channel))
+	default:
+		vodID := s.cfg.ChatVODID(channel)
+		workers = append(workers, func(ctx context.Context) {
+			if err := s.ensureChatVOD(ctx, channel, vodID); err != nil {
+				slog.Warn("manual chat recorder not started: create vod row", slog.Any("err", err), slog.String("channel", channel), slog.String("vod_id", vodID))
+				return
+			}
+			chat.StartTwitchChatRecorder(ctx, s.hub, channel, vodID, s.cfg.TwitchVODStart)
+		})
+	}
+	return workers
+}
+
+// ensureChatVOD creates the vods row a manual chat recording is stored under, since
+// chat_messages references it. With several channels the id is TWITCH_VOD_ID suffixed
+// with the channel, which is not a Twitch VOD, so that row is stored as processed and
+// skipped to keep it out of the download queue.
+func (s *Supervisor) ensureChatVOD(ctx context.Context, channel, vodID string) error {
+	processed, status := false, vod.StatusDiscovered
+	if vodID != s.cfg.TwitchVODID {
+		processed, status = true, vod.StatusSkipped
+	}
+	_, err := s.db.ExecContext(ctx, `INSERT INTO vods (channel, twitch_vod_id, date, processed, status, created_at)
+		VALUES ($1,$2,$3,$4,$5,NOW()) ON CONFLICT (twitch_vod_id) DO NOTHING`,
+		channel, vodID, s.cfg.TwitchVODStart, processed, string(status))
+	return err
+}
+
+// configured reports whether channel is one of cfg.TwitchChannels.
+func (s *Supervisor) configured(channel string) bool {
+	for _, c := range s.cfg.TwitchChannels {
+		if strings.EqualFold(c, channel) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,161 @@
+package supervisor
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/onnwee/vod-tender/backend/config"
+	dbpkg "github.com/onnwee/vod-tender/backend/db"
+)
+
+// fakeWorkers records which channels have a running worker.
+type fakeWorkers struct {
+	mu      sync.Mutex
+	active  map[string]int
+	stopped chan string
+}
+
+func (f *fakeWorkers) workers(_ context.Context, channel string) []func(context.Context) {
+	return []func(context.Context){func(ctx context.Context) {
+		f.mu.Lock()
+		f.active[channel]++
+		f.mu.Unlock()
+		<-ctx.Done()
+		f.mu.Lock()
+		f.active[channel]--
+		f.mu.Unlock()
+		f.stopped <- channel
+	}}
+}
+
+func newTestSupervisor(t *testing.T, rows *[]dbpkg.Channel, listErr *error) (*Supervisor, *fakeWorkers) {
+	t.Helper()
+	orig := listChannels
+	t.Cleanup(func() { listChannels = orig })
+	listChannels = func(context.Context, *sql.DB) ([]dbpkg.Channel, error) {
+		return *rows, *listErr
+	}
+	f := &fakeWorkers{active: map[string]int{}, stopped: make(chan string, 10)}
+	s := New(nil, &config.Config{TwitchChannels: []string{"envchan"}}, nil)
+	s.workers = f.workers
+	return s, f
+}
+
+func waitStopped(t *testing.T, f *fakeWorkers, want string) {
+	t.Helper()
+	select {
+	case got := <-f.stopped:
+		if got != want {
+			t.Fatalf("stopped %q, want %q", got, want)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("workers of %q not stopped", want)
+	}
+}
+
+func TestSyncStartsAndStopsChannels(t *testing.T) {
+	rows := []dbpkg.Channel{{Name: "ChanA", Enabled: true}, {Name: "chanb", Enabled: true}, {Name: "chanc"}}
+	var listErr error
+	s, f := newTestSupervisor(t, &rows, &listErr)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s.Sync(ctx)
+	if got := s.Running(); !reflect.DeepEqual(got, []string{"ChanA", "chanb"}) {
+		t.Fatalf("running = %v", got)
+	}
+
+	rows = []dbpkg.Channel{{Name: "chana", Enabled: true}, {Name: "chanb"}, {Name: "chanc", Enabled: true}}
+	s.Sync(ctx)
+	waitStopped(t, f, "chanb")
+	if got := s.Running(); !reflect.DeepEqual(got, []string{"ChanA", "chanc"}) {
+		t.Fatalf("running after change = %v", got)
+	}
+
+	// A failed lookup keeps what is running.
+	listErr = errors.New("db down")
+	s.Sync(ctx)
+	if got := s.Running(); len(got) != 2 {
+		t.Fatalf("running after failed lookup = %v", got)
+	}
+
+	s.stopAll()
+	if len(s.Running()) != 0 {
+		t.Fatal("workers left after stopAll")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for ch, n := range f.active {
+		if n != 0 {
+			t.Errorf("%s has %d active workers", ch, n)
+		}
+	}
+}
+
+func TestSyncFallbacks(t *testing.T) {
+	var rows []dbpkg.Channel
+	listErr := errors.New("no channels table")
+	s, _ := newTestSupervisor(t, &rows, &listErr)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Nothing running and the table unreadable: TWITCH_CHANNELS.
+	s.Sync(ctx)
+	if got := s.Running(); !reflect.DeepEqual(got, []string{"envchan"}) {
+		t.Fatalf("running = %v, want TWITCH_CHANNELS", got)
+	}
+	s.stopAll()
+
+	// An empty table runs the default channel.
+	listErr = nil
+	s.Sync(ctx)
+	if got := s.Running(); !reflect.DeepEqual(got, []string{config.DefaultChannel}) {
+		t.Fatalf("running = %v, want default channel", got)
+	}
+	s.stopAll()
+}
+
+func TestEnsureChatVOD(t *testing.T) {
+	dsn := os.Getenv("TEST_PG_DSN")
+	if dsn == "" {
+		t.Skip("TEST_PG_DSN not set")
+	}
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = db.Close() }()
+	ctx := context.Background()
+	if err := dbpkg.Migrate(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_, _ = db.Exec(`DELETE FROM vods WHERE twitch_vod_id LIKE 'supervisor-chat%'`)
+	})
+	s := New(db, &config.Config{TwitchChannels: []string{"one", "two"}, TwitchVODID: "supervisor-chat", TwitchVODStart: time.Now()}, nil)
+	id := s.cfg.ChatVODID("two")
+	for i := 0; i < 2; i++ {
+		if err := s.ensureChatVOD(ctx, "two", id); err != nil {
+			t.Fatalf("run %d: %v", i, err)
+		}
+	}
+	var channel, status string
+	var processed bool
+	if err := db.QueryRowContext(ctx, `SELECT channel, processed, status FROM vods WHERE twitch_vod_id=$1`, id).Scan(&channel, &processed, &status); err != nil {
+		t.Fatal(err)
+	}
+	if channel != "two" || !processed || status != "skipped" {
+		t.Fatalf("row = %s/%v/%s, want a processed skipped row of channel two", channel, processed, status)
+	}
+	if _, err := db.ExecContext(ctx, `INSERT INTO chat_messages (channel, vod_id, username, message, abs_timestamp, rel_timestamp) VALUES ('two', $1, 'u', 'hi', NOW(), 0)`, id); err != nil {
+		t.Fatalf("chat insert under the channel vod id: %v", err)
+	}
+	_, _ = db.ExecContext(ctx, `DELETE FROM chat_messages WHERE vod_id=$1`, id)
+}
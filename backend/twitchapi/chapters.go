@@ -0,0 +1,184 @@
+package twitchapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// GQLURL is the Twitch GQL endpoint.
+	GQLURL = "https://gql.twitch.tv/gql"
+	// DefaultGQLClientID is the public Twitch web client ID accepted by the GQL endpoint.
+	DefaultGQLClientID = "kimne78kx3ncx6brgo4mv6wki5h1ko"
+)
+
+// StreamMarker is a marker a broadcaster or editor placed during a stream.
+type StreamMarker struct {
+	CreatedAt       time.Time `json:"created_at"`
+	ID              string    `json:"id"`
+	Description     string    `json:"description"`
+	PositionSeconds int       `json:"position_seconds"`
+}
+
+// GetStreamMarkers lists the stream markers of an archived video. Helix only serves this
+// endpoint with a user token carrying user:read:broadcast, so UserToken must be set.
+func (hc *HelixClient) GetStreamMarkers(ctx context.Context, videoID string) ([]StreamMarker, error) {
+	if videoID == "" {
+		return nil, fmt.Errorf("videoID empty")
+	}
+	var out []StreamMarker
+	after := ""
+	for {
+		q := url.Values{}
+		q.Set("video_id", videoID)
+		q.Set("first", "100")
+		if after != "" {
+			q.Set("after", after)
+		}
+		var body struct {
+			Pagination struct {
+				Cursor string `json:"cursor"`
+			} `json:"pagination"`
+			Data []struct {
+				Videos []struct {
+					VideoID string         `json:"video_id"`
+					Markers []StreamMarker `json:"markers"`
+				} `json:"videos"`
+			} `json:"data"`
+		}
+		if err := hc.requestUserJSON(ctx, "/helix/streams/markers", q, &body); err != nil {
+			return nil, err
+		}
+		for _, d := range body.Data {
+			for _, v := range d.Videos {
+				out = append(out, v.Markers...)
+			}
+		}
+		if body.Pagination.Cursor == "" || body.Pagination.Cursor == after {
+			return out, nil
+		}
+		after = body.Pagination.Cursor
+	}
+}
+
+// GameSegment is a span of a video spent in one game/category.
+type GameSegment struct {
+	GameID          string
+	GameName        string
+	PositionSeconds int
+	DurationSeconds int
+}
+
+// GetVideoGameSegments returns the category segments of a video. Helix does not expose
+// category changes, so this queries the public GQL API (the same data the Twitch player
+// shows as chapters). A video that stayed in one category yields a single segment.
+func (hc *HelixClient) GetVideoGameSegments(ctx context.Context, videoID string) ([]GameSegment, error) {
+	if videoID == "" {
+		return nil, fmt.Errorf("videoID empty")
+	}
+	type game struct {
+		ID          string `json:"id"`
+		DisplayName string `json:"displayName"`
+	}
+	const query = `query VideoChapters($id: ID!) {
+  video(id: $id) {
+    lengthSeconds
+    game { id displayName }
+    moments(momentRequestType: VIDEO_CHAPTER_MARKERS) {
+      edges { node { type positionMilliseconds durationMilliseconds description details { ... on GameChangeMomentDetails { game { id displayName } } } } }
+    }
+  }
+}`
+	var body struct {
+		Data struct {
+			Video *struct {
+				Game    *game `json:"game"`
+				Moments struct {
+					Edges []struct {
+						Node struct {
+							Type                 string `json:"type"`
+							Description          string `json:"description"`
+							PositionMilliseconds int    `json:"positionMilliseconds"`
+							DurationMilliseconds int    `json:"durationMilliseconds"`
+							Details              struct {
+								Game *game `json:"game"`
+							} `json:"details"`
+						} `json:"node"`
+					} `json:"edges"`
+				} `json:"moments"`
+				LengthSeconds int `json:"lengthSeconds"`
+			} `json:"video"`
+		} `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := hc.postGQL(ctx, "video chapters", query, map[string]any{"id": videoID}, &body); err != nil {
+		return nil, err
+	}
+	if len(body.Errors) > 0 {
+		return nil, fmt.Errorf("gql video chapters: %s", body.Errors[0].Message)
+	}
+	v := body.Data.Video
+	if v == nil {
+		return nil, nil
+	}
+	var out []GameSegment
+	for _, e := range v.Moments.Edges {
+		n := e.Node
+		if n.Type != "" && n.Type != "GAME_CHANGE" {
+			continue
+		}
+		seg := GameSegment{GameName: n.Description, PositionSeconds: n.PositionMilliseconds / 1000, DurationSeconds: n.DurationMilliseconds / 1000}
+		if g := n.Details.Game; g != nil {
+			seg.GameID = g.ID
+			if g.DisplayName != "" {
+				seg.GameName = g.DisplayName
+			}
+		}
+		out = append(out, seg)
+	}
+	if len(out) == 0 && v.Game != nil && v.Game.DisplayName != "" {
+		out = append(out, GameSegment{GameID: v.Game.ID, GameName: v.Game.DisplayName, DurationSeconds: v.LengthSeconds})
+	}
+	return out, nil
+}
+
+// postGQL sends a query to the public GQL API and decodes the response into out. what
+// names the query in errors.
+func (hc *HelixClient) postGQL(ctx context.Context, what, query string, variables map[string]any, out any) error {
+	payload, err := json.Marshal(map[string]any{"query": query, "variables": variables})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, GQLURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	clientID := hc.GQLClientID
+	if clientID == "" {
+		clientID = DefaultGQLClientID
+	}
+	req.Header.Set("Client-Id", clientID)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := hc.http().Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("gql %s failed: %s (%s)", what, resp.Status, strings.TrimSpace(string(b)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode gql %s: %w", what, err)
+	}
+	return nil
+}
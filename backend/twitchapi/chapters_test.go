@@ -0,0 +1,110 @@
+package twitchapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHelixClient_GetStreamMarkers(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/helix/streams/markers" || r.URL.Query().Get("video_id") != "123" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer user-token" {
+			t.Errorf("Authorization=%q want user token", got)
+		}
+		page := map[string]any{
+			"data": []map[string]any{{
+				"videos": []map[string]any{{
+					"video_id": "123",
+					"markers": []map[string]any{{"id": "m1", "description": "Boss", "position_seconds": 90, "created_at": "2024-10-15T14:30:00Z"}},
+				}},
+			}},
+		}
+		if r.URL.Query().Get("after") == "" {
+			page["pagination"] = map[string]string{"cursor": "next"}
+		} else {
+			page["data"].([]map[string]any)[0]["videos"].([]map[string]any)[0]["markers"] = []map[string]any{{"id": "m2", "description": "End", "position_seconds": 600}}
+		}
+		_ = json.NewEncoder(w).Encode(page)
+	}))
+	defer server.Close()
+
+	client := &HelixClient{
+		ClientID:   "test-client-id",
+		UserToken:  func(context.Context) (string, error) { return "user-token", nil },
+		HTTPClient: &http.Client{Transport: &rewriteTransport{Transport: http.DefaultTransport, host: server.URL}},
+	}
+	markers, err := client.GetStreamMarkers(context.Background(), "123")
+	if err != nil {
+		t.Fatalf("GetStreamMarkers() error = %v", err)
+	}
+	if len(markers) != 2 || markers[0].Description != "Boss" || markers[0].PositionSeconds != 90 || markers[1].ID != "m2" {
+		t.Fatalf("markers = %+v", markers)
+	}
+	if !markers[0].CreatedAt.Equal(time.Date(2024, 10, 15, 14, 30, 0, 0, time.UTC)) {
+		t.Fatalf("created_at = %v", markers[0].CreatedAt)
+	}
+
+	client.UserToken = nil
+	if _, err := client.GetStreamMarkers(context.Background(), "123"); err == nil {
+		t.Fatal("expected error without user token")
+	}
+}
+
+func TestHelixClient_GetVideoGameSegments(t *testing.T) {
+	respond := func(w http.ResponseWriter, video any) {
+		_ = json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{"video": video}})
+	}
+	var video any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/gql" || r.Header.Get("Client-Id") != DefaultGQLClientID {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var body struct {
+			Variables map[string]string `json:"variables"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if body.Variables["id"] != "123" {
+			respond(w, nil)
+			return
+		}
+		respond(w, video)
+	}))
+	defer server.Close()
+	client := &HelixClient{HTTPClient: &http.Client{Transport: &rewriteTransport{Transport: http.DefaultTransport, host: server.URL}}}
+
+	video = map[string]any{
+		"lengthSeconds": 7200,
+		"game":          map[string]string{"id": "2", "displayName": "Minecraft"},
+		"moments": map[string]any{"edges": []map[string]any{
+			{"node": map[string]any{"type": "GAME_CHANGE", "positionMilliseconds": 0, "durationMilliseconds": 600000, "description": "Just Chatting", "details": map[string]any{"game": map[string]string{"id": "1", "displayName": "Just Chatting"}}}},
+			{"node": map[string]any{"type": "GAME_CHANGE", "positionMilliseconds": 600000, "durationMilliseconds": 6600000, "description": "Minecraft", "details": map[string]any{"game": map[string]string{"id": "2", "displayName": "Minecraft"}}}},
+		}},
+	}
+	segs, err := client.GetVideoGameSegments(context.Background(), "123")
+	if err != nil {
+		t.Fatalf("GetVideoGameSegments() error = %v", err)
+	}
+	if len(segs) != 2 || segs[1].GameName != "Minecraft" || segs[1].PositionSeconds != 600 || segs[1].DurationSeconds != 6600 {
+		t.Fatalf("segments = %+v", segs)
+	}
+
+	// A video without category changes yields its single game.
+	video = map[string]any{"lengthSeconds": 100, "game": map[string]string{"id": "3", "displayName": "Chess"}, "moments": map[string]any{"edges": []any{}}}
+	segs, err = client.GetVideoGameSegments(context.Background(), "123")
+	if err != nil || len(segs) != 1 || segs[0].GameName != "Chess" || segs[0].DurationSeconds != 100 {
+		t.Fatalf("single-game segments = %+v, %v", segs, err)
+	}
+
+	segs, err = client.GetVideoGameSegments(context.Background(), "missing")
+	if err != nil || segs != nil {
+		t.Fatalf("missing video = %+v, %v", segs, err)
+	}
+}
@@ -0,0 +1,128 @@
+package twitchapi
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// VideoComment is one chat message replayed with an archived video.
+type VideoComment struct {
+	CreatedAt   time.Time
+	ID          string
+	UserID      string
+	Login       string
+	DisplayName string
+	Color       string
+	Fragments   []CommentFragment
+	Badges      []CommentBadge
+	// OffsetSeconds is the message's position in the video.
+	OffsetSeconds float64
+}
+
+// CommentFragment is a run of message text; EmoteID is set when the run is an emote.
+type CommentFragment struct {
+	Text    string
+	EmoteID string
+}
+
+// CommentBadge is a chat badge (set and version, e.g. subscriber/12).
+type CommentBadge struct {
+	SetID   string
+	Version string
+}
+
+// GetVideoComments returns one page of an archived video's chat, in offset order,
+// starting after cursor (empty for the first page). next is empty after the last
+// page. Helix has no chat replay endpoint, so this queries the public GQL API.
+func (hc *HelixClient) GetVideoComments(ctx context.Context, videoID, cursor string) (comments []VideoComment, next string, err error) {
+	if videoID == "" {
+		return nil, "", fmt.Errorf("videoID empty")
+	}
+	const query = `query VideoComments($id: ID!, $cursor: Cursor) {
+  video(id: $id) {
+    comments(after: $cursor) {
+      edges { cursor node { id createdAt contentOffsetSeconds commenter { id login displayName }
+        message { fragments { text emote { emoteID } } userBadges { setID version } userColor } } }
+      pageInfo { hasNextPage }
+    }
+  }
+}`
+	vars := map[string]any{"id": videoID}
+	if cursor != "" {
+		vars["cursor"] = cursor
+	}
+	var body struct {
+		Data struct {
+			Video *struct {
+				Comments struct {
+					Edges []struct {
+						Cursor string `json:"cursor"`
+						Node   struct {
+							CreatedAt time.Time `json:"createdAt"`
+							Commenter *struct {
+								ID          string `json:"id"`
+								Login       string `json:"login"`
+								DisplayName string `json:"displayName"`
+							} `json:"commenter"`
+							Message struct {
+								Fragments []struct {
+									Emote *struct {
+										EmoteID string `json:"emoteID"`
+									} `json:"emote"`
+									Text string `json:"text"`
+								} `json:"fragments"`
+								UserBadges []struct {
+									SetID   string `json:"setID"`
+									Version string `json:"version"`
+								} `json:"userBadges"`
+								UserColor string `json:"userColor"`
+							} `json:"message"`
+							ID                   string  `json:"id"`
+							ContentOffsetSeconds float64 `json:"contentOffsetSeconds"`
+						} `json:"node"`
+					} `json:"edges"`
+					PageInfo struct {
+						HasNextPage bool `json:"hasNextPage"`
+					} `json:"pageInfo"`
+				} `json:"comments"`
+			} `json:"video"`
+		} `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := hc.postGQL(ctx, "video comments", query, vars, &body); err != nil {
+		return nil, "", err
+	}
+	if len(body.Errors) > 0 {
+		return nil, "", fmt.Errorf("gql video comments: %s", body.Errors[0].Message)
+	}
+	v := body.Data.Video
+	if v == nil {
+		return nil, "", fmt.Errorf("video %s not found", videoID)
+	}
+	for _, e := range v.Comments.Edges {
+		n := e.Node
+		c := VideoComment{ID: n.ID, CreatedAt: n.CreatedAt, OffsetSeconds: n.ContentOffsetSeconds, Color: n.Message.UserColor}
+		if n.Commenter != nil {
+			c.UserID, c.Login, c.DisplayName = n.Commenter.ID, n.Commenter.Login, n.Commenter.DisplayName
+		}
+		for _, f := range n.Message.Fragments {
+			frag := CommentFragment{Text: f.Text}
+			if f.Emote != nil {
+				frag.EmoteID = f.Emote.EmoteID
+			}
+			c.Fragments = append(c.Fragments, frag)
+		}
+		for _, b := range n.Message.UserBadges {
+			c.Badges = append(c.Badges, CommentBadge{SetID: b.SetID, Version: b.Version})
+		}
+		comments = append(comments, c)
+		next = e.Cursor
+	}
+	if !v.Comments.PageInfo.HasNextPage {
+		next = ""
+	}
+	return comments, next, nil
+}
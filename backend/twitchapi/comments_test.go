@@ -0,0 +1,52 @@
+package twitchapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHelixClient_GetVideoComments(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Variables map[string]string `json:"variables"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		edge := func(id, cursor string, offset float64) map[string]any {
+			return map[string]any{"cursor": cursor, "node": map[string]any{
+				"id": id, "createdAt": "2024-10-15T14:30:00Z", "contentOffsetSeconds": offset,
+				"commenter": map[string]string{"id": "42", "login": "viewer", "displayName": "Viewer"},
+				"message": map[string]any{
+					"fragments":  []map[string]any{{"text": "hi "}, {"text": "Kappa", "emote": map[string]string{"emoteID": "25"}}},
+					"userBadges": []map[string]string{{"setID": "subscriber", "version": "12"}},
+					"userColor":  "#FF0000",
+				},
+			}}
+		}
+		page := map[string]any{"edges": []any{edge("c1", "cur1", 1.5)}, "pageInfo": map[string]bool{"hasNextPage": true}}
+		if body.Variables["cursor"] == "cur1" {
+			page = map[string]any{"edges": []any{edge("c2", "cur2", 3)}, "pageInfo": map[string]bool{"hasNextPage": false}}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{"video": map[string]any{"comments": page}}})
+	}))
+	defer server.Close()
+	client := &HelixClient{HTTPClient: &http.Client{Transport: &rewriteTransport{Transport: http.DefaultTransport, host: server.URL}}}
+
+	comments, next, err := client.GetVideoComments(context.Background(), "123", "")
+	if err != nil {
+		t.Fatalf("GetVideoComments() error = %v", err)
+	}
+	if len(comments) != 1 || next != "cur1" {
+		t.Fatalf("first page = %+v, next %q", comments, next)
+	}
+	c := comments[0]
+	if c.ID != "c1" || c.Login != "viewer" || c.OffsetSeconds != 1.5 || len(c.Fragments) != 2 || c.Fragments[1].EmoteID != "25" || c.Badges[0].Version != "12" {
+		t.Fatalf("comment = %+v", c)
+	}
+	comments, next, err = client.GetVideoComments(context.Background(), "123", "cur1")
+	if err != nil || len(comments) != 1 || comments[0].ID != "c2" || next != "" {
+		t.Fatalf("last page = %+v, next %q, err %v", comments, next, err)
+	}
+}
@@ -0,0 +1,204 @@
+package twitchapi
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// EventSub webhook request headers.
+const (
+	EventSubHeaderMessageID        = "Twitch-Eventsub-Message-Id"
+	EventSubHeaderMessageTimestamp = "Twitch-Eventsub-Message-Timestamp"
+	EventSubHeaderMessageSignature = "Twitch-Eventsub-Message-Signature"
+	EventSubHeaderMessageType      = "Twitch-Eventsub-Message-Type"
+)
+
+// EventSub message types (the Twitch-Eventsub-Message-Type header).
+const (
+	EventSubNotification = "notification"
+	EventSubVerification = "webhook_callback_verification"
+	EventSubRevocation   = "revocation"
+)
+
+// EventSub subscription types used for live status.
+const (
+	EventSubStreamOnline  = "stream.online"
+	EventSubStreamOffline = "stream.offline"
+)
+
+// eventSubMaxAge is how old a message timestamp may be before it is rejected as a replay.
+const eventSubMaxAge = 10 * time.Minute
+
+var (
+	// ErrEventSubSignature is returned for messages whose signature does not match.
+	ErrEventSubSignature = errors.New("eventsub signature mismatch")
+	// ErrEventSubStale is returned for messages older than ten minutes (or from the future).
+	ErrEventSubStale = errors.New("eventsub message timestamp out of range")
+)
+
+// EventSubSignature returns the Twitch-Eventsub-Message-Signature value for a message:
+// "sha256=" and the hex HMAC-SHA256 of id, timestamp and body under secret.
+func EventSubSignature(secret, messageID, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(messageID))
+	mac.Write([]byte(timestamp))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyEventSub checks a webhook request's signature against secret and rejects
+// messages whose timestamp is more than ten minutes away from now.
+func VerifyEventSub(secret string, header http.Header, body []byte, now time.Time) error {
+	id := header.Get(EventSubHeaderMessageID)
+	ts := header.Get(EventSubHeaderMessageTimestamp)
+	want := EventSubSignature(secret, id, ts, body)
+	if id == "" || !hmac.Equal([]byte(want), []byte(header.Get(EventSubHeaderMessageSignature))) {
+		return ErrEventSubSignature
+	}
+	sent, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrEventSubStale, err)
+	}
+	if d := now.Sub(sent); d > eventSubMaxAge || d < -eventSubMaxAge {
+		return ErrEventSubStale
+	}
+	return nil
+}
+
+// EventSubSubscription is a Helix EventSub subscription.
+type EventSubSubscription struct {
+	CreatedAt time.Time         `json:"created_at"`
+	Condition map[string]string `json:"condition"`
+	Transport struct {
+		Method   string `json:"method"`
+		Callback string `json:"callback"`
+	} `json:"transport"`
+	ID      string `json:"id"`
+	Status  string `json:"status"`
+	Type    string `json:"type"`
+	Version string `json:"version"`
+}
+
+// EventSubMessage is the body of a webhook request. Challenge is set for
+// verification requests and Event for notifications.
+type EventSubMessage struct {
+	Challenge    string               `json:"challenge"`
+	Event        json.RawMessage      `json:"event"`
+	Subscription EventSubSubscription `json:"subscription"`
+}
+
+// StreamOnlineEvent is the event of a stream.online notification.
+type StreamOnlineEvent struct {
+	StartedAt            time.Time `json:"started_at"`
+	ID                   string    `json:"id"`
+	BroadcasterUserID    string    `json:"broadcaster_user_id"`
+	BroadcasterUserLogin string    `json:"broadcaster_user_login"`
+	Type                 string    `json:"type"`
+}
+
+// StreamOfflineEvent is the event of a stream.offline notification.
+type StreamOfflineEvent struct {
+	BroadcasterUserID    string `json:"broadcaster_user_id"`
+	BroadcasterUserLogin string `json:"broadcaster_user_login"`
+}
+
+// ListEventSubSubscriptions returns the app's EventSub subscriptions, filtered to
+// one broadcaster when userID is non-empty.
+func (hc *HelixClient) ListEventSubSubscriptions(ctx context.Context, userID string) ([]EventSubSubscription, error) {
+	var out []EventSubSubscription
+	after := ""
+	for {
+		q := url.Values{}
+		if userID != "" {
+			q.Set("user_id", userID)
+		}
+		if after != "" {
+			q.Set("after", after)
+		}
+		var body struct {
+			Pagination struct {
+				Cursor string `json:"cursor"`
+			} `json:"pagination"`
+			Data []EventSubSubscription `json:"data"`
+		}
+		if err := hc.requestJSON(ctx, "/helix/eventsub/subscriptions", q, &body); err != nil {
+			return nil, err
+		}
+		out = append(out, body.Data...)
+		if body.Pagination.Cursor == "" || len(body.Data) == 0 {
+			return out, nil
+		}
+		after = body.Pagination.Cursor
+	}
+}
+
+// CreateEventSubSubscription subscribes callback to a version 1 event of subType for
+// broadcasterID. Twitch confirms the callback with a verification request signed with
+// secret before the subscription is enabled.
+func (hc *HelixClient) CreateEventSubSubscription(ctx context.Context, subType, broadcasterID, callback, secret string) (EventSubSubscription, error) {
+	req := map[string]any{
+		"type":      subType,
+		"version":   "1",
+		"condition": map[string]string{"broadcaster_user_id": broadcasterID},
+		"transport": map[string]string{"method": "webhook", "callback": callback, "secret": secret},
+	}
+	var body struct {
+		Data []EventSubSubscription `json:"data"`
+	}
+	if err := hc.sendJSON(ctx, http.MethodPost, "/helix/eventsub/subscriptions", nil, req, &body); err != nil {
+		return EventSubSubscription{}, err
+	}
+	if len(body.Data) == 0 {
+		return EventSubSubscription{}, fmt.Errorf("create eventsub %s: empty response", subType)
+	}
+	return body.Data[0], nil
+}
+
+// DeleteEventSubSubscription removes a subscription.
+func (hc *HelixClient) DeleteEventSubSubscription(ctx context.Context, id string) error {
+	q := url.Values{}
+	q.Set("id", id)
+	return hc.sendJSON(ctx, http.MethodDelete, "/helix/eventsub/subscriptions", q, nil, nil)
+}
+
+// EnsureEventSubSubscriptions makes sure broadcasterID has one enabled or pending
+// webhook subscription to callback for each of types. Subscriptions to callback
+// that failed or were revoked are deleted and recreated. It returns the number created.
+func (hc *HelixClient) EnsureEventSubSubscriptions(ctx context.Context, broadcasterID, callback, secret string, types ...string) (int, error) {
+	subs, err := hc.ListEventSubSubscriptions(ctx, broadcasterID)
+	if err != nil {
+		return 0, err
+	}
+	have := map[string]bool{}
+	for _, s := range subs {
+		if s.Transport.Method != "webhook" || s.Transport.Callback != callback || s.Condition["broadcaster_user_id"] != broadcasterID {
+			continue
+		}
+		if s.Status == "enabled" || s.Status == "webhook_callback_verification_pending" {
+			have[s.Type] = true
+			continue
+		}
+		if err := hc.DeleteEventSubSubscription(ctx, s.ID); err != nil {
+			return 0, fmt.Errorf("delete %s subscription %s: %w", s.Status, s.ID, err)
+		}
+	}
+	created := 0
+	for _, t := range types {
+		if have[t] {
+			continue
+		}
+		if _, err := hc.CreateEventSubSubscription(ctx, t, broadcasterID, callback, secret); err != nil {
+			return created, fmt.Errorf("create %s subscription: %w", t, err)
+		}
+		created++
+	}
+	return created, nil
+}
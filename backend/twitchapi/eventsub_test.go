@@ -0,0 +1,97 @@
+package twitchapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func signedHeader(secret, id string, ts time.Time, body []byte) http.Header {
+	h := http.Header{}
+	stamp := ts.UTC().Format(time.RFC3339Nano)
+	h.Set(EventSubHeaderMessageID, id)
+	h.Set(EventSubHeaderMessageTimestamp, stamp)
+	h.Set(EventSubHeaderMessageSignature, EventSubSignature(secret, id, stamp, body))
+	return h
+}
+
+func TestVerifyEventSub(t *testing.T) {
+	now := time.Date(2024, 10, 15, 12, 0, 0, 0, time.UTC)
+	body := []byte(`{"subscription":{"type":"stream.online"}}`)
+	if err := VerifyEventSub("s3cret", signedHeader("s3cret", "m1", now.Add(-time.Minute), body), body, now); err != nil {
+		t.Fatalf("valid message: %v", err)
+	}
+	if err := VerifyEventSub("other", signedHeader("s3cret", "m1", now, body), body, now); !errors.Is(err, ErrEventSubSignature) {
+		t.Fatalf("wrong secret = %v, want ErrEventSubSignature", err)
+	}
+	if err := VerifyEventSub("s3cret", signedHeader("s3cret", "m1", now, body), []byte(`{}`), now); !errors.Is(err, ErrEventSubSignature) {
+		t.Fatalf("tampered body = %v, want ErrEventSubSignature", err)
+	}
+	if err := VerifyEventSub("s3cret", signedHeader("s3cret", "m1", now.Add(-11*time.Minute), body), body, now); !errors.Is(err, ErrEventSubStale) {
+		t.Fatalf("old message = %v, want ErrEventSubStale", err)
+	}
+}
+
+func TestEnsureEventSubSubscriptions(t *testing.T) {
+	const callback = "https://vods.example.com/eventsub"
+	var created []string
+	var deleted []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/helix/eventsub/subscriptions" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		switch r.Method {
+		case http.MethodGet:
+			if r.URL.Query().Get("user_id") != "42" {
+				t.Errorf("user_id = %q", r.URL.Query().Get("user_id"))
+			}
+			_, _ = w.Write([]byte(`{"data": [
+				{"id": "ok", "status": "enabled", "type": "stream.online", "condition": {"broadcaster_user_id": "42"}, "transport": {"method": "webhook", "callback": "` + callback + `"}},
+				{"id": "failed", "status": "webhook_callback_verification_failed", "type": "stream.offline", "condition": {"broadcaster_user_id": "42"}, "transport": {"method": "webhook", "callback": "` + callback + `"}},
+				{"id": "elsewhere", "status": "enabled", "type": "stream.offline", "condition": {"broadcaster_user_id": "42"}, "transport": {"method": "webhook", "callback": "https://other.example.com"}}
+			], "pagination": {}}`))
+		case http.MethodDelete:
+			deleted = append(deleted, r.URL.Query().Get("id"))
+			w.WriteHeader(http.StatusNoContent)
+		case http.MethodPost:
+			var req struct {
+				Condition map[string]string `json:"condition"`
+				Transport map[string]string `json:"transport"`
+				Type      string            `json:"type"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Errorf("decode create: %v", err)
+			}
+			if req.Condition["broadcaster_user_id"] != "42" || req.Transport["callback"] != callback || req.Transport["secret"] != "s3cret" {
+				t.Errorf("create request = %+v", req)
+			}
+			created = append(created, req.Type)
+			w.WriteHeader(http.StatusAccepted)
+			_, _ = w.Write([]byte(`{"data": [{"id": "new", "status": "webhook_callback_verification_pending", "type": "` + req.Type + `"}]}`))
+		}
+	}))
+	defer server.Close()
+
+	ts := &TokenSource{ClientID: "test-client-id", ClientSecret: "test-secret"}
+	ts.token = "test-token"
+	ts.expiresAt = time.Now().Add(time.Hour)
+	client := &HelixClient{
+		AppTokenSource: ts,
+		ClientID:       "test-client-id",
+		HTTPClient:     &http.Client{Transport: &rewriteTransport{Transport: http.DefaultTransport, host: server.URL}},
+	}
+	n, err := client.EnsureEventSubSubscriptions(context.Background(), "42", callback, "s3cret", EventSubStreamOnline, EventSubStreamOffline)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 || len(created) != 1 || created[0] != EventSubStreamOffline {
+		t.Fatalf("created %d %v, want only stream.offline", n, created)
+	}
+	if len(deleted) != 1 || deleted[0] != "failed" {
+		t.Fatalf("deleted %v, want [failed]", deleted)
+	}
+}
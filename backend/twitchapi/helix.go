@@ -3,6 +3,7 @@
 package twitchapi
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -24,7 +25,12 @@ const (
 type HelixClient struct {
 	AppTokenSource *TokenSource
 	HTTPClient     *http.Client
-	ClientID       string
+	// UserToken supplies a broadcaster user access token for endpoints that reject app
+	// tokens (stream markers need user:read:broadcast). Optional.
+	UserToken func(ctx context.Context) (string, error)
+	ClientID  string
+	// GQLClientID is sent to gql.twitch.tv; defaults to DefaultGQLClientID.
+	GQLClientID string
 }
 
 func (hc *HelixClient) http() *http.Client {
@@ -35,7 +41,32 @@ func (hc *HelixClient) http() *http.Client {
 }
 
 func (hc *HelixClient) requestJSON(ctx context.Context, path string, query url.Values, out any) error {
-	if hc.AppTokenSource == nil {
+	return hc.doRequestJSON(ctx, http.MethodGet, path, query, nil, out, false)
+}
+
+// requestUserJSON is requestJSON authenticated with UserToken instead of the app token.
+func (hc *HelixClient) requestUserJSON(ctx context.Context, path string, query url.Values, out any) error {
+	return hc.doRequestJSON(ctx, http.MethodGet, path, query, nil, out, true)
+}
+
+// sendJSON sends an app-token request with method, encoding in (if non-nil) as the
+// JSON body. out may be nil when the response has no body.
+func (hc *HelixClient) sendJSON(ctx context.Context, method, path string, query url.Values, in, out any) error {
+	var payload []byte
+	if in != nil {
+		var err error
+		if payload, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+	return hc.doRequestJSON(ctx, method, path, query, payload, out, false)
+}
+
+func (hc *HelixClient) doRequestJSON(ctx context.Context, method, path string, query url.Values, payload []byte, out any, user bool) error {
+	if user && hc.UserToken == nil {
+		return fmt.Errorf("missing user token source")
+	}
+	if !user && hc.AppTokenSource == nil {
 		return fmt.Errorf("missing app token source")
 	}
 	if hc.ClientID == "" {
@@ -44,16 +75,29 @@ func (hc *HelixClient) requestJSON(ctx context.Context, path string, query url.V
 
 	refreshedAfter401 := false
 	for attempt := 1; attempt <= helixMaxRetries; attempt++ {
-		tok, err := hc.AppTokenSource.Get(ctx)
+		var tok string
+		var err error
+		if user {
+			tok, err = hc.UserToken(ctx)
+		} else {
+			tok, err = hc.AppTokenSource.Get(ctx)
+		}
 		if err != nil {
 			return err
 		}
 
-		req, err := http.NewRequestWithContext(ctx, http.MethodGet, helixBaseURL+path, nil)
+		var body io.Reader
+		if payload != nil {
+			body = bytes.NewReader(payload)
+		}
+		req, err := http.NewRequestWithContext(ctx, method, helixBaseURL+path, body)
 		if err != nil {
 			return err
 		}
 		req.URL.RawQuery = query.Encode()
+		if payload != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
 		req.Header.Set("Client-Id", hc.ClientID)
 		req.Header.Set("Authorization", "Bearer "+tok)
 
@@ -68,7 +112,7 @@ func (hc *HelixClient) requestJSON(ctx context.Context, path string, query url.V
 			continue
 		}
 
-		if resp.StatusCode == http.StatusUnauthorized && !refreshedAfter401 {
+		if resp.StatusCode == http.StatusUnauthorized && !refreshedAfter401 && !user {
 			_ = resp.Body.Close()
 			// Force refresh and retry once.
 			hc.AppTokenSource.SetToken("", time.Time{})
@@ -113,7 +157,7 @@ func (hc *HelixClient) requestJSON(ctx context.Context, path string, query url.V
 			continue
 		}
 
-		if resp.StatusCode != http.StatusOK {
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
 			b, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
 			_ = resp.Body.Close()
 			msg := strings.TrimSpace(string(b))
@@ -123,7 +167,9 @@ func (hc *HelixClient) requestJSON(ctx context.Context, path string, query url.V
 			return fmt.Errorf("helix %s failed: %s (%s)", path, resp.Status, msg)
 		}
 
-		err = json.NewDecoder(resp.Body).Decode(out)
+		if out != nil && resp.StatusCode != http.StatusNoContent {
+			err = json.NewDecoder(resp.Body).Decode(out)
+		}
 		if closeErr := resp.Body.Close(); closeErr != nil {
 			slog.Warn("failed to close response body", slog.Any("err", closeErr))
 		}
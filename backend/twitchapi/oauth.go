@@ -126,3 +126,42 @@ func RefreshToken(ctx context.Context, clientID, clientSecret, refreshToken stri
 	}
 	return &res, nil
 }
+
+// ValidateResult is the response from the token validate endpoint.
+type ValidateResult struct {
+	ClientID  string   `json:"client_id"`
+	Login     string   `json:"login"`
+	UserID    string   `json:"user_id"`
+	Scopes    []string `json:"scopes"`
+	ExpiresIn int      `json:"expires_in"`
+}
+
+// ValidateToken looks up the account and scopes a user access token belongs to.
+func ValidateToken(ctx context.Context, accessToken string) (*ValidateResult, error) {
+	if accessToken == "" {
+		return nil, errors.New("missing access token")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://id.twitch.tv/oauth2/validate", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "OAuth "+strings.TrimPrefix(accessToken, "oauth:"))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			slog.Warn("failed to close response body", slog.Any("err", err))
+		}
+	}()
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("twitch token validate failed: %s: %s", resp.Status, string(b))
+	}
+	var res ValidateResult
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
@@ -1,6 +1,9 @@
 package twitchapi
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
@@ -174,3 +177,29 @@ func TestRefreshResult(t *testing.T) {
 		t.Errorf("Scope length = %d, want 2", len(result.Scope))
 	}
 }
+
+func TestValidateToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/oauth2/validate" || r.Header.Get("Authorization") != "OAuth bot-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"status":401,"message":"invalid access token"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"client_id":"cid","login":"somebot","user_id":"77","scopes":["chat:read"],"expires_in":3600}`))
+	}))
+	defer server.Close()
+	orig := http.DefaultClient
+	http.DefaultClient = &http.Client{Transport: &rewriteTransport{Transport: http.DefaultTransport, host: server.URL}}
+	defer func() { http.DefaultClient = orig }()
+
+	res, err := ValidateToken(context.Background(), "oauth:bot-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Login != "somebot" || res.UserID != "77" || len(res.Scopes) != 1 {
+		t.Fatalf("result = %+v", res)
+	}
+	if _, err := ValidateToken(context.Background(), "revoked"); err == nil {
+		t.Fatal("expected error for rejected token")
+	}
+}
@@ -0,0 +1,69 @@
+package vod
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+)
+
+// Operator actions on a single VOD, shared by the admin API and vodctl. Each returns
+// sql.ErrNoRows when the VOD does not exist.
+
+// Reprocess resets a VOD's download/upload state, stage results and upload
+// destinations and queues it again.
+func Reprocess(ctx context.Context, db *sql.DB, vodID string) error {
+	res, err := db.ExecContext(ctx, `
+        UPDATE vods
+        SET processed=FALSE,
+            processing_error=NULL,
+            youtube_url=NULL,
+            downloaded_path=NULL,
+            download_state=NULL,
+            download_retries=0,
+            download_bytes=0,
+            download_total=0,
+            download_speed=NULL,
+            download_eta_seconds=NULL,
+            download_fragment_index=NULL,
+            download_fragment_count=NULL,
+            progress_updated_at=NULL,
+            updated_at=CURRENT_TIMESTAMP
+        WHERE twitch_vod_id=$1
+    `, vodID)
+	if err := affectedOne(res, err); err != nil {
+		return err
+	}
+	if err := ResetStageResults(ctx, db, vodID); err != nil {
+		slog.Warn("reprocess failed to reset stage results", slog.String("vod_id", vodID), slog.Any("err", err))
+	}
+	if err := ResetUploads(ctx, db, vodID); err != nil {
+		slog.Warn("reprocess failed to reset upload destinations", slog.String("vod_id", vodID), slog.Any("err", err))
+	}
+	if err := TransitionStatus(ctx, db, vodID, StatusQueued, "manual reprocess"); err != nil {
+		slog.Warn("reprocess status transition failed", slog.String("vod_id", vodID), slog.Any("err", err))
+	}
+	return nil
+}
+
+// SetPriority sets a VOD's download priority; higher values are processed first.
+func SetPriority(ctx context.Context, db *sql.DB, vodID string, priority int) error {
+	res, err := db.ExecContext(ctx, `UPDATE vods SET priority=$1, updated_at=NOW() WHERE twitch_vod_id=$2`, priority, vodID)
+	return affectedOne(res, err)
+}
+
+// SetSkipUpload sets whether the pipeline skips uploading a VOD.
+func SetSkipUpload(ctx context.Context, db *sql.DB, vodID string, skip bool) error {
+	res, err := db.ExecContext(ctx, `UPDATE vods SET skip_upload=$1, updated_at=NOW() WHERE twitch_vod_id=$2`, skip, vodID)
+	return affectedOne(res, err)
+}
+
+// affectedOne turns an update that matched no row into sql.ErrNoRows.
+func affectedOne(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package vod
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	dbpkg "github.com/onnwee/vod-tender/backend/db"
+)
+
+func openAdminTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_PG_DSN")
+	if dsn == "" {
+		t.Skip("TEST_PG_DSN not set")
+	}
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	if err := dbpkg.Migrate(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestOperatorActions(t *testing.T) {
+	db := openAdminTestDB(t)
+	ctx := context.Background()
+	channel := "test_operator_actions"
+	_, _ = db.ExecContext(ctx, `DELETE FROM vods WHERE channel=$1`, channel)
+	if _, err := db.ExecContext(ctx, `INSERT INTO vods (channel, twitch_vod_id, title, date, processed, processing_error, status, created_at)
+		VALUES ($1, 'op1', 'Op', NOW(), TRUE, 'boom', 'failed', NOW())`, channel); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, err := range map[string]error{
+		"Reprocess":     Reprocess(ctx, db, "op-missing"),
+		"SetPriority":   SetPriority(ctx, db, "op-missing", 1),
+		"SetSkipUpload": SetSkipUpload(ctx, db, "op-missing", true),
+	} {
+		if !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("%s of unknown vod: %v, want sql.ErrNoRows", name, err)
+		}
+	}
+
+	if err := SetPriority(ctx, db, "op1", 7); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetSkipUpload(ctx, db, "op1", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := Reprocess(ctx, db, "op1"); err != nil {
+		t.Fatal(err)
+	}
+	var priority int
+	var skip, processed bool
+	var status string
+	var procErr sql.NullString
+	if err := db.QueryRowContext(ctx, `SELECT priority, skip_upload, processed, processing_error, status FROM vods WHERE twitch_vod_id='op1'`).
+		Scan(&priority, &skip, &processed, &procErr, &status); err != nil {
+		t.Fatal(err)
+	}
+	if priority != 7 || !skip || processed || procErr.Valid || status != string(StatusQueued) {
+		t.Fatalf("got priority=%d skip=%v processed=%v error=%v status=%s", priority, skip, processed, procErr, status)
+	}
+}
+
+func TestLoadCircuit(t *testing.T) {
+	db := openAdminTestDB(t)
+	ctx := context.Background()
+	channel := "test_load_circuit"
+	_, _ = db.ExecContext(ctx, `DELETE FROM kv WHERE channel=$1`, channel)
+	t.Cleanup(func() { _, _ = db.ExecContext(context.Background(), `DELETE FROM kv WHERE channel=$1`, channel) })
+
+	c, err := LoadCircuit(ctx, db, channel)
+	if err != nil || c.State != "" || c.Failures != "" {
+		t.Fatalf("empty circuit = %+v, %v", c, err)
+	}
+	if _, err := db.ExecContext(ctx, `INSERT INTO kv (channel, key, value) VALUES ($1, 'circuit_state', 'open'), ($1, 'circuit_failures', '4'), ($1, 'circuit_open_until', '2030-01-01T00:00:00Z')`, channel); err != nil {
+		t.Fatal(err)
+	}
+	c, err = LoadCircuit(ctx, db, channel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Channel != channel || c.State != "open" || c.Failures != "4" || c.OpenUntil != "2030-01-01T00:00:00Z" {
+		t.Fatalf("circuit = %+v", c)
+	}
+}
+
+func TestPreviewRetention(t *testing.T) {
+	db := openAdminTestDB(t)
+	ctx := context.Background()
+	channel := "test_preview_retention"
+	_, _ = db.ExecContext(ctx, `DELETE FROM vods WHERE channel=$1`, channel)
+	dir := t.TempDir()
+	now := time.Now()
+	for i, id := range []string{"pr-new", "pr-old"} {
+		path := filepath.Join(dir, id+".mp4")
+		if err := os.WriteFile(path, []byte("video"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.ExecContext(ctx, `INSERT INTO vods (channel, twitch_vod_id, title, date, downloaded_path, processed, status, created_at)
+			VALUES ($1, $2, $2, $3, $4, TRUE, 'uploaded', NOW())`, channel, id, now.Add(-time.Duration(i)*72*time.Hour), path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := PreviewRetention(ctx, db, channel, RetentionPolicy{KeepLastNVODs: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.DryRun || len(report.Files) != 1 || report.Files[0].VodID != "pr-old" || report.Files[0].SizeBytes != 5 {
+		t.Fatalf("report = %+v", report)
+	}
+	if _, err := os.Stat(report.Files[0].Path); err != nil {
+		t.Fatalf("preview deleted the file: %v", err)
+	}
+
+	if report, err := PreviewRetention(ctx, db, channel, RetentionPolicy{}); err != nil || len(report.Files) != 0 {
+		t.Fatalf("no policy: %+v, %v", report, err)
+	}
+}
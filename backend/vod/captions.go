@@ -0,0 +1,69 @@
+package vod
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/onnwee/vod-tender/backend/chat/export"
+	youtubeapi "github.com/onnwee/vod-tender/backend/youtubeapi"
+)
+
+const chatCaptionName = "Twitch chat"
+
+// chatCaptionFormat resolves kv youtube_chat_captions, then YOUTUBE_CHAT_CAPTIONS:
+// empty or "0" disables the caption track, "1" selects WebVTT, otherwise any export format name.
+func chatCaptionFormat(ctx context.Context, dbc *sql.DB, channel string) (export.Format, bool) {
+	v := strings.ToLower(strings.TrimSpace(channelSetting(ctx, dbc, channel, "youtube_chat_captions", "YOUTUBE_CHAT_CAPTIONS")))
+	switch v {
+	case "", "0", "false", "no":
+		return "", false
+	case "1", "true", "yes":
+		return export.FormatWebVTT, true
+	}
+	f, err := export.ParseFormat(v)
+	if err != nil || f == export.FormatJSONL {
+		slog.Warn("invalid chat caption format; captions disabled", slog.String("value", v))
+		return "", false
+	}
+	return f, true
+}
+
+// attachChatCaptions renders the VOD's chat (only the part's window for a split VOD) and
+// adds it to the uploaded video as a caption track. Failures are logged, never returned:
+// the video itself is already uploaded.
+func attachChatCaptions(ctx context.Context, dbc *sql.DB, yts *youtubeapi.Service, data VideoTemplateData, videoURL string) {
+	format, ok := chatCaptionFormat(ctx, dbc, data.Channel)
+	if !ok || data.ID == "" || data.ChatMessages == 0 {
+		return
+	}
+	logger := slog.With(slog.String("vod_id", data.ID), slog.String("format", string(format)))
+	videoID := youtubeapi.VideoIDFromURL(videoURL)
+	if videoID == "" {
+		logger.Warn("chat captions skipped; no video id in upload url", slog.String("url", videoURL))
+		return
+	}
+	svc, err := yts.Client(ctx)
+	if err != nil {
+		logger.Warn("chat captions skipped; youtube client", slog.Any("err", err))
+		return
+	}
+	// Messages moderators removed stay out of the permanent caption track.
+	opts := export.Options{HideModerated: true}
+	if data.PartCount > 0 {
+		opts.From, opts.To, opts.Shift = data.PartStart.Seconds(), data.PartEnd.Seconds(), true
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		_, err := export.Write(ctx, dbc, pw, data.ID, format, opts)
+		_ = pw.CloseWithError(err)
+	}()
+	if err := youtubeapi.InsertCaption(ctx, svc, videoID, "en", chatCaptionName, pr); err != nil {
+		_ = pr.CloseWithError(err)
+		logger.Warn("chat caption upload failed", slog.Any("err", err))
+		return
+	}
+	logger.Info("chat caption track attached", slog.String("video_id", videoID))
+}
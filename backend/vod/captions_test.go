@@ -0,0 +1,29 @@
+package vod
+
+import (
+	"context"
+	"testing"
+
+	"github.com/onnwee/vod-tender/backend/chat/export"
+)
+
+func TestChatCaptionFormat(t *testing.T) {
+	cases := []struct {
+		val  string
+		want export.Format
+		ok   bool
+	}{
+		{"", "", false},
+		{"0", "", false},
+		{"1", export.FormatWebVTT, true},
+		{"srv3", export.FormatYTT, true},
+		{"jsonl", "", false},
+		{"srt", "", false},
+	}
+	for _, tc := range cases {
+		t.Setenv("YOUTUBE_CHAT_CAPTIONS", tc.val)
+		if got, ok := chatCaptionFormat(context.Background(), nil, ""); got != tc.want || ok != tc.ok {
+			t.Errorf("chatCaptionFormat(%q) = %q, %v; want %q, %v", tc.val, got, ok, tc.want, tc.ok)
+		}
+	}
+}
@@ -94,6 +94,13 @@ func BackfillCatalog(ctx context.Context, db *sql.DB, channel string, maxCount i
 	}
 	for _, v := range vods {
 		_, _ = db.ExecContext(ctx, `INSERT INTO vods (channel, twitch_vod_id, title, date, duration_seconds, created_at) VALUES ($1,$2,$3,$4,$5,NOW()) ON CONFLICT (twitch_vod_id) DO NOTHING`, channel, v.ID, v.Title, v.Date, v.Duration)
+		// Chapters are only useful until upload; skip VODs that are already processed or
+		// whose chapters were already fetched (the upload stage syncs again if needed).
+		var processed, synced bool
+		if err := db.QueryRowContext(ctx, `SELECT COALESCE(processed,FALSE), chapters_synced_at IS NOT NULL FROM vods WHERE twitch_vod_id=$1`, v.ID).
+			Scan(&processed, &synced); err == nil && !processed && !synced {
+			syncMissingChapters(ctx, db, v.ID, channel)
+		}
 	}
 	slog.Info("catalog backfill inserted/ignored", slog.Int("count", len(vods)), slog.String("channel", channel))
 	return nil
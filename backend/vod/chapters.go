@@ -0,0 +1,269 @@
+package vod
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/onnwee/vod-tender/backend/db"
+	"github.com/onnwee/vod-tender/backend/twitchapi"
+)
+
+// Chapter sources stored in vod_chapters.source.
+const (
+	ChapterSourceMarker   = "marker"
+	ChapterSourceCategory = "category"
+	ChapterSourceManual   = "manual"
+)
+
+// YouTube only turns a timestamp list into chapters when it starts at 0:00, has at least
+// three entries and every chapter is at least ten seconds long.
+const (
+	minChapterSeconds = 10
+	minChapters       = 3
+)
+
+// ErrInvalidChapters is returned by ReplaceChapters for unusable input.
+var ErrInvalidChapters = errors.New("invalid chapters")
+
+// Chapter is one entry of a VOD's chapter list.
+type Chapter struct {
+	Title        string `json:"title"`
+	Source       string `json:"source"`
+	StartSeconds int    `json:"start_seconds"`
+}
+
+// chapterSource is the Twitch data chapters are built from (implemented by twitchapi.HelixClient).
+type chapterSource interface {
+	GetStreamMarkers(ctx context.Context, videoID string) ([]twitchapi.StreamMarker, error)
+	GetVideoGameSegments(ctx context.Context, videoID string) ([]twitchapi.GameSegment, error)
+}
+
+// newChapterSource builds the Helix client used for chapters; stream markers need the
+// channel's stored Twitch user token (or the default one). Replaced in tests.
+var newChapterSource = func(dbc *sql.DB, channel string) chapterSource {
+	c := helixClient()
+	c.UserToken = func(ctx context.Context) (string, error) {
+		account, err := db.ResolveOAuthChannel(ctx, dbc, "twitch", channel)
+		if err != nil {
+			return "", err
+		}
+		access, _, _, _, err := db.GetOAuthTokenForChannel(ctx, dbc, "twitch", account)
+		if err != nil {
+			return "", err
+		}
+		if access == "" {
+			return "", errors.New("no stored twitch user token")
+		}
+		return access, nil
+	}
+	return c
+}
+
+// chaptersEnabled reports whether chapters are synced and written to descriptions (CHAPTERS_ENABLED, default on).
+func chaptersEnabled() bool {
+	v := strings.ToLower(strings.TrimSpace(os.Getenv("CHAPTERS_ENABLED")))
+	return v != "0" && v != "false" && v != "no"
+}
+
+// buildChapters merges category segments and stream markers into a sorted chapter list.
+// When a marker and a category change share a second, the category wins.
+func buildChapters(markers []twitchapi.StreamMarker, segments []twitchapi.GameSegment) []Chapter {
+	var out []Chapter
+	for _, s := range segments {
+		if t := cleanChapterTitle(s.GameName); t != "" {
+			out = append(out, Chapter{StartSeconds: max(s.PositionSeconds, 0), Title: t, Source: ChapterSourceCategory})
+		}
+	}
+	for _, m := range markers {
+		if t := cleanChapterTitle(m.Description); t != "" {
+			out = append(out, Chapter{StartSeconds: max(m.PositionSeconds, 0), Title: t, Source: ChapterSourceMarker})
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].StartSeconds < out[j].StartSeconds })
+	dedup := out[:0]
+	for _, c := range out {
+		if n := len(dedup); n > 0 && dedup[n-1].StartSeconds == c.StartSeconds {
+			continue
+		}
+		dedup = append(dedup, c)
+	}
+	return dedup
+}
+
+func cleanChapterTitle(s string) string {
+	return strings.Join(strings.Fields(stripAngles(sanitizeTitle(s))), " ")
+}
+
+// SyncChapters rebuilds the automatic chapters of a VOD from Twitch markers and category
+// changes. VODs with manual chapters are left untouched. It returns the number of chapters stored.
+func SyncChapters(ctx context.Context, dbc *sql.DB, vodID, channel string) (int, error) {
+	var manual int
+	if err := dbc.QueryRowContext(ctx, `SELECT COUNT(*) FROM vod_chapters WHERE vod_id=$1 AND source='manual'`, vodID).Scan(&manual); err != nil {
+		return 0, err
+	}
+	if manual > 0 {
+		return 0, nil
+	}
+	src := newChapterSource(dbc, channel)
+	segments, segErr := src.GetVideoGameSegments(ctx, vodID)
+	markers, markErr := src.GetStreamMarkers(ctx, vodID)
+	if segErr != nil && markErr != nil {
+		return 0, fmt.Errorf("fetch chapters: %w", errors.Join(segErr, markErr))
+	}
+	if markErr != nil {
+		slog.Debug("stream markers unavailable; using category changes only", slog.String("vod_id", vodID), slog.Any("err", markErr))
+	}
+	if segErr != nil {
+		slog.Debug("category segments unavailable; using stream markers only", slog.String("vod_id", vodID), slog.Any("err", segErr))
+	}
+	chapters := buildChapters(markers, segments)
+	if err := writeChapters(ctx, dbc, vodID, chapters, false); err != nil {
+		return 0, err
+	}
+	markChaptersSynced(ctx, dbc, vodID)
+	return len(chapters), nil
+}
+
+// syncMissingChapters runs SyncChapters for a VOD that has no chapters yet (best-effort).
+// The attempt is recorded even when it fails, so the catalog backfill does not retry it.
+func syncMissingChapters(ctx context.Context, dbc *sql.DB, vodID, channel string) {
+	if !chaptersEnabled() {
+		return
+	}
+	var n int
+	if err := dbc.QueryRowContext(ctx, `SELECT COUNT(*) FROM vod_chapters WHERE vod_id=$1`, vodID).Scan(&n); err != nil || n > 0 {
+		return
+	}
+	if _, err := SyncChapters(ctx, dbc, vodID, channel); err != nil {
+		slog.Warn("chapter sync failed", slog.String("vod_id", vodID), slog.String("channel", channel), slog.Any("err", err))
+		markChaptersSynced(ctx, dbc, vodID)
+	}
+}
+
+// markChaptersSynced records that chapters were fetched for a VOD.
+func markChaptersSynced(ctx context.Context, dbc *sql.DB, vodID string) {
+	_, _ = dbc.ExecContext(ctx, `UPDATE vods SET chapters_synced_at=NOW() WHERE twitch_vod_id=$1`, vodID)
+}
+
+// writeChapters replaces a VOD's chapters. With manual=false only automatic rows are replaced.
+func writeChapters(ctx context.Context, dbc *sql.DB, vodID string, chapters []Chapter, manual bool) error {
+	tx, err := dbc.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	del := `DELETE FROM vod_chapters WHERE vod_id=$1 AND source<>'manual'`
+	if manual {
+		del = `DELETE FROM vod_chapters WHERE vod_id=$1`
+	}
+	if _, err := tx.ExecContext(ctx, del, vodID); err != nil {
+		return fmt.Errorf("delete chapters: %w", err)
+	}
+	for _, c := range chapters {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO vod_chapters (vod_id, start_seconds, title, source) VALUES ($1,$2,$3,$4)
+			ON CONFLICT (vod_id, start_seconds) DO NOTHING`, vodID, c.StartSeconds, c.Title, c.Source); err != nil {
+			return fmt.Errorf("insert chapter: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// LoadChapters returns a VOD's chapters ordered by start time.
+func LoadChapters(ctx context.Context, dbc *sql.DB, vodID string) ([]Chapter, error) {
+	rows, err := dbc.QueryContext(ctx, `SELECT start_seconds, title, source FROM vod_chapters WHERE vod_id=$1 ORDER BY start_seconds`, vodID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			slog.Warn("failed to close rows", slog.Any("err", err))
+		}
+	}()
+	out := []Chapter{}
+	for rows.Next() {
+		var c Chapter
+		if err := rows.Scan(&c.StartSeconds, &c.Title, &c.Source); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// ReplaceChapters stores an admin-edited chapter list. The result is marked manual so the
+// automatic sync no longer overwrites it; an empty list clears the manual edit.
+func ReplaceChapters(ctx context.Context, dbc *sql.DB, vodID string, chapters []Chapter) ([]Chapter, error) {
+	seen := map[int]bool{}
+	out := make([]Chapter, 0, len(chapters))
+	for _, c := range chapters {
+		c.Title = cleanChapterTitle(c.Title)
+		switch {
+		case c.StartSeconds < 0:
+			return nil, fmt.Errorf("%w: negative start_seconds %d", ErrInvalidChapters, c.StartSeconds)
+		case c.Title == "":
+			return nil, fmt.Errorf("%w: empty title at %d", ErrInvalidChapters, c.StartSeconds)
+		case seen[c.StartSeconds]:
+			return nil, fmt.Errorf("%w: duplicate start_seconds %d", ErrInvalidChapters, c.StartSeconds)
+		}
+		seen[c.StartSeconds] = true
+		c.Source = ChapterSourceManual
+		out = append(out, c)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].StartSeconds < out[j].StartSeconds })
+	if err := writeChapters(ctx, dbc, vodID, out, true); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// formatChapterList renders chapters as a YouTube description timestamp list, adjusting
+// them to YouTube's rules (first at 0:00, at least 10s apart, not in the last 10s of the
+// video). It returns "" when fewer than three usable chapters remain.
+func formatChapterList(chapters []Chapter, durationSeconds int) string {
+	sorted := append([]Chapter(nil), chapters...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].StartSeconds < sorted[j].StartSeconds })
+	var out []Chapter
+	for _, c := range sorted {
+		if durationSeconds > 0 && c.StartSeconds > durationSeconds-minChapterSeconds {
+			break
+		}
+		if len(out) == 0 {
+			if c.StartSeconds >= minChapterSeconds {
+				out = append(out, Chapter{Title: "Start"})
+			} else {
+				c.StartSeconds = 0
+			}
+		}
+		if n := len(out); n > 0 && c.StartSeconds-out[n-1].StartSeconds < minChapterSeconds {
+			continue
+		}
+		out = append(out, c)
+	}
+	if len(out) < minChapters {
+		return ""
+	}
+	var b strings.Builder
+	for i, c := range out {
+		if i > 0 {
+			b.WriteByte('\n')
+		}
+		b.WriteString(formatTimestamp(c.StartSeconds))
+		b.WriteByte(' ')
+		b.WriteString(c.Title)
+	}
+	return b.String()
+}
+
+// formatTimestamp renders seconds as M:SS, or H:MM:SS past the first hour.
+func formatTimestamp(sec int) string {
+	if sec >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", sec/3600, sec/60%60, sec%60)
+	}
+	return fmt.Sprintf("%d:%02d", sec/60, sec%60)
+}
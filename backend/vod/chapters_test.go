@@ -0,0 +1,188 @@
+package vod
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/onnwee/vod-tender/backend/twitchapi"
+)
+
+// fakeChapterSource serves canned Twitch chapter data.
+type fakeChapterSource struct {
+	markers     []twitchapi.StreamMarker
+	segments    []twitchapi.GameSegment
+	markersErr  error
+	segmentsErr error
+}
+
+func (f fakeChapterSource) GetStreamMarkers(context.Context, string) ([]twitchapi.StreamMarker, error) {
+	return f.markers, f.markersErr
+}
+
+func (f fakeChapterSource) GetVideoGameSegments(context.Context, string) ([]twitchapi.GameSegment, error) {
+	return f.segments, f.segmentsErr
+}
+
+func TestMain(m *testing.M) {
+	// Keep the upload and catalog paths from reaching Twitch in tests.
+	newChapterSource = func(*sql.DB, string) chapterSource { return fakeChapterSource{} }
+	os.Exit(m.Run())
+}
+
+func TestBuildChapters(t *testing.T) {
+	markers := []twitchapi.StreamMarker{
+		{PositionSeconds: 1800, Description: "Boss fight"},
+		{PositionSeconds: 600, Description: "dupe of category"},
+		{PositionSeconds: 900, Description: "  "},
+	}
+	segments := []twitchapi.GameSegment{
+		{PositionSeconds: 0, GameName: "Just Chatting"},
+		{PositionSeconds: 600, GameName: "Elden <Ring>"},
+	}
+	got := buildChapters(markers, segments)
+	want := []Chapter{
+		{StartSeconds: 0, Title: "Just Chatting", Source: ChapterSourceCategory},
+		{StartSeconds: 600, Title: "Elden Ring", Source: ChapterSourceCategory},
+		{StartSeconds: 1800, Title: "Boss fight", Source: ChapterSourceMarker},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("buildChapters = %+v", got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("chapter %d = %+v want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestFormatChapterList(t *testing.T) {
+	cases := []struct {
+		name     string
+		chapters []Chapter
+		duration int
+		want     string
+	}{
+		{
+			name:     "starts late gets a Start chapter",
+			chapters: []Chapter{{StartSeconds: 65, Title: "A"}, {StartSeconds: 3725, Title: "B"}},
+			want:     "0:00 Start\n1:05 A\n1:02:05 B",
+		},
+		{
+			name:     "first chapter near zero is moved to 0:00, short chapters dropped",
+			chapters: []Chapter{{StartSeconds: 4, Title: "A"}, {StartSeconds: 9, Title: "too close"}, {StartSeconds: 30, Title: "B"}, {StartSeconds: 50, Title: "C"}},
+			want:     "0:00 A\n0:30 B\n0:50 C",
+		},
+		{
+			name:     "chapters in the last ten seconds are dropped",
+			chapters: []Chapter{{StartSeconds: 0, Title: "A"}, {StartSeconds: 30, Title: "B"}, {StartSeconds: 95, Title: "C"}},
+			duration: 100,
+		},
+		{
+			name:     "fewer than three chapters",
+			chapters: []Chapter{{StartSeconds: 0, Title: "A"}, {StartSeconds: 60, Title: "B"}},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := formatChapterList(tc.chapters, tc.duration); got != tc.want {
+				t.Fatalf("formatChapterList =\n%s\nwant\n%s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDefaultDescriptionIncludesChapters(t *testing.T) {
+	t.Setenv("YOUTUBE_DESCRIPTION_TEMPLATE", "")
+	md, err := renderVideoMetadata(context.Background(), nil, VideoTemplateData{ID: "5", Date: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), Chapters: "0:00 A\n1:00 B\n2:00 C"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(md.Description, "https://www.twitch.tv/videos/5\n\nChapters:\n0:00 A\n1:00 B\n2:00 C") {
+		t.Fatalf("description = %q", md.Description)
+	}
+}
+
+func TestSyncAndReplaceChapters(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	channel := "chapters-chan"
+	id := "chapters_1"
+	t.Cleanup(func() {
+		_, _ = db.Exec(`DELETE FROM vods WHERE channel=$1`, channel)
+	})
+	if _, err := db.ExecContext(ctx, `INSERT INTO vods (channel,twitch_vod_id,title,date,duration_seconds,created_at)
+		VALUES ($1,$2,'Chapters',NOW(),7200,NOW()) ON CONFLICT (twitch_vod_id) DO NOTHING`, channel, id); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = db.ExecContext(ctx, `DELETE FROM vod_chapters WHERE vod_id=$1`, id)
+	old := newChapterSource
+	defer func() { newChapterSource = old }()
+	newChapterSource = func(*sql.DB, string) chapterSource {
+		return fakeChapterSource{
+			segments: []twitchapi.GameSegment{{GameName: "Just Chatting"}, {PositionSeconds: 900, GameName: "Minecraft"}},
+			markers:  []twitchapi.StreamMarker{{PositionSeconds: 3000, Description: "Nether"}},
+		}
+	}
+	n, err := SyncChapters(ctx, db, id, channel)
+	if err != nil || n != 3 {
+		t.Fatalf("SyncChapters = %d, %v", n, err)
+	}
+	md, err := PreviewVideoMetadata(ctx, db, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(md.Description, "0:00 Just Chatting\n15:00 Minecraft\n50:00 Nether") {
+		t.Fatalf("description missing chapters: %q", md.Description)
+	}
+
+	if _, err := ReplaceChapters(ctx, db, id, []Chapter{{StartSeconds: 10, Title: "x"}, {StartSeconds: 10, Title: "y"}}); !errors.Is(err, ErrInvalidChapters) {
+		t.Fatalf("expected ErrInvalidChapters, got %v", err)
+	}
+	if _, err := ReplaceChapters(ctx, db, id, []Chapter{{StartSeconds: 120, Title: "Later"}, {StartSeconds: 0, Title: "Intro"}}); err != nil {
+		t.Fatal(err)
+	}
+	// Manual chapters survive a sync.
+	if n, err := SyncChapters(ctx, db, id, channel); err != nil || n != 0 {
+		t.Fatalf("SyncChapters after manual edit = %d, %v", n, err)
+	}
+	got, err := LoadChapters(ctx, db, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Title != "Intro" || got[1].Source != ChapterSourceManual {
+		t.Fatalf("chapters = %+v", got)
+	}
+}
+
+func TestSyncMissingChaptersRecordsAttempt(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	channel := "chapters-attempt"
+	id := "chapters_attempt_1"
+	t.Cleanup(func() {
+		_, _ = db.Exec(`DELETE FROM vods WHERE channel=$1`, channel)
+	})
+	if _, err := db.ExecContext(ctx, `INSERT INTO vods (channel,twitch_vod_id,title,date,created_at)
+		VALUES ($1,$2,'Attempt',NOW(),NOW()) ON CONFLICT (twitch_vod_id) DO UPDATE SET chapters_synced_at=NULL`, channel, id); err != nil {
+		t.Fatal(err)
+	}
+	old := newChapterSource
+	defer func() { newChapterSource = old }()
+	down := errors.New("twitch down")
+	newChapterSource = func(*sql.DB, string) chapterSource {
+		return fakeChapterSource{markersErr: down, segmentsErr: down}
+	}
+	syncMissingChapters(ctx, db, id, channel)
+	var synced bool
+	if err := db.QueryRowContext(ctx, `SELECT chapters_synced_at IS NOT NULL FROM vods WHERE twitch_vod_id=$1`, id).Scan(&synced); err != nil {
+		t.Fatal(err)
+	}
+	if !synced {
+		t.Fatal("expected a failed sync to be recorded")
+	}
+}
@@ -0,0 +1,330 @@
+package vod
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	youtubeapi "github.com/onnwee/vod-tender/backend/youtubeapi"
+)
+
+// Upload destinations. Each VOD gets one vod_uploads row per configured destination; the
+// VOD is processed once every required destination has succeeded. Optional destinations
+// are attempted but their failures don't hold the VOD back.
+
+// Destination names accepted in UPLOAD_DESTINATIONS.
+const (
+	DestinationYouTube = "youtube"
+	DestinationS3      = "s3"
+	DestinationLocal   = "local"
+)
+
+// DefaultUploadDestinations keeps the historical YouTube-only behavior.
+const DefaultUploadDestinations = DestinationYouTube
+
+// vod_uploads statuses.
+const (
+	uploadPending   = "pending"
+	uploadRunning   = "uploading"
+	uploadSucceeded = "succeeded"
+	uploadFailed    = "failed"
+)
+
+// remoteKeyer is implemented by uploaders that store the file under a predictable key.
+type remoteKeyer interface {
+	RemoteKey(ctx context.Context, path string, date time.Time) string
+}
+
+// destination is one resolved upload target.
+type destination struct {
+	uploader Uploader
+	name     string
+	required bool
+}
+
+var destinationFactories = map[string]func() (Uploader, error){
+	// YouTube resolves the package-level uploader at call time so tests can swap it.
+	DestinationYouTube: func() (Uploader, error) { return uploader, nil },
+	DestinationS3:      func() (Uploader, error) { return newS3UploaderFromEnv() },
+	DestinationLocal:   func() (Uploader, error) { return newLocalUploaderFromEnv() },
+}
+
+// destinationSpec is a parsed destination entry before its uploader is built.
+type destinationSpec struct {
+	name     string
+	required bool
+}
+
+// parseDestinations parses a comma-separated destination list. Names listed in optional
+// are not required for the VOD to count as processed.
+func parseDestinations(spec, optional string) ([]destinationSpec, error) {
+	opt := map[string]bool{}
+	for _, n := range strings.Split(optional, ",") {
+		if n = strings.ToLower(strings.TrimSpace(n)); n != "" {
+			opt[n] = true
+		}
+	}
+	var out []destinationSpec
+	seen := map[string]bool{}
+	for _, raw := range strings.Split(spec, ",") {
+		name := strings.ToLower(strings.TrimSpace(raw))
+		if name == "" || seen[name] {
+			continue
+		}
+		if _, ok := destinationFactories[name]; !ok {
+			return nil, fmt.Errorf("unknown upload destination %q", name)
+		}
+		seen[name] = true
+		out = append(out, destinationSpec{name: name, required: !opt[name]})
+	}
+	return out, nil
+}
+
+// destinationsFor resolves a channel's destinations: kv upload_destinations, then
+// UPLOAD_DESTINATIONS, then DefaultUploadDestinations.
+func destinationsFor(ctx context.Context, dbc *sql.DB, channel string) ([]destination, error) {
+	var spec, optional string
+	_ = dbc.QueryRowContext(ctx, `SELECT value FROM kv WHERE channel=$1 AND key='upload_destinations'`, channel).Scan(&spec)
+	_ = dbc.QueryRowContext(ctx, `SELECT value FROM kv WHERE channel=$1 AND key='upload_optional_destinations'`, channel).Scan(&optional)
+	if strings.TrimSpace(spec) == "" {
+		spec = os.Getenv("UPLOAD_DESTINATIONS")
+	}
+	if strings.TrimSpace(spec) == "" {
+		spec = DefaultUploadDestinations
+	}
+	if strings.TrimSpace(optional) == "" {
+		optional = os.Getenv("UPLOAD_OPTIONAL_DESTINATIONS")
+	}
+	specs, err := parseDestinations(spec, optional)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]destination, 0, len(specs))
+	for _, s := range specs {
+		up, err := destinationFactories[s.name]()
+		if err != nil {
+			return nil, fmt.Errorf("destination %s: %w", s.name, err)
+		}
+		out = append(out, destination{name: s.name, required: s.required, uploader: up})
+	}
+	return out, nil
+}
+
+// localUploader copies the file into a directory tree (e.g. a NAS mount).
+type localUploader struct {
+	dir string
+}
+
+func newLocalUploaderFromEnv() (*localUploader, error) {
+	dir := strings.TrimSpace(os.Getenv("LOCAL_UPLOAD_DIR"))
+	if dir == "" {
+		return nil, errors.New("local destination requires LOCAL_UPLOAD_DIR")
+	}
+	return &localUploader{dir: dir}, nil
+}
+
+// RemoteKey returns the path of the copy relative to LOCAL_UPLOAD_DIR.
+func (l *localUploader) RemoteKey(ctx context.Context, path string, date time.Time) string {
+	return objectKey(ctx, "", path, date)
+}
+
+// Upload hard-links the file when source and destination share a filesystem and copies it
+// otherwise. The copy is written to a temp name first so a partial file is never visible.
+func (l *localUploader) Upload(ctx context.Context, dbc *sql.DB, path, title string, date time.Time) (string, error) {
+	dst := filepath.Join(l.dir, filepath.FromSlash(l.RemoteKey(ctx, path, date)))
+	if err := os.MkdirAll(filepath.Dir(dst), 0o750); err != nil {
+		return "", err
+	}
+	_ = os.Remove(dst)
+	if err := os.Link(path, dst); err == nil {
+		return dst, nil
+	}
+	in, err := os.Open(path) //nolint:gosec // G304: path is the pipeline's local media file
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = in.Close() }()
+	tmp := dst + ".part"
+	out, err := os.Create(tmp) //nolint:gosec // G304: path is under LOCAL_UPLOAD_DIR
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(out, &ctxReader{ctx: ctx, r: in})
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return "", err
+	}
+	return dst, os.Rename(tmp, dst)
+}
+
+// ctxReader stops a long copy when ctx is canceled.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *ctxReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
+
+// objectKey builds "<prefix>/<channel>/<YYYY-MM-DD>_<vod id><ext>" from the upload context.
+func objectKey(ctx context.Context, prefix, path string, date time.Time) string {
+	id, _ := ctx.Value(vodIDCtxKey{}).(string)
+	if id == "" {
+		id = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	channel, _ := ctx.Value(vodChannelCtxKey{}).(string)
+	if channel == "" {
+		channel = "default"
+	}
+	ext := filepath.Ext(path)
+	if ext == "" {
+		ext = ".mp4"
+	}
+	key := channel + "/" + date.UTC().Format("2006-01-02") + "_" + id + ext
+	if prefix != "" {
+		key = prefix + "/" + key
+	}
+	return key
+}
+
+// UploadRecord is the per-destination upload state of a VOD.
+type UploadRecord struct {
+	UpdatedAt     time.Time `json:"updated_at"`
+	Destination   string    `json:"destination"`
+	Status        string    `json:"status"`
+	URL           string    `json:"url,omitempty"`
+	RemoteKey     string    `json:"remote_key,omitempty"`
+	LastError     string    `json:"last_error,omitempty"`
+	SessionOffset int64     `json:"session_offset,omitempty"` // bytes committed in an in-progress resumable upload
+	Retries       int       `json:"retries"`
+	Required      bool      `json:"required"`
+}
+
+// LoadUploads returns the destination rows for a VOD.
+func LoadUploads(ctx context.Context, dbc *sql.DB, vodID string) ([]UploadRecord, error) {
+	rows, err := dbc.QueryContext(ctx, `SELECT destination, status, COALESCE(url,''), COALESCE(remote_key,''), COALESCE(last_error,''), COALESCE(session_offset,0), retries, required, updated_at
+		FROM vod_uploads WHERE vod_id=$1 ORDER BY destination`, vodID)
+	if err != nil {
+		return nil, fmt.Errorf("query uploads: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			slog.Warn("failed to close rows", slog.Any("err", err))
+		}
+	}()
+	out := make([]UploadRecord, 0)
+	for rows.Next() {
+		var u UploadRecord
+		if err := rows.Scan(&u.Destination, &u.Status, &u.URL, &u.RemoteKey, &u.LastError, &u.SessionOffset, &u.Retries, &u.Required, &u.UpdatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, u)
+	}
+	return out, rows.Err()
+}
+
+// ResetUploads forgets all destination and part upload results for a VOD (used by reprocess).
+func ResetUploads(ctx context.Context, dbc *sql.DB, vodID string) error {
+	if _, err := dbc.ExecContext(ctx, `DELETE FROM vod_uploads WHERE vod_id=$1`, vodID); err != nil {
+		return err
+	}
+	_, err := dbc.ExecContext(ctx, `UPDATE vod_segments SET upload_status=NULL, upload_url=NULL, upload_error=NULL, upload_attempts=0,
+		session_uri=NULL, session_offset=0, session_size=NULL, updated_at=NOW() WHERE vod_id=$1`, vodID)
+	return err
+}
+
+func ensureUploadRow(ctx context.Context, dbc *sql.DB, vodID string, d destination) {
+	_, _ = dbc.ExecContext(ctx, `INSERT INTO vod_uploads (vod_id, destination, status, required, created_at, updated_at)
+		VALUES ($1,$2,$3,$4,NOW(),NOW())
+		ON CONFLICT (vod_id, destination) DO UPDATE SET required=EXCLUDED.required`,
+		vodID, d.name, uploadPending, d.required)
+}
+
+func uploadStatus(ctx context.Context, dbc *sql.DB, vodID, dest string) (status, url string) {
+	_ = dbc.QueryRowContext(ctx, `SELECT status, COALESCE(url,'') FROM vod_uploads WHERE vod_id=$1 AND destination=$2`, vodID, dest).Scan(&status, &url)
+	return status, url
+}
+
+func markUploadRunning(ctx context.Context, dbc *sql.DB, vodID, dest, key string) {
+	_, _ = dbc.ExecContext(ctx, `UPDATE vod_uploads SET status=$3, remote_key=NULLIF($4,''), updated_at=NOW() WHERE vod_id=$1 AND destination=$2`,
+		vodID, dest, uploadRunning, key)
+}
+
+func markUploadSucceeded(ctx context.Context, dbc *sql.DB, vodID, dest, url string) {
+	_, _ = dbc.ExecContext(ctx, `UPDATE vod_uploads SET status=$3, url=$4, last_error=NULL, updated_at=NOW() WHERE vod_id=$1 AND destination=$2`,
+		vodID, dest, uploadSucceeded, url)
+}
+
+// markUploadFailed uses a background context so a canceled upload still records its outcome.
+func markUploadFailed(dbc *sql.DB, vodID, dest string, attempts int, uploadErr error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, _ = dbc.ExecContext(ctx, `UPDATE vod_uploads SET status=$3, retries=retries+$4, last_error=$5, updated_at=NOW() WHERE vod_id=$1 AND destination=$2`,
+		vodID, dest, uploadFailed, attempts, uploadErr.Error())
+}
+
+// uploadSessionStore persists a resumable upload session on the VOD's vod_uploads row.
+// Without a VOD id (ad-hoc uploads) sessions are kept in memory only.
+type uploadSessionStore struct {
+	db          *sql.DB
+	mem         *youtubeapi.UploadSession
+	vodID       string
+	destination string
+}
+
+func (s *uploadSessionStore) LoadUploadSession(ctx context.Context) (youtubeapi.UploadSession, bool, error) {
+	if s.vodID == "" || s.db == nil {
+		if s.mem == nil {
+			return youtubeapi.UploadSession{}, false, nil
+		}
+		return *s.mem, true, nil
+	}
+	var uri sql.NullString
+	var off, size sql.NullInt64
+	err := s.db.QueryRowContext(ctx, `SELECT session_uri, session_offset, session_size FROM vod_uploads WHERE vod_id=$1 AND destination=$2`,
+		s.vodID, s.destination).Scan(&uri, &off, &size)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !uri.Valid) {
+		return youtubeapi.UploadSession{}, false, nil
+	}
+	if err != nil {
+		return youtubeapi.UploadSession{}, false, err
+	}
+	return youtubeapi.UploadSession{URI: uri.String, Offset: off.Int64, Size: size.Int64}, true, nil
+}
+
+func (s *uploadSessionStore) SaveUploadSession(ctx context.Context, sess youtubeapi.UploadSession) error {
+	if s.vodID == "" || s.db == nil {
+		s.mem = &sess
+		return nil
+	}
+	_, err := s.db.ExecContext(ctx, `INSERT INTO vod_uploads (vod_id, destination, status, session_uri, session_offset, session_size, session_updated_at, created_at, updated_at)
+		VALUES ($1,$2,$3,$4,$5,$6,NOW(),NOW(),NOW())
+		ON CONFLICT (vod_id, destination) DO UPDATE SET session_uri=EXCLUDED.session_uri, session_offset=EXCLUDED.session_offset,
+			session_size=EXCLUDED.session_size, session_updated_at=NOW(), updated_at=NOW()`,
+		s.vodID, s.destination, uploadRunning, sess.URI, sess.Offset, sess.Size)
+	return err
+}
+
+func (s *uploadSessionStore) ClearUploadSession(ctx context.Context) error {
+	if s.vodID == "" || s.db == nil {
+		s.mem = nil
+		return nil
+	}
+	_, err := s.db.ExecContext(ctx, `UPDATE vod_uploads SET session_uri=NULL, session_offset=0, session_size=NULL, session_updated_at=NOW() WHERE vod_id=$1 AND destination=$2`,
+		s.vodID, s.destination)
+	return err
+}
@@ -0,0 +1,228 @@
+package vod
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/onnwee/vod-tender/backend/config"
+)
+
+func TestParseDestinations(t *testing.T) {
+	got, err := parseDestinations(" YouTube, s3 ,local,s3", "local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []destinationSpec{{DestinationYouTube, true}, {DestinationS3, true}, {DestinationLocal, false}}
+	if len(got) != len(want) {
+		t.Fatalf("parseDestinations = %+v want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("parseDestinations = %+v want %+v", got, want)
+		}
+	}
+	if _, err := parseDestinations("youtube,ftp", ""); err == nil {
+		t.Fatal("expected error for unknown destination")
+	}
+}
+
+func TestLocalUploaderCopiesUnderKey(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "twitch_7.mp4")
+	if err := os.WriteFile(src, []byte("video"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("LOCAL_UPLOAD_DIR", t.TempDir())
+	l, err := newLocalUploaderFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst, err := l.Upload(uploadCtx("7", "chan"), nil, src, "t", time.Date(2023, 12, 31, 23, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dst != filepath.Join(l.dir, "chan", "2023-12-31_7.mp4") {
+		t.Fatalf("unexpected destination %s", dst)
+	}
+	if b, _ := os.ReadFile(dst); string(b) != "video" {
+		t.Fatalf("copied content = %q", b)
+	}
+	// The copy must survive removal of the local media by the cleanup stage.
+	_ = os.Remove(src)
+	if _, err := os.Stat(dst); err != nil {
+		t.Fatalf("copy removed with source: %v", err)
+	}
+
+	t.Setenv("LOCAL_UPLOAD_DIR", "")
+	if _, err := newLocalUploaderFromEnv(); err == nil {
+		t.Fatal("expected error without LOCAL_UPLOAD_DIR")
+	}
+}
+
+type countingUploader struct {
+	calls *int
+	url   string
+}
+
+func (u countingUploader) Upload(ctx context.Context, dbc *sql.DB, path, title string, date time.Time) (string, error) {
+	*u.calls++
+	return u.url, nil
+}
+
+type failingUploader struct{}
+
+func (failingUploader) Upload(ctx context.Context, dbc *sql.DB, path, title string, date time.Time) (string, error) {
+	return "", errors.New("destination down")
+}
+
+func TestUploadRetryStopsOnInvalidMetadataSettings(t *testing.T) {
+	calls := 0
+	up := uploaderFunc(func() error {
+		calls++
+		return fmt.Errorf("%w: privacy %q", ErrInvalidMetadataSettings, "secret")
+	})
+	job := &Job{Logger: slog.Default(), ID: "bad_meta", Config: config.ChannelConfig{UploadMaxAttempts: 5, UploadBackoffBase: time.Millisecond}}
+	_, attempts, err := uploadFileWithRetry(context.Background(), job.Logger, up, job, "video.mp4")
+	if !errors.Is(err, ErrInvalidMetadataSettings) {
+		t.Fatalf("err = %v, want ErrInvalidMetadataSettings", err)
+	}
+	if calls != 1 || attempts != 1 {
+		t.Fatalf("calls=%d attempts=%d, want a single attempt", calls, attempts)
+	}
+}
+
+type uploaderFunc func() error
+
+func (f uploaderFunc) Upload(ctx context.Context, dbc *sql.DB, path, title string, date time.Time) (string, error) {
+	return "", f()
+}
+
+func TestUploadStageMultipleDestinations(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	channel := "multi-dest"
+	id := "multi_dest_1"
+	t.Cleanup(func() {
+		_, _ = db.Exec(`DELETE FROM vods WHERE channel=$1`, channel)
+	})
+	if _, err := db.ExecContext(ctx, `INSERT INTO vods (channel,twitch_vod_id,title,date,created_at)
+		VALUES ($1,$2,'Multi',NOW(),NOW())
+		ON CONFLICT (twitch_vod_id) DO UPDATE SET processed=FALSE, youtube_url=NULL`, channel, id); err != nil {
+		t.Fatal(err)
+	}
+	_ = ResetUploads(ctx, db, id)
+	t.Setenv("YOUTUBE_UPLOAD_ENABLED", "1")
+	t.Setenv("YOUTUBE_UPLOAD_OWNERSHIP", "self")
+	t.Setenv("UPLOAD_DESTINATIONS", "youtube,local")
+	t.Setenv("UPLOAD_OPTIONAL_DESTINATIONS", "")
+	t.Setenv("UPLOAD_MAX_ATTEMPTS", "1")
+	t.Setenv("LOCAL_UPLOAD_DIR", "/dev/null/not-a-dir") // local fails first
+	src := filepath.Join(t.TempDir(), "twitch_multi.mp4")
+	if err := os.WriteFile(src, []byte("video"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	calls := 0
+	oldU := uploader
+	uploader = countingUploader{calls: &calls, url: "https://youtu.be/multi"}
+	defer func() { uploader = oldU }()
+	newJob := func() *Job {
+		j := &Job{DB: db, Logger: slog.Default(), ID: id, Channel: channel, Date: time.Now(), Config: config.ChannelConfigFromEnv(channel)}
+		j.Set(ArtifactFile, src)
+		return j
+	}
+
+	if err := (uploadStage{}).Run(ctx, newJob()); err == nil {
+		t.Fatal("expected failure while required local destination fails")
+	}
+	var processed bool
+	_ = db.QueryRowContext(ctx, `SELECT processed FROM vods WHERE twitch_vod_id=$1`, id).Scan(&processed)
+	if processed {
+		t.Fatal("vod must not be processed until all required destinations succeed")
+	}
+
+	t.Setenv("LOCAL_UPLOAD_DIR", t.TempDir())
+	job := newJob()
+	if err := (uploadStage{}).Run(ctx, job); err != nil {
+		t.Fatalf("second run: %v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("youtube uploaded %d times; succeeded destinations must not be retried", calls)
+	}
+	if job.Artifacts[ArtifactYouTubeURL] != "https://youtu.be/multi" || job.Artifacts[ArtifactUploaded] != "true" {
+		t.Fatalf("unexpected artifacts %v", job.Artifacts)
+	}
+	_ = db.QueryRowContext(ctx, `SELECT processed FROM vods WHERE twitch_vod_id=$1`, id).Scan(&processed)
+	if !processed {
+		t.Fatal("expected processed once all destinations succeeded")
+	}
+	ups, err := LoadUploads(ctx, db, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ups) != 2 {
+		t.Fatalf("expected 2 upload rows, got %+v", ups)
+	}
+	for _, u := range ups {
+		if u.Status != uploadSucceeded {
+			t.Fatalf("destination %s status %s", u.Destination, u.Status)
+		}
+		if u.Destination == DestinationLocal && (u.Retries != 1 || u.RemoteKey == "") {
+			t.Fatalf("unexpected local row %+v", u)
+		}
+	}
+}
+
+func TestUploadStageOptionalDestinationFailure(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	channel := "optional-dest"
+	id := "optional_dest_1"
+	t.Cleanup(func() {
+		_, _ = db.Exec(`DELETE FROM vods WHERE channel=$1`, channel)
+	})
+	if _, err := db.ExecContext(ctx, `INSERT INTO vods (channel,twitch_vod_id,title,date,created_at)
+		VALUES ($1,$2,'Optional',NOW(),NOW())
+		ON CONFLICT (twitch_vod_id) DO UPDATE SET processed=FALSE, youtube_url=NULL`, channel, id); err != nil {
+		t.Fatal(err)
+	}
+	_ = ResetUploads(ctx, db, id)
+	t.Setenv("YOUTUBE_UPLOAD_ENABLED", "1")
+	t.Setenv("YOUTUBE_UPLOAD_OWNERSHIP", "self")
+	t.Setenv("UPLOAD_DESTINATIONS", "youtube,local")
+	t.Setenv("UPLOAD_OPTIONAL_DESTINATIONS", "youtube")
+	t.Setenv("UPLOAD_MAX_ATTEMPTS", "1")
+	t.Setenv("LOCAL_UPLOAD_DIR", t.TempDir())
+	src := filepath.Join(t.TempDir(), "twitch_optional.mp4")
+	if err := os.WriteFile(src, []byte("video"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	oldU := uploader
+	uploader = failingUploader{}
+	defer func() { uploader = oldU }()
+	job := &Job{DB: db, Logger: slog.Default(), ID: id, Channel: channel, Date: time.Now(), Config: config.ChannelConfigFromEnv(channel)}
+	job.Set(ArtifactFile, src)
+	// YouTube fails but is optional, so the VOD is processed once local succeeds.
+	if err := (uploadStage{}).Run(ctx, job); err != nil {
+		t.Fatal(err)
+	}
+	var status string
+	_ = db.QueryRowContext(ctx, `SELECT status FROM vods WHERE twitch_vod_id=$1`, id).Scan(&status)
+	if Status(status) != StatusUploaded {
+		t.Fatalf("status = %s want uploaded", status)
+	}
+	ups, err := LoadUploads(ctx, db, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, u := range ups {
+		if u.Destination == DestinationYouTube && (u.Status != uploadFailed || u.Required || u.LastError == "") {
+			t.Fatalf("unexpected youtube row %+v", u)
+		}
+	}
+}
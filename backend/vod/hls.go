@@ -0,0 +1,726 @@
+package vod
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/onnwee/vod-tender/backend/telemetry"
+	"github.com/onnwee/vod-tender/backend/twitchapi"
+)
+
+// Native HLS downloader: fetches a playback token from Twitch GQL, reads the usher
+// master playlist, picks a variant and downloads its segments concurrently. Each segment
+// is written to <data>/twitch_<id>.hls/ via a .part file and renamed when complete, so an
+// interrupted download resumes by skipping segments already on disk. Progress is the exact
+// number of bytes written.
+
+const (
+	defaultUsherURL     = "https://usher.ttvnw.net"
+	hlsProgressInterval = 2 * time.Second
+)
+
+// hlsDownloader implements Downloader without yt-dlp.
+type hlsDownloader struct {
+	client      *http.Client
+	gqlURL      string
+	usherURL    string
+	clientID    string
+	quality     string
+	format      string
+	concurrency int
+	retries     int
+	backoff     time.Duration
+	limiter     *bandwidthLimiter // DOWNLOAD_RATE_LIMIT shared by all segment workers; nil is unlimited
+}
+
+// newHLSDownloader builds a downloader from HLS_* environment settings.
+func newHLSDownloader() *hlsDownloader {
+	h := &hlsDownloader{
+		client:      &http.Client{Timeout: 2 * time.Minute},
+		gqlURL:      twitchapi.GQLURL,
+		usherURL:    defaultUsherURL,
+		clientID:    twitchapi.DefaultGQLClientID,
+		quality:     "source",
+		format:      "mp4",
+		concurrency: 8,
+		retries:     5,
+		backoff:     time.Second,
+	}
+	if v := strings.TrimSpace(os.Getenv("TWITCH_GQL_CLIENT_ID")); v != "" {
+		h.clientID = v
+	}
+	if v := strings.ToLower(strings.TrimSpace(os.Getenv("HLS_QUALITY"))); v != "" {
+		h.quality = v
+	}
+	if v := strings.ToLower(strings.TrimSpace(os.Getenv("HLS_OUTPUT_FORMAT"))); v == "ts" || v == "mp4" {
+		h.format = v
+	}
+	if n, err := strconv.Atoi(os.Getenv("HLS_CONCURRENCY")); err == nil && n > 0 {
+		h.concurrency = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("HLS_SEGMENT_RETRIES")); err == nil && n >= 0 {
+		h.retries = n
+	}
+	return h
+}
+
+func (h *hlsDownloader) Download(ctx context.Context, dbc *sql.DB, id, dataDir string) (string, error) {
+	logger := slog.Default().With(slog.String("vod_id", id), slog.String("component", "vod_download"), slog.String("downloader", "native"))
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	activeMu.Lock()
+	activeCancels[id] = cancel
+	activeMu.Unlock()
+	defer func() {
+		activeMu.Lock()
+		delete(activeCancels, id)
+		activeMu.Unlock()
+	}()
+	if telemetry.DownloadsStarted != nil {
+		telemetry.DownloadsStarted.Inc()
+	}
+	if limit := channelConfigFrom(ctx).DownloadRateLimit; limit != "" {
+		if rate, err := parseRateLimit(limit); err != nil {
+			logger.Error("invalid DOWNLOAD_RATE_LIMIT format; must be a number followed by K/M/G (e.g., 500K, 2M, 1.5M)", slog.String("provided", limit))
+		} else {
+			h.limiter = newBandwidthLimiter(rate)
+			logger.Debug("applying download rate limit", slog.String("rate_limit", limit))
+		}
+	}
+
+	token, sig, err := h.accessToken(ctx, id)
+	if err != nil {
+		return "", fmt.Errorf("playback token: %w", err)
+	}
+	q := url.Values{}
+	q.Set("nauth", token)
+	q.Set("nauthsig", sig)
+	q.Set("allow_source", "true")
+	q.Set("allow_audio_only", "true")
+	q.Set("player", "twitchweb")
+	masterURL := strings.TrimRight(h.usherURL, "/") + "/vod/" + url.PathEscape(id) + ".m3u8?" + q.Encode()
+	master, err := h.get(ctx, masterURL)
+	if err != nil {
+		return "", fmt.Errorf("master playlist: %w", err)
+	}
+	variants, err := parseMasterPlaylist(master, masterURL)
+	if err != nil {
+		return "", err
+	}
+	variant := pickVariant(variants, h.quality)
+	logger.Info("hls variant selected", slog.String("name", variant.Name), slog.Int("bandwidth", variant.Bandwidth), slog.String("resolution", variant.Resolution))
+
+	media, err := h.get(ctx, variant.URI)
+	if err != nil {
+		return "", fmt.Errorf("media playlist: %w", err)
+	}
+	pl, err := parseMediaPlaylist(media, variant.URI)
+	if err != nil {
+		return "", err
+	}
+	if len(pl.Segments) == 0 {
+		return "", errors.New("media playlist has no segments")
+	}
+
+	workDir := filepath.Join(dataDir, fmt.Sprintf("twitch_%s.hls", id))
+	if err := os.MkdirAll(workDir, 0o750); err != nil {
+		return "", fmt.Errorf("mkdir work dir: %w", err)
+	}
+	files, err := h.fetchSegments(ctx, dbc, id, workDir, pl, logger)
+	if err != nil {
+		if ctx.Err() != nil {
+			setCanceledState(dbc, id)
+			return "", ctx.Err()
+		}
+		return "", err
+	}
+
+	out, err := h.assemble(ctx, id, dataDir, workDir, files, pl.InitURI != "", logger)
+	if err != nil {
+		return "", err
+	}
+	var size int64
+	if fi, err := os.Stat(out); err == nil {
+		size = fi.Size()
+	}
+	if dbc != nil {
+		_, _ = dbc.ExecContext(ctx, `UPDATE vods SET download_state=$1, download_total=$2, download_bytes=$3, download_speed=NULL, download_eta_seconds=0, downloaded_path=$4, progress_updated_at=NOW() WHERE twitch_vod_id=$5`, "complete", size, size, out, id)
+	}
+	_ = os.RemoveAll(workDir)
+	logger.Info("download finished", slog.Int64("bytes", size), slog.Int("segments", len(pl.Segments)))
+	return out, nil
+}
+
+// fetchSegments downloads the init map (if any) and all segments, returning local file
+// paths in playlist order.
+func (h *hlsDownloader) fetchSegments(ctx context.Context, dbc *sql.DB, id, workDir string, pl *mediaPlaylist, logger *slog.Logger) ([]string, error) {
+	type item struct {
+		uri  string
+		path string
+	}
+	items := make([]item, 0, len(pl.Segments)+1)
+	if pl.InitURI != "" {
+		items = append(items, item{uri: pl.InitURI, path: filepath.Join(workDir, "init.mp4")})
+	}
+	for i, s := range pl.Segments {
+		items = append(items, item{uri: s.URI, path: filepath.Join(workDir, fmt.Sprintf("seg_%06d%s", i, segmentExt(s.URI)))})
+	}
+
+	var done atomic.Int64 // bytes on disk
+	var doneSegs atomic.Int64
+	pending := make([]item, 0, len(items))
+	for _, it := range items {
+		if fi, err := os.Stat(it.path); err == nil {
+			done.Add(fi.Size()) // checkpoint from a previous attempt
+			doneSegs.Add(1)
+			continue
+		}
+		pending = append(pending, it)
+	}
+	if len(pending) < len(items) {
+		logger.Info("resuming hls download", slog.Int("completed_segments", len(items)-len(pending)), slog.Int("total_segments", len(items)))
+	}
+
+	started, resumedBytes := time.Now(), done.Load()
+	report := func() {
+		n := doneSegs.Load()
+		p := downloadProgress{Downloaded: done.Load(), FragmentIndex: intPtr(int(n)), FragmentCount: intPtr(len(items))}
+		if n > 0 {
+			p.Total = int64Ptr(p.Downloaded / n * int64(len(items))) // estimate until all segments are known
+		}
+		if el := time.Since(started).Seconds(); el > 0 {
+			speed := float64(p.Downloaded-resumedBytes) / el
+			p.Speed = &speed
+			if speed > 0 && p.Total != nil && *p.Total > p.Downloaded {
+				p.ETA = intPtr(int(float64(*p.Total-p.Downloaded) / speed))
+			}
+		}
+		writeProgress(context.Background(), dbc, id, p)
+	}
+	stopProgress := make(chan struct{})
+	progressDone := make(chan struct{})
+	go func() {
+		defer close(progressDone)
+		t := time.NewTicker(hlsProgressInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-stopProgress:
+				return
+			case <-t.C:
+				report()
+			}
+		}
+	}()
+
+	work := make(chan item)
+	errCh := make(chan error, 1)
+	var wg sync.WaitGroup
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	for w := 0; w < h.concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for it := range work {
+				n, err := h.fetchSegment(ctx, it.uri, it.path)
+				if err != nil {
+					select {
+					case errCh <- fmt.Errorf("segment %s: %w", filepath.Base(it.path), err):
+					default:
+					}
+					cancel()
+					return
+				}
+				done.Add(n)
+				doneSegs.Add(1)
+			}
+		}()
+	}
+feed:
+	for _, it := range pending {
+		select {
+		case work <- it:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(work)
+	wg.Wait()
+	close(stopProgress)
+	<-progressDone
+	report()
+
+	select {
+	case err := <-errCh:
+		return nil, err
+	default:
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	paths := make([]string, len(items))
+	for i, it := range items {
+		paths[i] = it.path
+	}
+	return paths, nil
+}
+
+// fetchSegment downloads one segment with retries, writing through a .part file.
+// Twitch replaces muted audio segments: a 403/404 on "-unmuted.ts" is retried as "-muted.ts".
+func (h *hlsDownloader) fetchSegment(ctx context.Context, uri, path string) (int64, error) {
+	var lastErr error
+	for attempt := 0; attempt <= h.retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return 0, ctx.Err()
+			case <-time.After(h.backoff * time.Duration(1<<(attempt-1))):
+			}
+		}
+		n, status, err := h.fetchTo(ctx, uri, path)
+		if err == nil {
+			return n, nil
+		}
+		lastErr = err
+		if ctx.Err() != nil {
+			return 0, ctx.Err()
+		}
+		if (status == http.StatusForbidden || status == http.StatusNotFound) && strings.Contains(uri, "-unmuted.ts") {
+			uri = strings.Replace(uri, "-unmuted.ts", "-muted.ts", 1)
+		}
+	}
+	return 0, lastErr
+}
+
+func (h *hlsDownloader) fetchTo(ctx context.Context, uri, path string) (int64, int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return 0, resp.StatusCode, fmt.Errorf("http %d", resp.StatusCode)
+	}
+	part := path + ".part"
+	f, err := os.Create(part) //nolint:gosec // G304: path is built from data dir and segment index
+	if err != nil {
+		return 0, resp.StatusCode, err
+	}
+	var body io.Reader = resp.Body
+	if h.limiter != nil {
+		body = &limitedReader{ctx: ctx, r: resp.Body, l: h.limiter}
+	}
+	n, err := io.Copy(f, body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && resp.ContentLength > 0 && n != resp.ContentLength {
+		err = fmt.Errorf("short read: %d of %d bytes", n, resp.ContentLength)
+	}
+	if err != nil {
+		_ = os.Remove(part)
+		return 0, resp.StatusCode, err
+	}
+	if err := os.Rename(part, path); err != nil {
+		return 0, resp.StatusCode, err
+	}
+	return n, resp.StatusCode, nil
+}
+
+// assemble concatenates segments into the final file. TS segments are joined into a .ts
+// and, for HLS_OUTPUT_FORMAT=mp4, remuxed with ffmpeg (falling back to .ts without it).
+// fMP4 segments (EXT-X-MAP) concatenate directly into an .mp4.
+func (h *hlsDownloader) assemble(ctx context.Context, id, dataDir, workDir string, files []string, fmp4 bool, logger *slog.Logger) (string, error) {
+	base := filepath.Join(dataDir, fmt.Sprintf("twitch_%s", id))
+	if fmp4 {
+		out := base + ".mp4"
+		return out, concatFiles(files, out)
+	}
+	ts := base + ".ts"
+	if h.format == "ts" {
+		return ts, concatFiles(files, ts)
+	}
+	joined := filepath.Join(workDir, "joined.ts")
+	if err := concatFiles(files, joined); err != nil {
+		return "", err
+	}
+	ffmpeg, ok := findTool("ffmpeg")
+	if !ok {
+		logger.Warn("ffmpeg not found; keeping MPEG-TS output")
+		return ts, os.Rename(joined, ts)
+	}
+	out := base + ".mp4"
+	tmp := base + ".transcode.tmp.mp4"
+	//nolint:gosec // G204: tool path resolved from PATH, args are controlled
+	cmd := exec.CommandContext(ctx, ffmpeg, "-y", "-v", "error", "-i", joined, "-c", "copy", "-bsf:a", "aac_adtstoasc", "-movflags", "+faststart", tmp)
+	if b, err := cmd.CombinedOutput(); err != nil {
+		_ = os.Remove(tmp)
+		return "", fmt.Errorf("ffmpeg remux: %w: %s", err, strings.TrimSpace(string(b)))
+	}
+	if err := os.Rename(tmp, out); err != nil {
+		return "", err
+	}
+	return out, nil
+}
+
+// rateLimitPattern is the DOWNLOAD_RATE_LIMIT syntax of yt-dlp's --limit-rate: a number
+// followed by K, M or G and an optional B.
+var rateLimitPattern = regexp.MustCompile(`(?i)^(\d+(?:\.\d+)?)([KMG])B?$`)
+
+// parseRateLimit converts a DOWNLOAD_RATE_LIMIT value such as 500K or 1.5M to bytes per
+// second, with binary multiples like yt-dlp.
+func parseRateLimit(s string) (float64, error) {
+	m := rateLimitPattern.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return 0, fmt.Errorf("invalid rate limit %q", s)
+	}
+	n, err := strconv.ParseFloat(m[1], 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid rate limit %q", s)
+	}
+	switch strings.ToUpper(m[2]) {
+	case "K":
+		n *= 1 << 10
+	case "M":
+		n *= 1 << 20
+	case "G":
+		n *= 1 << 30
+	}
+	return n, nil
+}
+
+// bandwidthLimiter paces reads to an average byte rate. Bytes are paid for after they are
+// read, so the rate can be exceeded by at most one read per reader.
+type bandwidthLimiter struct {
+	mu   sync.Mutex
+	rate float64   // bytes per second
+	next time.Time // when the bytes read so far are paid for
+}
+
+func newBandwidthLimiter(rate float64) *bandwidthLimiter {
+	return &bandwidthLimiter{rate: rate}
+}
+
+// wait charges n bytes and sleeps until they are paid for.
+func (l *bandwidthLimiter) wait(ctx context.Context, n int) error {
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(time.Duration(float64(n) / l.rate * float64(time.Second)))
+	d := l.next.Sub(now)
+	l.mu.Unlock()
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// limitedReader reads through a bandwidthLimiter in chunks of at most 32 KiB.
+type limitedReader struct {
+	ctx context.Context
+	r   io.Reader
+	l   *bandwidthLimiter
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	if len(p) > 32<<10 {
+		p = p[:32<<10]
+	}
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if werr := r.l.wait(r.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+func concatFiles(files []string, out string) error {
+	tmp := out + ".tmp"
+	f, err := os.Create(tmp) //nolint:gosec // G304: path is built from data dir
+	if err != nil {
+		return err
+	}
+	for _, p := range files {
+		in, err := os.Open(p) //nolint:gosec // G304: segment paths are built by the downloader
+		if err != nil {
+			_ = f.Close()
+			_ = os.Remove(tmp)
+			return err
+		}
+		_, err = io.Copy(f, in)
+		_ = in.Close()
+		if err != nil {
+			_ = f.Close()
+			_ = os.Remove(tmp)
+			return err
+		}
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, out)
+}
+
+// accessToken requests a VOD playback access token from Twitch GQL.
+func (h *hlsDownloader) accessToken(ctx context.Context, id string) (string, string, error) {
+	body, _ := json.Marshal(map[string]any{
+		"query": fmt.Sprintf(`{videoPlaybackAccessToken(id:%q,params:{platform:"web",playerBackend:"mediaplayer",playerType:"site"}){value signature}}`, id),
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.gqlURL, bytes.NewReader(body))
+	if err != nil {
+		return "", "", err
+	}
+	req.Header.Set("Client-ID", h.clientID)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return "", "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("gql status %d", resp.StatusCode)
+	}
+	var out struct {
+		Data struct {
+			Token *struct {
+				Value     string `json:"value"`
+				Signature string `json:"signature"`
+			} `json:"videoPlaybackAccessToken"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", "", fmt.Errorf("decode gql: %w", err)
+	}
+	if out.Data.Token == nil || out.Data.Token.Value == "" {
+		return "", "", errors.New("no playback token returned (vod deleted or subscriber-only)")
+	}
+	return out.Data.Token.Value, out.Data.Token.Signature, nil
+}
+
+func (h *hlsDownloader) get(ctx context.Context, u string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	b, err := io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode == http.StatusForbidden {
+		return "", errors.New("http 403: subscriber-only or restricted vod")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("http %d", resp.StatusCode)
+	}
+	return string(b), nil
+}
+
+// setCanceledState records a canceled download and clears the transfer columns.
+func setCanceledState(dbc *sql.DB, id string) {
+	if dbc == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, _ = dbc.ExecContext(ctx, `UPDATE vods SET download_state=$1, download_speed=NULL, download_eta_seconds=NULL, progress_updated_at=NOW() WHERE twitch_vod_id=$2`, "canceled", id)
+}
+
+// hlsVariant is one entry of a master playlist.
+type hlsVariant struct {
+	URI        string
+	Name       string
+	Resolution string
+	Bandwidth  int
+}
+
+type hlsSegment struct {
+	URI      string
+	Duration float64
+}
+
+type mediaPlaylist struct {
+	InitURI  string
+	Segments []hlsSegment
+}
+
+// parseMasterPlaylist extracts variants; names come from the VIDEO group's EXT-X-MEDIA NAME
+// (e.g. "1080p60 (source)") or the VIDEO attribute itself.
+func parseMasterPlaylist(body, base string) ([]hlsVariant, error) {
+	if !strings.HasPrefix(strings.TrimSpace(body), "#EXTM3U") {
+		return nil, errors.New("not an m3u8 playlist")
+	}
+	names := map[string]string{}
+	var out []hlsVariant
+	var pending *hlsVariant
+	sc := bufio.NewScanner(strings.NewReader(body))
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		switch {
+		case strings.HasPrefix(line, "#EXT-X-MEDIA:"):
+			attrs := parseAttrs(strings.TrimPrefix(line, "#EXT-X-MEDIA:"))
+			if attrs["GROUP-ID"] != "" {
+				names[attrs["GROUP-ID"]] = attrs["NAME"]
+			}
+		case strings.HasPrefix(line, "#EXT-X-STREAM-INF:"):
+			attrs := parseAttrs(strings.TrimPrefix(line, "#EXT-X-STREAM-INF:"))
+			v := hlsVariant{Resolution: attrs["RESOLUTION"], Name: attrs["VIDEO"]}
+			v.Bandwidth, _ = strconv.Atoi(attrs["BANDWIDTH"])
+			if n := names[attrs["VIDEO"]]; n != "" {
+				v.Name = n
+			}
+			pending = &v
+		case line == "" || strings.HasPrefix(line, "#"):
+		default:
+			if pending != nil {
+				pending.URI = resolveURI(base, line)
+				out = append(out, *pending)
+				pending = nil
+			}
+		}
+	}
+	if len(out) == 0 {
+		return nil, errors.New("master playlist has no variants")
+	}
+	return out, nil
+}
+
+// pickVariant selects by quality: "source"/"best" = highest bandwidth, "worst" = lowest,
+// otherwise the first variant whose name starts with the quality (e.g. "720p60").
+func pickVariant(vs []hlsVariant, quality string) hlsVariant {
+	sorted := append([]hlsVariant(nil), vs...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Bandwidth > sorted[j].Bandwidth })
+	switch quality {
+	case "", "source", "best":
+		for _, v := range sorted {
+			if v.Name == "chunked" || strings.Contains(strings.ToLower(v.Name), "source") {
+				return v
+			}
+		}
+		return sorted[0]
+	case "worst":
+		return sorted[len(sorted)-1]
+	}
+	for _, v := range sorted {
+		if strings.HasPrefix(strings.ToLower(v.Name), quality) {
+			return v
+		}
+	}
+	return sorted[0]
+}
+
+func parseMediaPlaylist(body, base string) (*mediaPlaylist, error) {
+	if !strings.HasPrefix(strings.TrimSpace(body), "#EXTM3U") {
+		return nil, errors.New("not an m3u8 playlist")
+	}
+	pl := &mediaPlaylist{}
+	var dur float64
+	sc := bufio.NewScanner(strings.NewReader(body))
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		switch {
+		case strings.HasPrefix(line, "#EXT-X-MAP:"):
+			pl.InitURI = resolveURI(base, parseAttrs(strings.TrimPrefix(line, "#EXT-X-MAP:"))["URI"])
+		case strings.HasPrefix(line, "#EXTINF:"):
+			v := strings.TrimPrefix(line, "#EXTINF:")
+			if i := strings.IndexByte(v, ','); i >= 0 {
+				v = v[:i]
+			}
+			dur, _ = strconv.ParseFloat(v, 64)
+		case line == "" || strings.HasPrefix(line, "#"):
+		default:
+			pl.Segments = append(pl.Segments, hlsSegment{URI: resolveURI(base, line), Duration: dur})
+			dur = 0
+		}
+	}
+	return pl, sc.Err()
+}
+
+// parseAttrs parses an HLS attribute list (KEY=VALUE,KEY="quoted,value").
+func parseAttrs(s string) map[string]string {
+	out := map[string]string{}
+	for len(s) > 0 {
+		eq := strings.IndexByte(s, '=')
+		if eq < 0 {
+			break
+		}
+		key := strings.TrimSpace(s[:eq])
+		s = s[eq+1:]
+		var val string
+		if strings.HasPrefix(s, `"`) {
+			end := strings.IndexByte(s[1:], '"')
+			if end < 0 {
+				val, s = s[1:], ""
+			} else {
+				val, s = s[1:end+1], s[end+2:]
+			}
+		} else if c := strings.IndexByte(s, ','); c >= 0 {
+			val, s = s[:c], s[c:]
+		} else {
+			val, s = s, ""
+		}
+		out[key] = val
+		s = strings.TrimPrefix(s, ",")
+	}
+	return out
+}
+
+func resolveURI(base, ref string) string {
+	b, err := url.Parse(base)
+	if err != nil {
+		return ref
+	}
+	r, err := url.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return b.ResolveReference(r).String()
+}
+
+func segmentExt(uri string) string {
+	if u, err := url.Parse(uri); err == nil {
+		if ext := filepath.Ext(u.Path); ext != "" && len(ext) <= 5 {
+			return ext
+		}
+	}
+	return ".ts"
+}
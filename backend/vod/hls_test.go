@@ -0,0 +1,274 @@
+package vod
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/onnwee/vod-tender/backend/config"
+)
+
+const testMaster = `#EXTM3U
+#EXT-X-MEDIA:TYPE=VIDEO,GROUP-ID="chunked",NAME="1080p60 (source)",AUTOSELECT=YES,DEFAULT=YES
+#EXT-X-STREAM-INF:BANDWIDTH=6000000,RESOLUTION=1920x1080,CODECS="avc1.64002A,mp4a.40.2",VIDEO="chunked",FRAME-RATE=60.000
+chunked/index-dvr.m3u8
+#EXT-X-MEDIA:TYPE=VIDEO,GROUP-ID="360p30",NAME="360p",AUTOSELECT=YES,DEFAULT=YES
+#EXT-X-STREAM-INF:BANDWIDTH=700000,RESOLUTION=640x360,CODECS="avc1.4D401E,mp4a.40.2",VIDEO="360p30",FRAME-RATE=30.000
+360p30/index-dvr.m3u8
+`
+
+const testMedia = `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-TARGETDURATION:10
+#EXT-X-PLAYLIST-TYPE:VOD
+#EXTINF:10.000,
+0.ts
+#EXTINF:10.000,
+1-unmuted.ts
+#EXTINF:4.500,
+2.ts
+#EXT-X-ENDLIST
+`
+
+// fakeTwitch serves the GQL token endpoint, usher playlists and segments.
+type fakeTwitch struct {
+	segments map[string]string
+	hits     map[string]int
+	failOnce map[string]bool
+	mu       sync.Mutex
+}
+
+func (f *fakeTwitch) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	f.hits[r.URL.Path]++
+	n := f.hits[r.URL.Path]
+	f.mu.Unlock()
+	switch {
+	case r.URL.Path == "/gql":
+		if r.Header.Get("Client-ID") == "" {
+			http.Error(w, "missing client id", http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte(`{"data":{"videoPlaybackAccessToken":{"value":"tok","signature":"sig"}}}`))
+	case r.URL.Path == "/vod/123.m3u8":
+		if r.URL.Query().Get("nauth") != "tok" || r.URL.Query().Get("nauthsig") != "sig" {
+			http.Error(w, "bad token", http.StatusForbidden)
+			return
+		}
+		_, _ = w.Write([]byte(testMaster))
+	case strings.HasSuffix(r.URL.Path, "/index-dvr.m3u8"):
+		_, _ = w.Write([]byte(testMedia))
+	default:
+		name := filepath.Base(r.URL.Path)
+		if f.failOnce[name] && n == 1 {
+			http.Error(w, "flaky", http.StatusInternalServerError)
+			return
+		}
+		body, ok := f.segments[name]
+		if !ok || !strings.HasPrefix(r.URL.Path, "/vod/chunked/") {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(body))
+	}
+}
+
+func newTestHLS(srvURL string) *hlsDownloader {
+	h := newHLSDownloader()
+	h.gqlURL = srvURL + "/gql"
+	h.usherURL = srvURL
+	h.format = "ts"
+	h.backoff = time.Millisecond
+	h.concurrency = 2
+	return h
+}
+
+func TestParseMasterPlaylistAndPickVariant(t *testing.T) {
+	vs, err := parseMasterPlaylist(testMaster, "https://usher.example/vod/1.m3u8?x=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vs) != 2 {
+		t.Fatalf("variants = %d want 2", len(vs))
+	}
+	if vs[0].URI != "https://usher.example/vod/chunked/index-dvr.m3u8" || vs[0].Name != "1080p60 (source)" || vs[0].Bandwidth != 6000000 {
+		t.Fatalf("unexpected variant %+v", vs[0])
+	}
+	cases := map[string]string{"source": "1080p60 (source)", "": "1080p60 (source)", "worst": "360p", "360p": "360p", "720p": "1080p60 (source)"}
+	for q, want := range cases {
+		if got := pickVariant(vs, q).Name; got != want {
+			t.Errorf("pickVariant(%q) = %q want %q", q, got, want)
+		}
+	}
+	if _, err := parseMasterPlaylist("<html>", ""); err == nil {
+		t.Fatal("expected error for non-playlist body")
+	}
+}
+
+func TestParseMediaPlaylist(t *testing.T) {
+	pl, err := parseMediaPlaylist(testMedia, "https://cdn.example/abc/chunked/index-dvr.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pl.Segments) != 3 || pl.InitURI != "" {
+		t.Fatalf("unexpected playlist %+v", pl)
+	}
+	if pl.Segments[1].URI != "https://cdn.example/abc/chunked/1-unmuted.ts" || pl.Segments[2].Duration != 4.5 {
+		t.Fatalf("unexpected segment %+v", pl.Segments)
+	}
+	fmp4, err := parseMediaPlaylist("#EXTM3U\n#EXT-X-MAP:URI=\"init-0.mp4\"\n#EXTINF:2.0,\n0.mp4\n", "https://cdn.example/v/index.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmp4.InitURI != "https://cdn.example/v/init-0.mp4" || segmentExt(fmp4.Segments[0].URI) != ".mp4" {
+		t.Fatalf("unexpected fmp4 playlist %+v", fmp4)
+	}
+}
+
+func TestHLSDownloaderDownloadsAndConcatenates(t *testing.T) {
+	fake := &fakeTwitch{
+		segments: map[string]string{"0.ts": "AAAA", "1-muted.ts": "BBBB", "2.ts": "CC"},
+		hits:     map[string]int{},
+		failOnce: map[string]bool{"2.ts": true},
+	}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	dir := t.TempDir()
+	out, err := newTestHLS(srv.URL).Download(context.Background(), nil, "123", dir)
+	if err != nil {
+		t.Fatalf("download: %v", err)
+	}
+	if out != filepath.Join(dir, "twitch_123.ts") {
+		t.Fatalf("unexpected output path %s", out)
+	}
+	b, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "AAAABBBBCC" {
+		t.Fatalf("output = %q, segments not concatenated in order", b)
+	}
+	if fake.hits["/vod/chunked/2.ts"] != 2 {
+		t.Fatalf("expected failed segment to be retried once, hits=%d", fake.hits["/vod/chunked/2.ts"])
+	}
+	if fake.hits["/vod/chunked/1-unmuted.ts"] == 0 || fake.hits["/vod/chunked/1-muted.ts"] != 1 {
+		t.Fatalf("expected muted fallback, hits=%v", fake.hits)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "twitch_123.hls")); !os.IsNotExist(err) {
+		t.Fatal("expected segment work dir to be removed after success")
+	}
+}
+
+func TestHLSDownloaderResumesFromCheckpoint(t *testing.T) {
+	fake := &fakeTwitch{
+		segments: map[string]string{"0.ts": "AAAA", "1-unmuted.ts": "BBBB", "2.ts": "CC"},
+		hits:     map[string]int{},
+	}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	dir := t.TempDir()
+	work := filepath.Join(dir, "twitch_123.hls")
+	if err := os.MkdirAll(work, 0o750); err != nil {
+		t.Fatal(err)
+	}
+	// Segment 0 completed on a previous attempt; a leftover .part must be ignored.
+	if err := os.WriteFile(filepath.Join(work, "seg_000000.ts"), []byte("AAAA"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(work, "seg_000001.ts.part"), []byte("B"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	out, err := newTestHLS(srv.URL).Download(context.Background(), nil, "123", dir)
+	if err != nil {
+		t.Fatalf("download: %v", err)
+	}
+	if fake.hits["/vod/chunked/0.ts"] != 0 {
+		t.Fatalf("checkpointed segment was downloaded again")
+	}
+	b, _ := os.ReadFile(out)
+	if string(b) != "AAAABBBBCC" {
+		t.Fatalf("output = %q", b)
+	}
+}
+
+func TestHLSDownloaderFailsAfterRetries(t *testing.T) {
+	fake := &fakeTwitch{
+		segments: map[string]string{"0.ts": "AAAA", "1-unmuted.ts": "BBBB"}, // 2.ts missing
+		hits:     map[string]int{},
+	}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	h := newTestHLS(srv.URL)
+	h.retries = 2
+	dir := t.TempDir()
+	_, err := h.Download(context.Background(), nil, "123", dir)
+	if err == nil || !strings.Contains(err.Error(), "seg_000002") {
+		t.Fatalf("expected segment error, got %v", err)
+	}
+	if got := fake.hits["/vod/chunked/2.ts"]; got != 3 {
+		t.Fatalf("segment attempts = %d want 3", got)
+	}
+	// Completed segments stay on disk as checkpoints for the next attempt.
+	if _, err := os.Stat(filepath.Join(dir, "twitch_123.hls", "seg_000000.ts")); err != nil {
+		t.Fatalf("expected checkpoint to survive failure: %v", err)
+	}
+}
+
+func TestNewHLSDownloaderFromEnv(t *testing.T) {
+	t.Setenv("HLS_CONCURRENCY", "3")
+	t.Setenv("HLS_SEGMENT_RETRIES", "0")
+	t.Setenv("HLS_QUALITY", "360P")
+	t.Setenv("HLS_OUTPUT_FORMAT", "ts")
+	h := newHLSDownloader()
+	if h.concurrency != 3 || h.retries != 0 || h.quality != "360p" || h.format != "ts" {
+		t.Fatalf("env not applied: %+v", h)
+	}
+	t.Setenv("HLS_CONCURRENCY", "0")
+	t.Setenv("HLS_OUTPUT_FORMAT", "mkv")
+	h = newHLSDownloader()
+	if h.concurrency != 8 || h.format != "mp4" {
+		t.Fatalf("invalid values should keep defaults: %+v", h)
+	}
+}
+
+func TestParseRateLimit(t *testing.T) {
+	for in, want := range map[string]float64{"500K": 500 << 10, "2M": 2 << 20, "1.5mb": 1.5 * (1 << 20), "1G": 1 << 30} {
+		if got, err := parseRateLimit(in); err != nil || got != want {
+			t.Errorf("parseRateLimit(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "fast", "2", "0K", "-1M", "1T"} {
+		if _, err := parseRateLimit(in); err == nil {
+			t.Errorf("parseRateLimit(%q): expected error", in)
+		}
+	}
+}
+
+func TestHLSDownloaderHonorsRateLimit(t *testing.T) {
+	seg := strings.Repeat("A", 20<<10)
+	fake := &fakeTwitch{
+		segments: map[string]string{"0.ts": seg, "1-unmuted.ts": seg, "2.ts": seg},
+		hits:     map[string]int{},
+	}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	// 60 KiB at 100 KiB/s takes about 600ms however many segments run in parallel.
+	ctx := context.WithValue(context.Background(), channelConfigCtxKey{}, config.ChannelConfig{DownloadRateLimit: "100K"})
+	start := time.Now()
+	if _, err := newTestHLS(srv.URL).Download(ctx, nil, "123", t.TempDir()); err != nil {
+		t.Fatalf("download: %v", err)
+	}
+	if el := time.Since(start); el < 400*time.Millisecond {
+		t.Fatalf("download took %v; rate limit not applied", el)
+	}
+}
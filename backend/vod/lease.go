@@ -0,0 +1,224 @@
+package vod
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Lease-based work claiming lets several replicas run processOnce against the same
+// database without picking the same VOD. A worker locks a candidate row with
+// SELECT ... FOR UPDATE SKIP LOCKED, records ownership in vod_leases, and keeps the
+// lease alive with heartbeats while it processes. If a worker crashes its lease
+// expires and the VOD becomes claimable by any other worker.
+
+const defaultLeaseTTL = 2 * time.Minute
+
+var (
+	workerIDOnce sync.Once
+	workerID     string
+)
+
+// WorkerID returns the identity recorded as lease owner for this process.
+// WORKER_ID overrides the default of "<hostname>-<pid>-<random>"; the random
+// suffix keeps identities unique when a pod restarts with the same hostname and pid.
+func WorkerID() string {
+	workerIDOnce.Do(func() {
+		if v := strings.TrimSpace(os.Getenv("WORKER_ID")); v != "" {
+			workerID = v
+			return
+		}
+		host, err := os.Hostname()
+		if err != nil || host == "" {
+			host = "worker"
+		}
+		workerID = fmt.Sprintf("%s-%d-%s", host, os.Getpid(), uuid.New().String()[:8])
+	})
+	return workerID
+}
+
+// leaseTTL returns how long a claim stays valid without a heartbeat (VOD_LEASE_TTL, default 2m).
+func leaseTTL() time.Duration {
+	if s := os.Getenv("VOD_LEASE_TTL"); s != "" {
+		if d, err := time.ParseDuration(s); err == nil && d > 0 {
+			return d
+		}
+	}
+	return defaultLeaseTTL
+}
+
+// claimFilter carries the eligibility rules processOnce applies when picking a candidate.
+type claimFilter struct {
+	backfillCutoff    time.Time
+	channel           string
+	cooldown          time.Duration
+	maxAttempts       int
+	backfillThrottled bool
+}
+
+// claimedVOD is the subset of VOD fields processOnce needs after a successful claim.
+type claimedVOD struct {
+	Date       time.Time
+	ID         string
+	Title      string
+	SkipUpload bool
+}
+
+// claimAttempts bounds how often claimNextVOD selects again after losing a race for the
+// lease of its candidate.
+const claimAttempts = 5
+
+// claimNextVOD atomically selects the highest-priority eligible VOD that is not leased by
+// another live worker and records a lease for owner. It returns nil when nothing is claimable.
+func claimNextVOD(ctx context.Context, dbc *sql.DB, owner string, ttl time.Duration, f claimFilter) (*claimedVOD, error) {
+	for i := 0; i < claimAttempts; i++ {
+		c, raced, err := tryClaimVOD(ctx, dbc, owner, ttl, f)
+		if err != nil || !raced {
+			return c, err
+		}
+		// Another worker leased the candidate between our select and upsert. Its lease is
+		// committed now, so selecting again moves on to the next candidate.
+	}
+	return nil, nil
+}
+
+// tryClaimVOD makes one claim attempt. raced reports that the selected candidate was leased
+// by another worker before our lease could be recorded.
+func tryClaimVOD(ctx context.Context, dbc *sql.DB, owner string, ttl time.Duration, f claimFilter) (c *claimedVOD, raced bool, err error) {
+	tx, err := dbc.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, false, fmt.Errorf("begin claim tx: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	c = &claimedVOD{}
+	err = tx.QueryRowContext(ctx, `SELECT v.twitch_vod_id, COALESCE(v.title,''), v.date, COALESCE(v.skip_upload,FALSE)
+		FROM vods v
+		LEFT JOIN vod_leases l ON l.twitch_vod_id = v.twitch_vod_id
+		WHERE v.channel=$1 AND COALESCE(v.processed,false)=false AND (
+			v.processing_error IS NULL OR v.processing_error='' OR (v.download_retries < $2 AND EXTRACT(EPOCH FROM (NOW() - COALESCE(v.updated_at, v.created_at))) >= $3)
+		)
+		AND (l.twitch_vod_id IS NULL OR l.expires_at < NOW())
+		AND (v.twitch_deleted_at IS NULL OR COALESCE(v.downloaded_path,'') <> '')
+		AND NOT ($4 AND v.date < $5)
+		ORDER BY v.priority DESC, v.date ASC
+		LIMIT 1
+		FOR UPDATE OF v SKIP LOCKED`,
+		f.channel, f.maxAttempts, int(f.cooldown.Seconds()), f.backfillThrottled, f.backfillCutoff).
+		Scan(&c.ID, &c.Title, &c.Date, &c.SkipUpload)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("select claim candidate: %w", err)
+	}
+
+	// The row lock above keeps concurrent claimers off this VOD until commit; the conditional
+	// upsert additionally refuses to steal a lease that is still live.
+	res, err := tx.ExecContext(ctx, `INSERT INTO vod_leases (twitch_vod_id, owner, acquired_at, heartbeat_at, expires_at)
+		VALUES ($1, $2, NOW(), NOW(), NOW() + make_interval(secs => $3))
+		ON CONFLICT (twitch_vod_id) DO UPDATE SET owner=EXCLUDED.owner, acquired_at=EXCLUDED.acquired_at,
+			heartbeat_at=EXCLUDED.heartbeat_at, expires_at=EXCLUDED.expires_at
+		WHERE vod_leases.expires_at < NOW()`, c.ID, owner, ttl.Seconds())
+	if err != nil {
+		return nil, false, fmt.Errorf("insert lease: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, true, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, false, fmt.Errorf("commit claim: %w", err)
+	}
+	return c, false, nil
+}
+
+// vodLease is a held claim on a VOD. The heartbeat goroutine extends the lease until
+// release is called; if the lease is lost (e.g. expired during a long GC pause and taken
+// over by another worker) the context returned by startLease is canceled so this worker
+// stops touching a VOD it no longer owns.
+type vodLease struct {
+	dbc    *sql.DB
+	cancel context.CancelFunc
+	done   chan struct{}
+	vodID  string
+	owner  string
+	ttl    time.Duration
+}
+
+// startLease begins heartbeating an already-claimed lease and returns a context bound to it.
+func startLease(ctx context.Context, dbc *sql.DB, vodID, owner string, ttl time.Duration) (*vodLease, context.Context) {
+	leaseCtx, cancel := context.WithCancel(ctx)
+	l := &vodLease{dbc: dbc, cancel: cancel, done: make(chan struct{}), vodID: vodID, owner: owner, ttl: ttl}
+	go l.heartbeat(leaseCtx)
+	return l, leaseCtx
+}
+
+func (l *vodLease) heartbeat(ctx context.Context) {
+	defer close(l.done)
+	interval := l.ttl / 3
+	if interval <= 0 {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	extended := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			ok, err := extendLease(ctx, l.dbc, l.vodID, l.owner, l.ttl)
+			if err != nil {
+				// Transient DB error: keep trying until the lease would have expired anyway.
+				// After that another worker may have claimed the VOD, so stop working on it.
+				if time.Since(extended) >= l.ttl {
+					slog.Warn("lease expired without heartbeat; abandoning vod", slog.String("vod_id", l.vodID), slog.Any("err", err))
+					l.cancel()
+					return
+				}
+				slog.Warn("lease heartbeat failed", slog.String("vod_id", l.vodID), slog.Any("err", err))
+				continue
+			}
+			extended = time.Now()
+			if !ok {
+				slog.Warn("lease lost; abandoning vod", slog.String("vod_id", l.vodID), slog.String("owner", l.owner))
+				l.cancel()
+				return
+			}
+		}
+	}
+}
+
+// release stops the heartbeat and deletes the lease row (only if still owned).
+func (l *vodLease) release() {
+	l.cancel()
+	<-l.done
+	// Use a fresh context: the processing context may already be canceled.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := l.dbc.ExecContext(ctx, `DELETE FROM vod_leases WHERE twitch_vod_id=$1 AND owner=$2`, l.vodID, l.owner); err != nil {
+		slog.Warn("failed to release lease", slog.String("vod_id", l.vodID), slog.Any("err", err))
+	}
+}
+
+// extendLease pushes the expiry of a lease still owned by owner. It reports false when the
+// lease no longer belongs to owner.
+func extendLease(ctx context.Context, dbc *sql.DB, vodID, owner string, ttl time.Duration) (bool, error) {
+	res, err := dbc.ExecContext(ctx, `UPDATE vod_leases SET heartbeat_at=NOW(), expires_at=NOW() + make_interval(secs => $3)
+		WHERE twitch_vod_id=$1 AND owner=$2`, vodID, owner, ttl.Seconds())
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
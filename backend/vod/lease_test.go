@@ -0,0 +1,180 @@
+package vod
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+	dbpkg "github.com/onnwee/vod-tender/backend/db"
+)
+
+func TestLeaseTTL(t *testing.T) {
+	t.Setenv("VOD_LEASE_TTL", "")
+	if got := leaseTTL(); got != defaultLeaseTTL {
+		t.Fatalf("default ttl = %v want %v", got, defaultLeaseTTL)
+	}
+	t.Setenv("VOD_LEASE_TTL", "45s")
+	if got := leaseTTL(); got != 45*time.Second {
+		t.Fatalf("ttl = %v want 45s", got)
+	}
+	t.Setenv("VOD_LEASE_TTL", "-5s")
+	if got := leaseTTL(); got != defaultLeaseTTL {
+		t.Fatalf("negative ttl should fall back to default, got %v", got)
+	}
+	t.Setenv("VOD_LEASE_TTL", "bogus")
+	if got := leaseTTL(); got != defaultLeaseTTL {
+		t.Fatalf("invalid ttl should fall back to default, got %v", got)
+	}
+}
+
+func TestWorkerIDStable(t *testing.T) {
+	a, b := WorkerID(), WorkerID()
+	if a == "" || a != b {
+		t.Fatalf("expected stable non-empty worker id, got %q and %q", a, b)
+	}
+}
+
+func TestLeaseAbandonedWhenHeartbeatsFailForTTL(t *testing.T) {
+	// Nothing listens on port 1, so every heartbeat fails like a worker cut off from the DB.
+	db, err := sql.Open("pgx", "postgres://vod@127.0.0.1:1/vod?connect_timeout=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	l, ctx := startLease(context.Background(), db, "unreachable", "worker", 300*time.Millisecond)
+	defer l.cancel()
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("lease context still live after the ttl passed without a successful heartbeat")
+	}
+}
+
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_PG_DSN")
+	if dsn == "" {
+		t.Skip("TEST_PG_DSN not set")
+	}
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("failed to close db: %v", err)
+		}
+	})
+	if err := dbpkg.Migrate(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestClaimNextVODConcurrentWorkersGetDistinctVODs(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	channel := "lease-concurrent"
+	ids := []string{"lease_c1", "lease_c2", "lease_c3"}
+	t.Cleanup(func() {
+		_, _ = db.Exec(`DELETE FROM vods WHERE channel=$1`, channel)
+	})
+	for i, id := range ids {
+		_, err := db.ExecContext(ctx, `INSERT INTO vods (channel,twitch_vod_id,title,date,created_at,processed)
+			VALUES ($1,$2,'Lease',NOW() - make_interval(hours => $3),NOW(),FALSE)
+			ON CONFLICT (twitch_vod_id) DO UPDATE SET processed=FALSE, processing_error=NULL`, channel, id, i)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f := claimFilter{channel: channel, maxAttempts: 5, cooldown: time.Minute}
+	var mu sync.Mutex
+	seen := map[string]string{}
+	var wg sync.WaitGroup
+	for _, owner := range []string{"worker-a", "worker-b", "worker-c", "worker-d"} {
+		wg.Add(1)
+		go func(owner string) {
+			defer wg.Done()
+			c, err := claimNextVOD(ctx, db, owner, time.Minute, f)
+			if err != nil {
+				t.Errorf("claim %s: %v", owner, err)
+				return
+			}
+			if c == nil {
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if prev, dup := seen[c.ID]; dup {
+				t.Errorf("vod %s claimed by both %s and %s", c.ID, prev, owner)
+			}
+			seen[c.ID] = owner
+		}(owner)
+	}
+	wg.Wait()
+	if len(seen) == 0 {
+		t.Fatal("expected at least one claim")
+	}
+	for id, owner := range seen {
+		var dbOwner string
+		if err := db.QueryRowContext(ctx, `SELECT owner FROM vod_leases WHERE twitch_vod_id=$1`, id).Scan(&dbOwner); err != nil {
+			t.Fatalf("lease row for %s: %v", id, err)
+		}
+		if dbOwner != owner {
+			t.Fatalf("lease owner for %s = %s want %s", id, dbOwner, owner)
+		}
+	}
+}
+
+func TestClaimNextVODReclaimsExpiredLease(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	channel := "lease-expired"
+	id := "lease_expired_1"
+	t.Cleanup(func() {
+		_, _ = db.Exec(`DELETE FROM vods WHERE channel=$1`, channel)
+	})
+	if _, err := db.ExecContext(ctx, `INSERT INTO vods (channel,twitch_vod_id,title,date,created_at,processed)
+		VALUES ($1,$2,'Lease',NOW(),NOW(),FALSE)
+		ON CONFLICT (twitch_vod_id) DO UPDATE SET processed=FALSE, processing_error=NULL`, channel, id); err != nil {
+		t.Fatal(err)
+	}
+	f := claimFilter{channel: channel, maxAttempts: 5, cooldown: time.Minute}
+
+	c, err := claimNextVOD(ctx, db, "crashed-worker", time.Minute, f)
+	if err != nil || c == nil || c.ID != id {
+		t.Fatalf("first claim = %+v, %v", c, err)
+	}
+	// A live lease blocks other workers.
+	if c, err := claimNextVOD(ctx, db, "other-worker", time.Minute, f); err != nil || c != nil {
+		t.Fatalf("expected no claim while lease live, got %+v, %v", c, err)
+	}
+	// Simulate the owner crashing: no heartbeat, lease expires.
+	if _, err := db.ExecContext(ctx, `UPDATE vod_leases SET expires_at=NOW() - INTERVAL '1 second' WHERE twitch_vod_id=$1`, id); err != nil {
+		t.Fatal(err)
+	}
+	c, err = claimNextVOD(ctx, db, "other-worker", time.Minute, f)
+	if err != nil || c == nil || c.ID != id {
+		t.Fatalf("expected expired lease to be reclaimed, got %+v, %v", c, err)
+	}
+	// The crashed worker's heartbeat must now report the lease as lost.
+	ok, err := extendLease(ctx, db, id, "crashed-worker", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Fatal("expected heartbeat from previous owner to fail after takeover")
+	}
+	l, _ := startLease(ctx, db, id, "other-worker", time.Minute)
+	l.release()
+	var n int
+	_ = db.QueryRowContext(ctx, `SELECT COUNT(1) FROM vod_leases WHERE twitch_vod_id=$1`, id).Scan(&n)
+	if n != 0 {
+		t.Fatalf("expected lease released, %d rows remain", n)
+	}
+}
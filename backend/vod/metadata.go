@@ -0,0 +1,288 @@
+package vod
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/onnwee/vod-tender/backend/config"
+)
+
+// YouTube metadata is rendered from per-channel text/template templates. Each setting is
+// resolved from the channel's kv row first, then its configured value, then the defaults below,
+// which reproduce the historical "<date> <title>" title and attribution description.
+const (
+	defaultTitleTemplate       = `{{.Date.Format "2006-01-02"}} {{.Title}}{{with .PartTitle}} - {{.}}{{end}}`
+	defaultDescriptionTemplate = `{{with .Description}}{{.}}
+
+{{end}}{{if .PartCount}}Part {{.PartNumber}} of {{.PartCount}}, starting at {{hms .PartStart}} into the original stream.
+{{end}}Original stream date: {{.Date.Format "2006-01-02T15:04:05Z07:00"}}
+{{- with .Channel}}
+Attribution: Original Twitch channel {{printf "%q" .}}{{end}}
+{{- with .ID}}
+Original Twitch VOD ID: {{.}}
+Original Twitch URL: {{$.TwitchURL}}{{end}}
+{{- with .Chapters}}
+
+Chapters:
+{{.}}{{end}}`
+	defaultPrivacy = "private"
+
+	maxTitleRunes       = 100
+	maxDescriptionBytes = 5000
+	maxTagsLength       = 500
+)
+
+// ErrInvalidMetadataSettings wraps template parse/execute and privacy/category errors.
+var ErrInvalidMetadataSettings = errors.New("invalid youtube metadata settings")
+
+// VideoMetadata is the snippet/status metadata sent to YouTube for a VOD.
+type VideoMetadata struct {
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Privacy     string   `json:"privacy"`
+	CategoryID  string   `json:"category_id,omitempty"`
+	Tags        []string `json:"tags"`
+}
+
+// VideoTemplateData is the value templates are executed against.
+type VideoTemplateData struct {
+	Date            time.Time
+	ID              string
+	Title           string
+	Channel         string
+	Description     string // custom description set via /vods/{id}/description
+	TwitchURL       string
+	Duration        time.Duration
+	DurationSeconds int
+	Chapters        string // YouTube timestamp list, empty when there are too few chapters
+	ChatMessages    int
+	UniqueChatters  int
+	// Set when uploading one part of a split VOD; PartCount is 0 otherwise.
+	PartTitle  string
+	PartNumber int
+	PartCount  int
+	PartStart  time.Duration
+	PartEnd    time.Duration
+}
+
+type metadataTemplates struct {
+	title       *template.Template
+	description *template.Template
+	tags        *template.Template
+	privacy     string
+	categoryID  string
+}
+
+var templateFuncs = template.FuncMap{
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"trim":  strings.TrimSpace,
+	"join":  strings.Join,
+	"hms":   formatHMS,
+}
+
+// channelSetting resolves a per-channel kv value, falling back to the channel's
+// configured value for env (channel_settings, CHANNEL_CONFIG_FILE, then the environment).
+func channelSetting(ctx context.Context, dbc *sql.DB, channel, key, env string) string {
+	var v string
+	if dbc != nil {
+		_ = dbc.QueryRowContext(ctx, `SELECT value FROM kv WHERE channel=$1 AND key=$2`, channel, key).Scan(&v)
+	}
+	if strings.TrimSpace(v) == "" {
+		v = config.ChannelValue(ctx, dbc, channel, env)
+	}
+	return v
+}
+
+func loadMetadataTemplates(ctx context.Context, dbc *sql.DB, channel string) (metadataTemplates, error) {
+	var mt metadataTemplates
+	parse := func(name, key, env, def string) (*template.Template, error) {
+		src := channelSetting(ctx, dbc, channel, key, env)
+		if strings.TrimSpace(src) == "" {
+			src = def
+		}
+		t, err := template.New(name).Funcs(templateFuncs).Parse(src)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s template: %v", ErrInvalidMetadataSettings, name, err)
+		}
+		return t, nil
+	}
+	var err error
+	if mt.title, err = parse("title", "youtube_title_template", "YOUTUBE_TITLE_TEMPLATE", defaultTitleTemplate); err != nil {
+		return mt, err
+	}
+	if mt.description, err = parse("description", "youtube_description_template", "YOUTUBE_DESCRIPTION_TEMPLATE", defaultDescriptionTemplate); err != nil {
+		return mt, err
+	}
+	if mt.tags, err = parse("tags", "youtube_tags_template", "YOUTUBE_TAGS_TEMPLATE", ""); err != nil {
+		return mt, err
+	}
+	mt.privacy = strings.ToLower(strings.TrimSpace(channelSetting(ctx, dbc, channel, "youtube_privacy", "YOUTUBE_PRIVACY")))
+	switch mt.privacy {
+	case "":
+		mt.privacy = defaultPrivacy
+	case "private", "unlisted", "public":
+	default:
+		return mt, fmt.Errorf("%w: privacy %q (want private|unlisted|public)", ErrInvalidMetadataSettings, mt.privacy)
+	}
+	mt.categoryID = strings.TrimSpace(channelSetting(ctx, dbc, channel, "youtube_category_id", "YOUTUBE_CATEGORY_ID"))
+	for _, r := range mt.categoryID {
+		if r < '0' || r > '9' {
+			return mt, fmt.Errorf("%w: category id %q", ErrInvalidMetadataSettings, mt.categoryID)
+		}
+	}
+	return mt, nil
+}
+
+// renderVideoMetadata executes the channel's templates and applies YouTube's limits.
+func renderVideoMetadata(ctx context.Context, dbc *sql.DB, data VideoTemplateData) (VideoMetadata, error) {
+	mt, err := loadMetadataTemplates(ctx, dbc, data.Channel)
+	if err != nil {
+		return VideoMetadata{}, err
+	}
+	data.Title = sanitizeTitle(data.Title)
+	if data.Title == "" {
+		data.Title = "Twitch VOD"
+	}
+	if data.TwitchURL == "" && data.ID != "" {
+		data.TwitchURL = "https://www.twitch.tv/videos/" + data.ID
+	}
+	exec := func(t *template.Template) (string, error) {
+		var buf bytes.Buffer
+		if err := t.Execute(&buf, data); err != nil {
+			return "", fmt.Errorf("%w: render %s template: %v", ErrInvalidMetadataSettings, t.Name(), err)
+		}
+		return buf.String(), nil
+	}
+	title, err := exec(mt.title)
+	if err != nil {
+		return VideoMetadata{}, err
+	}
+	desc, err := exec(mt.description)
+	if err != nil {
+		return VideoMetadata{}, err
+	}
+	tags, err := exec(mt.tags)
+	if err != nil {
+		return VideoMetadata{}, err
+	}
+	md := VideoMetadata{
+		Title:       truncateRunes(sanitizeTitle(title), maxTitleRunes),
+		Description: truncateBytes(stripAngles(strings.TrimSpace(desc)), maxDescriptionBytes),
+		Tags:        splitTags(tags),
+		Privacy:     mt.privacy,
+		CategoryID:  mt.categoryID,
+	}
+	if md.Title == "" {
+		md.Title = truncateRunes(data.Title, maxTitleRunes)
+	}
+	return md, nil
+}
+
+// fillVideoStats adds duration, chat statistics and chapters for the VOD (best-effort).
+func fillVideoStats(ctx context.Context, dbc *sql.DB, data *VideoTemplateData) {
+	if dbc == nil || data.ID == "" {
+		return
+	}
+	var dur int
+	if err := dbc.QueryRowContext(ctx, `SELECT COALESCE(duration_seconds,0) FROM vods WHERE twitch_vod_id=$1`, data.ID).Scan(&dur); err == nil && dur > 0 {
+		data.DurationSeconds = dur
+		data.Duration = time.Duration(dur) * time.Second
+	}
+	_ = dbc.QueryRowContext(ctx, `SELECT COUNT(*), COUNT(DISTINCT username) FROM chat_messages WHERE vod_id=$1`, data.ID).Scan(&data.ChatMessages, &data.UniqueChatters)
+	if chaptersEnabled() {
+		if chapters, err := LoadChapters(ctx, dbc, data.ID); err == nil {
+			data.Chapters = formatChapterList(chapters, dur)
+		}
+	}
+}
+
+// PreviewVideoMetadata renders the YouTube metadata the upload stage would use for a VOD.
+// It returns sql.ErrNoRows when the VOD does not exist.
+func PreviewVideoMetadata(ctx context.Context, dbc *sql.DB, vodID string) (VideoMetadata, error) {
+	data := VideoTemplateData{ID: vodID}
+	err := dbc.QueryRowContext(ctx, `SELECT COALESCE(title,''), COALESCE(date, to_timestamp(0)), channel, COALESCE(description,'')
+		FROM vods WHERE twitch_vod_id=$1`, vodID).Scan(&data.Title, &data.Date, &data.Channel, &data.Description)
+	if err != nil {
+		return VideoMetadata{}, err
+	}
+	fillVideoStats(ctx, dbc, &data)
+	return renderVideoMetadata(ctx, dbc, data)
+}
+
+// sanitizeTitle drops control characters (including newlines) and characters YouTube rejects.
+func sanitizeTitle(s string) string {
+	clean := make([]rune, 0, len(s))
+	for _, r := range s {
+		if r < 0x20 || r == 0x7f || r == '<' || r == '>' {
+			continue
+		}
+		clean = append(clean, r)
+	}
+	return strings.TrimSpace(string(clean))
+}
+
+func stripAngles(s string) string {
+	return strings.NewReplacer("<", "", ">", "").Replace(s)
+}
+
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-3]) + "..."
+}
+
+func truncateBytes(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	s = s[:n]
+	for len(s) > 0 && !utf8.ValidString(s) {
+		s = s[:len(s)-1]
+	}
+	return s
+}
+
+// splitTags splits rendered tags on commas/newlines, dropping blanks and duplicates and
+// stopping before YouTube's 500 character limit (tags with spaces count their quotes).
+func splitTags(s string) []string {
+	tags := []string{}
+	seen := map[string]bool{}
+	total := 0
+	for _, f := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == '\n' }) {
+		tag := strings.TrimSpace(stripAngles(f))
+		key := strings.ToLower(tag)
+		if tag == "" || seen[key] {
+			continue
+		}
+		n := utf8.RuneCountInString(tag)
+		if strings.ContainsRune(tag, ' ') {
+			n += 2
+		}
+		if total > 0 {
+			n++ // separator
+		}
+		if total+n > maxTagsLength {
+			break
+		}
+		total += n
+		seen[key] = true
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+// formatHMS renders a duration as H:MM:SS.
+func formatHMS(d time.Duration) string {
+	s := int(d.Round(time.Second) / time.Second)
+	return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+}
@@ -0,0 +1,137 @@
+package vod
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderVideoMetadataDefaults(t *testing.T) {
+	for _, k := range []string{"YOUTUBE_TITLE_TEMPLATE", "YOUTUBE_DESCRIPTION_TEMPLATE", "YOUTUBE_TAGS_TEMPLATE", "YOUTUBE_PRIVACY", "YOUTUBE_CATEGORY_ID"} {
+		t.Setenv(k, "")
+	}
+	date := time.Date(2024, 3, 9, 18, 30, 0, 0, time.UTC)
+	md, err := renderVideoMetadata(context.Background(), nil, VideoTemplateData{ID: "123", Channel: "chan", Title: "Big\tStream\n", Date: date, Description: "Custom intro"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.Title != "2024-03-09 BigStream" {
+		t.Fatalf("title = %q", md.Title)
+	}
+	want := "Custom intro\n\nOriginal stream date: 2024-03-09T18:30:00Z\n" +
+		"Attribution: Original Twitch channel \"chan\"\n" +
+		"Original Twitch VOD ID: 123\n" +
+		"Original Twitch URL: https://www.twitch.tv/videos/123"
+	if md.Description != want {
+		t.Fatalf("description =\n%s\nwant\n%s", md.Description, want)
+	}
+	if md.Privacy != "private" || md.CategoryID != "" || len(md.Tags) != 0 {
+		t.Fatalf("unexpected defaults %+v", md)
+	}
+
+	// Without custom description, channel or id only the date line remains.
+	md, err = renderVideoMetadata(context.Background(), nil, VideoTemplateData{Date: date})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.Title != "2024-03-09 Twitch VOD" || md.Description != "Original stream date: 2024-03-09T18:30:00Z" {
+		t.Fatalf("unexpected minimal metadata %+v", md)
+	}
+}
+
+func TestRenderVideoMetadataCustomTemplates(t *testing.T) {
+	t.Setenv("YOUTUBE_TITLE_TEMPLATE", `{{upper .Channel}} | {{.Title}} ({{hms .Duration}})`)
+	t.Setenv("YOUTUBE_DESCRIPTION_TEMPLATE", `{{.ChatMessages}} messages from {{.UniqueChatters}} chatters <b>{{.TwitchURL}}</b>`)
+	t.Setenv("YOUTUBE_TAGS_TEMPLATE", "{{.Channel}}, twitch,\nTwitch , vod archive,,")
+	t.Setenv("YOUTUBE_PRIVACY", "Unlisted")
+	t.Setenv("YOUTUBE_CATEGORY_ID", "20")
+	data := VideoTemplateData{ID: "9", Channel: "chan", Title: strings.Repeat("x", 120), Duration: 3*time.Hour + 4*time.Minute + 5*time.Second, ChatMessages: 42, UniqueChatters: 7}
+	md, err := renderVideoMetadata(context.Background(), nil, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(md.Title, "CHAN | xxx") || len([]rune(md.Title)) != maxTitleRunes || !strings.HasSuffix(md.Title, "...") {
+		t.Fatalf("title = %q", md.Title)
+	}
+	if md.Description != "42 messages from 7 chatters bhttps://www.twitch.tv/videos/9/b" {
+		t.Fatalf("description = %q", md.Description)
+	}
+	if strings.Join(md.Tags, "|") != "chan|twitch|vod archive" {
+		t.Fatalf("tags = %q", md.Tags)
+	}
+	if md.Privacy != "unlisted" || md.CategoryID != "20" {
+		t.Fatalf("privacy/category = %s/%s", md.Privacy, md.CategoryID)
+	}
+
+	t.Setenv("YOUTUBE_TITLE_TEMPLATE", `{{hms .Duration}}`)
+	md, _ = renderVideoMetadata(context.Background(), nil, VideoTemplateData{Title: "t", Duration: 65 * time.Second})
+	if md.Title != "0:01:05" {
+		t.Fatalf("hms title = %q", md.Title)
+	}
+}
+
+func TestRenderVideoMetadataInvalidSettings(t *testing.T) {
+	cases := map[string]string{
+		"YOUTUBE_TITLE_TEMPLATE":       "{{.Title",
+		"YOUTUBE_DESCRIPTION_TEMPLATE": "{{.NoSuchField}}",
+		"YOUTUBE_PRIVACY":              "friends",
+		"YOUTUBE_CATEGORY_ID":          "gaming",
+	}
+	for env, val := range cases {
+		t.Run(env, func(t *testing.T) {
+			t.Setenv(env, val)
+			_, err := renderVideoMetadata(context.Background(), nil, VideoTemplateData{Title: "t"})
+			if !errors.Is(err, ErrInvalidMetadataSettings) {
+				t.Fatalf("expected ErrInvalidMetadataSettings, got %v", err)
+			}
+		})
+	}
+}
+
+func TestSplitTagsLimit(t *testing.T) {
+	var b strings.Builder
+	for i := 0; i < 100; i++ {
+		b.WriteString("tag" + strings.Repeat("x", 6) + ",")
+	}
+	tags := splitTags(b.String())
+	total := 0
+	for i, tag := range tags {
+		total += len(tag)
+		if i > 0 {
+			total++
+		}
+	}
+	if total > maxTagsLength || len(tags) == 0 {
+		t.Fatalf("tags exceed limit: %d chars in %d tags", total, len(tags))
+	}
+}
+
+func TestPreviewVideoMetadata(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	channel := "preview-chan"
+	t.Cleanup(func() {
+		_, _ = db.Exec(`DELETE FROM kv WHERE channel=$1`, channel)
+		_, _ = db.Exec(`DELETE FROM chat_messages WHERE vod_id='preview_1'`)
+		_, _ = db.Exec(`DELETE FROM vods WHERE channel=$1`, channel)
+	})
+	if _, err := db.ExecContext(ctx, `INSERT INTO vods (channel,twitch_vod_id,title,date,duration_seconds,created_at)
+		VALUES ($1,'preview_1','Preview',NOW(),3600,NOW()) ON CONFLICT (twitch_vod_id) DO NOTHING`, channel); err != nil {
+		t.Fatal(err)
+	}
+	for _, u := range []string{"a", "b", "a"} {
+		_, _ = db.ExecContext(ctx, `INSERT INTO chat_messages (vod_id,username,message,abs_timestamp,rel_timestamp,channel) VALUES ('preview_1',$1,'hi',NOW(),1,$2)`, u, channel)
+	}
+	_, _ = db.ExecContext(ctx, `INSERT INTO kv (channel,key,value) VALUES ($1,'youtube_title_template','{{.Title}} [{{.DurationSeconds}}s, {{.UniqueChatters}} chatters]')
+		ON CONFLICT (channel,key) DO UPDATE SET value=EXCLUDED.value`, channel)
+	t.Setenv("YOUTUBE_TITLE_TEMPLATE", "")
+	md, err := PreviewVideoMetadata(ctx, db, "preview_1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.Title != "Preview [3600s, 2 chatters]" {
+		t.Fatalf("title = %q", md.Title)
+	}
+}
@@ -0,0 +1,311 @@
+package vod
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/onnwee/vod-tender/backend/config"
+	"github.com/onnwee/vod-tender/backend/telemetry"
+)
+
+// Stage is one step of the per-VOD processing pipeline (download, verify, transcode, ...).
+// Stages run in the configured order; the first error stops the pipeline and the
+// successful stages before it are remembered in vod_stage_results so the next attempt
+// resumes at the failed stage.
+type Stage interface {
+	Name() string
+	Run(ctx context.Context, job *Job) error
+}
+
+// Resumable is implemented by stages that need to check whether a previous successful
+// result is still usable (e.g. the downloaded file still exists). Stages without it are
+// skipped whenever they previously succeeded.
+type Resumable interface {
+	Resume(ctx context.Context, job *Job, prev StageResult) bool
+}
+
+// Artifact keys shared between stages.
+const (
+	ArtifactFile       = "file"
+	ArtifactThumbnail  = "thumbnail"
+	ArtifactYouTubeURL = "youtube_url"
+	ArtifactUploaded   = "uploaded" // "true" once every required destination succeeded
+)
+
+// Job carries the state of one VOD through the pipeline.
+type Job struct {
+	Date       time.Time
+	DB         *sql.DB
+	Logger     *slog.Logger
+	Artifacts  map[string]string
+	outputs    map[string]string
+	ID         string
+	Channel    string
+	Title      string
+	DataDir    string
+	SkipUpload bool
+	// Config is the channel's settings for this run.
+	Config config.ChannelConfig
+}
+
+// Set records an artifact produced by the running stage; it is persisted with the stage result.
+func (j *Job) Set(key, value string) {
+	if j.Artifacts == nil {
+		j.Artifacts = map[string]string{}
+	}
+	if j.outputs == nil {
+		j.outputs = map[string]string{}
+	}
+	j.Artifacts[key] = value
+	j.outputs[key] = value
+}
+
+// File returns the current local media path.
+func (j *Job) File() string { return j.Artifacts[ArtifactFile] }
+
+// StageResult is the persisted outcome of a stage for a VOD.
+type StageResult struct {
+	StartedAt  *time.Time        `json:"started_at,omitempty"`
+	FinishedAt *time.Time        `json:"finished_at,omitempty"`
+	Outputs    map[string]string `json:"outputs,omitempty"`
+	Stage      string            `json:"stage"`
+	Status     string            `json:"status"`
+	Error      string            `json:"error,omitempty"`
+	Attempts   int               `json:"attempts"`
+}
+
+// Stage result statuses.
+const (
+	stageRunning   = "running"
+	stageSucceeded = "succeeded"
+	stageFailed    = "failed"
+)
+
+// StageError reports which stage stopped the pipeline.
+type StageError struct {
+	Err   error
+	Stage string
+}
+
+func (e *StageError) Error() string { return e.Stage + ": " + e.Err.Error() }
+func (e *StageError) Unwrap() error { return e.Err }
+
+// DefaultPipeline is used when neither the channel kv key pipeline_stages nor PIPELINE_STAGES is set.
+const DefaultPipeline = "download,upload,cleanup"
+
+var (
+	stagesMu sync.RWMutex
+	stages   = map[string]func() Stage{
+		"download":  func() Stage { return downloadStage{} },
+		"verify":    func() Stage { return verifyStage{} },
+		"transcode": func() Stage { return transcodeStage{} },
+		"thumbnail": func() Stage { return thumbnailStage{} },
+		"upload":    func() Stage { return uploadStage{} },
+		"cleanup":   func() Stage { return cleanupStage{} },
+	}
+)
+
+// RegisterStage makes a custom stage available to pipeline configuration under name.
+// Registering an existing name replaces it.
+func RegisterStage(name string, factory func() Stage) {
+	stagesMu.Lock()
+	defer stagesMu.Unlock()
+	stages[name] = factory
+}
+
+// StageNames returns the registered stage names, sorted.
+func StageNames() []string {
+	stagesMu.RLock()
+	defer stagesMu.RUnlock()
+	out := make([]string, 0, len(stages))
+	for n := range stages {
+		out = append(out, n)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// BuildPipeline resolves a comma-separated stage list. Unknown names are an error;
+// download is always run first because every other stage depends on its file.
+func BuildPipeline(spec string) ([]Stage, error) {
+	stagesMu.RLock()
+	defer stagesMu.RUnlock()
+	out := []Stage{stages["download"]()}
+	seen := map[string]bool{"download": true}
+	for _, raw := range strings.Split(spec, ",") {
+		name := strings.ToLower(strings.TrimSpace(raw))
+		if name == "" || seen[name] {
+			continue
+		}
+		f, ok := stages[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown pipeline stage %q", name)
+		}
+		seen[name] = true
+		out = append(out, f())
+	}
+	return out, nil
+}
+
+// pipelineFor returns the configured stages for a channel: kv pipeline_stages for the
+// channel, then PIPELINE_STAGES, then DefaultPipeline. An invalid configuration falls
+// back to the default so a typo doesn't halt processing.
+func pipelineFor(ctx context.Context, dbc *sql.DB, channel string) []Stage {
+	var spec string
+	_ = dbc.QueryRowContext(ctx, `SELECT value FROM kv WHERE channel=$1 AND key='pipeline_stages'`, channel).Scan(&spec)
+	if strings.TrimSpace(spec) == "" {
+		spec = os.Getenv("PIPELINE_STAGES")
+	}
+	if strings.TrimSpace(spec) == "" {
+		spec = DefaultPipeline
+	}
+	p, err := BuildPipeline(spec)
+	if err != nil {
+		slog.Warn("invalid pipeline configuration; using default", slog.String("channel", channel), slog.String("spec", spec), slog.Any("err", err))
+		p, _ = BuildPipeline(DefaultPipeline)
+	}
+	return p
+}
+
+// runPipeline executes stages in order for job, skipping stages that already succeeded
+// on a previous attempt and persisting each stage's outcome.
+func runPipeline(ctx context.Context, job *Job, pipeline []Stage) error {
+	prev, err := LoadStageResults(ctx, job.DB, job.ID)
+	if err != nil {
+		job.Logger.Warn("failed to load previous stage results; running all stages", slog.Any("err", err))
+		prev = nil
+	}
+	byName := make(map[string]StageResult, len(prev))
+	for _, r := range prev {
+		byName[r.Stage] = r
+	}
+	if job.Artifacts == nil {
+		job.Artifacts = map[string]string{}
+	}
+	for _, st := range pipeline {
+		name := st.Name()
+		if r, ok := byName[name]; ok && r.Status == stageSucceeded {
+			resume := true
+			if rs, ok := st.(Resumable); ok {
+				resume = rs.Resume(ctx, job, r)
+			}
+			if resume {
+				for k, v := range r.Outputs {
+					job.Artifacts[k] = v
+				}
+				job.Logger.Info("stage resumed from previous result", slog.String("stage", name))
+				continue
+			}
+		}
+
+		stageCtx, span := telemetry.StartSpan(ctx, "vod-processing", name, attribute.String("vod.id", job.ID))
+		job.outputs = map[string]string{}
+		recordStageStart(ctx, job.DB, job.ID, name)
+		start := time.Now()
+		err := st.Run(stageCtx, job)
+		dur := time.Since(start)
+		span.SetAttributes(attribute.Int64("stage.duration_ms", dur.Milliseconds()))
+		if telemetry.ProcessingStepDuration != nil {
+			telemetry.ProcessingStepDuration.WithLabelValues(name).Observe(dur.Seconds())
+		}
+		if err != nil {
+			telemetry.RecordError(span, err)
+			span.End()
+			// A canceled run (shutdown, lost lease, user cancel) is not a stage failure;
+			// leave the row as running so the next attempt simply reruns the stage.
+			if ctx.Err() == nil {
+				recordStageEnd(job.DB, job.ID, name, stageFailed, job.outputs, err)
+			}
+			return &StageError{Stage: name, Err: err}
+		}
+		telemetry.SetSpanSuccess(span)
+		span.End()
+		recordStageEnd(job.DB, job.ID, name, stageSucceeded, job.outputs, nil)
+	}
+	return nil
+}
+
+// finishPipeline marks a VOD processed once its pipeline has succeeded. The upload stage
+// normally does this itself; a pipeline configured without it would otherwise leave the
+// VOD unprocessed and pick it up again on every cycle.
+func finishPipeline(ctx context.Context, job *Job) error {
+	res, err := job.DB.ExecContext(ctx, `UPDATE vods SET processed=TRUE, processing_error=NULL, updated_at=NOW()
+		WHERE twitch_vod_id=$1 AND COALESCE(processed, FALSE)=FALSE`, job.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		setStatus(ctx, job.DB, job.Logger, job.ID, StatusSkipped, "pipeline has no upload stage")
+	}
+	return nil
+}
+
+func recordStageStart(ctx context.Context, dbc *sql.DB, vodID, stage string) {
+	_, _ = dbc.ExecContext(ctx, `INSERT INTO vod_stage_results (vod_id, stage, status, attempts, started_at, finished_at, error)
+		VALUES ($1,$2,$3,1,NOW(),NULL,NULL)
+		ON CONFLICT (vod_id, stage) DO UPDATE SET status=EXCLUDED.status, attempts=vod_stage_results.attempts+1, started_at=NOW(), finished_at=NULL, error=NULL`,
+		vodID, stage, stageRunning)
+}
+
+// recordStageEnd uses a background context so a canceled run still records its outcome.
+func recordStageEnd(dbc *sql.DB, vodID, stage, status string, outputs map[string]string, stageErr error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if outputs == nil {
+		outputs = map[string]string{}
+	}
+	b, _ := json.Marshal(outputs)
+	var errText any
+	if stageErr != nil {
+		errText = stageErr.Error()
+	}
+	_, _ = dbc.ExecContext(ctx, `UPDATE vod_stage_results SET status=$3, outputs=$4::jsonb, error=$5, finished_at=NOW() WHERE vod_id=$1 AND stage=$2`,
+		vodID, stage, status, string(b), errText)
+}
+
+// invalidateStage forgets a stage's previous result so it runs again on the next attempt.
+func invalidateStage(ctx context.Context, dbc *sql.DB, vodID, stage string) {
+	_, _ = dbc.ExecContext(ctx, `DELETE FROM vod_stage_results WHERE vod_id=$1 AND stage=$2`, vodID, stage)
+}
+
+// ResetStageResults clears all remembered stage results for a VOD (used by reprocess).
+func ResetStageResults(ctx context.Context, dbc *sql.DB, vodID string) error {
+	_, err := dbc.ExecContext(ctx, `DELETE FROM vod_stage_results WHERE vod_id=$1`, vodID)
+	return err
+}
+
+// LoadStageResults returns the persisted stage results for a VOD in execution order.
+func LoadStageResults(ctx context.Context, dbc *sql.DB, vodID string) ([]StageResult, error) {
+	rows, err := dbc.QueryContext(ctx, `SELECT stage, status, outputs::text, COALESCE(error,''), attempts, started_at, finished_at
+		FROM vod_stage_results WHERE vod_id=$1 ORDER BY started_at ASC NULLS LAST, stage ASC`, vodID)
+	if err != nil {
+		return nil, fmt.Errorf("query stage results: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			slog.Warn("failed to close rows", slog.Any("err", err))
+		}
+	}()
+	out := make([]StageResult, 0)
+	for rows.Next() {
+		var r StageResult
+		var outputs string
+		if err := rows.Scan(&r.Stage, &r.Status, &outputs, &r.Error, &r.Attempts, &r.StartedAt, &r.FinishedAt); err != nil {
+			return nil, err
+		}
+		r.Outputs = map[string]string{}
+		_ = json.Unmarshal([]byte(outputs), &r.Outputs)
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
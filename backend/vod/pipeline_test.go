@@ -0,0 +1,196 @@
+package vod
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/onnwee/vod-tender/backend/config"
+)
+
+func stageNames(p []Stage) []string {
+	out := make([]string, 0, len(p))
+	for _, s := range p {
+		out = append(out, s.Name())
+	}
+	return out
+}
+
+func TestBuildPipeline(t *testing.T) {
+	cases := []struct {
+		spec string
+		want []string
+	}{
+		{DefaultPipeline, []string{"download", "upload", "cleanup"}},
+		{"download,verify,transcode,thumbnail,upload,cleanup", []string{"download", "verify", "transcode", "thumbnail", "upload", "cleanup"}},
+		{" Verify , upload ", []string{"download", "verify", "upload"}}, // download forced first, names normalized
+		{"upload,download,upload", []string{"download", "upload"}},      // duplicates dropped
+		{"", []string{"download"}},
+	}
+	for _, c := range cases {
+		p, err := BuildPipeline(c.spec)
+		if err != nil {
+			t.Fatalf("BuildPipeline(%q): %v", c.spec, err)
+		}
+		got := stageNames(p)
+		if len(got) != len(c.want) {
+			t.Fatalf("BuildPipeline(%q) = %v want %v", c.spec, got, c.want)
+		}
+		for i := range got {
+			if got[i] != c.want[i] {
+				t.Fatalf("BuildPipeline(%q) = %v want %v", c.spec, got, c.want)
+			}
+		}
+	}
+	if _, err := BuildPipeline("download,bogus"); err == nil {
+		t.Fatal("expected error for unknown stage")
+	}
+}
+
+type flakyStage struct {
+	calls *int
+	fails int
+}
+
+func (flakyStage) Name() string { return "test_flaky" }
+
+func (s flakyStage) Run(ctx context.Context, job *Job) error {
+	*s.calls++
+	if *s.calls <= s.fails {
+		return errors.New("flaky failure")
+	}
+	job.Set("flaky", "done")
+	return nil
+}
+
+func TestRegisterStage(t *testing.T) {
+	calls := 0
+	RegisterStage("test_flaky", func() Stage { return flakyStage{calls: &calls} })
+	p, err := BuildPipeline("test_flaky")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := stageNames(p); len(got) != 2 || got[1] != "test_flaky" {
+		t.Fatalf("unexpected pipeline %v", got)
+	}
+}
+
+func TestVerifyMediaRejectsMissingAndEmptyFiles(t *testing.T) {
+	dir := t.TempDir()
+	job := &Job{ID: "verify"}
+	if err := verifyMedia(context.Background(), job, ""); err == nil {
+		t.Fatal("expected error for empty path")
+	}
+	if err := verifyMedia(context.Background(), job, filepath.Join(dir, "missing.mp4")); err == nil {
+		t.Fatal("expected error for missing file")
+	}
+	empty := filepath.Join(dir, "empty.mp4")
+	if err := os.WriteFile(empty, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyMedia(context.Background(), job, empty); err == nil {
+		t.Fatal("expected error for empty file")
+	}
+}
+
+type fileDownloader struct {
+	calls *int
+	dir   string
+}
+
+func (d fileDownloader) Download(ctx context.Context, dbc *sql.DB, id, dataDir string) (string, error) {
+	*d.calls++
+	p := filepath.Join(d.dir, id+".mp4")
+	return p, os.WriteFile(p, []byte("media"), 0o600)
+}
+
+func TestRunPipelineResumesAtFailedStage(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	channel := "pipeline-resume"
+	id := "pipeline_resume_1"
+	t.Cleanup(func() {
+		_, _ = db.Exec(`DELETE FROM vods WHERE channel=$1`, channel)
+	})
+	if _, err := db.ExecContext(ctx, `INSERT INTO vods (channel,twitch_vod_id,title,date,created_at)
+		VALUES ($1,$2,'Pipeline',NOW(),NOW())
+		ON CONFLICT (twitch_vod_id) DO NOTHING`, channel, id); err != nil {
+		t.Fatal(err)
+	}
+	_ = ResetStageResults(ctx, db, id)
+
+	downloads, flaky := 0, 0
+	oldD := downloader
+	downloader = fileDownloader{calls: &downloads, dir: t.TempDir()}
+	defer func() { downloader = oldD }()
+	pipeline := []Stage{downloadStage{}, flakyStage{calls: &flaky, fails: 1}}
+	newJob := func() *Job {
+		return &Job{DB: db, Logger: slog.Default(), ID: id, Channel: channel, Date: time.Now(), Config: config.ChannelConfigFromEnv(channel), DataDir: t.TempDir()}
+	}
+
+	err := runPipeline(ctx, newJob(), pipeline)
+	var serr *StageError
+	if !errors.As(err, &serr) || serr.Stage != "test_flaky" {
+		t.Fatalf("expected test_flaky stage error, got %v", err)
+	}
+
+	job := newJob()
+	if err := runPipeline(ctx, job, pipeline); err != nil {
+		t.Fatalf("second run: %v", err)
+	}
+	if downloads != 1 {
+		t.Fatalf("expected download to be resumed, not rerun; downloads=%d", downloads)
+	}
+	if flaky != 2 {
+		t.Fatalf("expected flaky stage to run twice, ran %d", flaky)
+	}
+	if job.File() == "" {
+		t.Fatal("expected file artifact restored from previous download result")
+	}
+
+	results, err := LoadStageResults(ctx, db, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byStage := map[string]StageResult{}
+	for _, r := range results {
+		byStage[r.Stage] = r
+	}
+	if r := byStage["test_flaky"]; r.Status != stageSucceeded || r.Attempts != 2 || r.Outputs["flaky"] != "done" {
+		t.Fatalf("unexpected flaky stage result %+v", r)
+	}
+	if r := byStage["download"]; r.Status != stageSucceeded || r.Attempts != 1 {
+		t.Fatalf("unexpected download stage result %+v", r)
+	}
+}
+
+func TestFinishPipelineWithoutUpload(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	channel := "pipeline-no-upload"
+	id := "pipeline_no_upload_1"
+	t.Cleanup(func() {
+		_, _ = db.Exec(`DELETE FROM vods WHERE channel=$1`, channel)
+	})
+	if _, err := db.ExecContext(ctx, `INSERT INTO vods (channel,twitch_vod_id,title,date,status,created_at)
+		VALUES ($1,$2,'Pipeline',NOW(),'downloaded',NOW())`, channel, id); err != nil {
+		t.Fatal(err)
+	}
+	job := &Job{DB: db, Logger: slog.Default(), ID: id, Channel: channel}
+	if err := finishPipeline(ctx, job); err != nil {
+		t.Fatal(err)
+	}
+	var processed bool
+	var status string
+	if err := db.QueryRowContext(ctx, `SELECT processed, status FROM vods WHERE twitch_vod_id=$1`, id).Scan(&processed, &status); err != nil {
+		t.Fatal(err)
+	}
+	if !processed || status != string(StatusSkipped) {
+		t.Fatalf("processed=%v status=%s, want processed skipped VOD", processed, status)
+	}
+}
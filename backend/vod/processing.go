@@ -3,17 +3,19 @@ package vod
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log/slog"
-	"math/rand"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"go.opentelemetry.io/otel/attribute"
+	yt "google.golang.org/api/youtube/v3"
 
 	"github.com/onnwee/vod-tender/backend/config"
 	"github.com/onnwee/vod-tender/backend/db"
@@ -38,6 +40,17 @@ func (ytDLPDownloader) Download(ctx context.Context, dbc *sql.DB, id, dataDir st
 	return downloadVOD(ctx, dbc, id, dataDir)
 }
 
+// configuredDownloader picks the implementation per call from DOWNLOADER:
+// "ytdlp" (default) shells out to yt-dlp, "native" uses the built-in HLS downloader.
+type configuredDownloader struct{}
+
+func (configuredDownloader) Download(ctx context.Context, dbc *sql.DB, id, dataDir string) (string, error) {
+	if strings.EqualFold(strings.TrimSpace(os.Getenv("DOWNLOADER")), "native") {
+		return newHLSDownloader().Download(ctx, dbc, id, dataDir)
+	}
+	return ytDLPDownloader{}.Download(ctx, dbc, id, dataDir)
+}
+
 type youtubeUploader struct{}
 
 func (youtubeUploader) Upload(ctx context.Context, dbc *sql.DB, path, title string, date time.Time) (string, error) {
@@ -52,27 +65,43 @@ type vodCustomDescKey struct{}
 type vodIDCtxKey struct{}
 type vodChannelCtxKey struct{}
 
+// channelConfigCtxKey carries the job's ChannelConfig to Downloader and Uploader implementations.
+type channelConfigCtxKey struct{}
+
+// channelConfigFrom returns the ChannelConfig of the job running in ctx, or the
+// environment's settings outside a job.
+func channelConfigFrom(ctx context.Context) config.ChannelConfig {
+	if c, ok := ctx.Value(channelConfigCtxKey{}).(config.ChannelConfig); ok {
+		return c
+	}
+	return config.ChannelConfigFromEnv("")
+}
+
 // configurable for tests
 var (
-	downloader Downloader = ytDLPDownloader{}
+	downloader Downloader = configuredDownloader{}
 	uploader   Uploader   = youtubeUploader{}
 )
 
 // StartVODProcessingJob runs a loop that picks the next unprocessed VOD and processes it.
-// It is safe to run a single instance per process; for multiple workers add distributed coordination.
-// The channel parameter filters VODs to process for a specific Twitch channel.
-func StartVODProcessingJob(ctx context.Context, dbc *sql.DB, channel string) {
-	interval := 1 * time.Minute
-	if s := os.Getenv("VOD_PROCESS_INTERVAL"); s != "" {
-		if d, err := time.ParseDuration(s); err == nil && d > 0 {
-			interval = d
-		}
-	}
+// Multiple instances (across processes or replicas) may run concurrently against the same
+// database: each VOD is claimed under a lease in vod_leases so only one worker processes it.
+// cfg.Channel filters VODs to process for a specific Twitch channel, and cfg supplies its
+// interval, throttling, retry and circuit breaker settings. cfg is re-resolved whenever
+// the runtime config changes (see config.WatchRuntime).
+func StartVODProcessingJob(ctx context.Context, dbc *sql.DB, cfg config.ChannelConfig) {
+	channel := cfg.Channel
+	interval := cfg.ProcessInterval
 	slog.Info("vod processing job starting", slog.Duration("interval", interval), slog.String("channel", channel))
 	// Kick an immediate run so we don't wait a full interval after boot.
-	if err := processOnce(ctx, dbc, channel); err != nil {
+	if err := processOnce(ctx, dbc, cfg); err != nil {
 		slog.Warn("process once", slog.Any("err", err))
 	}
+	wake := make(chan struct{}, 1)
+	processWakers.Store(strings.ToLower(channel), wake)
+	defer processWakers.CompareAndDelete(strings.ToLower(channel), wake)
+	changes, stopWatch := config.WatchRuntime()
+	defer stopWatch()
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 	for {
@@ -80,17 +109,52 @@ func StartVODProcessingJob(ctx context.Context, dbc *sql.DB, channel string) {
 		case <-ctx.Done():
 			slog.Info("vod processing job stopped", slog.String("channel", channel))
 			return
-		case <-ticker.C:
-			if err := processOnce(ctx, dbc, channel); err != nil {
-				slog.Warn("process once", slog.Any("err", err))
+		case <-changes:
+			cfg = reloadChannelConfig(ctx, dbc, channel)
+			if cfg.ProcessInterval != interval {
+				interval = cfg.ProcessInterval
+				ticker.Reset(interval)
+				slog.Info("vod processing interval changed", slog.Duration("interval", interval), slog.String("channel", channel))
 			}
+			continue
+		case <-ticker.C:
+		case <-wake:
+		}
+		if err := processOnce(ctx, dbc, cfg); err != nil {
+			slog.Warn("process once", slog.Any("err", err))
+		}
+	}
+}
+
+// reloadChannelConfig re-resolves channel's settings after a runtime config change.
+// Sources that fail to load are skipped with a warning.
+func reloadChannelConfig(ctx context.Context, dbc *sql.DB, channel string) config.ChannelConfig {
+	cfg, err := config.LoadChannelConfig(ctx, dbc, channel)
+	if err != nil {
+		slog.Warn("channel config reload", slog.Any("err", err), slog.String("channel", channel))
+	}
+	return cfg
+}
+
+// processWakers maps a lowercased channel to the wake channel of its running processing job.
+var processWakers sync.Map
+
+// TriggerProcessing runs the channel's processing cycle (discovery included) now
+// instead of at the next tick, e.g. when a stream has just ended. It is a no-op
+// when no processing job runs for the channel.
+func TriggerProcessing(channel string) {
+	if v, ok := processWakers.Load(strings.ToLower(channel)); ok {
+		select {
+		case v.(chan struct{}) <- struct{}{}:
+		default:
 		}
 	}
 }
 
-// processOnce selects a single pending VOD and processes it.
+// processOnce selects a single pending VOD of cfg.Channel and processes it.
 // It implements a simple circuit breaker to avoid hot-looping on systemic failures.
-func processOnce(ctx context.Context, dbc *sql.DB, channel string) error {
+func processOnce(ctx context.Context, dbc *sql.DB, cfg config.ChannelConfig) error {
+	channel := cfg.Channel
 	ctx, span := telemetry.StartSpan(ctx, "vod-processing", "processOnce")
 	defer span.End()
 
@@ -124,7 +188,7 @@ func processOnce(ctx context.Context, dbc *sql.DB, channel string) error {
 	if err := os.MkdirAll(dataDir, 0o750); err != nil {
 		return fmt.Errorf("mkdir data dir: %w", err)
 	}
-	// Best-effort cleanup: prune stale partial/tmp files to keep /data small
+	// Best-effort cleanup: prune stale partial/tmp files and hls work dirs to keep /data small
 	// Controlled via DATA_CLEANUP_MAX_AGE (default 24h). Set to 0 to disable.
 	maxAge := 24 * time.Hour
 	if s := os.Getenv("DATA_CLEANUP_MAX_AGE"); s != "" {
@@ -133,62 +197,49 @@ func processOnce(ctx context.Context, dbc *sql.DB, channel string) error {
 		}
 	}
 	if maxAge > 0 {
-		now := time.Now()
-		if entries, err := os.ReadDir(dataDir); err == nil {
-			for _, e := range entries {
-				name := e.Name()
-				if strings.HasSuffix(name, ".part") || strings.HasSuffix(name, ".tmp") || strings.Contains(name, ".transcode.tmp.mp4") {
-					if fi, err := e.Info(); err == nil {
-						if now.Sub(fi.ModTime()) > maxAge {
-							_ = os.Remove(filepath.Join(dataDir, name))
-						}
-					}
+		pruneStaleFiles(dataDir, maxAge)
+	}
+
+	// Optional orphan sweeper (ORPHAN_SWEEP=1): prune stale full files not referenced by any VOD
+	// and older than RETAIN_KEEP_NEWER_THAN_DAYS. This helps clean up any leftovers from crashes or
+	// manual copies. The data directory is shared by all channels, so every channel's paths count as active.
+	if cfg.SweepOrphans {
+		cutoff := time.Now().Add(-time.Duration(cfg.BackfillAfterDays) * 24 * time.Hour)
+		// Build a set of active paths from DB
+		active := map[string]struct{}{}
+		rows, err := dbc.QueryContext(ctx, `SELECT downloaded_path FROM vods WHERE downloaded_path IS NOT NULL`)
+		if err == nil {
+			defer func() {
+				if err := rows.Close(); err != nil {
+					slog.Warn("failed to close rows", slog.Any("err", err))
+				}
+			}()
+			for rows.Next() {
+				var p string
+				if err := rows.Scan(&p); err == nil && p != "" {
+					active[p] = struct{}{}
 				}
 			}
 		}
-	}
-
-	// Optional orphan sweeper: prune stale full files not referenced by DB and older than RETAIN_KEEP_NEWER_THAN_DAYS.
-	// This helps clean up any leftovers from crashes or manual copies.
-	if keepDaysStr := os.Getenv("RETAIN_KEEP_NEWER_THAN_DAYS"); keepDaysStr != "" {
-		if keepDays, err := strconv.Atoi(keepDaysStr); err == nil && keepDays >= 0 {
-			cutoff := time.Now().Add(-time.Duration(keepDays) * 24 * time.Hour)
-			// Build a set of active paths from DB
-			active := map[string]struct{}{}
-			rows, err := dbc.QueryContext(ctx, `SELECT downloaded_path FROM vods WHERE channel=$1 AND downloaded_path IS NOT NULL`, channel)
-			if err == nil {
-				defer func() {
-					if err := rows.Close(); err != nil {
-						slog.Warn("failed to close rows", slog.Any("err", err))
-					}
-				}()
-				for rows.Next() {
-					var p string
-					if err := rows.Scan(&p); err == nil && p != "" {
-						active[p] = struct{}{}
-					}
+		if entries, err := os.ReadDir(dataDir); err == nil {
+			for _, e := range entries {
+				if e.IsDir() {
+					continue
 				}
-			}
-			if entries, err := os.ReadDir(dataDir); err == nil {
-				for _, e := range entries {
-					if e.IsDir() {
+				// Only consider video-like files for sweeping
+				name := e.Name()
+				nameLower := strings.ToLower(name)
+				if strings.HasSuffix(nameLower, ".mp4") || strings.HasSuffix(nameLower, ".mkv") || strings.HasSuffix(nameLower, ".webm") {
+					path := filepath.Join(dataDir, name)
+					if _, ok := active[path]; ok {
 						continue
 					}
-					// Only consider video-like files for sweeping
-					name := e.Name()
-					nameLower := strings.ToLower(name)
-					if strings.HasSuffix(nameLower, ".mp4") || strings.HasSuffix(nameLower, ".mkv") || strings.HasSuffix(nameLower, ".webm") {
-						path := filepath.Join(dataDir, name)
-						if _, ok := active[path]; ok {
-							continue
-						}
-						if fi, err := e.Info(); err == nil {
-							if fi.ModTime().Before(cutoff) {
-								if err := os.Remove(path); err == nil {
-									slog.Info("sweeper removed orphaned file", slog.String("path", path))
-								} else {
-									slog.Warn("sweeper failed to remove orphaned file", slog.String("path", path), slog.Any("err", err))
-								}
+					if fi, err := e.Info(); err == nil {
+						if fi.ModTime().Before(cutoff) {
+							if err := os.Remove(path); err == nil {
+								slog.Info("sweeper removed orphaned file", slog.String("path", path))
+							} else {
+								slog.Warn("sweeper failed to remove orphaned file", slog.String("path", path), slog.Any("err", err))
 							}
 						}
 					}
@@ -200,18 +251,18 @@ func processOnce(ctx context.Context, dbc *sql.DB, channel string) error {
 		slog.Warn("discover vods", slog.Any("err", err), slog.String("component", "vod_process"), slog.String("channel", channel))
 		return err
 	}
+	if n, err := enqueueDiscovered(ctx, dbc, channel); err != nil {
+		slog.Warn("enqueue discovered vods", slog.Any("err", err), slog.String("component", "vod_process"), slog.String("channel", channel))
+	} else if n > 0 {
+		slog.Debug("queued discovered vods", slog.Int("count", n), slog.String("component", "vod_process"), slog.String("channel", channel))
+	}
 	// Queue depth (unprocessed VODs)
 	var queueDepth int
 	_ = dbc.QueryRowContext(ctx, `SELECT COUNT(1) FROM vods WHERE channel=$1 AND COALESCE(processed,false)=false`, channel).Scan(&queueDepth)
 	slog.Debug("processing cycle queue depth", slog.Int("queue_depth", queueDepth), slog.String("component", "vod_process"), slog.String("channel", channel))
 	telemetry.SetQueueDepth(queueDepth)
 	// Global upload throttling: hard cap uploads per 24h window (all VODs).
-	uploadDailyLimit := 10
-	if s := os.Getenv("UPLOAD_DAILY_LIMIT"); s != "" {
-		if n, err := strconv.Atoi(s); err == nil && n > 0 {
-			uploadDailyLimit = n
-		}
-	}
+	uploadDailyLimit := cfg.UploadDailyLimit
 	var uploaded24 int
 	_ = dbc.QueryRowContext(ctx, `SELECT COUNT(1) FROM vods WHERE channel=$1 AND youtube_url IS NOT NULL AND updated_at > (NOW() - INTERVAL '24 hours')`, channel).Scan(&uploaded24)
 	if uploaded24 >= uploadDailyLimit {
@@ -221,70 +272,29 @@ func processOnce(ctx context.Context, dbc *sql.DB, channel string) error {
 
 	// Backfill upload throttling: limit back-catalog uploads per 24h window.
 	// Define back-catalog as VODs older than RETAIN_KEEP_NEWER_THAN_DAYS (default 7 days).
-	backfillDays := 7
-	if s := os.Getenv("RETAIN_KEEP_NEWER_THAN_DAYS"); s != "" {
-		if n, err := strconv.Atoi(s); err == nil && n >= 0 {
-			backfillDays = n
-		}
-	}
-	backfillCutoff := time.Now().Add(-time.Duration(backfillDays) * 24 * time.Hour)
-	dailyLimit := 10
-	if s := os.Getenv("BACKFILL_UPLOAD_DAILY_LIMIT"); s != "" {
-		if n, err := strconv.Atoi(s); err == nil && n > 0 {
-			dailyLimit = n
-		}
-	}
+	backfillCutoff := time.Now().Add(-time.Duration(cfg.BackfillAfterDays) * 24 * time.Hour)
+	dailyLimit := cfg.BackfillUploadDailyLimit
 	// Count successful uploads of back-catalog in past 24h
 	var backfillUploaded24 int
 	_ = dbc.QueryRowContext(ctx, `SELECT COUNT(1) FROM vods WHERE channel=$1 AND youtube_url IS NOT NULL AND date < $2 AND updated_at > (NOW() - INTERVAL '24 hours')`, channel, backfillCutoff).Scan(&backfillUploaded24)
 	backfillThrottled := backfillUploaded24 >= dailyLimit
-	maxAttempts := 5
-	if s := os.Getenv("DOWNLOAD_MAX_ATTEMPTS"); s != "" {
-		if n, err := strconv.Atoi(s); err == nil && n > 0 {
-			maxAttempts = n
-		}
-	}
-	cooldown := 600 * time.Second
-	if s := os.Getenv("PROCESSING_RETRY_COOLDOWN"); s != "" {
-		if d, err := time.ParseDuration(s); err == nil && d > 0 {
-			cooldown = d
-		}
-	}
-	// Select a small batch of candidates and pick the first eligible.
-	rows, err := dbc.QueryContext(ctx, `SELECT twitch_vod_id, title, date, COALESCE(skip_upload,FALSE) FROM vods
-		WHERE channel=$1 AND COALESCE(processed,false)=false AND (
-			processing_error IS NULL OR processing_error='' OR (download_retries < $2 AND EXTRACT(EPOCH FROM (NOW() - COALESCE(updated_at, created_at))) >= $3)
-		)
-		ORDER BY priority DESC, date ASC LIMIT 20`, channel, maxAttempts, int(cooldown.Seconds()))
+	maxAttempts := cfg.DownloadMaxAttempts
+	cooldown := cfg.ProcessingRetryCooldown
+	// Claim the next eligible VOD under a lease so concurrent workers (other replicas)
+	// never process the same item; back-catalog is excluded while throttled.
+	owner := WorkerID()
+	ttl := leaseTTL()
+	claimed, err := claimNextVOD(ctx, dbc, owner, ttl, claimFilter{
+		channel:           channel,
+		maxAttempts:       maxAttempts,
+		cooldown:          cooldown,
+		backfillThrottled: backfillThrottled,
+		backfillCutoff:    backfillCutoff,
+	})
 	if err != nil {
 		return err
 	}
-	defer func() {
-		if err := rows.Close(); err != nil {
-			slog.Warn("failed to close rows", slog.Any("err", err))
-		}
-	}()
-	var id, title string
-	var date time.Time
-	var skipUpload bool
-	picked := false
-	for rows.Next() {
-		var cid, ctitle string
-		var cdate time.Time
-		var cskipUpload bool
-		if err := rows.Scan(&cid, &ctitle, &cdate, &cskipUpload); err != nil {
-			return err
-		}
-		isBackfill := cdate.Before(backfillCutoff)
-		if backfillThrottled && isBackfill {
-			// Skip back-catalog while throttled; continue searching for a newer (non-backfill) item.
-			continue
-		}
-		id, title, date, skipUpload = cid, ctitle, cdate, cskipUpload
-		picked = true
-		break
-	}
-	if !picked {
+	if claimed == nil {
 		if backfillThrottled {
 			slog.Info("backfill upload throttled for 24h window; no eligible non-backfill items", slog.Int("uploaded24h", backfillUploaded24), slog.Int("limit", dailyLimit))
 		} else {
@@ -292,6 +302,9 @@ func processOnce(ctx context.Context, dbc *sql.DB, channel string) error {
 		}
 		return nil
 	}
+	id, title, date, skipUpload := claimed.ID, claimed.Title, claimed.Date, claimed.SkipUpload
+	lease, ctx := startLease(ctx, dbc, id, owner, ttl)
+	defer lease.release()
 
 	// Add span attributes for selected VOD
 	span.SetAttributes(
@@ -301,11 +314,12 @@ func processOnce(ctx context.Context, dbc *sql.DB, channel string) error {
 		attribute.Int("queue_depth", queueDepth),
 	)
 
-	logger := slog.Default().With(slog.String("vod_id", id), slog.String("component", "vod_process"))
+	logger := slog.Default().With(slog.String("vod_id", id), slog.String("component", "vod_process"), slog.String("worker_id", owner))
 	if corr := ctx.Value(struct{ string }{"corr"}); corr != nil {
 		logger = logger.With(slog.Any("corr", corr))
 	}
 	logger.Info("processing candidate selected", slog.String("title", title), slog.Time("date", date), slog.Int("queue_depth", queueDepth))
+	setStatus(ctx, dbc, logger, id, StatusDownloading, "claimed by "+owner)
 
 	// Metrics
 	telemetry.ProcessingCycles.Inc()
@@ -326,219 +340,90 @@ func processOnce(ctx context.Context, dbc *sql.DB, channel string) error {
 	defer releaseDownloadSlot()
 	logger.Debug("download slot acquired", slog.Int("active_downloads", GetActiveDownloads()))
 
-	// Download with span
-	dlStart := time.Now()
-	ctx, downloadSpan := telemetry.StartSpan(ctx, "vod-processing", "download",
-		attribute.String("vod.id", id),
-		attribute.String("vod.title", title),
-	)
-	filePath, err := downloader.Download(ctx, dbc, id, dataDir)
-	dlDur := time.Since(dlStart)
-	downloadSpan.SetAttributes(attribute.Int64("download.duration_ms", dlDur.Milliseconds()))
-
-	if err != nil {
-		telemetry.RecordError(downloadSpan, err)
-		downloadSpan.End()
-
-		// Check if download was canceled (user-initiated or timeout)
+	job := &Job{
+		DB:         dbc,
+		Logger:     logger,
+		ID:         id,
+		Channel:    channel,
+		Title:      title,
+		Date:       date,
+		DataDir:    dataDir,
+		SkipUpload: skipUpload,
+		Config:     cfg,
+	}
+	pipeline := pipelineFor(ctx, dbc, channel)
+	if err := runPipeline(ctx, job, pipeline); err != nil {
+		// Check if processing was canceled (shutdown or lost lease)
 		if ctx.Err() != nil {
-			logger.Info("download canceled", slog.Any("reason", ctx.Err()))
+			logger.Info("processing canceled", slog.Any("reason", ctx.Err()))
 			// Don't treat cancellation as a failure or trip circuit breaker
 			return nil
 		}
-
-		lower := strings.ToLower(err.Error())
-		// Expected/auth-required: skip retries and do not trip circuit
-		if strings.Contains(lower, "subscriber-only") || strings.Contains(lower, "must be logged into") || strings.Contains(lower, "login required") {
-			logger.Warn("skipping vod: auth required (subscriber-only)")
-			// Mark non-retriable by setting retries to maxAttempts
-			_, _ = dbc.ExecContext(ctx, `UPDATE vods SET processing_error=$1, download_retries=$2, updated_at=NOW() WHERE twitch_vod_id=$3`, "auth-required: subscriber-only", maxAttempts, id)
-			return nil
-		}
-		// Otherwise count as a failure and trip the circuit
-		logger.Error("download failed", slog.Any("err", err), slog.Duration("download_duration", dlDur), slog.Int("queue_depth", queueDepth))
-		telemetry.DownloadsFailed.Inc()
-		_, _ = dbc.ExecContext(ctx, `UPDATE vods SET processing_error=$1, updated_at=NOW() WHERE twitch_vod_id=$2`, err.Error(), id)
-		updateCircuitOnFailure(ctx, dbc, channel)
-		telemetry.UpdateCircuitGauge(true)
+		handleStageFailure(ctx, dbc, logger, cfg, id, maxAttempts, queueDepth, err)
 		return nil
 	}
-
-	telemetry.SetSpanSuccess(downloadSpan)
-	downloadSpan.SetAttributes(attribute.String("download.path", filePath))
-	downloadSpan.End()
-
-	telemetry.DownloadsSucceeded.Inc()
-	telemetry.DownloadDuration.Observe(dlDur.Seconds())
-	logger.Info("download complete", slog.String("path", filePath), slog.Duration("download_duration", dlDur))
-	resetCircuit(ctx, dbc, channel)
-	_, _ = dbc.ExecContext(ctx, `UPDATE vods SET downloaded_path=$1, updated_at=NOW() WHERE twitch_vod_id=$2`, filePath, id)
-	// Upload policy guardrails + idempotency checks.
-	var preYT string
-	_ = dbc.QueryRowContext(ctx, `SELECT COALESCE(youtube_url,'' ) FROM vods WHERE twitch_vod_id=$1`, id).Scan(&preYT)
-	uplCfg, _ := config.Load()
-	uploadOwnershipValid := uplCfg.YouTubeUploadOwnership == "self" || uplCfg.YouTubeUploadOwnership == "authorized"
-	var ytURL string
-	var upDur time.Duration
-	if preYT != "" {
-		ytURL = preYT
-		slog.Info("skipping upload; youtube_url already present", slog.String("youtube_url", ytURL))
-		// Ensure processed is marked; we'll still perform post-success cleanup below.
-		_, _ = dbc.ExecContext(ctx, `UPDATE vods SET processed=TRUE, processing_error=NULL, updated_at=NOW() WHERE twitch_vod_id=$1`, id)
-	} else if skipUpload {
-		logger.Info("skipping upload; skip_upload=true for vod")
-		_, _ = dbc.ExecContext(ctx, `UPDATE vods SET processed=TRUE, processing_error=NULL, updated_at=NOW() WHERE twitch_vod_id=$1`, id)
-	} else if !uplCfg.YouTubeUploadEnabled {
-		logger.Info("skipping upload; YOUTUBE_UPLOAD_ENABLED is not set")
-		_, _ = dbc.ExecContext(ctx, `UPDATE vods SET processed=TRUE, processing_error=NULL, updated_at=NOW() WHERE twitch_vod_id=$1`, id)
-	} else if !uploadOwnershipValid {
-		logger.Warn("skipping upload; YOUTUBE_UPLOAD_OWNERSHIP must be self|authorized when uploads are enabled", slog.String("ownership", uplCfg.YouTubeUploadOwnership))
-		_, _ = dbc.ExecContext(ctx, `UPDATE vods SET processed=TRUE, processing_error=NULL, updated_at=NOW() WHERE twitch_vod_id=$1`, id)
-	} else {
-		// Retry loop with exponential backoff + jitter for uploads
-		maxUp := 5
-		if s := os.Getenv("UPLOAD_MAX_ATTEMPTS"); s != "" {
-			if n, err := strconv.Atoi(s); err == nil && n > 0 {
-				maxUp = n
-			}
-		}
-		base := 2 * time.Second
-		if s := os.Getenv("UPLOAD_BACKOFF_BASE"); s != "" {
-			if d, err := time.ParseDuration(s); err == nil && d > 0 {
-				base = d
-			}
-		}
-		var lastErr error
-		// Load any custom description set by user
-		var customDesc string
-		_ = dbc.QueryRowContext(ctx, `SELECT COALESCE(description,'') FROM vods WHERE twitch_vod_id=$1`, id).Scan(&customDesc)
-
-		// Start upload span
-		uploadCtx, uploadSpan := telemetry.StartSpan(ctx, "vod-processing", "upload",
-			attribute.String("vod.id", id),
-			attribute.String("vod.title", title),
-			attribute.String("upload.path", filePath),
-		)
-		uploadCtx = context.WithValue(uploadCtx, vodIDCtxKey{}, id)
-		uploadCtx = context.WithValue(uploadCtx, vodChannelCtxKey{}, channel)
-
-		for attempt := 0; attempt < maxUp; attempt++ {
-			if attempt > 0 {
-				backoff := base * time.Duration(1<<attempt)
-				//nolint:gosec // G404: math/rand is sufficient for exponential backoff jitter, not used for security
-				jitter := time.Duration(rand.Int63n(int64(base)))
-				backoff += jitter
-				logger.Warn("retrying upload", slog.Int("attempt", attempt), slog.Int("max", maxUp), slog.Duration("backoff", backoff))
-				time.Sleep(backoff)
-			}
-			upStart := time.Now()
-			// Temporarily override description if custom provided via context key
-			if customDesc != "" {
-				uploadCtx = context.WithValue(uploadCtx, vodCustomDescKey{}, customDesc)
-			}
-			url, err := uploader.Upload(uploadCtx, dbc, filePath, title, date)
-			if err == nil {
-				upDur = time.Since(upStart)
-				ytURL = url
-				break
-			}
-			lastErr = err
-			// Non-retriable: invalid title
-			el := strings.ToLower(err.Error())
-			if strings.Contains(el, "invalidtitle") || strings.Contains(el, "invalid or empty video title") {
-				logger.Error("non-retriable upload error: invalid title", slog.Any("err", err))
-				break
-			}
-			// If context canceled, abort early
-			if uploadCtx.Err() != nil {
-				break
-			}
-		}
-
-		uploadSpan.SetAttributes(attribute.Int64("upload.duration_ms", upDur.Milliseconds()))
-
-		if ytURL == "" {
-			// Exhausted attempts; persist error and increment retries so global cooldown/limit logic applies
-			logger.Error("upload exhausted retries", slog.Any("err", lastErr))
-			telemetry.RecordError(uploadSpan, lastErr)
-			uploadSpan.End()
-
-			_, _ = dbc.ExecContext(ctx, `UPDATE vods SET processing_error=$1, download_retries = COALESCE(download_retries,0)+1, updated_at=NOW() WHERE twitch_vod_id=$2`,
-				fmt.Sprintf("upload: %v", lastErr), id)
-			telemetry.UploadsFailed.Inc()
-			return nil
-		}
-
-		telemetry.SetSpanSuccess(uploadSpan)
-		uploadSpan.SetAttributes(attribute.String("upload.youtube_url", ytURL))
-		uploadSpan.End()
-
-		// Record YouTube URL and mark processed now
-		_, _ = dbc.ExecContext(ctx, `UPDATE vods SET youtube_url=$1, processed=TRUE, processing_error=NULL, updated_at=NOW() WHERE twitch_vod_id=$2`, ytURL, id)
+	if err := finishPipeline(ctx, job); err != nil {
+		logger.Error("failed to mark vod processed", slog.Any("err", err))
 	}
 
-	// Clean up local file after successful upload (both backfill and new items)
-	// Retention and optimization policy
-	// BACKFILL_AUTOCLEAN: if not "0", delete local file for older VODs (back catalog) — legacy behavior
-	// RETAIN_KEEP_NEWER_THAN_DAYS: window to consider a VOD "new" (default 7)
-	keepDays := 7
-	if s := os.Getenv("RETAIN_KEEP_NEWER_THAN_DAYS"); s != "" {
-		if n, err := strconv.Atoi(s); err == nil && n >= 0 {
-			keepDays = n
-		}
-	}
-	backfillAutoclean := os.Getenv("BACKFILL_AUTOCLEAN") != "0" // default on
-	cutoff := time.Now().Add(-time.Duration(keepDays) * 24 * time.Hour)
-	isBackfill := date.Before(cutoff)
-	// New behavior: always try to remove local file after successful upload to save disk, while keeping legacy backfill flag for logs
-	if ytURL != "" && filePath != "" {
-		if err := os.Remove(filePath); err != nil {
-			logger.Warn("delete local file failed", slog.String("path", filePath), slog.Any("err", err))
-		} else {
-			if isBackfill && backfillAutoclean {
-				logger.Info("autoclean removed local file", slog.String("path", filePath))
-			} else {
-				logger.Info("removed local file after upload", slog.String("path", filePath))
-			}
-			_, _ = dbc.ExecContext(ctx, `UPDATE vods SET downloaded_path=NULL, updated_at=NOW() WHERE twitch_vod_id=$1`, id)
-		}
-	}
-	// If we performed an upload in this run, we have upDur set; otherwise it may be zero for idempotent path
 	totalDur := time.Since(procStart)
-	if upDur > 0 {
-		telemetry.UploadsSucceeded.Inc()
-		telemetry.UploadDuration.Observe(upDur.Seconds())
-		if telemetry.ProcessingStepDuration != nil {
-			telemetry.ProcessingStepDuration.WithLabelValues("upload").Observe(upDur.Seconds())
-		}
-	}
 	telemetry.TotalProcessDuration.Observe(totalDur.Seconds())
 	if telemetry.ProcessingStepDuration != nil {
-		telemetry.ProcessingStepDuration.WithLabelValues("download").Observe(dlDur.Seconds())
 		telemetry.ProcessingStepDuration.WithLabelValues("total").Observe(totalDur.Seconds())
 	}
-
-	updateMovingAvg(ctx, dbc, channel, "avg_download_ms", float64(dlDur.Milliseconds()))
-	if upDur > 0 {
-		updateMovingAvg(ctx, dbc, channel, "avg_upload_ms", float64(upDur.Milliseconds()))
-	}
 	updateMovingAvg(ctx, dbc, channel, "avg_total_ms", float64(totalDur.Milliseconds()))
 
-	// Set final span attributes
+	ytURL := job.Artifacts[ArtifactYouTubeURL]
 	span.SetAttributes(
-		attribute.Int64("download.duration_ms", dlDur.Milliseconds()),
-		attribute.Int64("upload.duration_ms", upDur.Milliseconds()),
 		attribute.Int64("total.duration_ms", totalDur.Milliseconds()),
 		attribute.String("youtube_url", ytURL),
 	)
 	telemetry.SetSpanSuccess(span)
 
-	logger.Info("processed vod", slog.String("youtube_url", ytURL), slog.Duration("download_duration", dlDur), slog.Duration("upload_duration", upDur), slog.Duration("total_duration", totalDur), slog.Int("queue_depth", queueDepth-1))
+	logger.Info("processed vod", slog.String("youtube_url", ytURL), slog.Duration("total_duration", totalDur), slog.Int("queue_depth", queueDepth-1))
 	telemetry.SetQueueDepth(queueDepth - 1)
 	telemetry.UpdateCircuitGauge(false)
 	return nil
 }
 
+// handleStageFailure records a pipeline failure on the VOD. Download failures keep their
+// historical semantics (auth-required VODs stop retrying, other errors trip the circuit
+// breaker); failures in later stages count against the VOD's retry budget.
+func handleStageFailure(ctx context.Context, dbc *sql.DB, logger *slog.Logger, cfg config.ChannelConfig, id string, maxAttempts, queueDepth int, err error) {
+	stage := "pipeline"
+	var serr *StageError
+	if errors.As(err, &serr) {
+		stage = serr.Stage
+	}
+	if stage == "download" {
+		lower := strings.ToLower(err.Error())
+		// Expected/auth-required: skip retries and do not trip circuit
+		if strings.Contains(lower, "subscriber-only") || strings.Contains(lower, "must be logged into") || strings.Contains(lower, "login required") {
+			logger.Warn("skipping vod: auth required (subscriber-only)")
+			// Mark non-retriable by setting retries to maxAttempts
+			_, _ = dbc.ExecContext(ctx, `UPDATE vods SET processing_error=$1, download_retries=$2, updated_at=NOW() WHERE twitch_vod_id=$3`, "auth-required: subscriber-only", maxAttempts, id)
+			setStatus(ctx, dbc, logger, id, StatusFailed, "auth-required: subscriber-only")
+			return
+		}
+		// Otherwise count as a failure and trip the circuit
+		logger.Error("download failed", slog.Any("err", serr.Err), slog.Int("queue_depth", queueDepth))
+		telemetry.DownloadsFailed.Inc()
+		_, _ = dbc.ExecContext(ctx, `UPDATE vods SET processing_error=$1, updated_at=NOW() WHERE twitch_vod_id=$2`, serr.Err.Error(), id)
+		setStatus(ctx, dbc, logger, id, StatusFailed, err.Error())
+		updateCircuitOnFailure(ctx, dbc, cfg)
+		telemetry.UpdateCircuitGauge(true)
+		return
+	}
+	// Persist error and increment retries so global cooldown/limit logic applies
+	logger.Error("processing stage failed", slog.String("stage", stage), slog.Any("err", err))
+	if stage == "upload" {
+		telemetry.UploadsFailed.Inc()
+	}
+	_, _ = dbc.ExecContext(ctx, `UPDATE vods SET processing_error=$1, download_retries = COALESCE(download_retries,0)+1, updated_at=NOW() WHERE twitch_vod_id=$2`,
+		err.Error(), id)
+	setStatus(ctx, dbc, logger, id, StatusFailed, err.Error())
+}
+
 // updateMovingAvg maintains a simple exponential moving average (EMA) stored in kv.
 // alpha = 0.2 (new contributes 20%). Values stored as integer milliseconds.
 func updateMovingAvg(ctx context.Context, db *sql.DB, channel, key string, newVal float64) {
@@ -559,69 +444,83 @@ func updateMovingAvg(ctx context.Context, db *sql.DB, channel, key string, newVa
 		ON CONFLICT(channel,key) DO UPDATE SET value=EXCLUDED.value, updated_at=NOW()`, channel, key, fmt.Sprintf("%.0f", ema))
 }
 
-// uploadToYouTube uploads the given video file using stored OAuth token.
+// uploadToYouTube uploads the given video file to the VOD channel's YouTube account,
+// or the default account when the channel has not authorized its own.
 func uploadToYouTube(ctx context.Context, dbc *sql.DB, path, title string, date time.Time) (string, error) {
-	ts := &db.TokenStoreAdapter{DB: dbc}
-	cfg, _ := config.Load()
-	yts := youtubeapi.New(cfg, ts)
-	svc, err := yts.Client(ctx)
-	if err != nil {
-		return "", fmt.Errorf("youtube client: %w", err)
-	}
-	datePrefix := date.Format("2006-01-02")
-	// Sanitize and validate title: non-empty, trimmed, max 100 chars, no control chars
-	t := strings.TrimSpace(title)
-	if t == "" {
-		t = "Twitch VOD"
-	}
-	// Remove control characters
-	clean := make([]rune, 0, len(t))
-	for _, r := range t {
-		if r == '\n' || r == '\r' || r == '\t' {
-			continue
-		}
-		if r < 0x20 {
-			continue
-		}
-		clean = append(clean, r)
-	}
-	t = string(clean)
-	finalTitle := fmt.Sprintf("%s %s", datePrefix, t)
-	if len([]rune(finalTitle)) > 100 {
-		runes := []rune(finalTitle)
-		finalTitle = string(runes[:97]) + "..."
-	}
-	vodID := ""
+	data := VideoTemplateData{Title: title, Date: date}
 	if v := ctx.Value(vodIDCtxKey{}); v != nil {
 		if s, ok := v.(string); ok {
-			vodID = strings.TrimSpace(s)
+			data.ID = strings.TrimSpace(s)
 		}
 	}
-	channel := ""
 	if v := ctx.Value(vodChannelCtxKey{}); v != nil {
 		if s, ok := v.(string); ok {
-			channel = strings.TrimSpace(s)
+			data.Channel = strings.TrimSpace(s)
 		}
 	}
-
-	metaLines := []string{fmt.Sprintf("Original stream date: %s", date.Format(time.RFC3339))}
-	if channel != "" {
-		metaLines = append(metaLines, fmt.Sprintf("Attribution: Original Twitch channel %q", channel))
-	}
-	if vodID != "" {
-		metaLines = append(metaLines,
-			fmt.Sprintf("Original Twitch VOD ID: %s", vodID),
-			fmt.Sprintf("Original Twitch URL: https://www.twitch.tv/videos/%s", vodID),
-		)
+	account, err := db.ResolveOAuthChannel(ctx, dbc, "youtube", data.Channel)
+	if err != nil {
+		return "", fmt.Errorf("resolve youtube account: %w", err)
 	}
-
-	// Use custom description if provided in context (set by processOnce), while preserving attribution metadata.
-	description := strings.Join(metaLines, "\n")
+	cfg, _ := config.Load()
+	yts := youtubeapi.New(cfg, &db.TokenStoreAdapter{DB: dbc, Channel: account})
+	// Custom description set via the API (passed by the upload stage); templates decide where it goes.
 	if v := ctx.Value(vodCustomDescKey{}); v != nil {
-		if s, ok := v.(string); ok && strings.TrimSpace(s) != "" {
-			description = strings.TrimSpace(s) + "\n\n" + strings.Join(metaLines, "\n")
+		if s, ok := v.(string); ok {
+			data.Description = strings.TrimSpace(s)
 		}
 	}
-	return youtubeapi.UploadVideo(ctx, svc, path, finalTitle, description, "private")
+	fillVideoStats(ctx, dbc, &data)
+	var sessions youtubeapi.SessionStore = &uploadSessionStore{db: dbc, vodID: data.ID, destination: DestinationYouTube}
+	// One part of a split VOD (set by uploadParts): own title/chapters and resumable session.
+	if su, ok := ctx.Value(vodSegmentCtxKey{}).(segmentUpload); ok {
+		fillPartData(ctx, dbc, &data, su)
+		sessions = &segmentSessionStore{db: dbc, segID: su.seg.ID}
+	}
+	md, err := renderVideoMetadata(ctx, dbc, data)
+	if err != nil {
+		return "", fmt.Errorf("youtube metadata: %w", err)
+	}
+	up, err := yts.NewResumableUploader(ctx, sessions)
+	if err != nil {
+		return "", fmt.Errorf("youtube client: %w", err)
+	}
+	video := &yt.Video{
+		Snippet: &yt.VideoSnippet{Title: md.Title, Description: md.Description, Tags: md.Tags, CategoryId: md.CategoryID},
+		Status:  &yt.VideoStatus{PrivacyStatus: md.Privacy},
+	}
+	url, err := up.Upload(ctx, path, video)
+	if err != nil {
+		return "", err
+	}
+	attachChatCaptions(ctx, dbc, yts, data, url)
+	return url, nil
 }
 
+// pruneStaleFiles removes partial and temporary files in dataDir, and the work directories
+// of native downloads (twitch_<id>.hls, left by crashes), that are older than maxAge.
+func pruneStaleFiles(dataDir string, maxAge time.Duration) {
+	now := time.Now()
+	if entries, err := os.ReadDir(dataDir); err == nil {
+		for _, e := range entries {
+			name := e.Name()
+			if e.IsDir() && strings.HasSuffix(name, ".hls") {
+				// Each finished segment is renamed into the directory, so its mtime
+				// stays fresh while a download is making progress.
+				if fi, err := e.Info(); err == nil && now.Sub(fi.ModTime()) > maxAge {
+					if err := os.RemoveAll(filepath.Join(dataDir, name)); err == nil {
+						slog.Info("removed stale hls work dir", slog.String("path", filepath.Join(dataDir, name)))
+					}
+				}
+				continue
+			}
+			if strings.HasSuffix(name, ".part") || strings.HasSuffix(name, ".tmp") || strings.Contains(name, ".transcode.tmp.mp4") {
+				if fi, err := e.Info(); err == nil {
+					if now.Sub(fi.ModTime()) > maxAge {
+						_ = os.Remove(filepath.Join(dataDir, name))
+					}
+				}
+			}
+		}
+	}
+}
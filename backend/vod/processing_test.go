@@ -5,10 +5,12 @@ import (
 	"database/sql"
 	"errors"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/onnwee/vod-tender/backend/config"
 	dbpkg "github.com/onnwee/vod-tender/backend/db"
 )
 
@@ -89,7 +91,7 @@ func TestProcessOnceHappyPath(t *testing.T) {
 	defer func() { downloader, uploader = oldD, oldU }()
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
-	if err := processOnce(ctx, db, channel); err != nil {
+	if err := processOnce(ctx, db, config.ChannelConfigFromEnv(channel)); err != nil {
 		t.Fatal(err)
 	}
 	var processed bool
@@ -133,7 +135,7 @@ func TestProcessOnceUploadDisabledSkipsUpload(t *testing.T) {
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
-	if err := processOnce(ctx, db, channel); err != nil {
+	if err := processOnce(ctx, db, config.ChannelConfigFromEnv(channel)); err != nil {
 		t.Fatal(err)
 	}
 
@@ -188,7 +190,7 @@ func TestProcessOnceSkipUploadFlag(t *testing.T) {
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
-	if err := processOnce(ctx, db, channel); err != nil {
+	if err := processOnce(ctx, db, config.ChannelConfigFromEnv(channel)); err != nil {
 		t.Fatal(err)
 	}
 
@@ -235,7 +237,7 @@ func TestProcessOnceDownloadFail(t *testing.T) {
 	defer func() { downloader, uploader = oldD, oldU }()
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
-	if err := processOnce(ctx, db, channel); err != nil {
+	if err := processOnce(ctx, db, config.ChannelConfigFromEnv(channel)); err != nil {
 		t.Fatal(err)
 	}
 	var perr string
@@ -265,18 +267,18 @@ func TestCircuitBreakerTransitions(t *testing.T) {
 	t.Setenv("CIRCUIT_FAILURE_THRESHOLD", "2")
 	ctx := context.Background()
 	channel := ""
-	updateCircuitOnFailure(ctx, db, channel)
+	updateCircuitOnFailure(ctx, db, config.ChannelConfigFromEnv(channel))
 	var v string
 	_ = db.QueryRowContext(context.Background(), `SELECT value FROM kv WHERE channel=$1 AND key='circuit_failures'`, channel).Scan(&v)
 	if v != "1" {
 		t.Fatalf("expected failures=1 got %s", v)
 	}
-	updateCircuitOnFailure(ctx, db, channel)
+	updateCircuitOnFailure(ctx, db, config.ChannelConfigFromEnv(channel))
 	_ = db.QueryRowContext(context.Background(), `SELECT value FROM kv WHERE channel=$1 AND key='circuit_state'`, channel).Scan(&v)
 	if v != "open" {
 		t.Fatalf("expected state open got %s", v)
 	}
-	resetCircuit(ctx, db, channel)
+	resetCircuit(ctx, db, config.ChannelConfigFromEnv(channel))
 	_ = db.QueryRowContext(context.Background(), `SELECT value FROM kv WHERE channel=$1 AND key='circuit_state'`, channel).Scan(&v)
 	if v != "closed" {
 		t.Fatalf("expected state closed got %s", v)
@@ -308,7 +310,7 @@ func TestCircuitBreakerHalfOpenSuccess(t *testing.T) {
 		ON CONFLICT(channel,key) DO UPDATE SET value=EXCLUDED.value, updated_at=NOW()`, channel)
 
 	// Success in half-open should close the circuit
-	resetCircuit(ctx, db, channel)
+	resetCircuit(ctx, db, config.ChannelConfigFromEnv(channel))
 
 	var state string
 	_ = db.QueryRowContext(ctx, `SELECT value FROM kv WHERE channel=$1 AND key='circuit_state'`, channel).Scan(&state)
@@ -350,7 +352,7 @@ func TestCircuitBreakerHalfOpenFailure(t *testing.T) {
 		ON CONFLICT(channel,key) DO UPDATE SET value=EXCLUDED.value, updated_at=NOW()`, channel)
 
 	// Failure in half-open should reopen the circuit immediately
-	updateCircuitOnFailure(ctx, db, channel)
+	updateCircuitOnFailure(ctx, db, config.ChannelConfigFromEnv(channel))
 
 	var state string
 	_ = db.QueryRowContext(ctx, `SELECT value FROM kv WHERE channel=$1 AND key='circuit_state'`, channel).Scan(&state)
@@ -406,7 +408,7 @@ func TestUploadDailyLimitCapStopsProcessing(t *testing.T) {
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
-	if err := processOnce(ctx, db, channel); err != nil {
+	if err := processOnce(ctx, db, config.ChannelConfigFromEnv(channel)); err != nil {
 		t.Fatal(err)
 	}
 
@@ -422,3 +424,30 @@ func TestUploadDailyLimitCapStopsProcessing(t *testing.T) {
 		t.Fatalf("expected downloader not to be called when cap reached; called=%d", called)
 	}
 }
+
+func TestPruneStaleFiles(t *testing.T) {
+	dir := t.TempDir()
+	old := time.Now().Add(-48 * time.Hour)
+	for _, name := range []string{"stale.part", "twitch_1.hls/seg_000000.ts", "twitch_2.hls/seg_000000.ts", "twitch_3.mp4", "fresh.part"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("x"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"stale.part", "twitch_1.hls", "twitch_3.mp4"} {
+		if err := os.Chtimes(filepath.Join(dir, name), old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pruneStaleFiles(dir, 24*time.Hour)
+
+	for name, kept := range map[string]bool{"stale.part": false, "twitch_1.hls": false, "twitch_2.hls": true, "twitch_3.mp4": true, "fresh.part": true} {
+		if _, err := os.Stat(filepath.Join(dir, name)); (err == nil) != kept {
+			t.Errorf("%s: kept=%v, want %v", name, err == nil, kept)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package vod
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"strings"
+	"time"
+)
+
+// progressPrefix marks yt-dlp progress lines emitted by ytdlpProgressTemplate.
+const progressPrefix = "[vodtender-progress] "
+
+// ytdlpProgressTemplate asks yt-dlp to print its progress dict as one JSON object per line.
+const ytdlpProgressTemplate = "download:" + progressPrefix + "%(progress)j"
+
+// downloadProgressState is the download_state value while bytes are being transferred.
+const downloadProgressState = "downloading"
+
+// downloadProgress is a typed progress sample. Unknown values are nil.
+type downloadProgress struct {
+	Total         *int64
+	Speed         *float64 // bytes per second
+	ETA           *int     // seconds
+	FragmentIndex *int
+	FragmentCount *int
+	Status        string
+	Downloaded    int64
+}
+
+// parseProgressLine decodes a progress template line; ok is false for any other output.
+func parseProgressLine(line string) (downloadProgress, bool) {
+	i := strings.Index(line, progressPrefix)
+	if i < 0 {
+		return downloadProgress{}, false
+	}
+	var raw struct {
+		Status             string   `json:"status"`
+		DownloadedBytes    *float64 `json:"downloaded_bytes"`
+		TotalBytes         *float64 `json:"total_bytes"`
+		TotalBytesEstimate *float64 `json:"total_bytes_estimate"`
+		Speed              *float64 `json:"speed"`
+		ETA                *float64 `json:"eta"`
+		FragmentIndex      *float64 `json:"fragment_index"`
+		FragmentCount      *float64 `json:"fragment_count"`
+	}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(line[i+len(progressPrefix):])), &raw); err != nil {
+		return downloadProgress{}, false
+	}
+	p := downloadProgress{Status: raw.Status}
+	if raw.DownloadedBytes != nil {
+		p.Downloaded = int64(*raw.DownloadedBytes)
+	}
+	switch {
+	case raw.TotalBytes != nil && *raw.TotalBytes > 0:
+		p.Total = int64Ptr(int64(*raw.TotalBytes))
+	case raw.TotalBytesEstimate != nil && *raw.TotalBytesEstimate > 0:
+		p.Total = int64Ptr(int64(*raw.TotalBytesEstimate))
+	}
+	p.Speed = raw.Speed
+	p.ETA = floatIntPtr(raw.ETA)
+	p.FragmentIndex = floatIntPtr(raw.FragmentIndex)
+	p.FragmentCount = floatIntPtr(raw.FragmentCount)
+	return p, true
+}
+
+// writeProgress stores a progress sample in the typed vods columns.
+func writeProgress(ctx context.Context, dbc *sql.DB, id string, p downloadProgress) {
+	if dbc == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	_, _ = dbc.ExecContext(ctx, `UPDATE vods SET download_state=$1, download_bytes=$2, download_total=COALESCE($3, download_total),
+		download_speed=$4, download_eta_seconds=$5, download_fragment_index=$6, download_fragment_count=$7, progress_updated_at=NOW()
+		WHERE twitch_vod_id=$8`,
+		downloadProgressState, p.Downloaded, p.Total, p.Speed, p.ETA, p.FragmentIndex, p.FragmentCount, id)
+}
+
+// scanOutputLines calls fn for each line of r, treating '\r' as a line break too.
+func scanOutputLines(r io.Reader, fn func(string)) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	sc.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		for i, b := range data {
+			if b == '\n' || b == '\r' {
+				return i + 1, data[:i], nil
+			}
+		}
+		if atEOF && len(data) > 0 {
+			return len(data), data, nil
+		}
+		return 0, nil, nil
+	})
+	for sc.Scan() {
+		fn(sc.Text())
+	}
+	_, _ = io.Copy(io.Discard, r) // keep draining after an oversized line so the process never blocks
+}
+
+func int64Ptr(v int64) *int64 { return &v }
+
+func intPtr(v int) *int { return &v }
+
+func floatIntPtr(f *float64) *int {
+	if f == nil {
+		return nil
+	}
+	v := int(*f)
+	return &v
+}
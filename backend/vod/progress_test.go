@@ -0,0 +1,52 @@
+package vod
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseProgressLine(t *testing.T) {
+	line := progressPrefix + `{"status": "downloading", "downloaded_bytes": 1048576, "total_bytes": null, "total_bytes_estimate": 2500000000.0, "speed": 3145728.5, "eta": 790, "elapsed": 1.2, "fragment_index": 3, "fragment_count": 900, "filename": "/data/twitch_1.mp4", "_percent_str": " 0.0%"}`
+	p, ok := parseProgressLine(line)
+	if !ok {
+		t.Fatal("expected progress line to parse")
+	}
+	if p.Status != "downloading" || p.Downloaded != 1048576 {
+		t.Fatalf("unexpected progress %+v", p)
+	}
+	if p.Total == nil || *p.Total != 2500000000 {
+		t.Fatalf("expected total from estimate, got %v", p.Total)
+	}
+	if p.Speed == nil || *p.Speed != 3145728.5 {
+		t.Fatalf("unexpected speed %v", p.Speed)
+	}
+	if p.ETA == nil || *p.ETA != 790 || p.FragmentIndex == nil || *p.FragmentIndex != 3 || p.FragmentCount == nil || *p.FragmentCount != 900 {
+		t.Fatalf("unexpected eta/fragments %+v", p)
+	}
+
+	// Exact total wins over the estimate; unknown values stay nil.
+	p, ok = parseProgressLine(progressPrefix + `{"status":"finished","downloaded_bytes":2048,"total_bytes":2048,"total_bytes_estimate":4096,"speed":null,"eta":null}`)
+	if !ok || p.Total == nil || *p.Total != 2048 || p.Speed != nil || p.ETA != nil || p.FragmentIndex != nil {
+		t.Fatalf("unexpected finished progress %+v ok=%v", p, ok)
+	}
+
+	for _, s := range []string{
+		"",
+		"[download]   4.3% of ~2.19GiB at  3.05MiB/s ETA 11:22",
+		"ERROR: [twitch:vod] 123: This video is only available to subscribers",
+		progressPrefix + "NA",
+	} {
+		if _, ok := parseProgressLine(s); ok {
+			t.Errorf("parseProgressLine(%q) should not parse", s)
+		}
+	}
+}
+
+func TestScanOutputLines(t *testing.T) {
+	var got []string
+	scanOutputLines(strings.NewReader("a\rb\nc\r\nd"), func(s string) { got = append(got, s) })
+	want := []string{"a", "b", "c", "", "d"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Fatalf("lines = %q want %q", got, want)
+	}
+}
@@ -0,0 +1,242 @@
+package vod
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/onnwee/vod-tender/backend/config"
+)
+
+// TitleChange is a VOD title change seen on Twitch.
+type TitleChange struct {
+	ChangedAt time.Time `json:"changed_at"`
+	OldTitle  string    `json:"old_title"`
+	NewTitle  string    `json:"new_title"`
+}
+
+// CatalogDiff counts the changes made by one ReconcileCatalog run.
+type CatalogDiff struct {
+	Retitled int // titles changed on Twitch
+	Deleted  int // VODs newly missing from Twitch
+	Restored int // VODs marked deleted that are listed again
+	Bumped   int // undownloaded VODs raised in priority before they expire
+}
+
+// expiryPolicy decides which undownloaded VODs are close enough to Twitch's
+// deletion to be moved up the queue.
+type expiryPolicy struct {
+	retention time.Duration // how long Twitch keeps archives for the channel
+	window    time.Duration // bump VODs expiring within this long
+	priority  int           // priority given to bumped VODs
+}
+
+func loadExpiryPolicy() expiryPolicy {
+	p := expiryPolicy{retention: 7 * 24 * time.Hour, window: 48 * time.Hour, priority: 50}
+	if s := os.Getenv("TWITCH_VOD_RETENTION_DAYS"); s != "" {
+		if n, err := strconv.Atoi(s); err == nil && n > 0 {
+			p.retention = time.Duration(n) * 24 * time.Hour
+		}
+	}
+	if s := os.Getenv("VOD_EXPIRY_WINDOW"); s != "" {
+		if d, err := time.ParseDuration(s); err == nil && d >= 0 {
+			p.window = d
+		}
+	}
+	if s := os.Getenv("VOD_EXPIRY_PRIORITY"); s != "" {
+		if n, err := strconv.Atoi(s); err == nil {
+			p.priority = n
+		}
+	}
+	return p
+}
+
+// listArchiveVODs returns every archive VOD Twitch currently lists for the channel.
+// Replaced in tests.
+var listArchiveVODs = func(ctx context.Context, channel string) ([]VOD, error) {
+	if channel == "" {
+		channel = os.Getenv("TWITCH_CHANNEL")
+	}
+	if channel == config.DefaultChannel {
+		return nil, nil
+	}
+	client := helixClient()
+	userID, err := client.GetUserID(ctx, channel)
+	if err != nil {
+		return nil, err
+	}
+	var out []VOD
+	after := ""
+	for {
+		videos, cursor, err := client.ListVideos(ctx, userID, after, 100)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range videos {
+			created, _ := time.Parse(time.RFC3339, v.CreatedAt)
+			out = append(out, VOD{ID: v.ID, Title: v.Title, Date: created, Duration: parseTwitchDuration(v.Duration)})
+		}
+		if cursor == "" || len(videos) == 0 {
+			return out, nil
+		}
+		after = cursor
+	}
+}
+
+// ReconcileCatalog diffs the channel's Twitch archive list against the vods table.
+// Retitled VODs get their new title and a vod_title_history row; VODs no longer
+// listed get twitch_deleted_at (cleared again if they reappear); undownloaded VODs
+// about to expire are raised to VOD_EXPIRY_PRIORITY. VODs Twitch lists that are not
+// in the table are left to discovery and the catalog backfill.
+func ReconcileCatalog(ctx context.Context, db *sql.DB, channel string) (CatalogDiff, error) {
+	live, err := listArchiveVODs(ctx, channel)
+	if err != nil {
+		return CatalogDiff{}, err
+	}
+	return applyCatalog(ctx, db, channel, live, loadExpiryPolicy(), time.Now())
+}
+
+func applyCatalog(ctx context.Context, db *sql.DB, channel string, live []VOD, policy expiryPolicy, now time.Time) (CatalogDiff, error) {
+	var diff CatalogDiff
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return diff, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	type stored struct {
+		title   string
+		deleted bool
+	}
+	known := map[string]stored{}
+	rows, err := tx.QueryContext(ctx, `SELECT twitch_vod_id, COALESCE(title,''), twitch_deleted_at IS NOT NULL
+		FROM vods WHERE channel=$1 AND twitch_vod_id NOT LIKE 'live-%'`, channel)
+	if err != nil {
+		return diff, fmt.Errorf("load vods: %w", err)
+	}
+	for rows.Next() {
+		var id string
+		var s stored
+		if err := rows.Scan(&id, &s.title, &s.deleted); err != nil {
+			_ = rows.Close()
+			return diff, err
+		}
+		known[id] = s
+	}
+	if err := rows.Close(); err != nil {
+		return diff, err
+	}
+
+	listed := make(map[string]bool, len(live))
+	for _, v := range live {
+		listed[v.ID] = true
+		s, ok := known[v.ID]
+		if !ok {
+			continue
+		}
+		if s.deleted {
+			if _, err := tx.ExecContext(ctx, `UPDATE vods SET twitch_deleted_at=NULL, updated_at=NOW() WHERE twitch_vod_id=$1`, v.ID); err != nil {
+				return diff, fmt.Errorf("restore %s: %w", v.ID, err)
+			}
+			diff.Restored++
+		}
+		if v.Title == "" || v.Title == s.title {
+			continue
+		}
+		if s.title != "" {
+			if _, err := tx.ExecContext(ctx, `INSERT INTO vod_title_history (vod_id, old_title, new_title, changed_at) VALUES ($1,$2,$3,$4)`, v.ID, s.title, v.Title, now); err != nil {
+				return diff, fmt.Errorf("record title change %s: %w", v.ID, err)
+			}
+			diff.Retitled++
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE vods SET title=$1, updated_at=NOW() WHERE twitch_vod_id=$2`, v.Title, v.ID); err != nil {
+			return diff, fmt.Errorf("update title %s: %w", v.ID, err)
+		}
+	}
+
+	// An empty list is more likely a lookup problem than every VOD expiring at once.
+	if len(live) > 0 {
+		for id, s := range known {
+			if listed[id] || s.deleted {
+				continue
+			}
+			if _, err := tx.ExecContext(ctx, `UPDATE vods SET twitch_deleted_at=$1, updated_at=NOW() WHERE twitch_vod_id=$2`, now, id); err != nil {
+				return diff, fmt.Errorf("mark %s deleted: %w", id, err)
+			}
+			diff.Deleted++
+		}
+	}
+
+	cutoff := now.Add(-(policy.retention - policy.window))
+	res, err := tx.ExecContext(ctx, `UPDATE vods SET priority=$1, updated_at=NOW()
+		WHERE channel=$2 AND COALESCE(processed,false)=false AND COALESCE(downloaded_path,'')=''
+		AND twitch_deleted_at IS NULL AND twitch_vod_id NOT LIKE 'live-%'
+		AND date < $3 AND COALESCE(priority,0) < $1`, policy.priority, channel, cutoff)
+	if err != nil {
+		return diff, fmt.Errorf("bump expiring vods: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil {
+		diff.Bumped = int(n)
+	}
+	if err := tx.Commit(); err != nil {
+		return diff, err
+	}
+	return diff, nil
+}
+
+// LoadTitleHistory returns a VOD's title changes, oldest first.
+func LoadTitleHistory(ctx context.Context, db *sql.DB, vodID string) ([]TitleChange, error) {
+	rows, err := db.QueryContext(ctx, `SELECT changed_at, old_title, new_title FROM vod_title_history WHERE vod_id=$1 ORDER BY changed_at, id`, vodID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	out := []TitleChange{}
+	for rows.Next() {
+		var c TitleChange
+		if err := rows.Scan(&c.ChangedAt, &c.OldTitle, &c.NewTitle); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
+
+// StartCatalogReconcileJob runs ReconcileCatalog at start and then every
+// VOD_CATALOG_RECONCILE_INTERVAL (default 1h).
+func StartCatalogReconcileJob(ctx context.Context, db *sql.DB, channel string) {
+	interval := time.Hour
+	if v := os.Getenv("VOD_CATALOG_RECONCILE_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			interval = d
+		}
+	}
+	slog.Info("catalog reconcile job starting", slog.Duration("interval", interval), slog.String("channel", channel))
+	run := func() {
+		diff, err := ReconcileCatalog(ctx, db, channel)
+		if err != nil {
+			slog.Warn("catalog reconcile", slog.Any("err", err), slog.String("channel", channel))
+			return
+		}
+		if diff != (CatalogDiff{}) {
+			slog.Info("catalog reconciled", slog.Int("retitled", diff.Retitled), slog.Int("deleted", diff.Deleted),
+				slog.Int("restored", diff.Restored), slog.Int("bumped", diff.Bumped), slog.String("channel", channel))
+		}
+	}
+	run()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("catalog reconcile job stopped", slog.String("channel", channel))
+			return
+		case <-ticker.C:
+			run()
+		}
+	}
+}
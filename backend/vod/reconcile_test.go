@@ -0,0 +1,91 @@
+package vod
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLoadExpiryPolicy(t *testing.T) {
+	t.Setenv("TWITCH_VOD_RETENTION_DAYS", "")
+	t.Setenv("VOD_EXPIRY_WINDOW", "")
+	t.Setenv("VOD_EXPIRY_PRIORITY", "")
+	if p := loadExpiryPolicy(); p.retention != 7*24*time.Hour || p.window != 48*time.Hour || p.priority != 50 {
+		t.Fatalf("default policy = %+v", p)
+	}
+	t.Setenv("TWITCH_VOD_RETENTION_DAYS", "60")
+	t.Setenv("VOD_EXPIRY_WINDOW", "72h")
+	t.Setenv("VOD_EXPIRY_PRIORITY", "80")
+	if p := loadExpiryPolicy(); p.retention != 60*24*time.Hour || p.window != 72*time.Hour || p.priority != 80 {
+		t.Fatalf("policy = %+v", p)
+	}
+}
+
+func TestReconcileCatalog(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	channel := "test_reconcile_catalog"
+	cleanup := func() { _, _ = db.ExecContext(context.Background(), `DELETE FROM vods WHERE channel=$1`, channel) }
+	cleanup()
+	t.Cleanup(cleanup)
+
+	now := time.Now().UTC()
+	for _, v := range []VOD{
+		{ID: "rc-retitled", Title: "Old title", Date: now.Add(-24 * time.Hour)},
+		{ID: "rc-gone", Title: "Expired", Date: now.Add(-20 * 24 * time.Hour)},
+		{ID: "rc-expiring", Title: "Six days old", Date: now.Add(-6 * 24 * time.Hour)},
+		{ID: "rc-back", Title: "Back", Date: now.Add(-2 * 24 * time.Hour)},
+	} {
+		if err := insertVOD(ctx, db, channel, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.ExecContext(ctx, `UPDATE vods SET twitch_deleted_at=NOW() WHERE twitch_vod_id='rc-back'`); err != nil {
+		t.Fatal(err)
+	}
+	orig := listArchiveVODs
+	t.Cleanup(func() { listArchiveVODs = orig })
+	listArchiveVODs = func(context.Context, string) ([]VOD, error) {
+		return []VOD{
+			{ID: "rc-retitled", Title: "New title"},
+			{ID: "rc-expiring", Title: "Six days old"},
+			{ID: "rc-back", Title: "Back"},
+			{ID: "rc-unknown", Title: "Not in the table yet"},
+		}, nil
+	}
+
+	t.Setenv("TWITCH_VOD_RETENTION_DAYS", "7")
+	t.Setenv("VOD_EXPIRY_WINDOW", "48h")
+	t.Setenv("VOD_EXPIRY_PRIORITY", "50")
+	diff, err := ReconcileCatalog(ctx, db, channel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff != (CatalogDiff{Retitled: 1, Deleted: 1, Restored: 1, Bumped: 1}) {
+		t.Fatalf("diff = %+v", diff)
+	}
+
+	history, err := LoadTitleHistory(ctx, db, "rc-retitled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 || history[0].OldTitle != "Old title" || history[0].NewTitle != "New title" {
+		t.Fatalf("title history = %+v", history)
+	}
+	var deleted, restored bool
+	var priority int
+	if err := db.QueryRowContext(ctx, `SELECT
+		(SELECT twitch_deleted_at IS NOT NULL FROM vods WHERE twitch_vod_id='rc-gone'),
+		(SELECT twitch_deleted_at IS NULL FROM vods WHERE twitch_vod_id='rc-back'),
+		(SELECT priority FROM vods WHERE twitch_vod_id='rc-expiring')`).Scan(&deleted, &restored, &priority); err != nil {
+		t.Fatal(err)
+	}
+	if !deleted || !restored || priority != 50 {
+		t.Fatalf("deleted=%v restored=%v priority=%d", deleted, restored, priority)
+	}
+
+	// A second run with the same list changes nothing.
+	if diff, err := ReconcileCatalog(ctx, db, channel); err != nil || diff != (CatalogDiff{}) {
+		t.Fatalf("second run = %+v, %v", diff, err)
+	}
+}
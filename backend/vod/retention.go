@@ -7,9 +7,10 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
-	"strconv"
 	"strings"
 	"time"
+
+	"github.com/onnwee/vod-tender/backend/config"
 )
 
 // RetentionPolicy defines how to determine which VODs to clean up.
@@ -26,62 +27,37 @@ type RetentionPolicy struct {
 
 // LoadRetentionPolicy loads retention policy configuration from environment variables.
 func LoadRetentionPolicy() RetentionPolicy {
-	policy := RetentionPolicy{
-		Interval: 6 * time.Hour, // Default to run every 6 hours
-	}
-
-	// Load keep days policy
-	if s := os.Getenv("RETENTION_KEEP_DAYS"); s != "" {
-		if n, err := strconv.Atoi(s); err == nil && n >= 0 {
-			policy.KeepLastNDays = n
-		}
-	}
-
-	// Load keep count policy
-	if s := os.Getenv("RETENTION_KEEP_COUNT"); s != "" {
-		if n, err := strconv.Atoi(s); err == nil && n >= 0 {
-			policy.KeepLastNVODs = n
-		}
-	}
+	return RetentionPolicyFor(config.ChannelConfigFromEnv(""))
+}
 
-	// Load dry-run mode
-	if os.Getenv("RETENTION_DRY_RUN") == "1" {
-		policy.DryRun = true
+// RetentionPolicyFor returns the retention policy of a channel's settings.
+func RetentionPolicyFor(cfg config.ChannelConfig) RetentionPolicy {
+	return RetentionPolicy{
+		KeepLastNDays: cfg.RetentionKeepDays,
+		KeepLastNVODs: cfg.RetentionKeepCount,
+		DryRun:        cfg.RetentionDryRun,
+		Interval:      cfg.RetentionInterval,
 	}
-
-	// Load interval
-	if s := os.Getenv("RETENTION_INTERVAL"); s != "" {
-		if d, err := time.ParseDuration(s); err == nil && d > 0 {
-			policy.Interval = d
-		}
-	}
-
-	return policy
 }
 
 // StartRetentionJob runs a background job that periodically cleans up old VOD files
-// according to the configured retention policy.
-func StartRetentionJob(ctx context.Context, dbc *sql.DB, channel string) {
-	policy := LoadRetentionPolicy()
-
-	// Skip if no retention policy is configured
-	if policy.KeepLastNDays == 0 && policy.KeepLastNVODs == 0 {
-		slog.Info("retention job disabled (no policy configured)", slog.String("channel", channel))
-		return
-	}
-
-	slog.Info("retention job starting",
-		slog.String("channel", channel),
-		slog.Int("keep_days", policy.KeepLastNDays),
-		slog.Int("keep_count", policy.KeepLastNVODs),
-		slog.Bool("dry_run", policy.DryRun),
-		slog.Duration("interval", policy.Interval))
+// of cfg.Channel according to the channel's retention policy. The policy is
+// re-resolved whenever the runtime config changes, so it can be enabled, disabled
+// or adjusted without a restart.
+func StartRetentionJob(ctx context.Context, dbc *sql.DB, cfg config.ChannelConfig) {
+	channel := cfg.Channel
+	policy := RetentionPolicyFor(cfg)
+	logRetentionPolicy(channel, policy, "retention job starting")
 
 	// Run immediately on start
-	if err := runRetentionCleanup(ctx, dbc, channel, policy); err != nil {
-		slog.Warn("retention cleanup failed", slog.Any("err", err), slog.String("channel", channel))
+	if policy.enabled() {
+		if err := runRetentionCleanup(ctx, dbc, channel, policy); err != nil {
+			slog.Warn("retention cleanup failed", slog.Any("err", err), slog.String("channel", channel))
+		}
 	}
 
+	changes, stopWatch := config.WatchRuntime()
+	defer stopWatch()
 	ticker := time.NewTicker(policy.Interval)
 	defer ticker.Stop()
 
@@ -90,7 +66,20 @@ func StartRetentionJob(ctx context.Context, dbc *sql.DB, channel string) {
 		case <-ctx.Done():
 			slog.Info("retention job stopped", slog.String("channel", channel))
 			return
+		case <-changes:
+			next := RetentionPolicyFor(reloadChannelConfig(ctx, dbc, channel))
+			if next == policy {
+				continue
+			}
+			if next.Interval != policy.Interval {
+				ticker.Reset(next.Interval)
+			}
+			policy = next
+			logRetentionPolicy(channel, policy, "retention policy changed")
 		case <-ticker.C:
+			if !policy.enabled() {
+				continue
+			}
 			if err := runRetentionCleanup(ctx, dbc, channel, policy); err != nil {
 				slog.Warn("retention cleanup failed", slog.Any("err", err), slog.String("channel", channel))
 			}
@@ -98,8 +87,71 @@ func StartRetentionJob(ctx context.Context, dbc *sql.DB, channel string) {
 	}
 }
 
+// enabled reports whether the policy selects anything for cleanup.
+func (p RetentionPolicy) enabled() bool {
+	return p.KeepLastNDays > 0 || p.KeepLastNVODs > 0
+}
+
+func logRetentionPolicy(channel string, policy RetentionPolicy, msg string) {
+	if !policy.enabled() {
+		slog.Info(msg+" (disabled, no policy configured)", slog.String("channel", channel))
+		return
+	}
+	slog.Info(msg,
+		slog.String("channel", channel),
+		slog.Int("keep_days", policy.KeepLastNDays),
+		slog.Int("keep_count", policy.KeepLastNVODs),
+		slog.Bool("dry_run", policy.DryRun),
+		slog.Duration("interval", policy.Interval))
+}
+
+// RetentionReport is the outcome of one retention cycle.
+type RetentionReport struct {
+	Channel    string          `json:"channel"`
+	KeepDays   int             `json:"keep_days"`
+	KeepCount  int             `json:"keep_count"`
+	DryRun     bool            `json:"dry_run"`
+	Files      []RetentionFile `json:"files"` // deleted, or in a dry run those that would be
+	Skipped    int             `json:"skipped"`
+	Errors     int             `json:"errors"`
+	BytesFreed int64           `json:"bytes_freed"`
+}
+
+// RetentionFile is a downloaded VOD file selected by the retention policy.
+type RetentionFile struct {
+	Date      time.Time `json:"date"`
+	VodID     string    `json:"vod_id"`
+	Title     string    `json:"title"`
+	Path      string    `json:"path"`
+	SizeBytes int64     `json:"size_bytes"`
+}
+
+// PreviewRetention runs a dry-run retention cycle for channel and reports the files
+// policy would delete. Nothing is deleted. A policy that selects nothing (no keep
+// days or count) reports no files.
+func PreviewRetention(ctx context.Context, dbc *sql.DB, channel string, policy RetentionPolicy) (RetentionReport, error) {
+	policy.DryRun = true
+	if !policy.enabled() {
+		return RetentionReport{Channel: channel, DryRun: true, Files: []RetentionFile{}}, nil
+	}
+	return retentionCleanup(ctx, dbc, channel, policy)
+}
+
 // runRetentionCleanup performs a single retention cleanup cycle.
 func runRetentionCleanup(ctx context.Context, dbc *sql.DB, channel string, policy RetentionPolicy) error {
+	_, err := retentionCleanup(ctx, dbc, channel, policy)
+	return err
+}
+
+// retentionCleanup performs a retention cleanup cycle and reports what it removed.
+func retentionCleanup(ctx context.Context, dbc *sql.DB, channel string, policy RetentionPolicy) (RetentionReport, error) {
+	report := RetentionReport{
+		Channel:   channel,
+		KeepDays:  policy.KeepLastNDays,
+		KeepCount: policy.KeepLastNVODs,
+		DryRun:    policy.DryRun,
+		Files:     []RetentionFile{},
+	}
 	logger := slog.Default().With(
 		slog.String("component", "retention_cleanup"),
 		slog.String("channel", channel),
@@ -118,7 +170,7 @@ func runRetentionCleanup(ctx context.Context, dbc *sql.DB, channel string, polic
 			`SELECT twitch_vod_id FROM vods WHERE channel=$1 AND date >= $2`,
 			channel, cutoff)
 		if err != nil {
-			return fmt.Errorf("query recent vods: %w", err)
+			return report, fmt.Errorf("query recent vods: %w", err)
 		}
 		defer func() {
 			if err := rows.Close(); err != nil {
@@ -140,7 +192,7 @@ func runRetentionCleanup(ctx context.Context, dbc *sql.DB, channel string, polic
 			`SELECT twitch_vod_id FROM vods WHERE channel=$1 ORDER BY date DESC LIMIT $2`,
 			channel, policy.KeepLastNVODs)
 		if err != nil {
-			return fmt.Errorf("query last n vods: %w", err)
+			return report, fmt.Errorf("query last n vods: %w", err)
 		}
 		defer func() {
 			if err := rows.Close(); err != nil {
@@ -156,22 +208,18 @@ func runRetentionCleanup(ctx context.Context, dbc *sql.DB, channel string, polic
 		logger.Debug("identified vods to retain by count", slog.Int("retained_count", len(retainedIDs)))
 	}
 
-	// Safety check: Never delete VODs that are currently being processed or uploaded
-	// Identify by checking for null youtube_url but with a downloaded_path or recent processing activity
+	// Safety check: Never delete VODs that are currently being processed or uploaded.
+	// A VOD is active while its status is mid-pipeline or while a worker holds a live lease on it.
 	rows, err := dbc.QueryContext(ctx, `
 		SELECT twitch_vod_id FROM vods 
 		WHERE channel=$1 
 		AND (
-			-- Currently being processed
-			(processed = false AND downloaded_path IS NOT NULL)
-			-- Recently updated (within last hour, might be uploading)
-			OR (updated_at > NOW() - INTERVAL '1 hour' AND youtube_url IS NULL AND downloaded_path IS NOT NULL)
-			-- Has active download state
-			OR download_state IN ('downloading', 'processing')
+			status IN ('queued', 'downloading', 'downloaded', 'uploading')
+			OR twitch_vod_id IN (SELECT twitch_vod_id FROM vod_leases WHERE expires_at > NOW())
 		)
 	`, channel)
 	if err != nil {
-		return fmt.Errorf("query active vods: %w", err)
+		return report, fmt.Errorf("query active vods: %w", err)
 	}
 	activeIDs := make(map[string]struct{})
 	for rows.Next() {
@@ -194,7 +242,7 @@ func runRetentionCleanup(ctx context.Context, dbc *sql.DB, channel string, polic
 		ORDER BY date ASC
 	`, channel)
 	if err != nil {
-		return fmt.Errorf("query vods with files: %w", err)
+		return report, fmt.Errorf("query vods with files: %w", err)
 	}
 	defer func() {
 		if err := rows.Close(); err != nil {
@@ -233,6 +281,8 @@ func runRetentionCleanup(ctx context.Context, dbc *sql.DB, channel string, polic
 				_, err := dbc.ExecContext(ctx, `UPDATE vods SET downloaded_path=NULL WHERE twitch_vod_id=$1`, id)
 				if err != nil {
 					logger.Warn("failed to clear db reference for missing file", slog.String("vod_id", id), slog.Any("err", err))
+				} else {
+					archiveIfDone(ctx, dbc, logger, id)
 				}
 			}
 			logger.Debug("file already missing, clearing db reference", slog.String("path", path), slog.String("vod_id", id))
@@ -248,6 +298,10 @@ func runRetentionCleanup(ctx context.Context, dbc *sql.DB, channel string, polic
 		if err == nil {
 			bytesFreed += fileInfo.Size()
 		}
+		file := RetentionFile{Date: date, VodID: id, Title: title, Path: path}
+		if fileInfo != nil {
+			file.SizeBytes = fileInfo.Size()
+		}
 
 		if policy.DryRun {
 			logger.Info("dry-run: would delete file",
@@ -256,6 +310,7 @@ func runRetentionCleanup(ctx context.Context, dbc *sql.DB, channel string, polic
 				slog.String("title", title),
 				slog.Time("date", date),
 				slog.Int64("size_bytes", fileInfo.Size()))
+			report.Files = append(report.Files, file)
 			cleaned++
 		} else {
 			// Delete the file
@@ -277,6 +332,7 @@ func runRetentionCleanup(ctx context.Context, dbc *sql.DB, channel string, polic
 				errors++
 				continue
 			}
+			archiveIfDone(ctx, dbc, logger, id)
 
 			logger.Info("deleted old vod file",
 				slog.String("path", path),
@@ -284,6 +340,7 @@ func runRetentionCleanup(ctx context.Context, dbc *sql.DB, channel string, polic
 				slog.String("title", title),
 				slog.Time("date", date),
 				slog.Int64("size_bytes", fileInfo.Size()))
+			report.Files = append(report.Files, file)
 			cleaned++
 		}
 	}
@@ -300,7 +357,20 @@ func runRetentionCleanup(ctx context.Context, dbc *sql.DB, channel string, polic
 		slog.Int("errors", errors),
 		slog.Int64("bytes_freed", bytesFreed))
 
-	return nil
+	report.Skipped, report.Errors, report.BytesFreed = skipped, errors, bytesFreed
+	return report, nil
+}
+
+// archiveIfDone marks a VOD archived once its local media is gone, but only if processing
+// had already finished (uploaded or skipped); other states are left for the pipeline.
+func archiveIfDone(ctx context.Context, dbc *sql.DB, logger *slog.Logger, id string) {
+	var cur string
+	if err := dbc.QueryRowContext(ctx, `SELECT status FROM vods WHERE twitch_vod_id=$1`, id).Scan(&cur); err != nil {
+		return
+	}
+	if st := Status(cur); st == StatusUploaded || st == StatusSkipped {
+		setStatus(ctx, dbc, logger, id, StatusArchived, "local file removed by retention")
+	}
 }
 
 // CleanupTempFiles removes stale temporary and partial files from the data directory.
@@ -418,13 +418,14 @@ func TestRunRetentionCleanupSkipsActiveVODs(t *testing.T) {
 	}
 
 	_, err = db.ExecContext(ctx, `
-		INSERT INTO vods (channel, twitch_vod_id, title, date, duration_seconds, downloaded_path, processed, download_state, created_at)
-		VALUES ($1, $2, $3, $4, 60, $5, false, 'downloading', NOW())
+		INSERT INTO vods (channel, twitch_vod_id, title, date, duration_seconds, downloaded_path, processed, download_state, status, created_at)
+		VALUES ($1, $2, $3, $4, 60, $5, false, 'downloading', 'downloading', NOW())
 		ON CONFLICT (twitch_vod_id) DO UPDATE SET 
 			date=EXCLUDED.date, 
 			downloaded_path=EXCLUDED.downloaded_path,
 			processed=EXCLUDED.processed,
 			download_state=EXCLUDED.download_state,
+			status=EXCLUDED.status,
 			channel=EXCLUDED.channel
 	`, channel, id, "Test active", date, path)
 	if err != nil {
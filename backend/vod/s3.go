@@ -0,0 +1,324 @@
+package vod
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// S3-compatible uploader (AWS S3, MinIO, R2, ...). Requests are signed with AWS
+// Signature V4; files larger than one part use a multipart upload so multi-GB VODs
+// stay under the single-PUT size limit.
+
+const (
+	defaultS3PartSize = 64 << 20
+	minS3PartSize     = 5 << 20 // S3 minimum for all but the last part
+	unsignedPayload   = "UNSIGNED-PAYLOAD"
+)
+
+type s3Uploader struct {
+	client    *http.Client
+	endpoint  *url.URL
+	now       func() time.Time
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+	prefix    string
+	partSize  int64
+	pathStyle bool
+}
+
+// newS3UploaderFromEnv configures the uploader from S3_* variables (AWS_* credentials are
+// accepted as a fallback).
+func newS3UploaderFromEnv() (*s3Uploader, error) {
+	s := &s3Uploader{
+		client:    &http.Client{Timeout: 30 * time.Minute},
+		now:       time.Now,
+		region:    firstEnv("S3_REGION", "AWS_REGION"),
+		bucket:    strings.TrimSpace(os.Getenv("S3_BUCKET")),
+		accessKey: firstEnv("S3_ACCESS_KEY_ID", "AWS_ACCESS_KEY_ID"),
+		secretKey: firstEnv("S3_SECRET_ACCESS_KEY", "AWS_SECRET_ACCESS_KEY"),
+		prefix:    strings.Trim(os.Getenv("S3_PREFIX"), "/"),
+		partSize:  defaultS3PartSize,
+		pathStyle: os.Getenv("S3_PATH_STYLE") != "0",
+	}
+	if s.region == "" {
+		s.region = "us-east-1"
+	}
+	if s.bucket == "" {
+		return nil, errors.New("s3 destination requires S3_BUCKET")
+	}
+	if s.accessKey == "" || s.secretKey == "" {
+		return nil, errors.New("s3 destination requires S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY")
+	}
+	endpoint := strings.TrimSpace(os.Getenv("S3_ENDPOINT"))
+	if endpoint == "" {
+		endpoint = "https://s3." + s.region + ".amazonaws.com"
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid S3_ENDPOINT %q", endpoint)
+	}
+	s.endpoint = u
+	if v := os.Getenv("S3_PART_SIZE_MB"); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil && n > 0 {
+			s.partSize = n << 20
+		}
+	}
+	if s.partSize < minS3PartSize {
+		s.partSize = minS3PartSize
+	}
+	return s, nil
+}
+
+func firstEnv(keys ...string) string {
+	for _, k := range keys {
+		if v := strings.TrimSpace(os.Getenv(k)); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// RemoteKey returns the object key the VOD file is stored under.
+func (s *s3Uploader) RemoteKey(ctx context.Context, path string, date time.Time) string {
+	return objectKey(ctx, s.prefix, path, date)
+}
+
+func (s *s3Uploader) Upload(ctx context.Context, dbc *sql.DB, path, title string, date time.Time) (string, error) {
+	key := s.RemoteKey(ctx, path, date)
+	f, err := os.Open(path) //nolint:gosec // G304: path is the pipeline's local media file
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = f.Close() }()
+	fi, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	if fi.Size() <= s.partSize {
+		if _, err := s.do(ctx, http.MethodPut, key, nil, io.NewSectionReader(f, 0, fi.Size()), fi.Size(), unsignedPayload); err != nil {
+			return "", fmt.Errorf("s3 put %s: %w", key, err)
+		}
+		return s.objectURL(key).String(), nil
+	}
+	if err := s.multipart(ctx, key, f, fi.Size()); err != nil {
+		return "", fmt.Errorf("s3 multipart %s: %w", key, err)
+	}
+	return s.objectURL(key).String(), nil
+}
+
+func (s *s3Uploader) multipart(ctx context.Context, key string, f *os.File, size int64) error {
+	resp, err := s.do(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, nil, 0, emptySHA256())
+	if err != nil {
+		return fmt.Errorf("initiate: %w", err)
+	}
+	var initRes struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := xml.Unmarshal(resp, &initRes); err != nil || initRes.UploadID == "" {
+		return fmt.Errorf("initiate: missing upload id: %v", err)
+	}
+	uploadID := initRes.UploadID
+	abort := func() {
+		// Best effort; the bucket's lifecycle rules clean up anything left behind.
+		actx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		_, _ = s.do(actx, http.MethodDelete, key, url.Values{"uploadId": {uploadID}}, nil, 0, emptySHA256())
+	}
+
+	type part struct {
+		ETag       string `xml:"ETag"`
+		PartNumber int    `xml:"PartNumber"`
+	}
+	var parts []part
+	for n, off := 1, int64(0); off < size; n, off = n+1, off+s.partSize {
+		length := s.partSize
+		if off+length > size {
+			length = size - off
+		}
+		q := url.Values{"partNumber": {strconv.Itoa(n)}, "uploadId": {uploadID}}
+		etag, err := s.putPart(ctx, key, q, io.NewSectionReader(f, off, length), length)
+		if err != nil {
+			abort()
+			return fmt.Errorf("part %d: %w", n, err)
+		}
+		parts = append(parts, part{PartNumber: n, ETag: etag})
+	}
+
+	body, _ := xml.Marshal(struct {
+		XMLName xml.Name `xml:"CompleteMultipartUpload"`
+		Parts   []part   `xml:"Part"`
+	}{Parts: parts})
+	sum := sha256.Sum256(body)
+	resp, err = s.do(ctx, http.MethodPost, key, url.Values{"uploadId": {uploadID}}, bytes.NewReader(body), int64(len(body)), hex.EncodeToString(sum[:]))
+	if err != nil {
+		abort()
+		return fmt.Errorf("complete: %w", err)
+	}
+	// CompleteMultipartUpload can return 200 with an error document.
+	if bytes.Contains(resp, []byte("<Error>")) {
+		abort()
+		return fmt.Errorf("complete: %s", strings.TrimSpace(string(resp)))
+	}
+	return nil
+}
+
+func (s *s3Uploader) putPart(ctx context.Context, key string, q url.Values, body io.Reader, length int64) (string, error) {
+	req, err := s.newRequest(ctx, http.MethodPut, key, q, body, length, unsignedPayload)
+	if err != nil {
+		return "", err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode/100 != 2 {
+		return "", fmt.Errorf("http %d: %s", resp.StatusCode, strings.TrimSpace(string(b)))
+	}
+	return resp.Header.Get("ETag"), nil
+}
+
+// do sends a signed request and returns the (bounded) response body.
+func (s *s3Uploader) do(ctx context.Context, method, key string, q url.Values, body io.Reader, length int64, payloadHash string) ([]byte, error) {
+	req, err := s.newRequest(ctx, method, key, q, body, length, payloadHash)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("http %d: %s", resp.StatusCode, strings.TrimSpace(string(b)))
+	}
+	return b, nil
+}
+
+func (s *s3Uploader) objectURL(key string) *url.URL {
+	u := *s.endpoint
+	if s.pathStyle {
+		u.Path = "/" + s.bucket + "/" + key
+	} else {
+		u.Host = s.bucket + "." + u.Host
+		u.Path = "/" + key
+	}
+	u.RawPath = s3EscapePath(u.Path)
+	u.RawQuery = ""
+	return &u
+}
+
+func (s *s3Uploader) newRequest(ctx context.Context, method, key string, q url.Values, body io.Reader, length int64, payloadHash string) (*http.Request, error) {
+	u := s.objectURL(key)
+	u.RawQuery = canonicalQuery(q)
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = length
+	if length == 0 {
+		req.Body = http.NoBody
+	}
+	s.sign(req, u, payloadHash)
+	return req, nil
+}
+
+// sign adds AWS Signature V4 headers to req.
+func (s *s3Uploader) sign(req *http.Request, u *url.URL, payloadHash string) {
+	now := s.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	signed := "host;x-amz-content-sha256;x-amz-date"
+	canonical := strings.Join([]string{
+		req.Method,
+		u.EscapedPath(),
+		u.RawQuery,
+		"host:" + u.Host + "\nx-amz-content-sha256:" + payloadHash + "\nx-amz-date:" + amzDate + "\n",
+		signed,
+		payloadHash,
+	}, "\n")
+	scope := day + "/" + s.region + "/s3/aws4_request"
+	crHash := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(crHash[:])
+
+	k := hmacSHA256([]byte("AWS4"+s.secretKey), day)
+	k = hmacSHA256(k, s.region)
+	k = hmacSHA256(k, "s3")
+	k = hmacSHA256(k, "aws4_request")
+	sig := hex.EncodeToString(hmacSHA256(k, toSign))
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+s.accessKey+"/"+scope+", SignedHeaders="+signed+", Signature="+sig)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(data))
+	return m.Sum(nil)
+}
+
+func emptySHA256() string {
+	sum := sha256.Sum256(nil)
+	return hex.EncodeToString(sum[:])
+}
+
+// canonicalQuery encodes q with sorted keys and %20 for spaces, as SigV4 requires.
+func canonicalQuery(q url.Values) string {
+	if len(q) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		for _, v := range q[k] {
+			parts = append(parts, s3Escape(k)+"="+s3Escape(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// s3Escape percent-encodes everything except RFC 3986 unreserved characters.
+func s3Escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func s3EscapePath(p string) string {
+	segs := strings.Split(p, "/")
+	for i, s := range segs {
+		segs[i] = s3Escape(s)
+	}
+	return strings.Join(segs, "/")
+}
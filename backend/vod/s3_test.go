@@ -0,0 +1,202 @@
+package vod
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 implements the subset of the S3 API used by s3Uploader.
+type fakeS3 struct {
+	objects  map[string][]byte
+	parts    map[string]map[int][]byte
+	requests []string
+	failPart int
+	mu       sync.Mutex
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{objects: map[string][]byte{}, parts: map[string]map[int][]byte{}}
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	q := r.URL.Query()
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path+"?"+r.URL.RawQuery)
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/") || !strings.Contains(auth, "/us-east-1/s3/aws4_request") ||
+		r.Header.Get("x-amz-date") == "" || r.Header.Get("x-amz-content-sha256") == "" {
+		http.Error(w, "<Error><Code>AccessDenied</Code></Error>", http.StatusForbidden)
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+	switch {
+	case r.Method == http.MethodPost && q.Has("uploads"):
+		f.parts["upload-1"] = map[int][]byte{}
+		_, _ = fmt.Fprint(w, `<InitiateMultipartUploadResult><Bucket>vods</Bucket><UploadId>upload-1</UploadId></InitiateMultipartUploadResult>`)
+	case r.Method == http.MethodPut && q.Get("uploadId") != "":
+		var n int
+		_, _ = fmt.Sscanf(q.Get("partNumber"), "%d", &n)
+		if n == f.failPart {
+			http.Error(w, "<Error><Code>InternalError</Code></Error>", http.StatusInternalServerError)
+			return
+		}
+		f.parts[q.Get("uploadId")][n] = body
+		w.Header().Set("ETag", fmt.Sprintf(`"etag-%d"`, n))
+	case r.Method == http.MethodPost && q.Get("uploadId") != "":
+		var done struct {
+			Parts []struct {
+				ETag       string `xml:"ETag"`
+				PartNumber int    `xml:"PartNumber"`
+			} `xml:"Part"`
+		}
+		if err := xml.Unmarshal(body, &done); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var obj []byte
+		for i, p := range done.Parts {
+			if p.PartNumber != i+1 || p.ETag != fmt.Sprintf(`"etag-%d"`, i+1) {
+				http.Error(w, "bad part list", http.StatusBadRequest)
+				return
+			}
+			obj = append(obj, f.parts[q.Get("uploadId")][p.PartNumber]...)
+		}
+		f.objects[r.URL.Path] = obj
+		_, _ = fmt.Fprint(w, `<CompleteMultipartUploadResult></CompleteMultipartUploadResult>`)
+	case r.Method == http.MethodDelete && q.Get("uploadId") != "":
+		delete(f.parts, q.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut:
+		f.objects[r.URL.Path] = body
+	default:
+		http.Error(w, "unsupported", http.StatusBadRequest)
+	}
+}
+
+func newTestS3(t *testing.T, srvURL string) *s3Uploader {
+	t.Helper()
+	t.Setenv("S3_ENDPOINT", srvURL)
+	t.Setenv("S3_BUCKET", "vods")
+	t.Setenv("S3_ACCESS_KEY_ID", "AKID")
+	t.Setenv("S3_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("S3_PREFIX", "/archive/")
+	s, err := newS3UploaderFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func uploadCtx(id, channel string) context.Context {
+	ctx := context.WithValue(context.Background(), vodIDCtxKey{}, id)
+	return context.WithValue(ctx, vodChannelCtxKey{}, channel)
+}
+
+func TestS3UploaderSinglePut(t *testing.T) {
+	fake := newFakeS3()
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	s := newTestS3(t, srv.URL)
+
+	path := filepath.Join(t.TempDir(), "twitch_42.mp4")
+	if err := os.WriteFile(path, []byte("small video"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	date := time.Date(2024, 5, 6, 12, 0, 0, 0, time.UTC)
+	loc, err := s.Upload(uploadCtx("42", "somechan"), nil, path, "title", date)
+	if err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	wantPath := "/vods/archive/somechan/2024-05-06_42.mp4"
+	if got := string(fake.objects[wantPath]); got != "small video" {
+		t.Fatalf("object %s = %q (requests %v)", wantPath, got, fake.requests)
+	}
+	if loc != srv.URL+wantPath {
+		t.Fatalf("location = %s", loc)
+	}
+}
+
+func TestS3UploaderMultipart(t *testing.T) {
+	fake := newFakeS3()
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	s := newTestS3(t, srv.URL)
+	s.partSize = 4 // tiny parts to exercise the multipart path
+
+	path := filepath.Join(t.TempDir(), "twitch_43.mp4")
+	if err := os.WriteFile(path, []byte("0123456789"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Upload(uploadCtx("43", ""), nil, path, "title", time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	if got := string(fake.objects["/vods/archive/default/2024-01-02_43.mp4"]); got != "0123456789" {
+		t.Fatalf("assembled object = %q (requests %v)", got, fake.requests)
+	}
+
+	// A failed part aborts the multipart upload.
+	fake.failPart = 2
+	if _, err := s.Upload(uploadCtx("44", ""), nil, path, "title", time.Now()); err == nil {
+		t.Fatal("expected error when a part fails")
+	}
+	if _, ok := fake.parts["upload-1"]; ok {
+		t.Fatal("expected multipart upload to be aborted")
+	}
+}
+
+func TestS3UploaderRejectsBadCredentials(t *testing.T) {
+	fake := newFakeS3()
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	s := newTestS3(t, srv.URL)
+	s.accessKey = "WRONG"
+	path := filepath.Join(t.TempDir(), "v.mp4")
+	_ = os.WriteFile(path, []byte("x"), 0o600)
+	if _, err := s.Upload(context.Background(), nil, path, "t", time.Now()); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Fatalf("expected 403 error, got %v", err)
+	}
+}
+
+func TestNewS3UploaderFromEnvValidation(t *testing.T) {
+	t.Setenv("S3_BUCKET", "")
+	if _, err := newS3UploaderFromEnv(); err == nil {
+		t.Fatal("expected error without bucket")
+	}
+	t.Setenv("S3_BUCKET", "b")
+	t.Setenv("S3_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	if _, err := newS3UploaderFromEnv(); err == nil {
+		t.Fatal("expected error without credentials")
+	}
+	t.Setenv("AWS_ACCESS_KEY_ID", "a")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "s")
+	t.Setenv("S3_ENDPOINT", "")
+	t.Setenv("S3_REGION", "eu-west-1")
+	t.Setenv("S3_PATH_STYLE", "0")
+	s, err := newS3UploaderFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.objectURL("a b/c.mp4").String(); got != "https://b.s3.eu-west-1.amazonaws.com/a%20b/c.mp4" {
+		t.Fatalf("objectURL = %s", got)
+	}
+}
+
+func TestCanonicalQuery(t *testing.T) {
+	q := url.Values{"uploadId": {"a b+c"}, "partNumber": {"2"}, "uploads": {""}}
+	if got := canonicalQuery(q); got != "partNumber=2&uploadId=a%20b%2Bc&uploads=" {
+		t.Fatalf("canonicalQuery = %s", got)
+	}
+}
@@ -0,0 +1,645 @@
+package vod
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/onnwee/vod-tender/backend/youtubeapi"
+)
+
+// Segment types. Parts are cut out of the VOD with ffmpeg stream copy and uploaded to
+// YouTube as separate videos; the other types are metadata only (see docs/SEGMENTATION_API.md).
+const (
+	SegmentPart      = "part"
+	SegmentHighlight = "highlight"
+	SegmentChapter   = "chapter"
+	SegmentBookmark  = "bookmark"
+	SegmentClip      = "clip"
+)
+
+const (
+	maxSegmentsPerVOD     = 100
+	maxSegmentTitle       = 200
+	maxSegmentDescription = 2000
+	maxSegmentTags        = 10
+	maxSegmentTagLength   = 50
+	maxSegmentMetadata    = 5 << 10
+
+	// DefaultMaxPartDuration is YouTube's maximum video length; longer VODs are split
+	// into parts automatically unless SEGMENT_MAX_DURATION says otherwise.
+	DefaultMaxPartDuration = 12 * time.Hour
+)
+
+var (
+	// ErrInvalidSegment reports a segment field that fails validation.
+	ErrInvalidSegment = errors.New("invalid segment")
+	// ErrInvalidSegmentTimes reports an end time not after the start or past the VOD's end.
+	ErrInvalidSegmentTimes = errors.New("invalid segment times")
+	// ErrSegmentNotFound is returned when the segment does not exist for the VOD.
+	ErrSegmentNotFound = errors.New("segment not found")
+)
+
+// Segment is a named time range of a VOD.
+type Segment struct {
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+	Metadata       json.RawMessage `json:"metadata,omitempty"`
+	ID             string          `json:"id"`
+	VodID          string          `json:"vod_id"`
+	Type           string          `json:"type"`
+	Title          string          `json:"title"`
+	Description    string          `json:"description,omitempty"`
+	UploadStatus   string          `json:"upload_status,omitempty"`
+	UploadURL      string          `json:"upload_url,omitempty"`
+	UploadError    string          `json:"upload_error,omitempty"`
+	Tags           []string        `json:"tags"`
+	StartTime      float64         `json:"start_time"`
+	EndTime        float64         `json:"end_time"`
+	Duration       float64         `json:"duration"`
+	UploadAttempts int             `json:"upload_attempts"`
+	Auto           bool            `json:"auto"`
+}
+
+// SegmentInput is a create request or a partial update; nil fields are left unchanged.
+type SegmentInput struct {
+	Type        *string         `json:"type"`
+	Title       *string         `json:"title"`
+	StartTime   *float64        `json:"start_time"`
+	EndTime     *float64        `json:"end_time"`
+	Description *string         `json:"description"`
+	Tags        *[]string       `json:"tags"`
+	Metadata    json.RawMessage `json:"metadata"`
+}
+
+const segmentColumns = `id, vod_id, type, title, start_time, end_time, COALESCE(description,''), tags, metadata, auto,
+	COALESCE(upload_status,''), COALESCE(upload_url,''), COALESCE(upload_error,''), upload_attempts, created_at, updated_at`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSegment(row rowScanner) (Segment, error) {
+	var s Segment
+	var tags, meta []byte
+	if err := row.Scan(&s.ID, &s.VodID, &s.Type, &s.Title, &s.StartTime, &s.EndTime, &s.Description, &tags, &meta, &s.Auto,
+		&s.UploadStatus, &s.UploadURL, &s.UploadError, &s.UploadAttempts, &s.CreatedAt, &s.UpdatedAt); err != nil {
+		return s, err
+	}
+	s.Tags = []string{}
+	_ = json.Unmarshal(tags, &s.Tags)
+	if len(meta) > 0 && string(meta) != "null" {
+		s.Metadata = json.RawMessage(meta)
+	}
+	s.Duration = s.EndTime - s.StartTime
+	return s, nil
+}
+
+var segmentSorts = map[string]string{
+	"":              "start_time ASC, created_at ASC",
+	"start_asc":     "start_time ASC, created_at ASC",
+	"start_desc":    "start_time DESC, created_at DESC",
+	"created_asc":   "created_at ASC",
+	"created_desc":  "created_at DESC",
+	"duration_desc": "end_time - start_time DESC, start_time ASC",
+}
+
+// ListSegments returns a VOD's segments, optionally filtered by type, in the given sort
+// order (start_asc, start_desc, created_asc, created_desc, duration_desc).
+func ListSegments(ctx context.Context, dbc *sql.DB, vodID string, types []string, sort string) ([]Segment, error) {
+	order, ok := segmentSorts[sort]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown sort %q", ErrInvalidSegment, sort)
+	}
+	query := `SELECT ` + segmentColumns + ` FROM vod_segments WHERE vod_id=$1`
+	args := []any{vodID}
+	if len(types) > 0 {
+		ph := make([]string, 0, len(types))
+		for _, t := range types {
+			if !validSegmentType(t) {
+				return nil, fmt.Errorf("%w: unknown type %q", ErrInvalidSegment, t)
+			}
+			args = append(args, t)
+			ph = append(ph, "$"+strconv.Itoa(len(args)))
+		}
+		query += ` AND type IN (` + strings.Join(ph, ",") + `)`
+	}
+	//nolint:gosec // G202: ORDER BY comes from the fixed segmentSorts map, filters are parameterized
+	rows, err := dbc.QueryContext(ctx, query+` ORDER BY `+order, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			slog.Warn("failed to close rows", slog.Any("err", err))
+		}
+	}()
+	out := []Segment{}
+	for rows.Next() {
+		s, err := scanSegment(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+// GetSegment loads one segment of a VOD.
+func GetSegment(ctx context.Context, dbc *sql.DB, vodID, segID string) (Segment, error) {
+	s, err := scanSegment(dbc.QueryRowContext(ctx, `SELECT `+segmentColumns+` FROM vod_segments WHERE vod_id=$1 AND id=$2`, vodID, segID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return s, ErrSegmentNotFound
+	}
+	return s, err
+}
+
+// CreateSegment validates and stores a new segment. It returns sql.ErrNoRows when the VOD
+// does not exist. The type defaults to "part".
+func CreateSegment(ctx context.Context, dbc *sql.DB, vodID string, in SegmentInput) (Segment, error) {
+	var channel string
+	var duration int
+	if err := dbc.QueryRowContext(ctx, `SELECT channel, COALESCE(duration_seconds,0) FROM vods WHERE twitch_vod_id=$1`, vodID).Scan(&channel, &duration); err != nil {
+		return Segment{}, err
+	}
+	s := Segment{VodID: vodID, Type: SegmentPart, Tags: []string{}}
+	if in.Title == nil || in.StartTime == nil || in.EndTime == nil {
+		return Segment{}, fmt.Errorf("%w: title, start_time and end_time are required", ErrInvalidSegment)
+	}
+	applySegmentInput(&s, in)
+	if err := validateSegment(s, duration); err != nil {
+		return Segment{}, err
+	}
+	var count int
+	_ = dbc.QueryRowContext(ctx, `SELECT COUNT(*) FROM vod_segments WHERE vod_id=$1`, vodID).Scan(&count)
+	if count >= maxSegmentsPerVOD {
+		return Segment{}, fmt.Errorf("%w: at most %d segments per VOD", ErrInvalidSegment, maxSegmentsPerVOD)
+	}
+	s.ID = newSegmentID()
+	if err := insertSegment(ctx, dbc, channel, s); err != nil {
+		return Segment{}, err
+	}
+	return GetSegment(ctx, dbc, vodID, s.ID)
+}
+
+// UpdateSegment applies a partial update. Moving a part's start or end resets its upload
+// state so the new cut is uploaded.
+func UpdateSegment(ctx context.Context, dbc *sql.DB, vodID, segID string, in SegmentInput) (Segment, error) {
+	s, err := GetSegment(ctx, dbc, vodID, segID)
+	if err != nil {
+		return s, err
+	}
+	oldStart, oldEnd, oldType := s.StartTime, s.EndTime, s.Type
+	applySegmentInput(&s, in)
+	var duration int
+	_ = dbc.QueryRowContext(ctx, `SELECT COALESCE(duration_seconds,0) FROM vods WHERE twitch_vod_id=$1`, vodID).Scan(&duration)
+	if err := validateSegment(s, duration); err != nil {
+		return s, err
+	}
+	tags, _ := json.Marshal(s.Tags)
+	_, err = dbc.ExecContext(ctx, `UPDATE vod_segments SET type=$3, title=$4, start_time=$5, end_time=$6, description=NULLIF($7,''), tags=$8, metadata=$9, updated_at=NOW()
+		WHERE vod_id=$1 AND id=$2`, vodID, segID, s.Type, s.Title, s.StartTime, s.EndTime, s.Description, string(tags), nullJSON(s.Metadata))
+	if err != nil {
+		return s, err
+	}
+	if s.Type != oldType || s.StartTime != oldStart || s.EndTime != oldEnd {
+		_, _ = dbc.ExecContext(ctx, `UPDATE vod_segments SET upload_status=NULL, upload_url=NULL, upload_error=NULL, upload_attempts=0,
+			session_uri=NULL, session_offset=0, session_size=NULL WHERE vod_id=$1 AND id=$2`, vodID, segID)
+	}
+	return GetSegment(ctx, dbc, vodID, segID)
+}
+
+// DeleteSegment removes a segment.
+func DeleteSegment(ctx context.Context, dbc *sql.DB, vodID, segID string) error {
+	res, err := dbc.ExecContext(ctx, `DELETE FROM vod_segments WHERE vod_id=$1 AND id=$2`, vodID, segID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrSegmentNotFound
+	}
+	return nil
+}
+
+// AutoSplitParts replaces the VOD's automatic parts with equal parts no longer than max,
+// using the known VOD duration. Manually defined parts are never replaced. A VOD that fits
+// in max gets no parts.
+func AutoSplitParts(ctx context.Context, dbc *sql.DB, vodID string, max time.Duration) ([]Segment, error) {
+	var channel string
+	var duration int
+	if err := dbc.QueryRowContext(ctx, `SELECT channel, COALESCE(duration_seconds,0) FROM vods WHERE twitch_vod_id=$1`, vodID).Scan(&channel, &duration); err != nil {
+		return nil, err
+	}
+	if duration <= 0 {
+		return nil, fmt.Errorf("%w: vod duration unknown", ErrInvalidSegment)
+	}
+	if max <= 0 {
+		return nil, fmt.Errorf("%w: max duration must be positive", ErrInvalidSegment)
+	}
+	if err := createAutoParts(ctx, dbc, vodID, channel, float64(duration), max); err != nil {
+		return nil, err
+	}
+	return ListSegments(ctx, dbc, vodID, []string{SegmentPart}, "")
+}
+
+func createAutoParts(ctx context.Context, dbc *sql.DB, vodID, channel string, total float64, max time.Duration) error {
+	var manual, uploaded int
+	_ = dbc.QueryRowContext(ctx, `SELECT COUNT(*) FILTER (WHERE NOT auto), COUNT(*) FILTER (WHERE upload_status='succeeded')
+		FROM vod_segments WHERE vod_id=$1 AND type='part'`, vodID).Scan(&manual, &uploaded)
+	if manual > 0 {
+		return fmt.Errorf("%w: vod has manually defined parts", ErrInvalidSegment)
+	}
+	if uploaded > 0 {
+		return fmt.Errorf("%w: parts were already uploaded", ErrInvalidSegment)
+	}
+	tx, err := dbc.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if _, err := tx.ExecContext(ctx, `DELETE FROM vod_segments WHERE vod_id=$1 AND type='part' AND auto`, vodID); err != nil {
+		return err
+	}
+	for i, r := range splitRanges(total, max.Seconds()) {
+		s := Segment{ID: newSegmentID(), VodID: vodID, Type: SegmentPart, Title: fmt.Sprintf("Part %d", i+1), StartTime: r[0], EndTime: r[1], Tags: []string{}, Auto: true}
+		if err := insertSegment(ctx, tx, channel, s); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// splitRanges cuts [0,total) into the fewest equal ranges no longer than max.
+// A total that already fits yields no ranges.
+func splitRanges(total, max float64) [][2]float64 {
+	if total <= max || max <= 0 {
+		return nil
+	}
+	n := int(math.Ceil(total / max))
+	step := total / float64(n)
+	out := make([][2]float64, 0, n)
+	for i := 0; i < n; i++ {
+		end := math.Round(step*float64(i+1)*1000) / 1000
+		if i == n-1 {
+			end = total
+		}
+		start := 0.0
+		if i > 0 {
+			start = out[i-1][1]
+		}
+		out = append(out, [2]float64{start, end})
+	}
+	return out
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func insertSegment(ctx context.Context, dbc execer, channel string, s Segment) error {
+	tags, _ := json.Marshal(s.Tags)
+	_, err := dbc.ExecContext(ctx, `INSERT INTO vod_segments (id, vod_id, channel, type, title, start_time, end_time, description, tags, metadata, auto, created_at, updated_at)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,NULLIF($8,''),$9,$10,$11,NOW(),NOW())`,
+		s.ID, s.VodID, channel, s.Type, s.Title, s.StartTime, s.EndTime, s.Description, string(tags), nullJSON(s.Metadata), s.Auto)
+	return err
+}
+
+func nullJSON(b json.RawMessage) any {
+	if len(b) == 0 || string(b) == "null" {
+		return nil
+	}
+	return string(b)
+}
+
+func applySegmentInput(s *Segment, in SegmentInput) {
+	if in.Type != nil {
+		s.Type = strings.ToLower(strings.TrimSpace(*in.Type))
+	}
+	if in.Title != nil {
+		s.Title = strings.TrimSpace(*in.Title)
+	}
+	if in.StartTime != nil {
+		s.StartTime = *in.StartTime
+	}
+	if in.EndTime != nil {
+		s.EndTime = *in.EndTime
+	}
+	if in.Description != nil {
+		s.Description = strings.TrimSpace(*in.Description)
+	}
+	if in.Tags != nil {
+		s.Tags = make([]string, 0, len(*in.Tags))
+		for _, t := range *in.Tags {
+			if t = strings.TrimSpace(t); t != "" {
+				s.Tags = append(s.Tags, t)
+			}
+		}
+	}
+	if in.Metadata != nil {
+		s.Metadata = in.Metadata
+	}
+}
+
+func validSegmentType(t string) bool {
+	switch t {
+	case SegmentPart, SegmentHighlight, SegmentChapter, SegmentBookmark, SegmentClip:
+		return true
+	}
+	return false
+}
+
+// validateSegment checks a segment against the rules in docs/SEGMENTATION_API.md;
+// durationSeconds <= 0 means the VOD length is unknown and the end is not bounded.
+func validateSegment(s Segment, durationSeconds int) error {
+	switch {
+	case !validSegmentType(s.Type):
+		return fmt.Errorf("%w: type must be one of part, highlight, chapter, bookmark, clip", ErrInvalidSegment)
+	case s.Title == "":
+		return fmt.Errorf("%w: title is required", ErrInvalidSegment)
+	case len([]rune(s.Title)) > maxSegmentTitle:
+		return fmt.Errorf("%w: title longer than %d characters", ErrInvalidSegment, maxSegmentTitle)
+	case len([]rune(s.Description)) > maxSegmentDescription:
+		return fmt.Errorf("%w: description longer than %d characters", ErrInvalidSegment, maxSegmentDescription)
+	case len(s.Tags) > maxSegmentTags:
+		return fmt.Errorf("%w: at most %d tags", ErrInvalidSegment, maxSegmentTags)
+	case len(s.Metadata) > maxSegmentMetadata:
+		return fmt.Errorf("%w: metadata larger than %d bytes", ErrInvalidSegment, maxSegmentMetadata)
+	case s.StartTime < 0 || math.IsNaN(s.StartTime) || math.IsNaN(s.EndTime):
+		return fmt.Errorf("%w: start_time must be non-negative", ErrInvalidSegment)
+	case s.EndTime <= s.StartTime:
+		return fmt.Errorf("%w: end_time must be after start_time", ErrInvalidSegmentTimes)
+	case durationSeconds > 0 && s.EndTime > float64(durationSeconds):
+		return fmt.Errorf("%w: end_time past the VOD duration (%ds)", ErrInvalidSegmentTimes, durationSeconds)
+	}
+	for _, t := range s.Tags {
+		if len([]rune(t)) > maxSegmentTagLength {
+			return fmt.Errorf("%w: tag longer than %d characters", ErrInvalidSegment, maxSegmentTagLength)
+		}
+	}
+	if len(s.Metadata) > 0 {
+		var obj map[string]any
+		if err := json.Unmarshal(s.Metadata, &obj); err != nil {
+			return fmt.Errorf("%w: metadata must be a JSON object", ErrInvalidSegment)
+		}
+	}
+	return nil
+}
+
+func newSegmentID() string {
+	b := make([]byte, 12)
+	_, _ = rand.Read(b)
+	return "seg_" + hex.EncodeToString(b)
+}
+
+// maxPartDuration resolves the automatic split length: kv segment_max_duration, then
+// SEGMENT_MAX_DURATION, then DefaultMaxPartDuration. "0" disables automatic parts.
+func maxPartDuration(ctx context.Context, dbc *sql.DB, channel string) time.Duration {
+	v := strings.TrimSpace(channelSetting(ctx, dbc, channel, "segment_max_duration", "SEGMENT_MAX_DURATION"))
+	if v == "" {
+		return DefaultMaxPartDuration
+	}
+	if v == "0" {
+		return 0
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		slog.Warn("invalid segment max duration; using default", slog.String("value", v))
+		return DefaultMaxPartDuration
+	}
+	return d
+}
+
+// ensureAutoParts splits an over-long VOD into parts before its YouTube upload unless
+// parts were already defined. The duration comes from the catalog or, failing that, ffprobe.
+func ensureAutoParts(ctx context.Context, job *Job) error {
+	var parts int
+	if err := job.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM vod_segments WHERE vod_id=$1 AND type='part'`, job.ID).Scan(&parts); err != nil || parts > 0 {
+		return err
+	}
+	max := maxPartDuration(ctx, job.DB, job.Channel)
+	if max <= 0 {
+		return nil
+	}
+	var duration float64
+	_ = job.DB.QueryRowContext(ctx, `SELECT COALESCE(duration_seconds,0) FROM vods WHERE twitch_vod_id=$1`, job.ID).Scan(&duration)
+	if duration <= 0 {
+		if d, err := probeDuration(ctx, job.File()); err == nil {
+			duration = d
+		}
+	}
+	if duration <= max.Seconds() {
+		return nil
+	}
+	job.Logger.Info("splitting vod into parts", slog.Float64("duration_seconds", duration), slog.Duration("max", max))
+	return createAutoParts(ctx, job.DB, job.ID, job.Channel, duration, max)
+}
+
+// partPath is where a part of file is cut to: <base>.<segment id>_<start ms>-<end ms><ext>.
+// The bounds are part of the name so a part whose times changed is cut again.
+func partPath(file string, seg Segment) string {
+	ext := filepath.Ext(file)
+	return fmt.Sprintf("%s.%s_%d-%d%s", strings.TrimSuffix(file, ext), seg.ID,
+		int64(math.Round(seg.StartTime*1000)), int64(math.Round(seg.EndTime*1000)), ext)
+}
+
+// removeStaleCuts deletes cuts of file that belong to no current part: parts that were
+// re-split, edited or deleted, and cuts named by part number by earlier versions.
+func removeStaleCuts(logger *slog.Logger, file string, parts []Segment) {
+	keep := make(map[string]bool, len(parts))
+	for _, p := range parts {
+		keep[filepath.Base(partPath(file, p))] = true
+	}
+	ext := filepath.Ext(file)
+	base := strings.TrimSuffix(filepath.Base(file), ext)
+	entries, err := os.ReadDir(filepath.Dir(file))
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || keep[name] || !strings.HasSuffix(name, ext) ||
+			(!strings.HasPrefix(name, base+".seg_") && !strings.HasPrefix(name, base+".part")) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(filepath.Dir(file), name)); err == nil {
+			logger.Info("removed stale part cut", slog.String("file", name))
+		}
+	}
+}
+
+// cutSegment copies [start,end) of in to out without re-encoding. Seeking snaps to the
+// keyframe at or before start, so a part may begin slightly early.
+func cutSegment(ctx context.Context, in, out string, start, end float64) error {
+	ffmpeg, ok := findTool("ffmpeg")
+	if !ok {
+		return errors.New("ffmpeg not found")
+	}
+	ext := filepath.Ext(out)
+	tmp := strings.TrimSuffix(out, ext) + ".tmp" + ext
+	//nolint:gosec // G204: tool path resolved from PATH, args are controlled
+	cmd := exec.CommandContext(ctx, ffmpeg, "-y", "-v", "error",
+		"-ss", strconv.FormatFloat(start, 'f', 3, 64), "-i", in,
+		"-t", strconv.FormatFloat(end-start, 'f', 3, 64),
+		"-map", "0", "-c", "copy", "-avoid_negative_ts", "make_zero", tmp)
+	if b, err := cmd.CombinedOutput(); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("ffmpeg cut: %w: %s", err, strings.TrimSpace(string(b)))
+	}
+	return os.Rename(tmp, out)
+}
+
+// segmentUpload identifies the part being uploaded (carried in the upload context).
+type segmentUpload struct {
+	seg    Segment
+	number int
+	count  int
+}
+
+type vodSegmentCtxKey struct{}
+
+// uploadParts uploads each part of the VOD as its own video. Parts that already succeeded
+// are skipped, and a failing part does not stop the others. It returns the first part's URL.
+func uploadParts(ctx context.Context, logger *slog.Logger, up Uploader, job *Job, parts []Segment) (string, int, error) {
+	dbc := job.DB
+	var failed []error
+	firstURL := ""
+	total := 0
+	removeStaleCuts(logger, job.File(), parts)
+	for i, p := range parts {
+		plog := logger.With(slog.String("segment", p.ID), slog.Int("part", i+1))
+		if p.UploadStatus == uploadSucceeded {
+			if i == 0 {
+				firstURL = p.UploadURL
+			}
+			continue
+		}
+		path := partPath(job.File(), p)
+		if !fileExists(path) {
+			if err := cutSegment(ctx, job.File(), path, p.StartTime, p.EndTime); err != nil {
+				markSegmentUpload(dbc, p.ID, uploadFailed, "", 0, err)
+				failed = append(failed, fmt.Errorf("part %d: %w", i+1, err))
+				continue
+			}
+		}
+		markSegmentUpload(dbc, p.ID, uploadRunning, "", 0, nil)
+		pctx := context.WithValue(ctx, vodSegmentCtxKey{}, segmentUpload{seg: p, number: i + 1, count: len(parts)})
+		url, attempts, err := uploadFileWithRetry(pctx, plog, up, job, path)
+		total += attempts
+		if err != nil {
+			markSegmentUpload(dbc, p.ID, uploadFailed, "", attempts, err)
+			if ctx.Err() != nil {
+				return "", total, ctx.Err()
+			}
+			failed = append(failed, fmt.Errorf("part %d: %w", i+1, err))
+			continue
+		}
+		markSegmentUpload(dbc, p.ID, uploadSucceeded, url, attempts, nil)
+		plog.Info("part uploaded", slog.String("url", url))
+		_ = os.Remove(path)
+		if i == 0 {
+			firstURL = url
+		}
+	}
+	if len(failed) > 0 {
+		return "", total, errors.Join(failed...)
+	}
+	return firstURL, total, nil
+}
+
+func markSegmentUpload(dbc *sql.DB, segID, status, url string, attempts int, uploadErr error) {
+	// Use a fresh context so failures are recorded even when the upload was canceled.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	errText := ""
+	if uploadErr != nil {
+		errText = uploadErr.Error()
+	}
+	_, _ = dbc.ExecContext(ctx, `UPDATE vod_segments SET upload_status=$2, upload_url=COALESCE(NULLIF($3,''), upload_url),
+		upload_error=NULLIF($4,''), upload_attempts=upload_attempts+$5, updated_at=NOW() WHERE id=$1`,
+		segID, status, url, errText, attempts)
+}
+
+// segmentSessionStore keeps a part's resumable YouTube session on its vod_segments row.
+type segmentSessionStore struct {
+	db    *sql.DB
+	segID string
+}
+
+func (s *segmentSessionStore) LoadUploadSession(ctx context.Context) (youtubeapi.UploadSession, bool, error) {
+	var uri sql.NullString
+	var off, size sql.NullInt64
+	err := s.db.QueryRowContext(ctx, `SELECT session_uri, session_offset, session_size FROM vod_segments WHERE id=$1`, s.segID).Scan(&uri, &off, &size)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !uri.Valid) {
+		return youtubeapi.UploadSession{}, false, nil
+	}
+	if err != nil {
+		return youtubeapi.UploadSession{}, false, err
+	}
+	return youtubeapi.UploadSession{URI: uri.String, Offset: off.Int64, Size: size.Int64}, true, nil
+}
+
+func (s *segmentSessionStore) SaveUploadSession(ctx context.Context, sess youtubeapi.UploadSession) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE vod_segments SET session_uri=$2, session_offset=$3, session_size=$4, updated_at=NOW() WHERE id=$1`,
+		s.segID, sess.URI, sess.Offset, sess.Size)
+	return err
+}
+
+func (s *segmentSessionStore) ClearUploadSession(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE vod_segments SET session_uri=NULL, session_offset=0, session_size=NULL WHERE id=$1`, s.segID)
+	return err
+}
+
+// fillPartData narrows the template data to one part: its title and position, and the
+// chapters falling inside it.
+func fillPartData(ctx context.Context, dbc *sql.DB, data *VideoTemplateData, su segmentUpload) {
+	data.PartTitle = su.seg.Title
+	data.PartNumber = su.number
+	data.PartCount = su.count
+	data.PartStart = time.Duration(su.seg.StartTime * float64(time.Second))
+	data.PartEnd = time.Duration(su.seg.EndTime * float64(time.Second))
+	data.DurationSeconds = int(su.seg.EndTime - su.seg.StartTime)
+	data.Duration = data.PartEnd - data.PartStart
+	data.Chapters = ""
+	if dbc == nil || data.ID == "" || !chaptersEnabled() {
+		return
+	}
+	if chapters, err := LoadChapters(ctx, dbc, data.ID); err == nil {
+		window := chaptersForWindow(chapters, int(su.seg.StartTime), int(su.seg.EndTime))
+		data.Chapters = formatChapterList(window, data.DurationSeconds)
+	}
+}
+
+// chaptersForWindow returns the chapters inside [start,end) shifted to the window's start;
+// the chapter already running at start becomes the first one at 0.
+func chaptersForWindow(chapters []Chapter, start, end int) []Chapter {
+	var out []Chapter
+	var current *Chapter
+	for i := range chapters {
+		c := chapters[i]
+		switch {
+		case c.StartSeconds <= start:
+			current = &chapters[i]
+		case c.StartSeconds < end:
+			c.StartSeconds -= start
+			out = append(out, c)
+		}
+	}
+	if current != nil {
+		first := *current
+		first.StartSeconds = 0
+		out = append([]Chapter{first}, out...)
+	}
+	return out
+}
@@ -0,0 +1,198 @@
+package vod
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/onnwee/vod-tender/backend/config"
+)
+
+func TestSplitRanges(t *testing.T) {
+	if got := splitRanges(3600, 12*3600); got != nil {
+		t.Fatalf("short vod split into %v", got)
+	}
+	got := splitRanges(30*3600, 12*3600)
+	if len(got) != 3 {
+		t.Fatalf("splitRanges = %v", got)
+	}
+	for i, r := range got {
+		if r[1]-r[0] > 12*3600 {
+			t.Fatalf("part %d too long: %v", i, r)
+		}
+		if i > 0 && r[0] != got[i-1][1] {
+			t.Fatalf("gap between parts: %v", got)
+		}
+	}
+	if got[0][0] != 0 || got[2][1] != 30*3600 || got[0][1] != 10*3600 {
+		t.Fatalf("unexpected bounds %v", got)
+	}
+}
+
+func TestValidateSegment(t *testing.T) {
+	ok := Segment{Type: SegmentPart, Title: "Part 1", StartTime: 0, EndTime: 60, Tags: []string{"a"}}
+	if err := validateSegment(ok, 120); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name   string
+		mutate func(*Segment)
+		want   error
+	}{
+		{"unknown type", func(s *Segment) { s.Type = "scene" }, ErrInvalidSegment},
+		{"missing title", func(s *Segment) { s.Title = "" }, ErrInvalidSegment},
+		{"long title", func(s *Segment) { s.Title = strings.Repeat("x", maxSegmentTitle+1) }, ErrInvalidSegment},
+		{"too many tags", func(s *Segment) { s.Tags = make([]string, maxSegmentTags+1) }, ErrInvalidSegment},
+		{"metadata not an object", func(s *Segment) { s.Metadata = json.RawMessage(`[1]`) }, ErrInvalidSegment},
+		{"negative start", func(s *Segment) { s.StartTime = -1 }, ErrInvalidSegment},
+		{"end before start", func(s *Segment) { s.EndTime = 0 }, ErrInvalidSegmentTimes},
+		{"end past vod", func(s *Segment) { s.EndTime = 121 }, ErrInvalidSegmentTimes},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := ok
+			tc.mutate(&s)
+			if err := validateSegment(s, 120); !errors.Is(err, tc.want) {
+				t.Fatalf("validateSegment = %v want %v", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestChaptersForWindow(t *testing.T) {
+	chapters := []Chapter{{StartSeconds: 0, Title: "A"}, {StartSeconds: 500, Title: "B"}, {StartSeconds: 1500, Title: "C"}, {StartSeconds: 2500, Title: "D"}}
+	got := chaptersForWindow(chapters, 1000, 2000)
+	if len(got) != 2 || got[0].Title != "B" || got[0].StartSeconds != 0 || got[1].Title != "C" || got[1].StartSeconds != 500 {
+		t.Fatalf("chaptersForWindow = %+v", got)
+	}
+	if p := partPath("/data/twitch_1.mp4", Segment{ID: "seg_ab", StartTime: 43200, EndTime: 86400.5}); p != "/data/twitch_1.seg_ab_43200000-86400500.mp4" {
+		t.Fatalf("partPath = %s", p)
+	}
+}
+
+func TestDefaultTemplatesForPart(t *testing.T) {
+	for _, k := range []string{"YOUTUBE_TITLE_TEMPLATE", "YOUTUBE_DESCRIPTION_TEMPLATE"} {
+		t.Setenv(k, "")
+	}
+	data := VideoTemplateData{ID: "5", Title: "Marathon", Date: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	fillPartData(context.Background(), nil, &data, segmentUpload{seg: Segment{Title: "Part 2", StartTime: 43200, EndTime: 86400}, number: 2, count: 3})
+	md, err := renderVideoMetadata(context.Background(), nil, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.Title != "2024-01-01 Marathon - Part 2" {
+		t.Fatalf("title = %q", md.Title)
+	}
+	if !strings.HasPrefix(md.Description, "Part 2 of 3, starting at 12:00:00 into the original stream.\nOriginal stream date:") {
+		t.Fatalf("description = %q", md.Description)
+	}
+}
+
+// pathUploader records uploaded paths and fails those listed in fail.
+type pathUploader struct {
+	uploaded *[]string
+	fail     map[string]bool
+}
+
+func (u pathUploader) Upload(ctx context.Context, dbc *sql.DB, path, title string, date time.Time) (string, error) {
+	if u.fail[path] {
+		return "", errors.New("quota exceeded")
+	}
+	*u.uploaded = append(*u.uploaded, path)
+	return "https://youtu.be/" + filepath.Base(path), nil
+}
+
+func TestSegmentsCRUDAndPartUploads(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	channel := "segments-chan"
+	id := "segments_1"
+	t.Cleanup(func() {
+		_, _ = db.Exec(`DELETE FROM vods WHERE channel=$1`, channel)
+	})
+	if _, err := db.ExecContext(ctx, `INSERT INTO vods (channel,twitch_vod_id,title,date,duration_seconds,created_at)
+		VALUES ($1,$2,'Segments',NOW(),90000,NOW()) ON CONFLICT (twitch_vod_id) DO NOTHING`, channel, id); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = db.ExecContext(ctx, `DELETE FROM vod_segments WHERE vod_id=$1`, id)
+
+	title, start, end, typ := "Boss", 100.0, 200.0, SegmentHighlight
+	hl, err := CreateSegment(ctx, db, id, SegmentInput{Type: &typ, Title: &title, StartTime: &start, EndTime: &end, Metadata: json.RawMessage(`{"color":"#fff"}`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hl.ID, "seg_") || hl.Duration != 100 || string(hl.Metadata) == "" {
+		t.Fatalf("created segment %+v", hl)
+	}
+	if _, err := CreateSegment(ctx, db, "no_such_vod", SegmentInput{Title: &title, StartTime: &start, EndTime: &end}); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("expected sql.ErrNoRows for unknown vod, got %v", err)
+	}
+	newTitle := "Boss kill"
+	if hl, err = UpdateSegment(ctx, db, id, hl.ID, SegmentInput{Title: &newTitle}); err != nil || hl.Title != newTitle || hl.StartTime != 100 {
+		t.Fatalf("UpdateSegment = %+v, %v", hl, err)
+	}
+
+	parts, err := AutoSplitParts(ctx, db, id, 12*time.Hour)
+	if err != nil || len(parts) != 3 {
+		t.Fatalf("AutoSplitParts = %d parts, %v", len(parts), err)
+	}
+	if all, _ := ListSegments(ctx, db, id, nil, "duration_desc"); len(all) != 4 || all[3].ID != hl.ID {
+		t.Fatalf("ListSegments = %+v", all)
+	}
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "twitch_segments.mp4")
+	stale := partPath(src, Segment{ID: parts[1].ID, StartTime: 0, EndTime: 60})
+	for _, p := range []string{src, partPath(src, parts[0]), partPath(src, parts[1]), partPath(src, parts[2]), stale} {
+		if err := os.WriteFile(p, []byte("video"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("UPLOAD_MAX_ATTEMPTS", "1")
+	job := &Job{DB: db, Logger: slog.Default(), ID: id, Channel: channel, Date: time.Now(), Config: config.ChannelConfigFromEnv(channel)}
+	job.Set(ArtifactFile, src)
+
+	var uploaded []string
+	up := pathUploader{uploaded: &uploaded, fail: map[string]bool{partPath(src, parts[1]): true}}
+	if _, _, err := uploadParts(ctx, slog.Default(), up, job, parts); err == nil {
+		t.Fatal("expected error while part 2 fails")
+	}
+	if len(uploaded) != 2 {
+		t.Fatalf("uploaded %v", uploaded)
+	}
+	if fileExists(stale) {
+		t.Fatal("expected the cut with outdated bounds to be removed")
+	}
+	parts, _ = ListSegments(ctx, db, id, []string{SegmentPart}, "")
+	if parts[0].UploadStatus != uploadSucceeded || parts[1].UploadStatus != uploadFailed || parts[2].UploadStatus != uploadSucceeded {
+		t.Fatalf("part states %s/%s/%s", parts[0].UploadStatus, parts[1].UploadStatus, parts[2].UploadStatus)
+	}
+	if _, err := AutoSplitParts(ctx, db, id, 6*time.Hour); !errors.Is(err, ErrInvalidSegment) {
+		t.Fatalf("expected re-split of uploaded parts to fail, got %v", err)
+	}
+
+	// Only the failed part is retried.
+	uploaded = nil
+	up.fail = nil
+	url, _, err := uploadParts(ctx, slog.Default(), up, job, parts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(uploaded) != 1 || uploaded[0] != partPath(src, parts[1]) || url != "https://youtu.be/"+filepath.Base(partPath(src, parts[0])) {
+		t.Fatalf("retry uploaded %v, url %s", uploaded, url)
+	}
+
+	if err := DeleteSegment(ctx, db, id, hl.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetSegment(ctx, db, id, hl.ID); !errors.Is(err, ErrSegmentNotFound) {
+		t.Fatalf("expected ErrSegmentNotFound, got %v", err)
+	}
+}
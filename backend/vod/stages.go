@@ -0,0 +1,458 @@
+package vod
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/onnwee/vod-tender/backend/config"
+	"github.com/onnwee/vod-tender/backend/telemetry"
+)
+
+// downloadStage wraps the configured Downloader.
+type downloadStage struct{}
+
+func (downloadStage) Name() string { return "download" }
+
+func (downloadStage) Run(ctx context.Context, job *Job) error {
+	start := time.Now()
+	path, err := downloader.Download(context.WithValue(ctx, channelConfigCtxKey{}, job.Config), job.DB, job.ID, job.DataDir)
+	dur := time.Since(start)
+	if err != nil {
+		return err
+	}
+	telemetry.DownloadsSucceeded.Inc()
+	telemetry.DownloadDuration.Observe(dur.Seconds())
+	job.Logger.Info("download complete", slog.String("path", path), slog.Duration("download_duration", dur))
+	resetCircuit(ctx, job.DB, job.Config)
+	_, _ = job.DB.ExecContext(ctx, `UPDATE vods SET downloaded_path=$1, updated_at=NOW() WHERE twitch_vod_id=$2`, path, job.ID)
+	setStatus(ctx, job.DB, job.Logger, job.ID, StatusDownloaded, "download complete")
+	updateMovingAvg(ctx, job.DB, job.Channel, "avg_download_ms", float64(dur.Milliseconds()))
+	job.Set(ArtifactFile, path)
+	return nil
+}
+
+// Resume reuses a previous download only while its file is still on disk.
+func (downloadStage) Resume(ctx context.Context, job *Job, prev StageResult) bool {
+	path := prev.Outputs[ArtifactFile]
+	if path == "" {
+		return false
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Size() == 0 {
+		return false
+	}
+	_, _ = job.DB.ExecContext(ctx, `UPDATE vods SET downloaded_path=$1, updated_at=NOW() WHERE twitch_vod_id=$2`, path, job.ID)
+	setStatus(ctx, job.DB, job.Logger, job.ID, StatusDownloaded, "resumed: download already complete")
+	return true
+}
+
+// verifyStage checks the downloaded file is non-empty and, when ffprobe is available and
+// the expected duration is known, that its duration is at least VERIFY_MIN_DURATION_RATIO
+// (default 0.9) of it. A bad file is removed and the download stage is invalidated so the
+// next attempt downloads again.
+type verifyStage struct{}
+
+func (verifyStage) Name() string { return "verify" }
+
+func (verifyStage) Run(ctx context.Context, job *Job) error {
+	path := job.File()
+	err := verifyMedia(ctx, job, path)
+	if err != nil {
+		job.Logger.Warn("verification failed; discarding download", slog.String("path", path), slog.Any("err", err))
+		_ = os.Remove(path)
+		_, _ = job.DB.ExecContext(ctx, `UPDATE vods SET downloaded_path=NULL, updated_at=NOW() WHERE twitch_vod_id=$1`, job.ID)
+		invalidateStage(ctx, job.DB, job.ID, "download")
+	}
+	return err
+}
+
+func verifyMedia(ctx context.Context, job *Job, path string) error {
+	if path == "" {
+		return errors.New("no file to verify")
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("stat: %w", err)
+	}
+	if fi.Size() == 0 {
+		return errors.New("file is empty")
+	}
+	if _, ok := findTool("ffprobe"); !ok {
+		return nil
+	}
+	var expected int
+	_ = job.DB.QueryRowContext(ctx, `SELECT COALESCE(duration_seconds,0) FROM vods WHERE twitch_vod_id=$1`, job.ID).Scan(&expected)
+	if expected <= 0 {
+		return nil
+	}
+	got, err := probeDuration(ctx, path)
+	if err != nil {
+		return err
+	}
+	ratio := 0.9
+	if s := os.Getenv("VERIFY_MIN_DURATION_RATIO"); s != "" {
+		if f, err := strconv.ParseFloat(s, 64); err == nil && f > 0 {
+			ratio = f
+		}
+	}
+	if got < float64(expected)*ratio {
+		return fmt.Errorf("duration %.0fs shorter than expected %ds", got, expected)
+	}
+	return nil
+}
+
+// probeDuration reads a media file's duration in seconds with ffprobe.
+func probeDuration(ctx context.Context, path string) (float64, error) {
+	ffprobe, ok := findTool("ffprobe")
+	if !ok {
+		return 0, errors.New("ffprobe not found")
+	}
+	//nolint:gosec // G204: tool path resolved from PATH, args are controlled
+	out, err := exec.CommandContext(ctx, ffprobe, "-v", "error", "-show_entries", "format=duration", "-of", "csv=p=0", path).Output()
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe: %w", err)
+	}
+	got, err := strconv.ParseFloat(strings.TrimSpace(string(out)), 64)
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe duration %q: %w", strings.TrimSpace(string(out)), err)
+	}
+	return got, nil
+}
+
+// transcodeStage re-muxes or re-encodes the file with ffmpeg. TRANSCODE_ARGS holds the
+// output options (default "-c copy -movflags +faststart": remux only, fast-start MP4).
+type transcodeStage struct{}
+
+func (transcodeStage) Name() string { return "transcode" }
+
+func (transcodeStage) Run(ctx context.Context, job *Job) error {
+	ffmpeg, ok := findTool("ffmpeg")
+	if !ok {
+		return errors.New("ffmpeg not found")
+	}
+	in := job.File()
+	base := strings.TrimSuffix(in, filepath.Ext(in))
+	tmp := base + ".transcode.tmp.mp4"
+	final := base + ".mp4"
+	opts := strings.Fields(os.Getenv("TRANSCODE_ARGS"))
+	if len(opts) == 0 {
+		opts = []string{"-c", "copy", "-movflags", "+faststart"}
+	}
+	args := append([]string{"-y", "-v", "error", "-i", in}, opts...)
+	args = append(args, tmp)
+	start := time.Now()
+	//nolint:gosec // G204: tool path resolved from PATH, args come from operator configuration
+	if out, err := exec.CommandContext(ctx, ffmpeg, args...).CombinedOutput(); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("ffmpeg: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	if err := os.Rename(tmp, final); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("rename transcode output: %w", err)
+	}
+	if final != in {
+		_ = os.Remove(in)
+	}
+	job.Logger.Info("transcode complete", slog.String("path", final), slog.Duration("duration", time.Since(start)))
+	_, _ = job.DB.ExecContext(ctx, `UPDATE vods SET downloaded_path=$1, updated_at=NOW() WHERE twitch_vod_id=$2`, final, job.ID)
+	job.Set(ArtifactFile, final)
+	return nil
+}
+
+func (transcodeStage) Resume(_ context.Context, _ *Job, prev StageResult) bool {
+	return fileExists(prev.Outputs[ArtifactFile])
+}
+
+// thumbnailStage extracts a JPEG frame at THUMBNAIL_OFFSET (default 60s, clamped to the
+// middle of short VODs) next to the media file.
+type thumbnailStage struct{}
+
+func (thumbnailStage) Name() string { return "thumbnail" }
+
+func (thumbnailStage) Run(ctx context.Context, job *Job) error {
+	ffmpeg, ok := findTool("ffmpeg")
+	if !ok {
+		return errors.New("ffmpeg not found")
+	}
+	offset := 60 * time.Second
+	if s := os.Getenv("THUMBNAIL_OFFSET"); s != "" {
+		if d, err := time.ParseDuration(s); err == nil && d >= 0 {
+			offset = d
+		}
+	}
+	var dur int
+	_ = job.DB.QueryRowContext(ctx, `SELECT COALESCE(duration_seconds,0) FROM vods WHERE twitch_vod_id=$1`, job.ID).Scan(&dur)
+	if dur > 0 && offset >= time.Duration(dur)*time.Second {
+		offset = time.Duration(dur) * time.Second / 2
+	}
+	in := job.File()
+	out := strings.TrimSuffix(in, filepath.Ext(in)) + ".jpg"
+	//nolint:gosec // G204: tool path resolved from PATH, args are controlled
+	cmd := exec.CommandContext(ctx, ffmpeg, "-y", "-v", "error", "-ss", strconv.FormatFloat(offset.Seconds(), 'f', 3, 64), "-i", in, "-frames:v", "1", "-q:v", "2", out)
+	if b, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("ffmpeg: %w: %s", err, strings.TrimSpace(string(b)))
+	}
+	job.Set(ArtifactThumbnail, out)
+	return nil
+}
+
+func (thumbnailStage) Resume(_ context.Context, _ *Job, prev StageResult) bool {
+	return fileExists(prev.Outputs[ArtifactThumbnail])
+}
+
+// uploadStage applies the upload policy (skip_upload, YOUTUBE_UPLOAD_ENABLED, ownership) and
+// publishes the file to every configured destination with retries. Each destination keeps its
+// own row in vod_uploads; destinations that already succeeded are not uploaded again, and the
+// stage fails while any required destination is still failing.
+type uploadStage struct{}
+
+func (uploadStage) Name() string { return "upload" }
+
+func (uploadStage) Run(ctx context.Context, job *Job) error {
+	dbc, id, logger := job.DB, job.ID, job.Logger
+	var preYT string
+	_ = dbc.QueryRowContext(ctx, `SELECT COALESCE(youtube_url,'' ) FROM vods WHERE twitch_vod_id=$1`, id).Scan(&preYT)
+	uplCfg, _ := config.Load()
+	uploadOwnershipValid := uplCfg.YouTubeUploadOwnership == "self" || uplCfg.YouTubeUploadOwnership == "authorized"
+	skip := func(reason string) {
+		_, _ = dbc.ExecContext(ctx, `UPDATE vods SET processed=TRUE, processing_error=NULL, updated_at=NOW() WHERE twitch_vod_id=$1`, id)
+		setStatus(ctx, dbc, logger, id, StatusSkipped, reason)
+	}
+	if job.SkipUpload {
+		if preYT != "" {
+			_, _ = dbc.ExecContext(ctx, `UPDATE vods SET processed=TRUE, processing_error=NULL, updated_at=NOW() WHERE twitch_vod_id=$1`, id)
+			setStatus(ctx, dbc, logger, id, StatusUploaded, "youtube_url already present")
+			job.Set(ArtifactYouTubeURL, preYT)
+			return nil
+		}
+		logger.Info("skipping upload; skip_upload=true for vod")
+		skip("skip_upload set")
+		return nil
+	}
+
+	dests, err := destinationsFor(ctx, dbc, job.Channel)
+	if err != nil {
+		return fmt.Errorf("upload destinations: %w", err)
+	}
+	// YouTube is dropped (not failed) when the operator hasn't enabled it; a URL recorded
+	// earlier still counts as a successful YouTube upload.
+	ytReason := ""
+	active := make([]destination, 0, len(dests))
+	for _, d := range dests {
+		if d.name == DestinationYouTube && preYT == "" {
+			switch {
+			case !uplCfg.YouTubeUploadEnabled:
+				logger.Info("skipping youtube destination; YOUTUBE_UPLOAD_ENABLED is not set")
+				ytReason = "uploads disabled"
+				continue
+			case !uploadOwnershipValid:
+				logger.Warn("skipping youtube destination; YOUTUBE_UPLOAD_OWNERSHIP must be self|authorized when uploads are enabled", slog.String("ownership", uplCfg.YouTubeUploadOwnership))
+				ytReason = "upload ownership not confirmed"
+				continue
+			}
+		}
+		active = append(active, d)
+	}
+	if len(active) == 0 {
+		if ytReason == "" {
+			ytReason = "no upload destinations"
+		}
+		skip(ytReason)
+		return nil
+	}
+
+	for _, d := range active {
+		if d.name == DestinationYouTube {
+			syncMissingChapters(ctx, dbc, id, job.Channel)
+			if preYT == "" {
+				if err := ensureAutoParts(ctx, job); err != nil {
+					logger.Warn("automatic split failed; uploading whole file", slog.Any("err", err))
+				}
+			}
+		}
+	}
+
+	// Load any custom description set by user
+	var customDesc string
+	_ = dbc.QueryRowContext(ctx, `SELECT COALESCE(description,'') FROM vods WHERE twitch_vod_id=$1`, id).Scan(&customDesc)
+	uploadCtx := context.WithValue(ctx, vodIDCtxKey{}, id)
+	uploadCtx = context.WithValue(uploadCtx, vodChannelCtxKey{}, job.Channel)
+	if customDesc != "" {
+		uploadCtx = context.WithValue(uploadCtx, vodCustomDescKey{}, customDesc)
+	}
+
+	var failed []error
+	started := false
+	for _, d := range active {
+		ensureUploadRow(ctx, dbc, id, d)
+		if d.name == DestinationYouTube && preYT != "" {
+			logger.Info("skipping youtube upload; youtube_url already present", slog.String("youtube_url", preYT))
+			markUploadSucceeded(ctx, dbc, id, d.name, preYT)
+		}
+		if st, url := uploadStatus(ctx, dbc, id, d.name); st == uploadSucceeded {
+			if d.name == DestinationYouTube {
+				job.Set(ArtifactYouTubeURL, url)
+			}
+			continue
+		}
+		if !started {
+			setStatus(ctx, dbc, logger, id, StatusUploading, "upload started")
+			started = true
+		}
+		var key string
+		if k, ok := d.uploader.(remoteKeyer); ok {
+			key = k.RemoteKey(uploadCtx, job.File(), job.Date)
+		}
+		markUploadRunning(ctx, dbc, id, d.name, key)
+		dlog := logger.With(slog.String("destination", d.name))
+		upStart := time.Now()
+		var url string
+		var attempts int
+		var err error
+		// A VOD with part segments goes to YouTube as one video per part.
+		parts, _ := ListSegments(ctx, dbc, id, []string{SegmentPart}, "")
+		if d.name == DestinationYouTube && len(parts) > 0 {
+			dlog.Info("uploading vod in parts", slog.Int("parts", len(parts)))
+			url, attempts, err = uploadParts(uploadCtx, dlog, d.uploader, job, parts)
+		} else {
+			url, attempts, err = uploadWithRetry(uploadCtx, dlog, d.uploader, job)
+		}
+		if err != nil {
+			markUploadFailed(dbc, id, d.name, attempts, err)
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if !d.required {
+				dlog.Warn("optional upload destination failed", slog.Any("err", err))
+				continue
+			}
+			failed = append(failed, fmt.Errorf("%s: %w", d.name, err))
+			continue
+		}
+		upDur := time.Since(upStart)
+		markUploadSucceeded(ctx, dbc, id, d.name, url)
+		telemetry.UploadsSucceeded.Inc()
+		telemetry.UploadDuration.Observe(upDur.Seconds())
+		dlog.Info("upload complete", slog.String("url", url), slog.Duration("upload_duration", upDur))
+		if d.name == DestinationYouTube {
+			_, _ = dbc.ExecContext(ctx, `UPDATE vods SET youtube_url=$1, updated_at=NOW() WHERE twitch_vod_id=$2`, url, id)
+			updateMovingAvg(ctx, dbc, job.Channel, "avg_upload_ms", float64(upDur.Milliseconds()))
+			job.Set(ArtifactYouTubeURL, url)
+		}
+	}
+	if len(failed) > 0 {
+		return errors.Join(failed...)
+	}
+	_, _ = dbc.ExecContext(ctx, `UPDATE vods SET processed=TRUE, processing_error=NULL, updated_at=NOW() WHERE twitch_vod_id=$1`, id)
+	setStatus(ctx, dbc, logger, id, StatusUploaded, "upload complete")
+	job.Set(ArtifactUploaded, "true")
+	return nil
+}
+
+// uploadWithRetry runs one destination's upload with exponential backoff + jitter.
+// It returns the number of attempts made.
+func uploadWithRetry(ctx context.Context, logger *slog.Logger, up Uploader, job *Job) (string, int, error) {
+	return uploadFileWithRetry(ctx, logger, up, job, job.File())
+}
+
+// uploadFileWithRetry is uploadWithRetry for a file other than the job's own (a cut part).
+func uploadFileWithRetry(ctx context.Context, logger *slog.Logger, up Uploader, job *Job, path string) (string, int, error) {
+	maxUp := job.Config.UploadMaxAttempts
+	base := job.Config.UploadBackoffBase
+	var lastErr error
+	attempt := 0
+	for ; attempt < maxUp; attempt++ {
+		if attempt > 0 {
+			backoff := base * time.Duration(1<<attempt)
+			//nolint:gosec // G404: math/rand is sufficient for exponential backoff jitter, not used for security
+			jitter := time.Duration(rand.Int63n(int64(base)))
+			backoff += jitter
+			logger.Warn("retrying upload", slog.Int("attempt", attempt), slog.Int("max", maxUp), slog.Duration("backoff", backoff))
+			time.Sleep(backoff)
+		}
+		url, err := up.Upload(ctx, job.DB, path, job.Title, job.Date)
+		if err == nil {
+			return url, attempt + 1, nil
+		}
+		lastErr = err
+		// Non-retriable: invalid title
+		el := strings.ToLower(err.Error())
+		if strings.Contains(el, "invalidtitle") || strings.Contains(el, "invalid or empty video title") {
+			logger.Error("non-retriable upload error: invalid title", slog.Any("err", err))
+			attempt++
+			break
+		}
+		// Non-retriable: broken metadata templates or settings render the same way every time
+		if errors.Is(err, ErrInvalidMetadataSettings) {
+			logger.Error("non-retriable upload error: invalid metadata settings", slog.Any("err", err))
+			attempt++
+			break
+		}
+		// If context canceled, abort early
+		if ctx.Err() != nil {
+			attempt++
+			break
+		}
+	}
+	logger.Error("upload exhausted retries", slog.Any("err", lastErr))
+	return "", attempt, lastErr
+}
+
+// cleanupStage removes local media once the VOD is published. It never fails the VOD:
+// by this point the upload has been recorded.
+type cleanupStage struct{}
+
+func (cleanupStage) Name() string { return "cleanup" }
+
+func (cleanupStage) Run(ctx context.Context, job *Job) error {
+	path := job.File()
+	if (job.Artifacts[ArtifactYouTubeURL] == "" && job.Artifacts[ArtifactUploaded] == "") || path == "" {
+		return nil
+	}
+	// BACKFILL_AUTOCLEAN is kept for log wording only; files are always removed after upload.
+	keepDays := job.Config.BackfillAfterDays
+	backfillAutoclean := os.Getenv("BACKFILL_AUTOCLEAN") != "0" // default on
+	isBackfill := job.Date.Before(time.Now().Add(-time.Duration(keepDays) * 24 * time.Hour))
+	if err := os.Remove(path); err != nil {
+		job.Logger.Warn("delete local file failed", slog.String("path", path), slog.Any("err", err))
+		return nil
+	}
+	if isBackfill && backfillAutoclean {
+		job.Logger.Info("autoclean removed local file", slog.String("path", path))
+	} else {
+		job.Logger.Info("removed local file after upload", slog.String("path", path))
+	}
+	if thumb := job.Artifacts[ArtifactThumbnail]; thumb != "" {
+		_ = os.Remove(thumb)
+	}
+	_, _ = job.DB.ExecContext(ctx, `UPDATE vods SET downloaded_path=NULL, updated_at=NOW() WHERE twitch_vod_id=$1`, job.ID)
+	return nil
+}
+
+// findTool resolves an external binary from PATH or the runtime image's /usr/local/bin.
+func findTool(name string) (string, bool) {
+	if p, err := exec.LookPath(name); err == nil {
+		return p, true
+	}
+	p := filepath.Join("/usr/local/bin", name)
+	if fileExists(p) {
+		return p, true
+	}
+	return "", false
+}
+
+func fileExists(path string) bool {
+	if path == "" {
+		return false
+	}
+	_, err := os.Stat(path)
+	return err == nil
+}
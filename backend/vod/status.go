@@ -0,0 +1,188 @@
+package vod
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// Status is the lifecycle state of a VOD, stored in vods.status.
+//
+//	discovered → queued → downloading → downloaded → uploading → uploaded/skipped → archived
+//
+// Any working state may move to failed; failed, canceled and manually reprocessed VODs
+// return to queued.
+type Status string
+
+const (
+	StatusDiscovered  Status = "discovered"  // known from Helix/catalog, not yet accepted by a processing job
+	StatusQueued      Status = "queued"      // eligible for the processing job
+	StatusDownloading Status = "downloading" // claimed by a worker and downloading
+	StatusDownloaded  Status = "downloaded"  // media file present locally
+	StatusUploading   Status = "uploading"   // upload in progress
+	StatusUploaded    Status = "uploaded"    // published; youtube_url set
+	StatusSkipped     Status = "skipped"     // processed without upload (skip_upload, uploads disabled, policy)
+	StatusArchived    Status = "archived"    // terminal; local media removed by retention
+	StatusFailed      Status = "failed"      // last attempt failed; see processing_error
+)
+
+// ErrInvalidTransition is returned when a status change is not allowed from the current state.
+var ErrInvalidTransition = errors.New("invalid vod status transition")
+
+// transitions lists the allowed target states for each state. Re-entering downloading
+// from downloading/downloaded/uploading covers a worker reclaiming a VOD whose previous
+// owner crashed mid-flight (its lease expired).
+var transitions = map[Status][]Status{
+	StatusDiscovered:  {StatusQueued, StatusDownloading, StatusSkipped, StatusFailed},
+	StatusQueued:      {StatusDownloading, StatusSkipped, StatusFailed},
+	StatusDownloading: {StatusDownloaded, StatusFailed, StatusQueued},
+	StatusDownloaded:  {StatusUploading, StatusUploaded, StatusSkipped, StatusDownloading, StatusFailed, StatusQueued},
+	StatusUploading:   {StatusUploaded, StatusFailed, StatusDownloading, StatusQueued},
+	StatusUploaded:    {StatusArchived, StatusQueued},
+	StatusSkipped:     {StatusArchived, StatusQueued},
+	StatusArchived:    {StatusQueued},
+	StatusFailed:      {StatusQueued, StatusDownloading, StatusSkipped},
+}
+
+// AllStatuses returns every lifecycle state in pipeline order.
+func AllStatuses() []Status {
+	return []Status{StatusDiscovered, StatusQueued, StatusDownloading, StatusDownloaded, StatusUploading,
+		StatusUploaded, StatusSkipped, StatusArchived, StatusFailed}
+}
+
+// Valid reports whether s is a known status.
+func (s Status) Valid() bool {
+	_, ok := transitions[s]
+	return ok
+}
+
+// Terminal reports whether s means processing has finished (successfully or by policy).
+func (s Status) Terminal() bool {
+	return s == StatusUploaded || s == StatusSkipped || s == StatusArchived
+}
+
+// CanTransition reports whether a VOD may move from one status to another.
+// Staying in the same state is always allowed and treated as a no-op.
+func CanTransition(from, to Status) bool {
+	if !from.Valid() || !to.Valid() {
+		return false
+	}
+	if from == to {
+		return true
+	}
+	for _, s := range transitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// StateTransition is one entry of a VOD's status history.
+type StateTransition struct {
+	At     time.Time `json:"at"`
+	From   Status    `json:"from,omitempty"`
+	To     Status    `json:"to"`
+	Reason string    `json:"reason,omitempty"`
+	Actor  string    `json:"actor,omitempty"`
+}
+
+// TransitionStatus moves a VOD to a new status, validating the change against its current
+// status and appending to vod_state_transitions in the same transaction. A transition to
+// the current status is a no-op and is not recorded.
+func TransitionStatus(ctx context.Context, dbc *sql.DB, vodID string, to Status, reason string) error {
+	if !to.Valid() {
+		return fmt.Errorf("%w: unknown status %q", ErrInvalidTransition, to)
+	}
+	tx, err := dbc.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin status tx: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var cur string
+	if err := tx.QueryRowContext(ctx, `SELECT status FROM vods WHERE twitch_vod_id=$1 FOR UPDATE`, vodID).Scan(&cur); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("vod %s not found", vodID)
+		}
+		return fmt.Errorf("load status: %w", err)
+	}
+	from := Status(cur)
+	if from == to {
+		return nil
+	}
+	if !CanTransition(from, to) {
+		return fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, from, to)
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE vods SET status=$1 WHERE twitch_vod_id=$2`, string(to), vodID); err != nil {
+		return fmt.Errorf("update status: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO vod_state_transitions (vod_id, from_status, to_status, reason, actor) VALUES ($1,$2,$3,$4,$5)`,
+		vodID, string(from), string(to), reason, WorkerID()); err != nil {
+		return fmt.Errorf("record transition: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit status: %w", err)
+	}
+	return nil
+}
+
+// setStatus is the best-effort form of TransitionStatus used inside the processing loop,
+// where a failed bookkeeping write must not abort the pipeline.
+func setStatus(ctx context.Context, dbc *sql.DB, logger *slog.Logger, vodID string, to Status, reason string) {
+	if err := TransitionStatus(ctx, dbc, vodID, to, reason); err != nil {
+		logger.Warn("status transition failed", slog.String("to", string(to)), slog.Any("err", err))
+	}
+}
+
+// enqueueDiscovered moves all discovered VODs of a channel to queued, recording history
+// for each. It returns the number of VODs queued.
+func enqueueDiscovered(ctx context.Context, dbc *sql.DB, channel string) (int, error) {
+	rows, err := dbc.QueryContext(ctx, `WITH moved AS (
+			UPDATE vods SET status='queued' WHERE channel=$1 AND status='discovered' RETURNING twitch_vod_id
+		)
+		INSERT INTO vod_state_transitions (vod_id, from_status, to_status, reason, actor)
+		SELECT twitch_vod_id, 'discovered', 'queued', 'accepted by processing job', $2 FROM moved
+		RETURNING vod_id`, channel, WorkerID())
+	if err != nil {
+		return 0, fmt.Errorf("enqueue discovered: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			slog.Warn("failed to close rows", slog.Any("err", err))
+		}
+	}()
+	n := 0
+	for rows.Next() {
+		n++
+	}
+	return n, rows.Err()
+}
+
+// StatusHistory returns the recorded status transitions for a VOD, oldest first.
+func StatusHistory(ctx context.Context, dbc *sql.DB, vodID string) ([]StateTransition, error) {
+	rows, err := dbc.QueryContext(ctx, `SELECT created_at, COALESCE(from_status,''), to_status, COALESCE(reason,''), COALESCE(actor,'')
+		FROM vod_state_transitions WHERE vod_id=$1 ORDER BY created_at ASC, id ASC`, vodID)
+	if err != nil {
+		return nil, fmt.Errorf("query status history: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			slog.Warn("failed to close rows", slog.Any("err", err))
+		}
+	}()
+	out := make([]StateTransition, 0)
+	for rows.Next() {
+		var st StateTransition
+		var from, to string
+		if err := rows.Scan(&st.At, &from, &to, &st.Reason, &st.Actor); err != nil {
+			return nil, err
+		}
+		st.From, st.To = Status(from), Status(to)
+		out = append(out, st)
+	}
+	return out, rows.Err()
+}
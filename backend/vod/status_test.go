@@ -0,0 +1,103 @@
+package vod
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestCanTransition(t *testing.T) {
+	cases := []struct {
+		from, to Status
+		want     bool
+	}{
+		{StatusDiscovered, StatusQueued, true},
+		{StatusQueued, StatusDownloading, true},
+		{StatusDownloading, StatusDownloaded, true},
+		{StatusDownloaded, StatusUploading, true},
+		{StatusUploading, StatusUploaded, true},
+		{StatusDownloaded, StatusSkipped, true},
+		{StatusUploaded, StatusArchived, true},
+		{StatusSkipped, StatusArchived, true},
+		{StatusDownloading, StatusFailed, true},
+		{StatusFailed, StatusQueued, true},
+		{StatusUploading, StatusDownloading, true}, // crashed worker reclaimed
+		{StatusArchived, StatusQueued, true},       // manual reprocess
+		{StatusQueued, StatusQueued, true},         // no-op
+		{StatusQueued, StatusUploaded, false},
+		{StatusDiscovered, StatusArchived, false},
+		{StatusUploaded, StatusDownloading, false},
+		{StatusArchived, StatusFailed, false},
+		{Status("bogus"), StatusQueued, false},
+		{StatusQueued, Status("bogus"), false},
+	}
+	for _, c := range cases {
+		if got := CanTransition(c.from, c.to); got != c.want {
+			t.Errorf("CanTransition(%s, %s) = %v want %v", c.from, c.to, got, c.want)
+		}
+	}
+}
+
+func TestAllStatusesHaveTransitions(t *testing.T) {
+	for _, s := range AllStatuses() {
+		if !s.Valid() {
+			t.Errorf("status %s missing from transition table", s)
+		}
+	}
+	if len(AllStatuses()) != len(transitions) {
+		t.Fatalf("AllStatuses has %d entries, transition table %d", len(AllStatuses()), len(transitions))
+	}
+}
+
+func TestTransitionStatusRecordsHistory(t *testing.T) {
+	db := openTestDB(t)
+	ctx := context.Background()
+	channel := "status-history"
+	id := "status_history_1"
+	t.Cleanup(func() {
+		_, _ = db.Exec(`DELETE FROM vods WHERE channel=$1`, channel)
+	})
+	if _, err := db.ExecContext(ctx, `INSERT INTO vods (channel,twitch_vod_id,title,date,created_at)
+		VALUES ($1,$2,'Status',NOW(),NOW())
+		ON CONFLICT (twitch_vod_id) DO UPDATE SET status='discovered'`, channel, id); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = db.ExecContext(ctx, `DELETE FROM vod_state_transitions WHERE vod_id=$1`, id)
+
+	n, err := enqueueDiscovered(ctx, db, channel)
+	if err != nil || n != 1 {
+		t.Fatalf("enqueueDiscovered = %d, %v", n, err)
+	}
+	for _, to := range []Status{StatusDownloading, StatusDownloaded, StatusDownloaded, StatusUploading, StatusUploaded} {
+		if err := TransitionStatus(ctx, db, id, to, "test"); err != nil {
+			t.Fatalf("transition to %s: %v", to, err)
+		}
+	}
+	if err := TransitionStatus(ctx, db, id, StatusDownloading, "test"); !errors.Is(err, ErrInvalidTransition) {
+		t.Fatalf("expected ErrInvalidTransition, got %v", err)
+	}
+
+	var cur string
+	if err := db.QueryRowContext(ctx, `SELECT status FROM vods WHERE twitch_vod_id=$1`, id).Scan(&cur); err != nil {
+		t.Fatal(err)
+	}
+	if Status(cur) != StatusUploaded {
+		t.Fatalf("status = %s want uploaded", cur)
+	}
+	hist, err := StatusHistory(ctx, db, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Status{StatusQueued, StatusDownloading, StatusDownloaded, StatusUploading, StatusUploaded}
+	if len(hist) != len(want) {
+		t.Fatalf("history len = %d want %d: %+v", len(hist), len(want), hist)
+	}
+	for i, st := range want {
+		if hist[i].To != st {
+			t.Errorf("history[%d].To = %s want %s", i, hist[i].To, st)
+		}
+	}
+	if hist[0].From != StatusDiscovered {
+		t.Errorf("first transition from = %s want discovered", hist[0].From)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"io"
 	"log/slog"
 	"math/rand"
 	"os"
@@ -116,12 +117,15 @@ func downloadVOD(ctx context.Context, db *sql.DB, id, dataDir string) (string, e
 		"--retries", "infinite", // retry network errors
 		"--fragment-retries", "infinite", // retry fragment errors (HLS)
 		"--concurrent-fragments", "10", // speed up HLS by parallel fragments
-		"--no-cache-dir", // avoid writing caches to disk
-		"-o", out,        // output path
+		"--no-cache-dir",                             // avoid writing caches to disk
+		"--newline",                                  // one progress sample per line
+		"--progress-template", ytdlpProgressTemplate, // machine-readable progress (see progress.go)
+		"-o", out, // output path
 		url,
 	}
 
-	if extra := os.Getenv("YTDLP_ARGS"); strings.TrimSpace(extra) != "" {
+	cfg := channelConfigFrom(ctx)
+	if extra := cfg.YtdlpArgs; extra != "" {
 		args = append(strings.Fields(extra), args...)
 	}
 	if strings.EqualFold(os.Getenv("LOG_LEVEL"), "DEBUG") || os.Getenv("YTDLP_VERBOSE") == "1" {
@@ -129,11 +133,9 @@ func downloadVOD(ctx context.Context, db *sql.DB, id, dataDir string) (string, e
 	}
 
 	// Bandwidth limit support via --limit-rate flag (e.g., "500K", "2M", "1.5M")
-	if limit := strings.TrimSpace(os.Getenv("DOWNLOAD_RATE_LIMIT")); limit != "" {
+	if limit := cfg.DownloadRateLimit; limit != "" {
 		// yt-dlp expects a number (int or float) followed by K/M/G (optionally B), e.g., 500K, 2M, 1.5M, 1G, 1.5MB
-		// Regex: ^\d+(\.\d+)?[KMG](B)?$ (case-insensitive)
-		limitRatePattern := regexp.MustCompile(`(?i)^\d+(\.\d+)?[KMG](B)?$`)
-		if !limitRatePattern.MatchString(limit) {
+		if _, err := parseRateLimit(limit); err != nil {
 			logger.Error("invalid DOWNLOAD_RATE_LIMIT format; must be a number followed by K/M/G (e.g., 500K, 2M, 1.5M)", slog.String("provided", limit))
 		} else {
 			args = append([]string{"--limit-rate", limit}, args...)
@@ -148,18 +150,8 @@ func downloadVOD(ctx context.Context, db *sql.DB, id, dataDir string) (string, e
 	}
 
 	// Retry loop with exponential backoff + jitter and configurable attempts
-	maxAttempts := 5
-	if s := os.Getenv("DOWNLOAD_MAX_ATTEMPTS"); s != "" {
-		if n, err := strconv.Atoi(s); err == nil && n > 0 {
-			maxAttempts = n
-		}
-	}
-	baseBackoff := 2 * time.Second
-	if s := os.Getenv("DOWNLOAD_BACKOFF_BASE"); s != "" {
-		if d, err := time.ParseDuration(s); err == nil && d > 0 {
-			baseBackoff = d
-		}
-	}
+	maxAttempts := cfg.DownloadMaxAttempts
+	baseBackoff := cfg.DownloadBackoffBase
 	var lastErr error
 	for attempt := 0; attempt < maxAttempts; attempt++ {
 		logger.Debug("download attempt", slog.Int("attempt", attempt+1), slog.Int("max", maxAttempts))
@@ -176,6 +168,11 @@ func downloadVOD(ctx context.Context, db *sql.DB, id, dataDir string) (string, e
 		}
 		//nolint:gosec // G204: ytDLP command path is from environment variable or hardcoded constant, args are controlled
 		cmd := exec.CommandContext(ctx, ytDLP, args...)
+		stdout, errPipe := cmd.StdoutPipe()
+		if errPipe != nil {
+			lastErr = errPipe
+			break
+		}
 		stderr, errPipe := cmd.StderrPipe()
 		if errPipe != nil {
 			lastErr = errPipe
@@ -188,34 +185,9 @@ func downloadVOD(ctx context.Context, db *sql.DB, id, dataDir string) (string, e
 		activeMu.Lock()
 		activeCancels[id] = func() { _ = cmd.Process.Kill() }
 		activeMu.Unlock()
-		progressRe := regexp.MustCompile(`(?i)\[download\]\s+([0-9.]+)%.*?of\s+~?([0-9.]+)([KMG]iB).*?at\s+([0-9.]+)([KMG]iB)/s.*?ETA\s+([0-9:]+)`) // best-effort
-		totalBytes := int64(0)
-		var lastPercent float64
-		bytesRe := regexp.MustCompile(`(?i)([0-9.]+)([KMG]iB)`) // for size groups
-		decUnit := func(val string, unit string) int64 {
-			// Convert to bytes
-			f := 0.0
-			for _, c := range val {
-				if c == '.' {
-					continue
-				}
-			}
-			if _, err := fmt.Sscanf(val, "%f", &f); err != nil {
-				slog.Debug("failed to parse download size", slog.String("val", val), slog.Any("err", err))
-			}
-			mult := float64(1)
-			switch strings.ToUpper(unit) {
-			case "KIB":
-				mult = 1024
-			case "MIB":
-				mult = 1024 * 1024
-			case "GIB":
-				mult = 1024 * 1024 * 1024
-			}
-			return int64(f * mult)
-		}
-		// Reader loop; also capture tail of stderr for diagnostics (with secret scrubbing)
+		// Capture tail of output for diagnostics (with secret scrubbing)
 		const maxTail = 100
+		var tailMu sync.Mutex
 		lastLines := make([]string, 0, maxTail)
 		sanitize := func(s string) string {
 			// Redact explicit Cookie headers and auth-token occurrences if any
@@ -233,53 +205,44 @@ func downloadVOD(ctx context.Context, db *sql.DB, id, dataDir string) (string, e
 				return
 			}
 			s = sanitize(s)
+			tailMu.Lock()
+			defer tailMu.Unlock()
 			if len(lastLines) >= maxTail {
 				lastLines = lastLines[1:]
 			}
 			lastLines = append(lastLines, s)
 		}
-		// Reader loop
-		go func() {
-			buf := make([]byte, 16*1024)
-			var line strings.Builder
-			for {
-				n, err := stderr.Read(buf)
-				if n > 0 {
-					chunk := string(buf[:n])
-					for _, r := range chunk {
-						if r == '\n' || r == '\r' {
-							s := line.String()
-							line.Reset()
-							if m := progressRe.FindStringSubmatch(s); len(m) > 0 {
-								// m[1]=percent, m[2]=size, m[3]=unit
-								if totalBytes == 0 {
-									if mm := bytesRe.FindStringSubmatch(m[2] + m[3]); len(mm) == 3 {
-										totalBytes = decUnit(mm[1], mm[2])
-									}
-								}
-								if p, err := strconv.ParseFloat(m[1], 64); err == nil {
-									lastPercent = p
-								}
-								// approximate current bytes
-								curBytes := int64(0)
-								if totalBytes > 0 && lastPercent > 0 {
-									curBytes = int64((lastPercent / 100.0) * float64(totalBytes))
-								}
-								// Update DB with approximate progress
-								_, _ = db.ExecContext(ctx, `UPDATE vods SET download_state=$1, download_total=$2, download_bytes=$3, progress_updated_at=NOW() WHERE twitch_vod_id=$4`, s, totalBytes, curBytes, id)
-							} else if strings.TrimSpace(s) != "" {
-								appendLine(strings.TrimSpace(s))
-							}
-						} else {
-							line.WriteRune(r)
-						}
-					}
-				}
-				if err != nil {
-					break
-				}
+		// Progress arrives as JSON lines from --progress-template; DB writes are throttled
+		// to one per second except for the final sample.
+		var progressMu sync.Mutex
+		var lastWrite time.Time
+		var totalBytes int64
+		handleLine := func(s string) {
+			p, ok := parseProgressLine(s)
+			if !ok {
+				appendLine(strings.TrimSpace(s))
+				return
 			}
-		}()
+			progressMu.Lock()
+			defer progressMu.Unlock()
+			if p.Total != nil {
+				totalBytes = *p.Total
+			}
+			if p.Status != "finished" && time.Since(lastWrite) < time.Second {
+				return
+			}
+			lastWrite = time.Now()
+			writeProgress(ctx, db, id, p)
+		}
+		var readers sync.WaitGroup
+		for _, r := range []io.Reader{stdout, stderr} {
+			readers.Add(1)
+			go func(r io.Reader) {
+				defer readers.Done()
+				scanOutputLines(r, handleLine)
+			}(r)
+		}
+		readers.Wait()
 		err := cmd.Wait()
 		activeMu.Lock()
 		delete(activeCancels, id)
@@ -290,7 +253,7 @@ func downloadVOD(ctx context.Context, db *sql.DB, id, dataDir string) (string, e
 			if fi, statErr := os.Stat(out); statErr == nil {
 				actual = fi.Size()
 			}
-			_, _ = db.ExecContext(ctx, `UPDATE vods SET download_state=$1, download_total=$2, download_bytes=$3, downloaded_path=$4, progress_updated_at=NOW() WHERE twitch_vod_id=$5`, "complete", actual, actual, out, id)
+			_, _ = db.ExecContext(ctx, `UPDATE vods SET download_state=$1, download_total=$2, download_bytes=$3, download_speed=NULL, download_eta_seconds=0, downloaded_path=$4, progress_updated_at=NOW() WHERE twitch_vod_id=$5`, "complete", actual, actual, out, id)
 			logger.Info("download finished", slog.Int64("bytes", actual))
 			telemetry.DownloadsSucceeded.Inc()
 			return out, nil
@@ -301,7 +264,7 @@ func downloadVOD(ctx context.Context, db *sql.DB, id, dataDir string) (string, e
 			logger.Info("download canceled", slog.Any("reason", ctx.Err()))
 			// Use a background context for DB update since ctx is canceled
 			bgCtx := context.Background()
-			_, _ = db.ExecContext(bgCtx, `UPDATE vods SET download_state=$1, download_bytes=0, download_total=0, progress_updated_at=NOW() WHERE twitch_vod_id=$2`, "canceled", id)
+			_, _ = db.ExecContext(bgCtx, `UPDATE vods SET download_state=$1, download_bytes=0, download_total=0, download_speed=NULL, download_eta_seconds=NULL, download_fragment_index=NULL, download_fragment_count=NULL, progress_updated_at=NOW() WHERE twitch_vod_id=$2`, "canceled", id)
 			return "", ctx.Err()
 		}
 		// Classify error from stderr state we captured last; fallback to err.Error()
@@ -322,14 +285,10 @@ func downloadVOD(ctx context.Context, db *sql.DB, id, dataDir string) (string, e
 // uploadToYouTube uploads the given video file using stored OAuth token.
 // (moved uploadToYouTube implementation to processing.go)
 
-// Circuit breaker helpers
-func updateCircuitOnFailure(ctx context.Context, db *sql.DB, channel string) {
-	threshold := 0
-	if s := os.Getenv("CIRCUIT_FAILURE_THRESHOLD"); s != "" {
-		if n, err := strconv.Atoi(s); err == nil {
-			threshold = n
-		}
-	}
+// Circuit breaker helpers; the breaker state is kept per channel in kv.
+func updateCircuitOnFailure(ctx context.Context, db *sql.DB, cfg config.ChannelConfig) {
+	channel := cfg.Channel
+	threshold := cfg.CircuitFailureThreshold
 	if threshold <= 0 {
 		return
 	}
@@ -343,12 +302,7 @@ func updateCircuitOnFailure(ctx context.Context, db *sql.DB, channel string) {
 
 	// If in half-open state, a failure immediately reopens the circuit
 	if currentState == "half-open" {
-		cool := 5 * time.Minute
-		if s := os.Getenv("CIRCUIT_OPEN_COOLDOWN"); s != "" {
-			if d, err := time.ParseDuration(s); err == nil {
-				cool = d
-			}
-		}
+		cool := cfg.CircuitOpenCooldown
 		until := time.Now().Add(cool).UTC().Format(time.RFC3339)
 
 		_, _ = db.ExecContext(ctx, `INSERT INTO kv (channel,key,value,updated_at) VALUES ($1,'circuit_state','open',NOW())
@@ -378,12 +332,7 @@ func updateCircuitOnFailure(ctx context.Context, db *sql.DB, channel string) {
 		ON CONFLICT(channel,key) DO UPDATE SET value=EXCLUDED.value, updated_at=NOW()`, channel, fmt.Sprintf("%d", fails))
 	if fails >= threshold {
 		// open circuit
-		cool := 5 * time.Minute
-		if s := os.Getenv("CIRCUIT_OPEN_COOLDOWN"); s != "" {
-			if d, err := time.ParseDuration(s); err == nil {
-				cool = d
-			}
-		}
+		cool := cfg.CircuitOpenCooldown
 		until := time.Now().Add(cool).UTC().Format(time.RFC3339)
 
 		_, _ = db.ExecContext(ctx, `INSERT INTO kv (channel,key,value,updated_at) VALUES ($1,'circuit_state','open',NOW())
@@ -397,11 +346,12 @@ func updateCircuitOnFailure(ctx context.Context, db *sql.DB, channel string) {
 	}
 }
 
-func resetCircuit(ctx context.Context, db *sql.DB, channel string) {
+func resetCircuit(ctx context.Context, db *sql.DB, cfg config.ChannelConfig) {
+	channel := cfg.Channel
 	// success path: if half-open or open we close; reset failures
 	var state string
 	_ = db.QueryRowContext(ctx, `SELECT value FROM kv WHERE channel=$1 AND key='circuit_state'`, channel).Scan(&state)
-	if state == "closed" && os.Getenv("CIRCUIT_FAILURE_THRESHOLD") == "" {
+	if state == "closed" && cfg.CircuitFailureThreshold <= 0 {
 		return
 	}
 
@@ -421,3 +371,37 @@ func resetCircuit(ctx context.Context, db *sql.DB, channel string) {
 	telemetry.UpdateCircuitGauge(false)
 	telemetry.SetCircuitState("closed")
 }
+
+// Circuit is a channel's circuit breaker as stored in kv. Empty fields have not been
+// written yet; an empty State means closed.
+type Circuit struct {
+	Channel   string `json:"channel"`
+	State     string `json:"state"`
+	Failures  string `json:"failures,omitempty"`
+	OpenUntil string `json:"open_until,omitempty"`
+}
+
+// LoadCircuit reads the circuit breaker of channel.
+func LoadCircuit(ctx context.Context, db *sql.DB, channel string) (Circuit, error) {
+	c := Circuit{Channel: channel}
+	rows, err := db.QueryContext(ctx, `SELECT key, value FROM kv WHERE channel=$1 AND key IN ('circuit_state','circuit_failures','circuit_open_until')`, channel)
+	if err != nil {
+		return c, err
+	}
+	defer func() { _ = rows.Close() }()
+	for rows.Next() {
+		var k, v string
+		if err := rows.Scan(&k, &v); err != nil {
+			return c, err
+		}
+		switch k {
+		case "circuit_state":
+			c.State = v
+		case "circuit_failures":
+			c.Failures = v
+		case "circuit_open_until":
+			c.OpenUntil = v
+		}
+	}
+	return c, rows.Err()
+}
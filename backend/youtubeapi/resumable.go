@@ -0,0 +1,301 @@
+package youtubeapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	yt "google.golang.org/api/youtube/v3"
+)
+
+// Resumable uploads follow https://developers.google.com/youtube/v3/guides/using_resumable_upload_protocol.
+// The session URI and the byte offset YouTube has committed are persisted through a
+// SessionStore after every chunk, so a failed attempt (or a restarted process) continues
+// the same session instead of re-sending the file and spending another videos.insert quota.
+
+const (
+	defaultUploadBaseURL = "https://www.googleapis.com"
+	// DefaultChunkSize is the upload chunk size; YouTube requires multiples of 256 KiB.
+	DefaultChunkSize = 16 << 20
+	chunkAlign       = 256 << 10
+)
+
+// ErrSessionExpired is returned when YouTube no longer knows the stored session URI.
+var ErrSessionExpired = errors.New("youtube upload session expired")
+
+// UploadSession is the persisted state of a resumable upload.
+type UploadSession struct {
+	URI    string
+	Offset int64 // bytes committed by YouTube
+	Size   int64 // file size the session was created for
+}
+
+// SessionStore persists the resumable session for one upload.
+type SessionStore interface {
+	LoadUploadSession(ctx context.Context) (UploadSession, bool, error)
+	SaveUploadSession(ctx context.Context, s UploadSession) error
+	ClearUploadSession(ctx context.Context) error
+}
+
+// ResumableUploader uploads a video file in chunks over the resumable protocol.
+type ResumableUploader struct {
+	Client   *http.Client
+	Sessions SessionStore
+	// BaseURL overrides the API host (tests); defaults to https://www.googleapis.com.
+	BaseURL string
+	// ChunkSize defaults to DefaultChunkSize and is rounded down to a 256 KiB multiple.
+	ChunkSize int64
+	// ChunkRetries is how many times a failed chunk is resumed within one Upload call.
+	ChunkRetries int
+	// Backoff is the base delay between chunk retries (doubled per retry).
+	Backoff time.Duration
+}
+
+// NewResumableUploader returns an uploader using the service's authorized HTTP client.
+func (s *Service) NewResumableUploader(ctx context.Context, sessions SessionStore) (*ResumableUploader, error) {
+	tok, err := s.refreshIfNeeded(ctx)
+	if err != nil {
+		return nil, err
+	}
+	u := &ResumableUploader{Client: s.oauth.Client(ctx, tok), Sessions: sessions, ChunkRetries: 5, Backoff: 2 * time.Second}
+	if n, err := strconv.Atoi(os.Getenv("YOUTUBE_UPLOAD_CHUNK_MB")); err == nil && n > 0 {
+		u.ChunkSize = int64(n) << 20
+	}
+	return u, nil
+}
+
+// Upload sends the file at path, resuming a stored session when it matches the file size.
+// It returns the watch URL of the created video.
+func (u *ResumableUploader) Upload(ctx context.Context, path string, video *yt.Video) (string, error) {
+	//nolint:gosec // G304: Path is to downloaded VOD file in controlled data directory
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("open file: %w", err)
+	}
+	defer func() {
+		if err := f.Close(); err != nil {
+			slog.Warn("failed to close video file", slog.Any("err", err))
+		}
+	}()
+	fi, err := f.Stat()
+	if err != nil {
+		return "", fmt.Errorf("stat file: %w", err)
+	}
+	size := fi.Size()
+
+	sess, ok, err := u.Sessions.LoadUploadSession(ctx)
+	if err != nil {
+		return "", fmt.Errorf("load upload session: %w", err)
+	}
+	if ok && sess.URI != "" && sess.Size == size {
+		// Ask YouTube what it has; our stored offset may be behind the last acknowledged chunk.
+		off, id, err := u.queryOffset(ctx, sess.URI, size)
+		switch {
+		case errors.Is(err, ErrSessionExpired):
+			slog.Info("youtube upload session expired; starting a new one")
+			ok = false
+		case err != nil:
+			return "", err
+		case id != "":
+			_ = u.Sessions.ClearUploadSession(ctx)
+			return watchURL(id), nil
+		default:
+			sess.Offset = off
+			slog.Info("resuming youtube upload session", slog.Int64("offset", off), slog.Int64("size", size))
+		}
+	} else {
+		ok = false
+	}
+	if !ok {
+		uri, err := u.initiate(ctx, video, size)
+		if err != nil {
+			return "", err
+		}
+		sess = UploadSession{URI: uri, Size: size}
+		if err := u.Sessions.SaveUploadSession(ctx, sess); err != nil {
+			return "", fmt.Errorf("save upload session: %w", err)
+		}
+	}
+
+	chunk := u.chunkSize()
+	retries := 0
+	for {
+		end := sess.Offset + chunk
+		if end > size {
+			end = size
+		}
+		off, id, err := u.putChunk(ctx, sess.URI, io.NewSectionReader(f, sess.Offset, end-sess.Offset), sess.Offset, end, size)
+		if err == nil && id != "" {
+			_ = u.Sessions.ClearUploadSession(ctx)
+			return watchURL(id), nil
+		}
+		if err == nil && off <= sess.Offset {
+			// A 308 that does not move the committed offset made no progress. Count it as a
+			// failed attempt so a server that keeps answering the same Range cannot loop us.
+			err = fmt.Errorf("chunk not committed (range ends at offset %d)", off)
+		}
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, ErrSessionExpired) || retries >= u.ChunkRetries {
+				if errors.Is(err, ErrSessionExpired) {
+					_ = u.Sessions.ClearUploadSession(ctx)
+				}
+				return "", fmt.Errorf("youtube upload at offset %d: %w", sess.Offset, err)
+			}
+			retries++
+			delay := u.Backoff * time.Duration(1<<(retries-1))
+			slog.Warn("youtube upload chunk failed; resuming", slog.Int64("offset", sess.Offset), slog.Int("retry", retries), slog.Duration("backoff", delay), slog.Any("err", err))
+			select {
+			case <-ctx.Done():
+				return "", ctx.Err()
+			case <-time.After(delay):
+			}
+			off, id, err = u.queryOffset(ctx, sess.URI, size)
+			if err != nil {
+				if errors.Is(err, ErrSessionExpired) {
+					_ = u.Sessions.ClearUploadSession(ctx)
+				}
+				return "", fmt.Errorf("youtube upload status: %w", err)
+			}
+			if id != "" {
+				_ = u.Sessions.ClearUploadSession(ctx)
+				return watchURL(id), nil
+			}
+		} else {
+			retries = 0
+		}
+		sess.Offset = off
+		if err := u.Sessions.SaveUploadSession(ctx, sess); err != nil {
+			slog.Warn("failed to persist youtube upload offset", slog.Any("err", err))
+		}
+	}
+}
+
+func (u *ResumableUploader) chunkSize() int64 {
+	c := u.ChunkSize
+	if c <= 0 {
+		c = DefaultChunkSize
+	}
+	if c < chunkAlign {
+		return chunkAlign
+	}
+	return c - c%chunkAlign
+}
+
+func (u *ResumableUploader) baseURL() string {
+	if u.BaseURL != "" {
+		return strings.TrimRight(u.BaseURL, "/")
+	}
+	return defaultUploadBaseURL
+}
+
+// initiate creates an upload session and returns its URI.
+func (u *ResumableUploader) initiate(ctx context.Context, video *yt.Video, size int64) (string, error) {
+	body, err := json.Marshal(video)
+	if err != nil {
+		return "", err
+	}
+	endpoint := u.baseURL() + "/upload/youtube/v3/videos?uploadType=resumable&part=snippet,status"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	req.Header.Set("X-Upload-Content-Length", strconv.FormatInt(size, 10))
+	req.Header.Set("X-Upload-Content-Type", "video/*")
+	resp, err := u.Client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("youtube upload initiate: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("youtube upload initiate: %s", responseError(resp))
+	}
+	loc := resp.Header.Get("Location")
+	if loc == "" {
+		return "", errors.New("youtube upload initiate: missing session location")
+	}
+	return loc, nil
+}
+
+// putChunk uploads bytes [start,end) and returns the committed offset, or the video id
+// once the upload is complete.
+func (u *ResumableUploader) putChunk(ctx context.Context, uri string, body io.Reader, start, end, size int64) (int64, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, uri, body)
+	if err != nil {
+		return 0, "", err
+	}
+	req.ContentLength = end - start
+	if size == 0 {
+		req.Body = http.NoBody
+		req.Header.Set("Content-Range", "bytes */0")
+	} else {
+		req.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end-1, size))
+	}
+	return u.doSession(req)
+}
+
+// queryOffset asks YouTube how many bytes of the session it has committed.
+func (u *ResumableUploader) queryOffset(ctx context.Context, uri string, size int64) (int64, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, uri, http.NoBody)
+	if err != nil {
+		return 0, "", err
+	}
+	req.ContentLength = 0
+	req.Header.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+	return u.doSession(req)
+}
+
+func (u *ResumableUploader) doSession(req *http.Request) (int64, string, error) {
+	resp, err := u.Client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	switch {
+	case resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusCreated:
+		var v yt.Video
+		if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
+			return 0, "", fmt.Errorf("decode video resource: %w", err)
+		}
+		if v.Id == "" {
+			return 0, "", errors.New("youtube upload: empty id")
+		}
+		return 0, v.Id, nil
+	case resp.StatusCode == http.StatusPermanentRedirect: // "308 Resume Incomplete"
+		return parseRangeHeader(resp.Header.Get("Range")), "", nil
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return 0, "", ErrSessionExpired
+	default:
+		return 0, "", errors.New(responseError(resp))
+	}
+}
+
+// parseRangeHeader converts "bytes=0-N" into the next offset (N+1); no header means 0.
+func parseRangeHeader(h string) int64 {
+	h = strings.TrimSpace(h)
+	i := strings.LastIndexByte(h, '-')
+	if i < 0 {
+		return 0
+	}
+	n, err := strconv.ParseInt(h[i+1:], 10, 64)
+	if err != nil {
+		return 0
+	}
+	return n + 1
+}
+
+func responseError(resp *http.Response) string {
+	b, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+	return fmt.Sprintf("http %d: %s", resp.StatusCode, strings.TrimSpace(string(b)))
+}
+
+func watchURL(id string) string { return "https://www.youtube.com/watch?v=" + id }
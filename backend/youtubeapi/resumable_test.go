@@ -0,0 +1,251 @@
+package youtubeapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	yt "google.golang.org/api/youtube/v3"
+)
+
+// fakeResumable implements the server side of the YouTube resumable upload protocol.
+type fakeResumable struct {
+	sessions    map[string][]byte
+	srvURL      string
+	title       string
+	initiations int
+	chunks      int
+	failChunk   int  // 1-based chunk number that fails once with 503 after committing half
+	stall       bool // acknowledge chunks with 308 without committing them
+	mu          sync.Mutex
+}
+
+func (f *fakeResumable) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.Method == http.MethodPost && r.URL.Path == "/upload/youtube/v3/videos" {
+		if r.URL.Query().Get("uploadType") != "resumable" || r.Header.Get("X-Upload-Content-Length") == "" {
+			http.Error(w, "bad initiation", http.StatusBadRequest)
+			return
+		}
+		var v yt.Video
+		_ = json.NewDecoder(r.Body).Decode(&v)
+		if v.Snippet != nil {
+			f.title = v.Snippet.Title
+		}
+		f.initiations++
+		id := fmt.Sprintf("s%d", f.initiations)
+		f.sessions[id] = nil
+		w.Header().Set("Location", f.srvURL+"/session/"+id)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/session/")
+	got, ok := f.sessions[id]
+	if r.Method != http.MethodPut || !ok {
+		http.NotFound(w, r)
+		return
+	}
+	var start, end, total int64
+	cr := r.Header.Get("Content-Range")
+	body, _ := io.ReadAll(r.Body)
+	if strings.HasPrefix(cr, "bytes */") {
+		total, _ = strconv.ParseInt(strings.TrimPrefix(cr, "bytes */"), 10, 64)
+		f.reply(w, id, total)
+		return
+	}
+	if _, err := fmt.Sscanf(cr, "bytes %d-%d/%d", &start, &end, &total); err != nil || start != int64(len(got)) || int64(len(body)) != end-start+1 {
+		http.Error(w, "bad content-range "+cr, http.StatusBadRequest)
+		return
+	}
+	f.chunks++
+	if f.stall {
+		f.reply(w, id, total)
+		return
+	}
+	if f.chunks == f.failChunk {
+		// Commit part of the chunk, then fail, like a connection dropped mid-transfer.
+		f.sessions[id] = append(got, body[:len(body)/2]...)
+		http.Error(w, "backend error", http.StatusServiceUnavailable)
+		return
+	}
+	f.sessions[id] = append(got, body...)
+	f.reply(w, id, total)
+}
+
+func (f *fakeResumable) reply(w http.ResponseWriter, id string, total int64) {
+	n := int64(len(f.sessions[id]))
+	if n == total && total > 0 {
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(yt.Video{Id: "vid-" + id})
+		return
+	}
+	if n > 0 {
+		w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", n-1))
+	}
+	w.WriteHeader(http.StatusPermanentRedirect)
+}
+
+type memSessions struct {
+	sess  *UploadSession
+	saves int
+}
+
+func (m *memSessions) LoadUploadSession(context.Context) (UploadSession, bool, error) {
+	if m.sess == nil {
+		return UploadSession{}, false, nil
+	}
+	return *m.sess, true, nil
+}
+
+func (m *memSessions) SaveUploadSession(_ context.Context, s UploadSession) error {
+	m.saves++
+	m.sess = &s
+	return nil
+}
+
+func (m *memSessions) ClearUploadSession(context.Context) error {
+	m.sess = nil
+	return nil
+}
+
+func newFakeResumable(t *testing.T) (*fakeResumable, *httptest.Server) {
+	t.Helper()
+	f := &fakeResumable{sessions: map[string][]byte{}}
+	srv := httptest.NewServer(f)
+	f.srvURL = srv.URL
+	t.Cleanup(srv.Close)
+	return f, srv
+}
+
+func writeVideo(t *testing.T, size int) (string, []byte) {
+	t.Helper()
+	data := bytes.Repeat([]byte("0123456789abcdef"), size/16)
+	path := filepath.Join(t.TempDir(), "vod.mp4")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path, data
+}
+
+func testVideo() *yt.Video {
+	return &yt.Video{Snippet: &yt.VideoSnippet{Title: "2024-01-01 Stream"}, Status: &yt.VideoStatus{PrivacyStatus: "private"}}
+}
+
+func TestResumableUploadChunks(t *testing.T) {
+	f, srv := newFakeResumable(t)
+	path, data := writeVideo(t, 3*chunkAlign+100)
+	store := &memSessions{}
+	u := &ResumableUploader{Client: srv.Client(), Sessions: store, BaseURL: srv.URL, ChunkSize: chunkAlign}
+	url, err := u.Upload(context.Background(), path, testVideo())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if url != "https://www.youtube.com/watch?v=vid-s1" {
+		t.Fatalf("url = %s", url)
+	}
+	if !bytes.Equal(f.sessions["s1"], data) || f.chunks != 4 || f.title != "2024-01-01 Stream" {
+		t.Fatalf("unexpected server state: chunks=%d len=%d title=%q", f.chunks, len(f.sessions["s1"]), f.title)
+	}
+	if store.sess != nil {
+		t.Fatal("session should be cleared after completion")
+	}
+}
+
+func TestResumableUploadResumesAfterFailure(t *testing.T) {
+	f, srv := newFakeResumable(t)
+	path, data := writeVideo(t, 4*chunkAlign)
+	f.failChunk = 3
+	store := &memSessions{}
+	first := &ResumableUploader{Client: srv.Client(), Sessions: store, BaseURL: srv.URL, ChunkSize: chunkAlign}
+	if _, err := first.Upload(context.Background(), path, testVideo()); err == nil {
+		t.Fatal("expected first attempt to fail")
+	}
+	if store.sess == nil || store.sess.Offset != 2*chunkAlign {
+		t.Fatalf("expected committed offset %d persisted, got %+v", 2*chunkAlign, store.sess)
+	}
+
+	// A new uploader (e.g. after a restart) continues the same session from the server's offset.
+	second := &ResumableUploader{Client: srv.Client(), Sessions: store, BaseURL: srv.URL, ChunkSize: chunkAlign}
+	url, err := second.Upload(context.Background(), path, testVideo())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.initiations != 1 {
+		t.Fatalf("expected session reuse, got %d initiations", f.initiations)
+	}
+	if url != "https://www.youtube.com/watch?v=vid-s1" || !bytes.Equal(f.sessions["s1"], data) {
+		t.Fatalf("unexpected result url=%s len=%d", url, len(f.sessions["s1"]))
+	}
+}
+
+func TestResumableUploadRetriesChunkWithinCall(t *testing.T) {
+	f, srv := newFakeResumable(t)
+	path, data := writeVideo(t, 2*chunkAlign)
+	f.failChunk = 2
+	u := &ResumableUploader{Client: srv.Client(), Sessions: &memSessions{}, BaseURL: srv.URL, ChunkSize: chunkAlign, ChunkRetries: 2}
+	if _, err := u.Upload(context.Background(), path, testVideo()); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(f.sessions["s1"], data) {
+		t.Fatal("uploaded bytes differ after in-call resume")
+	}
+}
+
+func TestResumableUploadGivesUpWhenOffsetStalls(t *testing.T) {
+	f, srv := newFakeResumable(t)
+	path, _ := writeVideo(t, 2*chunkAlign)
+	f.stall = true
+	u := &ResumableUploader{Client: srv.Client(), Sessions: &memSessions{}, BaseURL: srv.URL, ChunkSize: chunkAlign, ChunkRetries: 2}
+	_, err := u.Upload(context.Background(), path, testVideo())
+	if err == nil || !strings.Contains(err.Error(), "not committed") {
+		t.Fatalf("err = %v, want a stalled-upload error", err)
+	}
+	if f.chunks != 3 {
+		t.Fatalf("chunks sent = %d, want 3 (one attempt and two retries)", f.chunks)
+	}
+}
+
+func TestResumableUploadExpiredOrMismatchedSession(t *testing.T) {
+	f, srv := newFakeResumable(t)
+	path, _ := writeVideo(t, chunkAlign)
+
+	// Unknown session URI (expired) starts a new session.
+	store := &memSessions{sess: &UploadSession{URI: srv.URL + "/session/gone", Offset: 10, Size: chunkAlign}}
+	u := &ResumableUploader{Client: srv.Client(), Sessions: store, BaseURL: srv.URL, ChunkSize: chunkAlign}
+	if _, err := u.Upload(context.Background(), path, testVideo()); err != nil {
+		t.Fatal(err)
+	}
+	if f.initiations != 1 {
+		t.Fatalf("initiations = %d want 1", f.initiations)
+	}
+
+	// A session for a different file size (file replaced) is not reused.
+	f.sessions["s1"] = nil
+	store.sess = &UploadSession{URI: srv.URL + "/session/s1", Size: chunkAlign + 1}
+	if _, err := u.Upload(context.Background(), path, testVideo()); err != nil {
+		t.Fatal(err)
+	}
+	if f.initiations != 2 {
+		t.Fatalf("initiations = %d want 2", f.initiations)
+	}
+}
+
+func TestParseRangeHeader(t *testing.T) {
+	cases := map[string]int64{"": 0, "bytes=0-0": 1, "bytes=0-524287": 524288, "garbage": 0}
+	for h, want := range cases {
+		if got := parseRangeHeader(h); got != want {
+			t.Errorf("parseRangeHeader(%q) = %d want %d", h, got, want)
+		}
+	}
+}
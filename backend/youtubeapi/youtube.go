@@ -8,7 +8,9 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"net/url"
 	"os"
 	"strings"
 	"time"
@@ -138,3 +140,31 @@ func UploadVideo(ctx context.Context, svc *yt.Service, path, title, description,
 	}
 	return "https://www.youtube.com/watch?v=" + res.Id, nil
 }
+
+// InsertCaption attaches a caption track read from body to an uploaded video.
+// The token needs the youtube.force-ssl scope in addition to youtube.upload.
+func InsertCaption(ctx context.Context, svc *yt.Service, videoID, language, name string, body io.Reader) error {
+	if svc == nil {
+		return fmt.Errorf("nil youtube service")
+	}
+	caption := &yt.Caption{Snippet: &yt.CaptionSnippet{VideoId: videoID, Language: language, Name: name}}
+	if _, err := svc.Captions.Insert([]string{"snippet"}, caption).Media(body).Context(ctx).Do(); err != nil {
+		return fmt.Errorf("youtube caption insert: %w", err)
+	}
+	return nil
+}
+
+// VideoIDFromURL extracts the video id from a watch or youtu.be URL.
+func VideoIDFromURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	if v := u.Query().Get("v"); v != "" {
+		return v
+	}
+	if strings.EqualFold(u.Host, "youtu.be") {
+		return strings.Trim(u.Path, "/")
+	}
+	return ""
+}
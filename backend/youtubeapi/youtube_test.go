@@ -199,3 +199,16 @@ func TestUploadVideo_DefaultPrivacy(t *testing.T) {
 		t.Error("expected error for nil service")
 	}
 }
+
+func TestVideoIDFromURL(t *testing.T) {
+	cases := map[string]string{
+		"https://www.youtube.com/watch?v=abc123": "abc123",
+		"https://youtu.be/xyz789":                "xyz789",
+		"https://example.com/video":              "",
+	}
+	for in, want := range cases {
+		if got := VideoIDFromURL(in); got != want {
+			t.Errorf("VideoIDFromURL(%q) = %q, want %q", in, got, want)
+		}
+	}
+}